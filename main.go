@@ -410,6 +410,10 @@ func baseDBConfig(config skyconfig.Configuration) skydb.DBConfig {
 	return skydb.DBConfig{
 		CanMigrate:             config.App.DevMode,
 		PasswordHistoryEnabled: passwordHistoryEnabled,
+		SSLMode:                config.DB.SSLMode,
+		SSLRootCert:            config.DB.SSLRootCert,
+		SSLCert:                config.DB.SSLCert,
+		SSLKey:                 config.DB.SSLKey,
 	}
 }
 
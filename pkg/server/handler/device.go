@@ -30,7 +30,10 @@ type deviceRegisterPayload struct {
 	ID          string
 	Type        string
 	Topic       string
-	DeviceToken string `mapstructure:"device_token"`
+	DeviceToken string                 `mapstructure:"device_token"`
+	AppVersion  string                 `mapstructure:"app_version"`
+	OSVersion   string                 `mapstructure:"os_version"`
+	Metadata    map[string]interface{} `mapstructure:"metadata"`
 }
 
 func (payload *deviceRegisterPayload) Decode(data map[string]interface{}) skyerr.Error {
@@ -86,7 +89,9 @@ type DeviceReigsterResult struct {
 //		"access_token": "some-access-token",
 //		"type": "ios",
 //		"topic": "io.skygear.sample.topic",
-//		"device_token": "some-device-token"
+//		"device_token": "some-device-token",
+//		"app_version": "1.2.0",
+//		"os_version": "10.3"
 //	}
 //	EOF
 //
@@ -172,6 +177,15 @@ func (h *DeviceRegisterHandler) Handle(rpayload *router.Payload, response *route
 	device.Topic = payload.Topic
 	device.AuthInfoID = rpayload.AuthInfoID
 	device.LastRegisteredAt = timeNow()
+	if payload.AppVersion != "" {
+		device.AppVersion = payload.AppVersion
+	}
+	if payload.OSVersion != "" {
+		device.OSVersion = payload.OSVersion
+	}
+	if payload.Metadata != nil {
+		device.Metadata = payload.Metadata
+	}
 
 	if err := conn.SaveDevice(&device); err != nil {
 		log.WithFields(logrus.Fields{
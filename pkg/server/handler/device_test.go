@@ -129,6 +129,29 @@ func TestDeviceRegisterHandler(t *testing.T) {
 			})
 		})
 
+		Convey("creates new device with versions and metadata", func() {
+			payload.Data = map[string]interface{}{
+				"type":         "android",
+				"device_token": "some-awesome-token",
+				"app_version":  "1.2.0",
+				"os_version":   "7.1",
+				"metadata": map[string]interface{}{
+					"model": "Pixel",
+				},
+			}
+
+			handler := &DeviceRegisterHandler{}
+			handler.Handle(&payload, &resp)
+
+			result := resp.Result.(DeviceReigsterResult)
+			device := conn.devices[result.ID]
+			So(device.AppVersion, ShouldEqual, "1.2.0")
+			So(device.OSVersion, ShouldEqual, "7.1")
+			So(device.Metadata, ShouldResemble, map[string]interface{}{
+				"model": "Pixel",
+			})
+		})
+
 		Convey("updates old device", func() {
 			olddevice := skydb.Device{
 				ID:               "deviceid",
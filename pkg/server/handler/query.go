@@ -107,6 +107,24 @@ func (parser *QueryParser) predicateOperatorFromString(operatorString string) sk
 		return skydb.Like
 	case "ilike":
 		return skydb.ILike
+	case "contains":
+		return skydb.Contains
+	case "icontains":
+		return skydb.IContains
+	case "hasPath":
+		return skydb.JSONHasPath
+	case "between":
+		return skydb.Between
+	case "regex":
+		return skydb.Regex
+	case "iregex":
+		return skydb.IRegex
+	case "containsAll":
+		return skydb.ContainsAll
+	case "isNull":
+		return skydb.NoValue
+	case "isNotNull":
+		return skydb.HasValue
 	case "in":
 		return skydb.In
 	case "func":
@@ -203,6 +221,20 @@ func (parser *QueryParser) parseFunc(s []interface{}) (f skydb.Func, err error)
 		f, err = parser.parseDistanceFunc(s[2:])
 	case "userRelation":
 		f, err = parser.parseUserRelationFunc(s[2:])
+	case "isPublicReadable":
+		f, err = parser.parseIsPublicReadableFunc(s[2:])
+	case "aclContainsRole":
+		f, err = parser.parseACLContainsRoleFunc(s[2:])
+	case "length":
+		f, err = parser.parseLengthFunc(s[2:])
+	case "lower":
+		f, err = parser.parseLowerFunc(s[2:])
+	case "upper":
+		f, err = parser.parseUpperFunc(s[2:])
+	case "date_trunc":
+		f, err = parser.parseDateTruncFunc(s[2:])
+	case "geohash":
+		f, err = parser.parseGeohashFunc(s[2:])
 	case "":
 		return nil, errors.New("empty function name")
 	default:
@@ -234,6 +266,111 @@ func (parser *QueryParser) parseDistanceFunc(s []interface{}) (skydb.DistanceFun
 	}, nil
 }
 
+func (parser *QueryParser) parseLengthFunc(s []interface{}) (skydb.LengthFunc, error) {
+	field, err := parser.parseSingleKeyPathArgument("length", s)
+	if err != nil {
+		return skydb.LengthFunc{}, err
+	}
+	return skydb.LengthFunc{Field: field}, nil
+}
+
+func (parser *QueryParser) parseLowerFunc(s []interface{}) (skydb.LowerFunc, error) {
+	field, err := parser.parseSingleKeyPathArgument("lower", s)
+	if err != nil {
+		return skydb.LowerFunc{}, err
+	}
+	return skydb.LowerFunc{Field: field}, nil
+}
+
+func (parser *QueryParser) parseUpperFunc(s []interface{}) (skydb.UpperFunc, error) {
+	field, err := parser.parseSingleKeyPathArgument("upper", s)
+	if err != nil {
+		return skydb.UpperFunc{}, err
+	}
+	return skydb.UpperFunc{Field: field}, nil
+}
+
+func (parser *QueryParser) parseDateTruncFunc(s []interface{}) (skydb.DateTruncFunc, error) {
+	emptyDateTruncFunc := skydb.DateTruncFunc{}
+	if len(s) != 2 {
+		return emptyDateTruncFunc, fmt.Errorf("want 2 arguments for date_trunc func, got %d", len(s))
+	}
+
+	var field string
+	if err := skyconv.MapFrom(s[0], (*skyconv.MapKeyPath)(&field)); err != nil {
+		return emptyDateTruncFunc, fmt.Errorf("invalid key path: %v", err)
+	}
+
+	unit, ok := s[1].(string)
+	if !ok {
+		return emptyDateTruncFunc, fmt.Errorf("invalid unit: %v", s[1])
+	}
+
+	return skydb.DateTruncFunc{
+		Field: field,
+		Unit:  unit,
+	}, nil
+}
+
+func (parser *QueryParser) parseGeohashFunc(s []interface{}) (skydb.GeohashFunc, error) {
+	emptyGeohashFunc := skydb.GeohashFunc{}
+	if len(s) != 2 {
+		return emptyGeohashFunc, fmt.Errorf("want 2 arguments for geohash func, got %d", len(s))
+	}
+
+	var field string
+	if err := skyconv.MapFrom(s[0], (*skyconv.MapKeyPath)(&field)); err != nil {
+		return emptyGeohashFunc, fmt.Errorf("invalid key path: %v", err)
+	}
+
+	precision, ok := s[1].(float64)
+	if !ok || precision != float64(int(precision)) {
+		return emptyGeohashFunc, fmt.Errorf("invalid precision: %v", s[1])
+	}
+
+	return skydb.GeohashFunc{
+		Field:     field,
+		Precision: int(precision),
+	}, nil
+}
+
+// parseSingleKeyPathArgument parses the arguments of a function that
+// takes exactly one key path.
+func (parser *QueryParser) parseSingleKeyPathArgument(funcName string, s []interface{}) (string, error) {
+	if len(s) != 1 {
+		return "", fmt.Errorf("want 1 argument for %s func, got %d", funcName, len(s))
+	}
+
+	var field string
+	if err := skyconv.MapFrom(s[0], (*skyconv.MapKeyPath)(&field)); err != nil {
+		return "", fmt.Errorf("invalid key path: %v", err)
+	}
+	return field, nil
+}
+
+func (parser *QueryParser) parseIsPublicReadableFunc(s []interface{}) (skydb.IsPublicReadableFunc, error) {
+	if len(s) != 0 {
+		return skydb.IsPublicReadableFunc{}, fmt.Errorf("want 0 arguments for is public readable func, got %d", len(s))
+	}
+	return skydb.IsPublicReadableFunc{}, nil
+}
+
+func (parser *QueryParser) parseACLContainsRoleFunc(s []interface{}) (skydb.ACLContainsRoleFunc, error) {
+	emptyACLContainsRoleFunc := skydb.ACLContainsRoleFunc{}
+	if len(s) != 1 {
+		return emptyACLContainsRoleFunc, fmt.Errorf("want 1 argument for acl contains role func, got %d", len(s))
+	}
+
+	role, ok := s[0].(string)
+	if !ok {
+		return emptyACLContainsRoleFunc, fmt.Errorf("invalid role: %v", s[0])
+	}
+
+	return skydb.ACLContainsRoleFunc{
+		Role: role,
+	}, nil
+}
+
 func (parser *QueryParser) parseUserRelationFunc(s []interface{}) (skydb.UserRelationFunc, error) {
 	emptyUserRelationFunc := skydb.UserRelationFunc{}
 	if len(s) != 2 {
@@ -323,6 +460,15 @@ func (parser *QueryParser) queryFromRaw(rawQuery map[string]interface{}, query *
 		query.Offset = uint64(offset)
 	}
 
+	mustDoSlice(rawQuery, "after", func(rawAfter []interface{}) skyerr.Error {
+		after, err := parser.positionFromRaw(recordType, rawAfter)
+		if err != nil {
+			return err
+		}
+		query.After = after
+		return nil
+	})
+
 	if limit, ok := rawQuery["limit"].(float64); ok {
 		query.Limit = new(uint64)
 		*query.Limit = uint64(limit)
@@ -330,6 +476,30 @@ func (parser *QueryParser) queryFromRaw(rawQuery map[string]interface{}, query *
 	return nil
 }
 
+// positionFromRaw parses the position of a record in the order of a
+// query, which is a tuple of the sort value and the ID of the record,
+// such as the last record of the previous page.
+func (parser *QueryParser) positionFromRaw(recordType string, rawAfter []interface{}) (*skydb.QueryPosition, skyerr.Error) {
+	if len(rawAfter) != 2 {
+		return nil, skyerr.NewInvalidArgument(
+			"after should be a tuple of the sort value and the record id",
+			[]string{"after"})
+	}
+
+	rawID, _ := rawAfter[1].(string)
+	id, err := skydb.ParseRecordID(rawID)
+	if err != nil || id.Type != recordType {
+		return nil, skyerr.NewInvalidArgument(
+			`after should contain the id of a record of the queried type, such as "note/1"`,
+			[]string{"after"})
+	}
+
+	return &skydb.QueryPosition{
+		SortValue: skyconv.ParseLiteral(rawAfter[0]),
+		ID:        id.Key,
+	}, nil
+}
+
 // execute do when if the value of key in m is []interface{}. If value exists
 // for key but its type is not []interface{} or do returns an error, it panics.
 func mustDoSlice(m map[string]interface{}, key string, do func(value []interface{}) skyerr.Error) {
@@ -559,6 +729,11 @@ func (c *ExpressionACLChecker) checkKeyPath(keyPath string, accessMode skydb.Fie
 			if len(fields) <= i {
 				panic("number of components in keypath does not match that in database schema")
 			}
+			if fields[i].Type == skydb.TypeJSON {
+				// the remaining components are a path within the JSON
+				// field, which is not subject to Field ACL
+				break
+			}
 			recordType = fields[i].ReferenceType
 		}
 	}
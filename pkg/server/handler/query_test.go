@@ -16,8 +16,10 @@ package handler
 
 import (
 	"testing"
+	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -56,6 +58,22 @@ func TestQueryFromRaw(t *testing.T) {
 			})
 		})
 
+		Convey("should parse null predicate", func() {
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"predicate": []interface{}{
+					"isNull",
+					map[string]interface{}{"$type": "keypath", "$val": "content"},
+				},
+			}, &query)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, skydb.Query{
+				Type:      "note",
+				Predicate: skydb.IsNull("content"),
+			})
+		})
+
 		Convey("functional predicate with user relation", func() {
 			query := skydb.Query{}
 			err := parser.queryFromRaw(map[string]interface{}{
@@ -107,6 +125,38 @@ func TestQueryFromRaw(t *testing.T) {
 				},
 			})
 		})
+
+		Convey("should parse after", func() {
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"sort": []interface{}{
+					[]interface{}{
+						map[string]interface{}{"$type": "keypath", "$val": "_created_at"},
+						"desc",
+					},
+				},
+				"after": []interface{}{
+					map[string]interface{}{"$type": "date", "$date": "2017-01-01T00:00:00Z"},
+					"note/note1",
+				},
+			}, &query)
+			So(err, ShouldBeNil)
+			So(query.After, ShouldResemble, &skydb.QueryPosition{
+				SortValue: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+				ID:        "note1",
+			})
+		})
+
+		Convey("should reject after with id of another record type", func() {
+			query := skydb.Query{}
+			err := parser.queryFromRaw(map[string]interface{}{
+				"record_type": "note",
+				"after":       []interface{}{"photo1", "photo/photo1"},
+			}, &query)
+			So(err, ShouldNotBeNil)
+			So(err.Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
 	})
 
 }
@@ -2850,6 +2850,14 @@ func (db *selectiveDatabase) Rollback() error {
 	return db.Database.(skydb.TxDatabase).Rollback()
 }
 
+func (db *selectiveDatabase) Savepoint(name string) error {
+	return db.Database.(skydb.TxDatabase).Savepoint(name)
+}
+
+func (db *selectiveDatabase) RollbackTo(name string) error {
+	return db.Database.(skydb.TxDatabase).RollbackTo(name)
+}
+
 func TestAtomicOperation(t *testing.T) {
 	realTime := timeNow
 	timeNow = func() time.Time { return ZeroTime }
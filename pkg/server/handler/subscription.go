@@ -35,12 +35,14 @@ func (s jsonSubscription) MarshalJSON() ([]byte, error) {
 		DeviceID         string                  `json:"device_id"`
 		NotificationInfo *skydb.NotificationInfo `json:"notification_info,omitempty"`
 		Query            jsonQuery               `json:"query"`
+		WatchFields      []string                `json:"watch_fields,omitempty"`
 	}{
 		s.ID,
 		s.Type,
 		s.DeviceID,
 		s.NotificationInfo,
 		jsonQuery(s.Query),
+		s.WatchFields,
 	})
 }
 
@@ -160,6 +162,24 @@ func opString(op skydb.Operator) string {
 		return "like"
 	case skydb.ILike:
 		return "ilike"
+	case skydb.Contains:
+		return "contains"
+	case skydb.IContains:
+		return "icontains"
+	case skydb.JSONHasPath:
+		return "hasPath"
+	case skydb.Between:
+		return "between"
+	case skydb.Regex:
+		return "regex"
+	case skydb.IRegex:
+		return "iregex"
+	case skydb.ContainsAll:
+		return "containsAll"
+	case skydb.NoValue:
+		return "isNull"
+	case skydb.HasValue:
+		return "isNotNull"
 	case skydb.In:
 		return "in"
 	default:
@@ -176,6 +196,31 @@ func funcSlice(i interface{}) []interface{} {
 			skyconv.ToMap(skyconv.MapKeyPath(f.Field)),
 			skyconv.ToMap(skyconv.MapLocation(f.Location)),
 		}
+	case skydb.LengthFunc:
+		return []interface{}{
+			"func",
+			"length",
+			skyconv.ToMap(skyconv.MapKeyPath(f.Field)),
+		}
+	case skydb.LowerFunc:
+		return []interface{}{
+			"func",
+			"lower",
+			skyconv.ToMap(skyconv.MapKeyPath(f.Field)),
+		}
+	case skydb.UpperFunc:
+		return []interface{}{
+			"func",
+			"upper",
+			skyconv.ToMap(skyconv.MapKeyPath(f.Field)),
+		}
+	case skydb.DateTruncFunc:
+		return []interface{}{
+			"func",
+			"date_trunc",
+			skyconv.ToMap(skyconv.MapKeyPath(f.Field)),
+			f.Unit,
+		}
 	default:
 		panic(fmt.Errorf("got unrecgonized skydb.Func = %T", i))
 	}
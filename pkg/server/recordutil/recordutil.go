@@ -645,6 +645,9 @@ func QueryResultInfo(db skydb.Database, query *skydb.Query, accessControlOptions
 		}
 		resultInfo["count"] = recordCount
 	}
+	if results != nil && results.Truncated {
+		resultInfo["truncated"] = true
+	}
 	return resultInfo, nil
 }
 
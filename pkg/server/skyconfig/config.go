@@ -136,8 +136,12 @@ type Configuration struct {
 		ResponseTimeout int64      `json:"response_timeout"`
 	} `json:"app"`
 	DB struct {
-		ImplName string `json:"implementation"`
-		Option   string `json:"option"`
+		ImplName    string `json:"implementation"`
+		Option      string `json:"option"`
+		SSLMode     string `json:"sslmode"`
+		SSLRootCert string `json:"sslrootcert"`
+		SSLCert     string `json:"sslcert"`
+		SSLKey      string `json:"sslkey"`
 	} `json:"database"`
 	TokenStore struct {
 		ImplName string `json:"implementation"`
@@ -368,6 +372,22 @@ func (config *Configuration) ReadFromEnv() {
 		config.DB.Option = os.Getenv("DATABASE_URL")
 	}
 
+	if sslMode := os.Getenv("DATABASE_SSLMODE"); sslMode != "" {
+		config.DB.SSLMode = sslMode
+	}
+
+	if sslRootCert := os.Getenv("DATABASE_SSLROOTCERT"); sslRootCert != "" {
+		config.DB.SSLRootCert = sslRootCert
+	}
+
+	if sslCert := os.Getenv("DATABASE_SSLCERT"); sslCert != "" {
+		config.DB.SSLCert = sslCert
+	}
+
+	if sslKey := os.Getenv("DATABASE_SSLKEY"); sslKey != "" {
+		config.DB.SSLKey = sslKey
+	}
+
 	if slave, err := parseBool(os.Getenv("SLAVE")); err == nil {
 		config.App.Slave = slave
 	}
@@ -18,6 +18,7 @@ package skydb
 
 import (
 	"errors"
+	"fmt"
 	"time"
 )
 
@@ -37,6 +38,17 @@ var ErrRoleUpdatesFailed = errors.New("skydb: Update of user roles failed")
 // cannot be found in the current container
 var ErrDeviceNotFound = errors.New("skydb: Specific device not found")
 
+// UserMergeConflictError is returned by Conn.MergeUsers if a record of
+// the source user cannot be moved to the target user, because the
+// target user has a record of the same ID in the same database.
+type UserMergeConflictError struct {
+	RecordID RecordID
+}
+
+func (e *UserMergeConflictError) Error() string {
+	return fmt.Sprintf("skydb: record %s of the source user conflicts with a record of the target user", e.RecordID)
+}
+
 // ErrDatabaseIsReadOnly is returned by skydb.Database if the requested
 // operation modifies the database and the database is readonly.
 var ErrDatabaseIsReadOnly = errors.New("skydb: database is read only")
@@ -63,8 +75,19 @@ type Conn interface {
 
 	// CreateAuth creates a new AuthInfo in the container
 	// this Conn associated to.
+	//
+	// CreateAuth returns ErrUserDuplicated if an AuthInfo with the same
+	// ID exists, even if it is created concurrently through another Conn.
 	CreateAuth(authinfo *AuthInfo) error
 
+	// CreateOrGetAuth creates the supplied AuthInfo unless an AuthInfo
+	// with the same ID, or with any of its principal IDs, already exists.
+	// In that case the supplied AuthInfo is filled in with the existing
+	// one instead. The lookup and the creation happen in one atomic step.
+	//
+	// CreateOrGetAuth returns true if the AuthInfo is created.
+	CreateOrGetAuth(authinfo *AuthInfo) (bool, error)
+
 	// GetAuth fetches the AuthInfo with supplied ID in the container and
 	// fills in the supplied AuthInfo with the result.
 	//
@@ -94,6 +117,15 @@ type Conn interface {
 	// exist in the container.
 	DeleteAuth(id string) error
 
+	// MergeUsers moves records, relations, devices and principals of the
+	// user identified by sourceID to the user identified by targetID, and
+	// then deletes the source user, all in one transaction.
+	//
+	// MergeUsers returns ErrUserNotFound if either user does not exist,
+	// and *UserMergeConflictError if a record of the source user has the
+	// same ID as a record of the target user in the same database.
+	MergeUsers(sourceID, targetID string) error
+
 	// GetPasswordHistory returns a slice of PasswordHistory of the given user
 	//
 	// If historySize is greater than 0, the returned slice contains history
@@ -160,18 +192,41 @@ type Conn interface {
 	// be referenced by records.
 	SaveAsset(asset *Asset) error
 
+	// DeleteOrphanedAssets deletes the information of Assets not
+	// associated with any record, returning the number of Assets deleted.
+	// The files of the Assets in the asset store are not deleted.
+	//
+	// An Asset is saved before the record associated with it, so Assets
+	// being uploaded are also deleted if they are not yet associated.
+	DeleteOrphanedAssets() (int, error)
+
 	QueryRelation(user string, name string, direction string, config QueryConfig) []AuthInfo
 	QueryRelationCount(user string, name string, direction string) (uint64, error)
 	AddRelation(user string, name string, targetUser string) error
 	RemoveRelation(user string, name string, targetUser string) error
 
+	// RemoveRelations removes the relations of the user to each of the
+	// target users, returning the number of relations removed. Target
+	// users not related to the user are ignored.
+	RemoveRelations(user string, name string, targetUsers []string) (int, error)
+
 	GetDevice(id string, device *Device) error
 
 	// QueryDevicesByUser queries the Device database which are registered
 	// by the specified user.
 	QueryDevicesByUser(user string) ([]Device, error)
 	QueryDevicesByUserAndTopic(user, topic string) ([]Device, error)
+
+	// QueryDevicesByAppVersion queries the devices running the specified
+	// version of the app.
+	QueryDevicesByAppVersion(appVersion string) ([]Device, error)
 	SaveDevice(device *Device) error
+
+	// RegisterDevice saves the device as registered now. If the device
+	// has a token, it replaces the device of the same type and token,
+	// and the ID of the replaced device is assigned to it. Otherwise the
+	// device is saved by its ID, which is generated if empty.
+	RegisterDevice(device *Device) error
 	DeleteDevice(id string) error
 
 	// DeleteDevicesByToken deletes device where its Token == token and
@@ -180,12 +235,23 @@ type Conn interface {
 	// If such device does not exist, ErrDeviceNotFound is returned.
 	DeleteDevicesByToken(token string, t time.Time) error
 
+	// QueryEmptyDevicesByTime returns the devices that
+	// DeleteEmptyDevicesByTime would delete with the same t, so that they
+	// can be reviewed before deletion.
+	QueryEmptyDevicesByTime(t time.Time) ([]Device, error)
+
 	// DeleteEmptyDevicesByTime deletes device where Token is empty and
 	// LastRegisteredAt < t. If t == ZeroTime, LastRegisteredAt is not considered.
 	//
 	// If such device does not exist, ErrDeviceNotFound is returned.
 	DeleteEmptyDevicesByTime(t time.Time) error
 
+	// DeleteDevicesByUser deletes all devices registered by the
+	// specified user, returning the number of devices deleted. Unlike
+	// other methods deleting devices, it is not an error if the user
+	// has no devices.
+	DeleteDevicesByUser(user string) (int, error)
+
 	PublicDB() Database
 	PrivateDB(userKey string) Database
 	UnionDB() Database
@@ -240,6 +306,33 @@ type Conn interface {
 	// such OAuthInfo does not exist in the container.
 	DeleteOAuth(provider string, principalID string) error
 
+	// FetchOutbox returns at most limit events in the outbox that are
+	// not yet marked delivered, in the order they are written.
+	//
+	// Events are written to the outbox only if DBConfig.OutboxEnabled is
+	// set, in the same transaction as the change of the Record, such that
+	// an event is not lost if it cannot be published at the moment.
+	FetchOutbox(limit int) ([]OutboxEvent, error)
+
+	// MarkOutboxDelivered marks the events in the outbox delivered, such
+	// that they are no longer returned by FetchOutbox.
+	MarkOutboxDelivered(ids []int64) error
+
+	// NextSequenceValue returns the next value of the named sequence in
+	// the container, creating the sequence on first use. Values of a
+	// sequence are strictly increasing across all Conns, but may have
+	// gaps, and are not rolled back with a transaction.
+	NextSequenceValue(name string) (int64, error)
+
+	// RunInTransaction calls fn within a transaction, which is committed
+	// if fn returns nil and rolled back otherwise.
+	//
+	// If the transaction is aborted because of a serialization failure
+	// or a deadlock, fn is called again in a new transaction after a
+	// short delay, up to a limited number of attempts. fn should
+	// therefore be safe to retry.
+	RunInTransaction(fn func(tx Conn) error) error
+
 	Close() error
 
 	CustomTokenConn
@@ -279,8 +372,18 @@ const (
 //
 // For RecordCreated or RecordUpdated event, Record is the newly
 // created / updated Record. For RecordDeleted, Record is the Record
-// being deleted.
+// being deleted. For RecordUpdated event, Original is the Record
+// before the update if it is known.
 type RecordEvent struct {
-	Record *Record
-	Event  RecordHookEvent
+	Record   *Record
+	Original *Record
+	Event    RecordHookEvent
+}
+
+// OutboxEvent is a RecordEvent written to the outbox. See
+// Conn.FetchOutbox.
+type OutboxEvent struct {
+	ID int64
+	RecordEvent
+	CreatedAt time.Time
 }
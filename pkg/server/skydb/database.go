@@ -18,13 +18,19 @@ package skydb
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"time"
 )
 
 // ErrRecordNotFound is returned from Get and Delete when Database
 // cannot find the Record by the specified key
 var ErrRecordNotFound = errors.New("skydb: Record not found for the specified key")
 
+// ErrRecordStale is returned from SaveIfUnmodified when the Record has
+// been modified since it was read
+var ErrRecordStale = errors.New("skydb: Record has been modified since it was read")
+
 // EmptyRows is a convenient variable that acts as an empty Rows.
 // Useful for skydb implementators and testing.
 var EmptyRows = NewRows(emptyRowsIter(0))
@@ -43,6 +49,22 @@ func (rs emptyRowsIter) OverallRecordCount() *uint64 {
 	return nil
 }
 
+// RowScanError is returned from Rows.Err when a row of the result set
+// cannot be scanned into a Record, for example when a stored value does
+// not match the type of its column.
+//
+// Unlike other errors, a RowScanError does not close the Rows. Callers
+// may log it and call Rows.Scan again to continue with the next row.
+type RowScanError struct {
+	RecordID RecordID
+	Column   string
+	Err      error
+}
+
+func (e *RowScanError) Error() string {
+	return fmt.Sprintf("skydb: failed to scan column %q of record %s: %v", e.Column, e.RecordID, e.Err)
+}
+
 var ErrDatabaseTxDidBegin = errors.New("skydb: a transaction has already begun")
 var ErrDatabaseTxDidNotBegin = errors.New("skydb: a transaction has not begun")
 var ErrDatabaseTxDone = errors.New("skydb: Database's transaction has already committed or rolled back")
@@ -68,6 +90,16 @@ const (
 	UnionDatabase
 )
 
+// ExtendOptions are options of a record type set when the record type
+// is extended by Database.ExtendWithOptions.
+type ExtendOptions struct {
+	// PreserveUpdatedAt makes Database.Save keep the _updated_at and
+	// _updated_by of a record saved again, so that they record when the
+	// record was first saved. This suits record types whose records are
+	// only appended, such as audit logs.
+	PreserveUpdatedAt bool
+}
+
 // Database represents a collection of record (either public or private)
 // in a container.
 //
@@ -108,13 +140,86 @@ type Database interface {
 	Get(id RecordID, record *Record) error
 	GetByIDs(ids []RecordID, accessControlOptions *AccessControlOptions) (*Rows, error)
 
+	// GetRawField returns the JSON of the field of the Record identified
+	// by the supplied key as stored in the Database, without decoding
+	// it. The field must be a JSON field. Nil is returned if the field
+	// has no value.
+	//
+	// GetRawField returns an ErrRecordNotFound if Record identified by
+	// the supplied key does not exist in the Database.
+	GetRawField(id RecordID, field string) ([]byte, error)
+
+	// GetAsOf returns the version of the Record identified by the
+	// supplied key which was live at the supplied time. Versions are
+	// only kept if DBConfig.RecordHistoryEnabled is set when they are
+	// saved.
+	//
+	// GetAsOf returns an ErrRecordNotFound if the Record did not exist
+	// or was deleted at that time. Like Get, access control is not
+	// applied.
+	GetAsOf(id RecordID, at time.Time) (Record, error)
+
+	// GetHistory returns the versions of the Record identified by the
+	// supplied key in the order they are saved, including the versions
+	// in which the Record is deleted. See GetAsOf on how versions are kept.
+	//
+	// GetHistory returns an ErrRecordNotFound if there is no version
+	// of the Record.
+	GetHistory(id RecordID) ([]RecordVersion, error)
+
+	// OutgoingReferences returns the references held by the Record
+	// identified by the supplied key, keyed by the name of the
+	// reference field. Reference fields without value are omitted.
+	//
+	// OutgoingReferences returns an ErrRecordNotFound if Record
+	// identified by the supplied key does not exist in the Database.
+	OutgoingReferences(id RecordID) (map[string]Reference, error)
+
 	// Save updates the supplied Record in the Database if Record with
 	// the same key exists, else such Record is created.
 	//
-	// Save returns an error if the underlying implementation failed to
-	// create / modify the Record.
+	// A Record created without ACL is given the default access of its
+	// record type, if any. See Conn.SetRecordDefaultAccess.
+	//
+	// Save returns an ErrAssetNotFound if the Record is associated with
+	// an Asset that does not exist, and an ErrRecordTooLarge if the Record
+	// exceeds DBConfig.MaxRecordSize. It returns an error if the underlying
+	// implementation failed to create / modify the Record.
 	Save(record *Record) error
 
+	// SaveNew saves the supplied Record like Save does. If the key of
+	// the Record ID is empty, a new key is generated and assigned to
+	// the Record before it is saved.
+	SaveNew(record *Record) error
+
+	// SaveIfUnmodified saves the supplied Record like Save does, only if
+	// the stored Record was last updated at updatedAt. A zero updatedAt
+	// means the Record is expected to be new.
+	//
+	// SaveIfUnmodified returns an ErrRecordStale if the stored Record
+	// has been updated at another time, or created since it was expected
+	// to be new. It returns an ErrRecordNotFound if the stored Record
+	// does not exist while a non-zero updatedAt is supplied.
+	SaveIfUnmodified(record *Record, updatedAt time.Time) error
+
+	// Clone saves a new Record of key newKey and owned by newOwner, with
+	// the data of the Record identified by sourceID. Metadata such as
+	// ACL is not copied, and the timestamps of the new Record are set to
+	// now. A new key is generated if newKey is empty.
+	//
+	// Clone returns an ErrRecordNotFound if the source Record does not
+	// exist, or an ErrRecordStale if a Record of newKey already exists.
+	Clone(sourceID RecordID, newKey string, newOwner string) (Record, error)
+
+	// Patch updates only the supplied fields of the Record identified
+	// by id, leaving its other fields untouched, and sets the time it is
+	// last updated to now and its updater to updaterID. A field supplied
+	// with Null is set to null.
+	//
+	// Patch returns an ErrRecordNotFound if the Record identified by
+	// the supplied key does not exist in the Database.
+	Patch(id RecordID, updaterID string, fields map[string]interface{}) error
+
 	// Delete removes the Record identified by the key in the Database.
 	//
 	// Delete returns an ErrRecordNotFound if the Record identified by
@@ -123,6 +228,36 @@ type Database interface {
 	// failed to remove the Record.
 	Delete(id RecordID) error
 
+	// AddLabel attaches a label to the Record identified by id. Labels
+	// are free-form strings shared by all record types; attaching a label
+	// the Record already has is a no-op.
+	//
+	// AddLabel returns an ErrRecordNotFound if the Record does not exist
+	// in the Database.
+	AddLabel(id RecordID, label string) error
+
+	// RemoveLabel detaches a label from the Record identified by id.
+	RemoveLabel(id RecordID, label string) error
+
+	// QueryByLabel executes the supplied query against the records of
+	// every record type attached with the label and returns the results
+	// merged as QueryUnion does. The type and label of the query are
+	// ignored. Access control is applied as in Query.
+	QueryByLabel(label string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error)
+
+	// AcquireLock takes an advisory lock on the Record identified by id
+	// on behalf of owner, which expires after ttl. Acquiring a lock
+	// already held by the same owner extends it.
+	//
+	// AcquireLock returns false if the lock is held by another owner and
+	// has not expired. The lock does not prevent the Record from being
+	// modified; it is up to callers to acquire it before editing.
+	AcquireLock(id RecordID, owner string, ttl time.Duration) (bool, error)
+
+	// ReleaseLock releases the lock on the Record identified by id if it
+	// is held by owner.
+	ReleaseLock(id RecordID, owner string) error
+
 	// Query executes the supplied query against the Database and returns
 	// an Rows to iterate the results.
 	Query(query *Query, accessControlOptions *AccessControlOptions) (*Rows, error)
@@ -131,6 +266,62 @@ type Database interface {
 	// the number of records matching the query's predicate.
 	QueryCount(query *Query, accessControlOptions *AccessControlOptions) (uint64, error)
 
+	// QueryIDs executes the supplied query against the Database and returns
+	// the IDs of the matching records, in the order of the query's sorts.
+	// Only the IDs are read, so it is cheaper than Query for checking
+	// which records match. Access control and the default query limit
+	// are applied as in Query.
+	QueryIDs(query *Query, accessControlOptions *AccessControlOptions) ([]RecordID, error)
+
+	// QueryUnion executes each of the supplied queries against the Database
+	// and returns an Rows to iterate the results of all queries, merged
+	// in the order specified by their sorts. Limit and offset apply to
+	// each query separately. Strings are ordered as bytes rather than
+	// by the collation of the database.
+	//
+	// QueryUnion returns an error if the queries do not have the same
+	// sorts. See ValidateUnionQueries.
+	QueryUnion(queries []*Query, accessControlOptions *AccessControlOptions) (*Rows, error)
+
+	// QueryTypes executes the supplied query against every record type
+	// whose name starts with pattern, such as "log_", and returns the
+	// results merged as QueryUnion does. The type of the query is
+	// ignored. Access control is applied as in Query.
+	QueryTypes(pattern string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error)
+
+	// QueryByUpdater returns an Rows to iterate the records of the record
+	// type last modified by the specified user, most recently updated
+	// first. Access control is applied as in Query.
+	QueryByUpdater(recordType string, updaterID string, accessControlOptions *AccessControlOptions) (*Rows, error)
+
+	// QueryByRelation executes the supplied query against records of the
+	// record type owned by users related to the specified user, such as
+	// the users the user follows. The relation name and direction are
+	// those of UserRelationFunc. Access control is applied as in Query.
+	QueryByRelation(recordType string, relationName string, direction string, userID string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error)
+
+	// QueryAfterCursor returns an Rows to iterate at most limit records
+	// of the record type updated after the cursor, ordered by updated at
+	// and then by ID. The cursor is the updated at and ID of the last
+	// record previously returned, so records updated at the same time
+	// are neither skipped nor repeated. A zero cursor starts from the
+	// first record. Access control is applied as in Query.
+	QueryAfterCursor(recordType string, updatedAt time.Time, id string, limit int, accessControlOptions *AccessControlOptions) (*Rows, error)
+
+	// OpenCursor returns a Cursor to iterate the records matched by the
+	// supplied query in batches, in the order of record ID. If token is
+	// not empty, the Cursor continues after the position identified by
+	// a token previously returned by Cursor.Next, which may be from
+	// another process. Sorts, limit, offset and after of the query are
+	// not supported. Access control is applied to every batch as in Query.
+	OpenCursor(query *Query, token string, accessControlOptions *AccessControlOptions) (Cursor, error)
+
+	// CountByReference returns the number of records of the record type
+	// referencing each record through the reference field, keyed by the
+	// key of the referenced record. Records without a value in the field
+	// are not counted. Like Get, access control is not applied.
+	CountByReference(recordType string, refField string) (map[string]int64, error)
+
 	// Extend extends the Database record schema such that a record
 	// arrived subsequently with that schema can be saved
 	//
@@ -139,6 +330,21 @@ type Database interface {
 	// existing schema in the Database
 	Extend(recordType string, schema RecordSchema) (extended bool, err error)
 
+	// ExtendWithOptions extends the Database record schema like Extend
+	// does, and sets the options of the record type. Options set
+	// previously are replaced.
+	ExtendWithOptions(recordType string, schema RecordSchema, options ExtendOptions) (extended bool, err error)
+
+	// ExtendMany extends the Database record schemas of multiple record
+	// types in a single transaction. Record types are created before
+	// reference fields are added, so a record type can reference another
+	// record type extended in the same call.
+	//
+	// ExtendMany returns an error if any of the specified schemas
+	// conflicts with existing schema in the Database, in which case no
+	// schema is extended.
+	ExtendMany(schemas map[string]RecordSchema) error
+
 	// RenameSchema renames a column of the Database record schema
 	RenameSchema(recordType, oldColumnName, newColumnName string) error
 
@@ -151,12 +357,52 @@ type Database interface {
 	// FetchRecordTypes returns a list of all existing record type
 	GetRecordSchemas() (map[string]RecordSchema, error)
 
+	// CheckSchema compares the schemas of the record types in the
+	// Database against the expected ones without changing them, and
+	// returns the differences. See DiffSchemas.
+	CheckSchema(expected map[string]RecordSchema) ([]SchemaDiff, error)
+
+	// TypeStats returns the number of records of each existing record
+	// type, counting records of all databases. The numbers are estimates
+	// unless the Conn is configured to count exactly.
+	TypeStats() (map[string]int64, error)
+
+	// AnalyzeType refreshes the statistics the database keeps on the
+	// records of a record type for planning queries.
+	AnalyzeType(recordType string) error
+
+	// VacuumType reclaims the storage occupied by deleted or updated
+	// records of a record type. VacuumType cannot be called
+	// in a transaction.
+	VacuumType(recordType string) error
+
 	GetSubscription(key string, deviceID string, subscription *Subscription) error
 	SaveSubscription(subscription *Subscription) error
+
+	// UpdateSubscription replaces the query of an existing subscription,
+	// identified by its ID and device ID. ErrSubscriptionNotFound is
+	// returned if no such subscription exists.
+	UpdateSubscription(subscription *Subscription) error
+
 	DeleteSubscription(key string, deviceID string) error
 	GetSubscriptionsByDeviceID(deviceID string) []Subscription
+
+	// GetSubscriptionsByDevice is like GetSubscriptionsByDeviceID, but
+	// returns the error encountered instead of logging it.
+	GetSubscriptionsByDevice(deviceID string) ([]Subscription, error)
+
 	GetMatchingSubscriptions(record *Record) []Subscription
 
+	// GetMatchingSubscriptionsBatch returns the subscriptions matching
+	// each of the records in one query. The i-th element of the result
+	// holds the subscriptions matching records[i].
+	GetMatchingSubscriptionsBatch(records []*Record) [][]Subscription
+
+	// SubscriptionMatchesRecord returns whether the record would match
+	// the subscription of the ID, on any of the devices having it.
+	// ErrSubscriptionNotFound is returned if no such subscription exists.
+	SubscriptionMatchesRecord(subscriptionID string, record *Record) (bool, error)
+
 	GetIndexesByRecordType(recordType string) (indexes map[string]Index, err error)
 	SaveIndex(recordType, indexName string, index Index) error
 	DeleteIndex(recordType string, indexName string) error
@@ -178,6 +424,21 @@ type Transactional interface {
 
 	// Rollbacks discards all the changes made to storage after Begin.
 	Rollback() error
+
+	// Savepoint establishes a savepoint with the specified name in the
+	// current transaction.
+	//
+	// Calling Savepoint on a non-Begin'ed storage returns
+	// ErrDatabaseTxDidNotBegin.
+	Savepoint(name string) error
+
+	// RollbackTo discards all the changes made to storage after the
+	// savepoint with the specified name was established, leaving the
+	// rest of the transaction intact.
+	//
+	// Calling RollbackTo on a non-Begin'ed storage returns
+	// ErrDatabaseTxDidNotBegin.
+	RollbackTo(name string) error
 }
 
 func WithTransaction(tx Transactional, do func() error) (err error) {
@@ -215,6 +476,11 @@ type Rows struct {
 	record      Record
 	nexted      bool
 	recordCount *uint64
+
+	// Truncated is true if the query did not specify a limit and more
+	// records than DBConfig.DefaultQueryLimit matched the query. Only
+	// the first DefaultQueryLimit records are returned.
+	Truncated bool
 }
 
 // NewRows creates a new Rows.
@@ -248,7 +514,9 @@ func (r *Rows) Scan() bool {
 	r.record = Record{}
 	r.lasterr = r.iter.Next(&r.record)
 	if r.lasterr != nil {
-		r.Close()
+		if _, ok := r.lasterr.(*RowScanError); !ok {
+			r.Close()
+		}
 		return false
 	}
 
@@ -272,6 +540,9 @@ func (r *Rows) OverallRecordCount() *uint64 {
 
 // Err returns the last error encountered during Scan.
 //
+// If the error is a *RowScanError, only the current row is skipped and
+// Scan may be called again to read the remaining rows.
+//
 // NOTE: It is not an error if the underlying result set is exhausted.
 func (r *Rows) Err() error {
 	if r.lasterr == io.EOF {
@@ -327,3 +598,12 @@ func (rs *MemoryRows) OverallRecordCount() *uint64 {
 	}
 	return &result
 }
+
+// Cursor iterates the records matched by a query in batches. See
+// Database.OpenCursor.
+type Cursor interface {
+	// Next returns at most batchSize records following those returned
+	// previously, and a token identifying the position after them. An
+	// empty batch is returned when the records are exhausted.
+	Next(batchSize uint64) ([]Record, string, error)
+}
@@ -0,0 +1,68 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRows(t *testing.T) {
+	Convey("Rows", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		iter := NewMockRowsIter(ctrl)
+		rows := NewRows(iter)
+
+		Convey("continues after a row scan error", func() {
+			scanErr := &RowScanError{
+				RecordID: NewRecordID("note", "id0"),
+				Column:   "amount",
+				Err:      errors.New("cannot convert"),
+			}
+			gomock.InOrder(
+				iter.EXPECT().Next(gomock.Any()).Return(scanErr),
+				iter.EXPECT().Next(gomock.Any()).Return(nil),
+				iter.EXPECT().Next(gomock.Any()).Return(io.EOF),
+				iter.EXPECT().Close().Return(nil),
+			)
+
+			So(rows.Scan(), ShouldBeFalse)
+			So(rows.Err(), ShouldEqual, scanErr)
+			So(rows.Err().Error(), ShouldEqual, `skydb: failed to scan column "amount" of record note/id0: cannot convert`)
+			So(rows.Scan(), ShouldBeTrue)
+			So(rows.Err(), ShouldBeNil)
+			So(rows.Scan(), ShouldBeFalse)
+			So(rows.Err(), ShouldBeNil)
+		})
+
+		Convey("closes on other errors", func() {
+			err := errors.New("connection lost")
+			gomock.InOrder(
+				iter.EXPECT().Next(gomock.Any()).Return(err),
+				iter.EXPECT().Close().Return(nil),
+			)
+
+			So(rows.Scan(), ShouldBeFalse)
+			So(rows.Err(), ShouldEqual, err)
+			So(rows.Scan(), ShouldBeFalse)
+		})
+	})
+}
@@ -4,9 +4,9 @@ package skydb
 
 import "strconv"
 
-const _DataType_name = "TypeStringTypeNumberTypeBooleanTypeJSONTypeReferenceTypeLocationTypeDateTimeTypeAssetTypeACLTypeIntegerTypeSequenceTypeGeometryTypeUnknown"
+const _DataType_name = "TypeStringTypeNumberTypeBooleanTypeJSONTypeReferenceTypeLocationTypeDateTimeTypeAssetTypeACLTypeIntegerTypeSequenceTypeGeometryTypeUnknownTypeAssetListTypeDateTimeTZTypeEnum"
 
-var _DataType_index = [...]uint8{0, 10, 20, 31, 39, 52, 64, 76, 85, 92, 103, 115, 127, 138}
+var _DataType_index = [...]uint8{0, 10, 20, 31, 39, 52, 64, 76, 85, 92, 103, 115, 127, 138, 151, 165, 173}
 
 func (i DataType) String() string {
 	i -= 1
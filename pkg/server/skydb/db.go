@@ -17,6 +17,7 @@ package skydb
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 var drivers = map[string]Driver{}
@@ -64,6 +65,76 @@ func GetAccessModel(accessString string) AccessModel {
 type DBConfig struct {
 	CanMigrate             bool
 	PasswordHistoryEnabled bool
+
+	// ExactTypeStats makes Database.TypeStats count rows of every record
+	// table instead of using the planner's estimates.
+	ExactTypeStats bool
+
+	// CoerceStringFields makes Database accept numbers for string fields.
+	// Such numbers are converted to strings when records are saved and
+	// when string fields are compared with numbers in queries.
+	CoerceStringFields bool
+
+	// QueryCacheSize is the maximum number of query results kept in
+	// memory. Query results are cached only if it is positive. A cached
+	// result is discarded when a record of a record type read by the
+	// query is modified through this process, or after QueryCacheTTL if
+	// it is positive.
+	QueryCacheSize int
+	QueryCacheTTL  time.Duration
+
+	// OutboxEnabled makes Database write an event to the outbox when a
+	// record is saved or deleted. See Conn.FetchOutbox.
+	OutboxEnabled bool
+
+	// RecordHistoryEnabled makes Database keep the version of a record
+	// whenever it is saved or deleted. See Database.GetAsOf.
+	RecordHistoryEnabled bool
+
+	// DefaultQueryLimit is the limit applied to Database.Query when the
+	// query does not specify one. Rows.Truncated tells whether records
+	// are left out because of it. Queries are not limited by default if
+	// it is zero.
+	DefaultQueryLimit uint64
+
+	// MaxRecordSize is the maximum size in bytes of a record saved by
+	// Database.Save, counting the string, JSON and other variable length
+	// values of the record. Records are not limited in size if it is not
+	// positive.
+	MaxRecordSize int
+
+	// LogMutatingSQL makes Conn log every statement modifying data at
+	// info level for auditing. The values of bound parameters, which may
+	// contain personal data, are redacted from all logged statements.
+	LogMutatingSQL bool
+
+	// FieldKeyProvider provides the key for encrypting and decrypting
+	// the values of encrypted fields. Records with encrypted fields
+	// cannot be saved or read if it is nil.
+	FieldKeyProvider FieldKeyProvider
+
+	// SSLMode, SSLRootCert, SSLCert and SSLKey configure the TLS
+	// connection to the database. If specified, they take precedence
+	// over the ones in the option string.
+	SSLMode     string
+	SSLRootCert string
+	SSLCert     string
+	SSLKey      string
+}
+
+// FieldKeyProvider provides the key of an app for encrypting the values
+// of fields declared encrypted by FieldType.Encrypted.
+type FieldKeyProvider interface {
+	// FieldKey returns a key of 16, 24 or 32 bytes.
+	FieldKey() ([]byte, error)
+}
+
+// StaticFieldKey is a FieldKeyProvider of a fixed key.
+type StaticFieldKey []byte
+
+// FieldKey implements FieldKeyProvider.
+func (k StaticFieldKey) FieldKey() ([]byte, error) {
+	return []byte(k), nil
 }
 
 // DBOpener aliases the function for opening Conn
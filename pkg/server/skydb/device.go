@@ -24,4 +24,11 @@ type Device struct {
 	AuthInfoID       string
 	Topic            string
 	LastRegisteredAt time.Time
+
+	// AppVersion and OSVersion are the versions of the app and the
+	// operating system running on the device, for targeting
+	// notifications. Metadata holds other information about the device.
+	AppVersion string
+	OSVersion  string
+	Metadata   map[string]interface{}
 }
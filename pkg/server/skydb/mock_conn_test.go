@@ -44,6 +44,19 @@ func (_mr *MockConnMockRecorder) CreateAuth(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateAuth", reflect.TypeOf((*MockConn)(nil).CreateAuth), arg0)
 }
 
+// CreateOrGetAuth mocks base method
+func (_m *MockConn) CreateOrGetAuth(authinfo *AuthInfo) (bool, error) {
+	ret := _m.ctrl.Call(_m, "CreateOrGetAuth", authinfo)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrGetAuth indicates an expected call of CreateOrGetAuth
+func (_mr *MockConnMockRecorder) CreateOrGetAuth(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateOrGetAuth", reflect.TypeOf((*MockConn)(nil).CreateOrGetAuth), arg0)
+}
+
 // GetAuth mocks base method
 func (_m *MockConn) GetAuth(id string, authinfo *AuthInfo) error {
 	ret := _m.ctrl.Call(_m, "GetAuth", id, authinfo)
@@ -92,6 +105,18 @@ func (_mr *MockConnMockRecorder) DeleteAuth(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteAuth", reflect.TypeOf((*MockConn)(nil).DeleteAuth), arg0)
 }
 
+// MergeUsers mocks base method
+func (_m *MockConn) MergeUsers(sourceID string, targetID string) error {
+	ret := _m.ctrl.Call(_m, "MergeUsers", sourceID, targetID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MergeUsers indicates an expected call of MergeUsers
+func (_mr *MockConnMockRecorder) MergeUsers(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "MergeUsers", reflect.TypeOf((*MockConn)(nil).MergeUsers), arg0, arg1)
+}
+
 // GetPasswordHistory mocks base method
 func (_m *MockConn) GetPasswordHistory(authID string, historySize int, historyDays int) ([]PasswordHistory, error) {
 	ret := _m.ctrl.Call(_m, "GetPasswordHistory", authID, historySize, historyDays)
@@ -316,6 +341,19 @@ func (_mr *MockConnMockRecorder) SaveAsset(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveAsset", reflect.TypeOf((*MockConn)(nil).SaveAsset), arg0)
 }
 
+// DeleteOrphanedAssets mocks base method
+func (_m *MockConn) DeleteOrphanedAssets() (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteOrphanedAssets")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOrphanedAssets indicates an expected call of DeleteOrphanedAssets
+func (_mr *MockConnMockRecorder) DeleteOrphanedAssets() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteOrphanedAssets", reflect.TypeOf((*MockConn)(nil).DeleteOrphanedAssets))
+}
+
 // QueryRelation mocks base method
 func (_m *MockConn) QueryRelation(user string, name string, direction string, config QueryConfig) []AuthInfo {
 	ret := _m.ctrl.Call(_m, "QueryRelation", user, name, direction, config)
@@ -365,6 +403,19 @@ func (_mr *MockConnMockRecorder) RemoveRelation(arg0, arg1, arg2 interface{}) *g
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveRelation", reflect.TypeOf((*MockConn)(nil).RemoveRelation), arg0, arg1, arg2)
 }
 
+// RemoveRelations mocks base method
+func (_m *MockConn) RemoveRelations(user string, name string, targetUsers []string) (int, error) {
+	ret := _m.ctrl.Call(_m, "RemoveRelations", user, name, targetUsers)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveRelations indicates an expected call of RemoveRelations
+func (_mr *MockConnMockRecorder) RemoveRelations(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveRelations", reflect.TypeOf((*MockConn)(nil).RemoveRelations), arg0, arg1, arg2)
+}
+
 // GetDevice mocks base method
 func (_m *MockConn) GetDevice(id string, device *Device) error {
 	ret := _m.ctrl.Call(_m, "GetDevice", id, device)
@@ -403,6 +454,19 @@ func (_mr *MockConnMockRecorder) QueryDevicesByUserAndTopic(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByUserAndTopic", reflect.TypeOf((*MockConn)(nil).QueryDevicesByUserAndTopic), arg0, arg1)
 }
 
+// QueryDevicesByAppVersion mocks base method
+func (_m *MockConn) QueryDevicesByAppVersion(appVersion string) ([]Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryDevicesByAppVersion", appVersion)
+	ret0, _ := ret[0].([]Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryDevicesByAppVersion indicates an expected call of QueryDevicesByAppVersion
+func (_mr *MockConnMockRecorder) QueryDevicesByAppVersion(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByAppVersion", reflect.TypeOf((*MockConn)(nil).QueryDevicesByAppVersion), arg0)
+}
+
 // SaveDevice mocks base method
 func (_m *MockConn) SaveDevice(device *Device) error {
 	ret := _m.ctrl.Call(_m, "SaveDevice", device)
@@ -415,6 +479,18 @@ func (_mr *MockConnMockRecorder) SaveDevice(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveDevice", reflect.TypeOf((*MockConn)(nil).SaveDevice), arg0)
 }
 
+// RegisterDevice mocks base method
+func (_m *MockConn) RegisterDevice(device *Device) error {
+	ret := _m.ctrl.Call(_m, "RegisterDevice", device)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegisterDevice indicates an expected call of RegisterDevice
+func (_mr *MockConnMockRecorder) RegisterDevice(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RegisterDevice", reflect.TypeOf((*MockConn)(nil).RegisterDevice), arg0)
+}
+
 // DeleteDevice mocks base method
 func (_m *MockConn) DeleteDevice(id string) error {
 	ret := _m.ctrl.Call(_m, "DeleteDevice", id)
@@ -439,6 +515,19 @@ func (_mr *MockConnMockRecorder) DeleteDevicesByToken(arg0, arg1 interface{}) *g
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteDevicesByToken", reflect.TypeOf((*MockConn)(nil).DeleteDevicesByToken), arg0, arg1)
 }
 
+// QueryEmptyDevicesByTime mocks base method
+func (_m *MockConn) QueryEmptyDevicesByTime(t time.Time) ([]Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryEmptyDevicesByTime", t)
+	ret0, _ := ret[0].([]Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryEmptyDevicesByTime indicates an expected call of QueryEmptyDevicesByTime
+func (_mr *MockConnMockRecorder) QueryEmptyDevicesByTime(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryEmptyDevicesByTime", reflect.TypeOf((*MockConn)(nil).QueryEmptyDevicesByTime), arg0)
+}
+
 // DeleteEmptyDevicesByTime mocks base method
 func (_m *MockConn) DeleteEmptyDevicesByTime(t time.Time) error {
 	ret := _m.ctrl.Call(_m, "DeleteEmptyDevicesByTime", t)
@@ -451,6 +540,19 @@ func (_mr *MockConnMockRecorder) DeleteEmptyDevicesByTime(arg0 interface{}) *gom
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteEmptyDevicesByTime", reflect.TypeOf((*MockConn)(nil).DeleteEmptyDevicesByTime), arg0)
 }
 
+// DeleteDevicesByUser mocks base method
+func (_m *MockConn) DeleteDevicesByUser(user string) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteDevicesByUser", user)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteDevicesByUser indicates an expected call of DeleteDevicesByUser
+func (_mr *MockConnMockRecorder) DeleteDevicesByUser(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteDevicesByUser", reflect.TypeOf((*MockConn)(nil).DeleteDevicesByUser), arg0)
+}
+
 // PublicDB mocks base method
 func (_m *MockConn) PublicDB() Database {
 	ret := _m.ctrl.Call(_m, "PublicDB")
@@ -583,6 +685,56 @@ func (_mr *MockConnMockRecorder) DeleteOAuth(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteOAuth", reflect.TypeOf((*MockConn)(nil).DeleteOAuth), arg0, arg1)
 }
 
+// FetchOutbox mocks base method
+func (_m *MockConn) FetchOutbox(limit int) ([]OutboxEvent, error) {
+	ret := _m.ctrl.Call(_m, "FetchOutbox", limit)
+	ret0, _ := ret[0].([]OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchOutbox indicates an expected call of FetchOutbox
+func (_mr *MockConnMockRecorder) FetchOutbox(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FetchOutbox", reflect.TypeOf((*MockConn)(nil).FetchOutbox), arg0)
+}
+
+// MarkOutboxDelivered mocks base method
+func (_m *MockConn) MarkOutboxDelivered(ids []int64) error {
+	ret := _m.ctrl.Call(_m, "MarkOutboxDelivered", ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkOutboxDelivered indicates an expected call of MarkOutboxDelivered
+func (_mr *MockConnMockRecorder) MarkOutboxDelivered(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "MarkOutboxDelivered", reflect.TypeOf((*MockConn)(nil).MarkOutboxDelivered), arg0)
+}
+
+// NextSequenceValue mocks base method
+func (_m *MockConn) NextSequenceValue(name string) (int64, error) {
+	ret := _m.ctrl.Call(_m, "NextSequenceValue", name)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextSequenceValue indicates an expected call of NextSequenceValue
+func (_mr *MockConnMockRecorder) NextSequenceValue(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "NextSequenceValue", reflect.TypeOf((*MockConn)(nil).NextSequenceValue), arg0)
+}
+
+// RunInTransaction mocks base method
+func (_m *MockConn) RunInTransaction(fn func(tx Conn) error) error {
+	ret := _m.ctrl.Call(_m, "RunInTransaction", fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunInTransaction indicates an expected call of RunInTransaction
+func (_mr *MockConnMockRecorder) RunInTransaction(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RunInTransaction", reflect.TypeOf((*MockConn)(nil).RunInTransaction), arg0)
+}
+
 // Close mocks base method
 func (_m *MockConn) Close() error {
 	ret := _m.ctrl.Call(_m, "Close")
@@ -6,6 +6,7 @@ package skydb
 import (
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockDatabase is a mock of Database interface
@@ -141,6 +142,58 @@ func (_mr *MockDatabaseMockRecorder) GetByIDs(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetByIDs", reflect.TypeOf((*MockDatabase)(nil).GetByIDs), arg0, arg1)
 }
 
+// GetRawField mocks base method
+func (_m *MockDatabase) GetRawField(id RecordID, field string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetRawField", id, field)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRawField indicates an expected call of GetRawField
+func (_mr *MockDatabaseMockRecorder) GetRawField(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRawField", reflect.TypeOf((*MockDatabase)(nil).GetRawField), arg0, arg1)
+}
+
+// GetAsOf mocks base method
+func (_m *MockDatabase) GetAsOf(id RecordID, at time.Time) (Record, error) {
+	ret := _m.ctrl.Call(_m, "GetAsOf", id, at)
+	ret0, _ := ret[0].(Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAsOf indicates an expected call of GetAsOf
+func (_mr *MockDatabaseMockRecorder) GetAsOf(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAsOf", reflect.TypeOf((*MockDatabase)(nil).GetAsOf), arg0, arg1)
+}
+
+// GetHistory mocks base method
+func (_m *MockDatabase) GetHistory(id RecordID) ([]RecordVersion, error) {
+	ret := _m.ctrl.Call(_m, "GetHistory", id)
+	ret0, _ := ret[0].([]RecordVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory
+func (_mr *MockDatabaseMockRecorder) GetHistory(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetHistory", reflect.TypeOf((*MockDatabase)(nil).GetHistory), arg0)
+}
+
+// OutgoingReferences mocks base method
+func (_m *MockDatabase) OutgoingReferences(id RecordID) (map[string]Reference, error) {
+	ret := _m.ctrl.Call(_m, "OutgoingReferences", id)
+	ret0, _ := ret[0].(map[string]Reference)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OutgoingReferences indicates an expected call of OutgoingReferences
+func (_mr *MockDatabaseMockRecorder) OutgoingReferences(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OutgoingReferences", reflect.TypeOf((*MockDatabase)(nil).OutgoingReferences), arg0)
+}
+
 // Save mocks base method
 func (_m *MockDatabase) Save(record *Record) error {
 	ret := _m.ctrl.Call(_m, "Save", record)
@@ -153,6 +206,55 @@ func (_mr *MockDatabaseMockRecorder) Save(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Save", reflect.TypeOf((*MockDatabase)(nil).Save), arg0)
 }
 
+// SaveNew mocks base method
+func (_m *MockDatabase) SaveNew(record *Record) error {
+	ret := _m.ctrl.Call(_m, "SaveNew", record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveNew indicates an expected call of SaveNew
+func (_mr *MockDatabaseMockRecorder) SaveNew(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveNew", reflect.TypeOf((*MockDatabase)(nil).SaveNew), arg0)
+}
+
+// SaveIfUnmodified mocks base method
+func (_m *MockDatabase) SaveIfUnmodified(record *Record, updatedAt time.Time) error {
+	ret := _m.ctrl.Call(_m, "SaveIfUnmodified", record, updatedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIfUnmodified indicates an expected call of SaveIfUnmodified
+func (_mr *MockDatabaseMockRecorder) SaveIfUnmodified(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveIfUnmodified", reflect.TypeOf((*MockDatabase)(nil).SaveIfUnmodified), arg0, arg1)
+}
+
+// Clone mocks base method
+func (_m *MockDatabase) Clone(sourceID RecordID, newKey string, newOwner string) (Record, error) {
+	ret := _m.ctrl.Call(_m, "Clone", sourceID, newKey, newOwner)
+	ret0, _ := ret[0].(Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clone indicates an expected call of Clone
+func (_mr *MockDatabaseMockRecorder) Clone(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Clone", reflect.TypeOf((*MockDatabase)(nil).Clone), arg0, arg1, arg2)
+}
+
+// Patch mocks base method
+func (_m *MockDatabase) Patch(id RecordID, updaterID string, fields map[string]interface{}) error {
+	ret := _m.ctrl.Call(_m, "Patch", id, updaterID, fields)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Patch indicates an expected call of Patch
+func (_mr *MockDatabaseMockRecorder) Patch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Patch", reflect.TypeOf((*MockDatabase)(nil).Patch), arg0, arg1, arg2)
+}
+
 // Delete mocks base method
 func (_m *MockDatabase) Delete(id RecordID) error {
 	ret := _m.ctrl.Call(_m, "Delete", id)
@@ -165,6 +267,68 @@ func (_mr *MockDatabaseMockRecorder) Delete(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Delete", reflect.TypeOf((*MockDatabase)(nil).Delete), arg0)
 }
 
+// AddLabel mocks base method
+func (_m *MockDatabase) AddLabel(id RecordID, label string) error {
+	ret := _m.ctrl.Call(_m, "AddLabel", id, label)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddLabel indicates an expected call of AddLabel
+func (_mr *MockDatabaseMockRecorder) AddLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AddLabel", reflect.TypeOf((*MockDatabase)(nil).AddLabel), arg0, arg1)
+}
+
+// RemoveLabel mocks base method
+func (_m *MockDatabase) RemoveLabel(id RecordID, label string) error {
+	ret := _m.ctrl.Call(_m, "RemoveLabel", id, label)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveLabel indicates an expected call of RemoveLabel
+func (_mr *MockDatabaseMockRecorder) RemoveLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveLabel", reflect.TypeOf((*MockDatabase)(nil).RemoveLabel), arg0, arg1)
+}
+
+// QueryByLabel mocks base method
+func (_m *MockDatabase) QueryByLabel(label string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByLabel", label, query, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByLabel indicates an expected call of QueryByLabel
+func (_mr *MockDatabaseMockRecorder) QueryByLabel(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByLabel", reflect.TypeOf((*MockDatabase)(nil).QueryByLabel), arg0, arg1, arg2)
+}
+
+// AcquireLock mocks base method
+func (_m *MockDatabase) AcquireLock(id RecordID, owner string, ttl time.Duration) (bool, error) {
+	ret := _m.ctrl.Call(_m, "AcquireLock", id, owner, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireLock indicates an expected call of AcquireLock
+func (_mr *MockDatabaseMockRecorder) AcquireLock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AcquireLock", reflect.TypeOf((*MockDatabase)(nil).AcquireLock), arg0, arg1, arg2)
+}
+
+// ReleaseLock mocks base method
+func (_m *MockDatabase) ReleaseLock(id RecordID, owner string) error {
+	ret := _m.ctrl.Call(_m, "ReleaseLock", id, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLock indicates an expected call of ReleaseLock
+func (_mr *MockDatabaseMockRecorder) ReleaseLock(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReleaseLock", reflect.TypeOf((*MockDatabase)(nil).ReleaseLock), arg0, arg1)
+}
+
 // Query mocks base method
 func (_m *MockDatabase) Query(query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
 	ret := _m.ctrl.Call(_m, "Query", query, accessControlOptions)
@@ -191,6 +355,110 @@ func (_mr *MockDatabaseMockRecorder) QueryCount(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryCount", reflect.TypeOf((*MockDatabase)(nil).QueryCount), arg0, arg1)
 }
 
+// QueryIDs mocks base method
+func (_m *MockDatabase) QueryIDs(query *Query, accessControlOptions *AccessControlOptions) ([]RecordID, error) {
+	ret := _m.ctrl.Call(_m, "QueryIDs", query, accessControlOptions)
+	ret0, _ := ret[0].([]RecordID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryIDs indicates an expected call of QueryIDs
+func (_mr *MockDatabaseMockRecorder) QueryIDs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryIDs", reflect.TypeOf((*MockDatabase)(nil).QueryIDs), arg0, arg1)
+}
+
+// QueryUnion mocks base method
+func (_m *MockDatabase) QueryUnion(queries []*Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryUnion", queries, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryUnion indicates an expected call of QueryUnion
+func (_mr *MockDatabaseMockRecorder) QueryUnion(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryUnion", reflect.TypeOf((*MockDatabase)(nil).QueryUnion), arg0, arg1)
+}
+
+// QueryTypes mocks base method
+func (_m *MockDatabase) QueryTypes(pattern string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryTypes", pattern, query, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryTypes indicates an expected call of QueryTypes
+func (_mr *MockDatabaseMockRecorder) QueryTypes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryTypes", reflect.TypeOf((*MockDatabase)(nil).QueryTypes), arg0, arg1, arg2)
+}
+
+// QueryByUpdater mocks base method
+func (_m *MockDatabase) QueryByUpdater(recordType string, updaterID string, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByUpdater", recordType, updaterID, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByUpdater indicates an expected call of QueryByUpdater
+func (_mr *MockDatabaseMockRecorder) QueryByUpdater(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByUpdater", reflect.TypeOf((*MockDatabase)(nil).QueryByUpdater), arg0, arg1, arg2)
+}
+
+// QueryByRelation mocks base method
+func (_m *MockDatabase) QueryByRelation(recordType string, relationName string, direction string, userID string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByRelation", recordType, relationName, direction, userID, query, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByRelation indicates an expected call of QueryByRelation
+func (_mr *MockDatabaseMockRecorder) QueryByRelation(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByRelation", reflect.TypeOf((*MockDatabase)(nil).QueryByRelation), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// QueryAfterCursor mocks base method
+func (_m *MockDatabase) QueryAfterCursor(recordType string, updatedAt time.Time, id string, limit int, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryAfterCursor", recordType, updatedAt, id, limit, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAfterCursor indicates an expected call of QueryAfterCursor
+func (_mr *MockDatabaseMockRecorder) QueryAfterCursor(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryAfterCursor", reflect.TypeOf((*MockDatabase)(nil).QueryAfterCursor), arg0, arg1, arg2, arg3, arg4)
+}
+
+// OpenCursor mocks base method
+func (_m *MockDatabase) OpenCursor(query *Query, token string, accessControlOptions *AccessControlOptions) (Cursor, error) {
+	ret := _m.ctrl.Call(_m, "OpenCursor", query, token, accessControlOptions)
+	ret0, _ := ret[0].(Cursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenCursor indicates an expected call of OpenCursor
+func (_mr *MockDatabaseMockRecorder) OpenCursor(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OpenCursor", reflect.TypeOf((*MockDatabase)(nil).OpenCursor), arg0, arg1, arg2)
+}
+
+// CountByReference mocks base method
+func (_m *MockDatabase) CountByReference(recordType string, refField string) (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "CountByReference", recordType, refField)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountByReference indicates an expected call of CountByReference
+func (_mr *MockDatabaseMockRecorder) CountByReference(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CountByReference", reflect.TypeOf((*MockDatabase)(nil).CountByReference), arg0, arg1)
+}
+
 // Extend mocks base method
 func (_m *MockDatabase) Extend(recordType string, schema RecordSchema) (bool, error) {
 	ret := _m.ctrl.Call(_m, "Extend", recordType, schema)
@@ -204,6 +472,31 @@ func (_mr *MockDatabaseMockRecorder) Extend(arg0, arg1 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Extend", reflect.TypeOf((*MockDatabase)(nil).Extend), arg0, arg1)
 }
 
+// ExtendWithOptions mocks base method
+func (_m *MockDatabase) ExtendWithOptions(recordType string, schema RecordSchema, options ExtendOptions) (bool, error) {
+	ret := _m.ctrl.Call(_m, "ExtendWithOptions", recordType, schema, options)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtendWithOptions indicates an expected call of ExtendWithOptions
+func (_mr *MockDatabaseMockRecorder) ExtendWithOptions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendWithOptions", reflect.TypeOf((*MockDatabase)(nil).ExtendWithOptions), arg0, arg1, arg2)
+}
+
+// ExtendMany mocks base method
+func (_m *MockDatabase) ExtendMany(schemas map[string]RecordSchema) error {
+	ret := _m.ctrl.Call(_m, "ExtendMany", schemas)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendMany indicates an expected call of ExtendMany
+func (_mr *MockDatabaseMockRecorder) ExtendMany(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendMany", reflect.TypeOf((*MockDatabase)(nil).ExtendMany), arg0)
+}
+
 // RenameSchema mocks base method
 func (_m *MockDatabase) RenameSchema(recordType string, oldColumnName string, newColumnName string) error {
 	ret := _m.ctrl.Call(_m, "RenameSchema", recordType, oldColumnName, newColumnName)
@@ -254,6 +547,56 @@ func (_mr *MockDatabaseMockRecorder) GetRecordSchemas() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRecordSchemas", reflect.TypeOf((*MockDatabase)(nil).GetRecordSchemas))
 }
 
+// CheckSchema mocks base method
+func (_m *MockDatabase) CheckSchema(expected map[string]RecordSchema) ([]SchemaDiff, error) {
+	ret := _m.ctrl.Call(_m, "CheckSchema", expected)
+	ret0, _ := ret[0].([]SchemaDiff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckSchema indicates an expected call of CheckSchema
+func (_mr *MockDatabaseMockRecorder) CheckSchema(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CheckSchema", reflect.TypeOf((*MockDatabase)(nil).CheckSchema), arg0)
+}
+
+// TypeStats mocks base method
+func (_m *MockDatabase) TypeStats() (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "TypeStats")
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TypeStats indicates an expected call of TypeStats
+func (_mr *MockDatabaseMockRecorder) TypeStats() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TypeStats", reflect.TypeOf((*MockDatabase)(nil).TypeStats))
+}
+
+// AnalyzeType mocks base method
+func (_m *MockDatabase) AnalyzeType(recordType string) error {
+	ret := _m.ctrl.Call(_m, "AnalyzeType", recordType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnalyzeType indicates an expected call of AnalyzeType
+func (_mr *MockDatabaseMockRecorder) AnalyzeType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AnalyzeType", reflect.TypeOf((*MockDatabase)(nil).AnalyzeType), arg0)
+}
+
+// VacuumType mocks base method
+func (_m *MockDatabase) VacuumType(recordType string) error {
+	ret := _m.ctrl.Call(_m, "VacuumType", recordType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VacuumType indicates an expected call of VacuumType
+func (_mr *MockDatabaseMockRecorder) VacuumType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "VacuumType", reflect.TypeOf((*MockDatabase)(nil).VacuumType), arg0)
+}
+
 // GetSubscription mocks base method
 func (_m *MockDatabase) GetSubscription(key string, deviceID string, subscription *Subscription) error {
 	ret := _m.ctrl.Call(_m, "GetSubscription", key, deviceID, subscription)
@@ -278,6 +621,18 @@ func (_mr *MockDatabaseMockRecorder) SaveSubscription(arg0 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveSubscription", reflect.TypeOf((*MockDatabase)(nil).SaveSubscription), arg0)
 }
 
+// UpdateSubscription mocks base method
+func (_m *MockDatabase) UpdateSubscription(subscription *Subscription) error {
+	ret := _m.ctrl.Call(_m, "UpdateSubscription", subscription)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSubscription indicates an expected call of UpdateSubscription
+func (_mr *MockDatabaseMockRecorder) UpdateSubscription(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateSubscription", reflect.TypeOf((*MockDatabase)(nil).UpdateSubscription), arg0)
+}
+
 // DeleteSubscription mocks base method
 func (_m *MockDatabase) DeleteSubscription(key string, deviceID string) error {
 	ret := _m.ctrl.Call(_m, "DeleteSubscription", key, deviceID)
@@ -302,6 +657,19 @@ func (_mr *MockDatabaseMockRecorder) GetSubscriptionsByDeviceID(arg0 interface{}
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscriptionsByDeviceID", reflect.TypeOf((*MockDatabase)(nil).GetSubscriptionsByDeviceID), arg0)
 }
 
+// GetSubscriptionsByDevice mocks base method
+func (_m *MockDatabase) GetSubscriptionsByDevice(deviceID string) ([]Subscription, error) {
+	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDevice", deviceID)
+	ret0, _ := ret[0].([]Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptionsByDevice indicates an expected call of GetSubscriptionsByDevice
+func (_mr *MockDatabaseMockRecorder) GetSubscriptionsByDevice(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscriptionsByDevice", reflect.TypeOf((*MockDatabase)(nil).GetSubscriptionsByDevice), arg0)
+}
+
 // GetMatchingSubscriptions mocks base method
 func (_m *MockDatabase) GetMatchingSubscriptions(record *Record) []Subscription {
 	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptions", record)
@@ -314,6 +682,31 @@ func (_mr *MockDatabaseMockRecorder) GetMatchingSubscriptions(arg0 interface{})
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptions", reflect.TypeOf((*MockDatabase)(nil).GetMatchingSubscriptions), arg0)
 }
 
+// GetMatchingSubscriptionsBatch mocks base method
+func (_m *MockDatabase) GetMatchingSubscriptionsBatch(records []*Record) [][]Subscription {
+	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptionsBatch", records)
+	ret0, _ := ret[0].([][]Subscription)
+	return ret0
+}
+
+// GetMatchingSubscriptionsBatch indicates an expected call of GetMatchingSubscriptionsBatch
+func (_mr *MockDatabaseMockRecorder) GetMatchingSubscriptionsBatch(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptionsBatch", reflect.TypeOf((*MockDatabase)(nil).GetMatchingSubscriptionsBatch), arg0)
+}
+
+// SubscriptionMatchesRecord mocks base method
+func (_m *MockDatabase) SubscriptionMatchesRecord(subscriptionID string, record *Record) (bool, error) {
+	ret := _m.ctrl.Call(_m, "SubscriptionMatchesRecord", subscriptionID, record)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscriptionMatchesRecord indicates an expected call of SubscriptionMatchesRecord
+func (_mr *MockDatabaseMockRecorder) SubscriptionMatchesRecord(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SubscriptionMatchesRecord", reflect.TypeOf((*MockDatabase)(nil).SubscriptionMatchesRecord), arg0, arg1)
+}
+
 // GetIndexesByRecordType mocks base method
 func (_m *MockDatabase) GetIndexesByRecordType(recordType string) (map[string]Index, error) {
 	ret := _m.ctrl.Call(_m, "GetIndexesByRecordType", recordType)
@@ -410,6 +803,30 @@ func (_mr *MockTransactionalMockRecorder) Rollback() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Rollback", reflect.TypeOf((*MockTransactional)(nil).Rollback))
 }
 
+// Savepoint mocks base method
+func (_m *MockTransactional) Savepoint(name string) error {
+	ret := _m.ctrl.Call(_m, "Savepoint", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Savepoint indicates an expected call of Savepoint
+func (_mr *MockTransactionalMockRecorder) Savepoint(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Savepoint", reflect.TypeOf((*MockTransactional)(nil).Savepoint), arg0)
+}
+
+// RollbackTo mocks base method
+func (_m *MockTransactional) RollbackTo(name string) error {
+	ret := _m.ctrl.Call(_m, "RollbackTo", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollbackTo indicates an expected call of RollbackTo
+func (_mr *MockTransactionalMockRecorder) RollbackTo(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RollbackTo", reflect.TypeOf((*MockTransactional)(nil).RollbackTo), arg0)
+}
+
 // MockTxDatabase is a mock of TxDatabase interface
 type MockTxDatabase struct {
 	ctrl     *gomock.Controller
@@ -469,6 +886,30 @@ func (_mr *MockTxDatabaseMockRecorder) Rollback() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Rollback", reflect.TypeOf((*MockTxDatabase)(nil).Rollback))
 }
 
+// Savepoint mocks base method
+func (_m *MockTxDatabase) Savepoint(name string) error {
+	ret := _m.ctrl.Call(_m, "Savepoint", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Savepoint indicates an expected call of Savepoint
+func (_mr *MockTxDatabaseMockRecorder) Savepoint(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Savepoint", reflect.TypeOf((*MockTxDatabase)(nil).Savepoint), arg0)
+}
+
+// RollbackTo mocks base method
+func (_m *MockTxDatabase) RollbackTo(name string) error {
+	ret := _m.ctrl.Call(_m, "RollbackTo", name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollbackTo indicates an expected call of RollbackTo
+func (_mr *MockTxDatabaseMockRecorder) RollbackTo(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RollbackTo", reflect.TypeOf((*MockTxDatabase)(nil).RollbackTo), arg0)
+}
+
 // Conn mocks base method
 func (_m *MockTxDatabase) Conn() Conn {
 	ret := _m.ctrl.Call(_m, "Conn")
@@ -579,6 +1020,58 @@ func (_mr *MockTxDatabaseMockRecorder) GetByIDs(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetByIDs", reflect.TypeOf((*MockTxDatabase)(nil).GetByIDs), arg0, arg1)
 }
 
+// GetRawField mocks base method
+func (_m *MockTxDatabase) GetRawField(id RecordID, field string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetRawField", id, field)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRawField indicates an expected call of GetRawField
+func (_mr *MockTxDatabaseMockRecorder) GetRawField(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRawField", reflect.TypeOf((*MockTxDatabase)(nil).GetRawField), arg0, arg1)
+}
+
+// GetAsOf mocks base method
+func (_m *MockTxDatabase) GetAsOf(id RecordID, at time.Time) (Record, error) {
+	ret := _m.ctrl.Call(_m, "GetAsOf", id, at)
+	ret0, _ := ret[0].(Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAsOf indicates an expected call of GetAsOf
+func (_mr *MockTxDatabaseMockRecorder) GetAsOf(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAsOf", reflect.TypeOf((*MockTxDatabase)(nil).GetAsOf), arg0, arg1)
+}
+
+// GetHistory mocks base method
+func (_m *MockTxDatabase) GetHistory(id RecordID) ([]RecordVersion, error) {
+	ret := _m.ctrl.Call(_m, "GetHistory", id)
+	ret0, _ := ret[0].([]RecordVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory
+func (_mr *MockTxDatabaseMockRecorder) GetHistory(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetHistory", reflect.TypeOf((*MockTxDatabase)(nil).GetHistory), arg0)
+}
+
+// OutgoingReferences mocks base method
+func (_m *MockTxDatabase) OutgoingReferences(id RecordID) (map[string]Reference, error) {
+	ret := _m.ctrl.Call(_m, "OutgoingReferences", id)
+	ret0, _ := ret[0].(map[string]Reference)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OutgoingReferences indicates an expected call of OutgoingReferences
+func (_mr *MockTxDatabaseMockRecorder) OutgoingReferences(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OutgoingReferences", reflect.TypeOf((*MockTxDatabase)(nil).OutgoingReferences), arg0)
+}
+
 // Save mocks base method
 func (_m *MockTxDatabase) Save(record *Record) error {
 	ret := _m.ctrl.Call(_m, "Save", record)
@@ -591,6 +1084,55 @@ func (_mr *MockTxDatabaseMockRecorder) Save(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Save", reflect.TypeOf((*MockTxDatabase)(nil).Save), arg0)
 }
 
+// SaveNew mocks base method
+func (_m *MockTxDatabase) SaveNew(record *Record) error {
+	ret := _m.ctrl.Call(_m, "SaveNew", record)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveNew indicates an expected call of SaveNew
+func (_mr *MockTxDatabaseMockRecorder) SaveNew(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveNew", reflect.TypeOf((*MockTxDatabase)(nil).SaveNew), arg0)
+}
+
+// SaveIfUnmodified mocks base method
+func (_m *MockTxDatabase) SaveIfUnmodified(record *Record, updatedAt time.Time) error {
+	ret := _m.ctrl.Call(_m, "SaveIfUnmodified", record, updatedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIfUnmodified indicates an expected call of SaveIfUnmodified
+func (_mr *MockTxDatabaseMockRecorder) SaveIfUnmodified(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveIfUnmodified", reflect.TypeOf((*MockTxDatabase)(nil).SaveIfUnmodified), arg0, arg1)
+}
+
+// Clone mocks base method
+func (_m *MockTxDatabase) Clone(sourceID RecordID, newKey string, newOwner string) (Record, error) {
+	ret := _m.ctrl.Call(_m, "Clone", sourceID, newKey, newOwner)
+	ret0, _ := ret[0].(Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clone indicates an expected call of Clone
+func (_mr *MockTxDatabaseMockRecorder) Clone(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Clone", reflect.TypeOf((*MockTxDatabase)(nil).Clone), arg0, arg1, arg2)
+}
+
+// Patch mocks base method
+func (_m *MockTxDatabase) Patch(id RecordID, updaterID string, fields map[string]interface{}) error {
+	ret := _m.ctrl.Call(_m, "Patch", id, updaterID, fields)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Patch indicates an expected call of Patch
+func (_mr *MockTxDatabaseMockRecorder) Patch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Patch", reflect.TypeOf((*MockTxDatabase)(nil).Patch), arg0, arg1, arg2)
+}
+
 // Delete mocks base method
 func (_m *MockTxDatabase) Delete(id RecordID) error {
 	ret := _m.ctrl.Call(_m, "Delete", id)
@@ -603,6 +1145,68 @@ func (_mr *MockTxDatabaseMockRecorder) Delete(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Delete", reflect.TypeOf((*MockTxDatabase)(nil).Delete), arg0)
 }
 
+// AddLabel mocks base method
+func (_m *MockTxDatabase) AddLabel(id RecordID, label string) error {
+	ret := _m.ctrl.Call(_m, "AddLabel", id, label)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddLabel indicates an expected call of AddLabel
+func (_mr *MockTxDatabaseMockRecorder) AddLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AddLabel", reflect.TypeOf((*MockTxDatabase)(nil).AddLabel), arg0, arg1)
+}
+
+// RemoveLabel mocks base method
+func (_m *MockTxDatabase) RemoveLabel(id RecordID, label string) error {
+	ret := _m.ctrl.Call(_m, "RemoveLabel", id, label)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveLabel indicates an expected call of RemoveLabel
+func (_mr *MockTxDatabaseMockRecorder) RemoveLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveLabel", reflect.TypeOf((*MockTxDatabase)(nil).RemoveLabel), arg0, arg1)
+}
+
+// QueryByLabel mocks base method
+func (_m *MockTxDatabase) QueryByLabel(label string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByLabel", label, query, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByLabel indicates an expected call of QueryByLabel
+func (_mr *MockTxDatabaseMockRecorder) QueryByLabel(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByLabel", reflect.TypeOf((*MockTxDatabase)(nil).QueryByLabel), arg0, arg1, arg2)
+}
+
+// AcquireLock mocks base method
+func (_m *MockTxDatabase) AcquireLock(id RecordID, owner string, ttl time.Duration) (bool, error) {
+	ret := _m.ctrl.Call(_m, "AcquireLock", id, owner, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireLock indicates an expected call of AcquireLock
+func (_mr *MockTxDatabaseMockRecorder) AcquireLock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AcquireLock", reflect.TypeOf((*MockTxDatabase)(nil).AcquireLock), arg0, arg1, arg2)
+}
+
+// ReleaseLock mocks base method
+func (_m *MockTxDatabase) ReleaseLock(id RecordID, owner string) error {
+	ret := _m.ctrl.Call(_m, "ReleaseLock", id, owner)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLock indicates an expected call of ReleaseLock
+func (_mr *MockTxDatabaseMockRecorder) ReleaseLock(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReleaseLock", reflect.TypeOf((*MockTxDatabase)(nil).ReleaseLock), arg0, arg1)
+}
+
 // Query mocks base method
 func (_m *MockTxDatabase) Query(query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
 	ret := _m.ctrl.Call(_m, "Query", query, accessControlOptions)
@@ -629,6 +1233,110 @@ func (_mr *MockTxDatabaseMockRecorder) QueryCount(arg0, arg1 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryCount", reflect.TypeOf((*MockTxDatabase)(nil).QueryCount), arg0, arg1)
 }
 
+// QueryIDs mocks base method
+func (_m *MockTxDatabase) QueryIDs(query *Query, accessControlOptions *AccessControlOptions) ([]RecordID, error) {
+	ret := _m.ctrl.Call(_m, "QueryIDs", query, accessControlOptions)
+	ret0, _ := ret[0].([]RecordID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryIDs indicates an expected call of QueryIDs
+func (_mr *MockTxDatabaseMockRecorder) QueryIDs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryIDs", reflect.TypeOf((*MockTxDatabase)(nil).QueryIDs), arg0, arg1)
+}
+
+// QueryUnion mocks base method
+func (_m *MockTxDatabase) QueryUnion(queries []*Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryUnion", queries, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryUnion indicates an expected call of QueryUnion
+func (_mr *MockTxDatabaseMockRecorder) QueryUnion(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryUnion", reflect.TypeOf((*MockTxDatabase)(nil).QueryUnion), arg0, arg1)
+}
+
+// QueryTypes mocks base method
+func (_m *MockTxDatabase) QueryTypes(pattern string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryTypes", pattern, query, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryTypes indicates an expected call of QueryTypes
+func (_mr *MockTxDatabaseMockRecorder) QueryTypes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryTypes", reflect.TypeOf((*MockTxDatabase)(nil).QueryTypes), arg0, arg1, arg2)
+}
+
+// QueryByUpdater mocks base method
+func (_m *MockTxDatabase) QueryByUpdater(recordType string, updaterID string, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByUpdater", recordType, updaterID, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByUpdater indicates an expected call of QueryByUpdater
+func (_mr *MockTxDatabaseMockRecorder) QueryByUpdater(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByUpdater", reflect.TypeOf((*MockTxDatabase)(nil).QueryByUpdater), arg0, arg1, arg2)
+}
+
+// QueryByRelation mocks base method
+func (_m *MockTxDatabase) QueryByRelation(recordType string, relationName string, direction string, userID string, query *Query, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByRelation", recordType, relationName, direction, userID, query, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByRelation indicates an expected call of QueryByRelation
+func (_mr *MockTxDatabaseMockRecorder) QueryByRelation(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByRelation", reflect.TypeOf((*MockTxDatabase)(nil).QueryByRelation), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// QueryAfterCursor mocks base method
+func (_m *MockTxDatabase) QueryAfterCursor(recordType string, updatedAt time.Time, id string, limit int, accessControlOptions *AccessControlOptions) (*Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryAfterCursor", recordType, updatedAt, id, limit, accessControlOptions)
+	ret0, _ := ret[0].(*Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAfterCursor indicates an expected call of QueryAfterCursor
+func (_mr *MockTxDatabaseMockRecorder) QueryAfterCursor(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryAfterCursor", reflect.TypeOf((*MockTxDatabase)(nil).QueryAfterCursor), arg0, arg1, arg2, arg3, arg4)
+}
+
+// OpenCursor mocks base method
+func (_m *MockTxDatabase) OpenCursor(query *Query, token string, accessControlOptions *AccessControlOptions) (Cursor, error) {
+	ret := _m.ctrl.Call(_m, "OpenCursor", query, token, accessControlOptions)
+	ret0, _ := ret[0].(Cursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenCursor indicates an expected call of OpenCursor
+func (_mr *MockTxDatabaseMockRecorder) OpenCursor(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OpenCursor", reflect.TypeOf((*MockTxDatabase)(nil).OpenCursor), arg0, arg1, arg2)
+}
+
+// CountByReference mocks base method
+func (_m *MockTxDatabase) CountByReference(recordType string, refField string) (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "CountByReference", recordType, refField)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountByReference indicates an expected call of CountByReference
+func (_mr *MockTxDatabaseMockRecorder) CountByReference(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CountByReference", reflect.TypeOf((*MockTxDatabase)(nil).CountByReference), arg0, arg1)
+}
+
 // Extend mocks base method
 func (_m *MockTxDatabase) Extend(recordType string, schema RecordSchema) (bool, error) {
 	ret := _m.ctrl.Call(_m, "Extend", recordType, schema)
@@ -642,6 +1350,31 @@ func (_mr *MockTxDatabaseMockRecorder) Extend(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Extend", reflect.TypeOf((*MockTxDatabase)(nil).Extend), arg0, arg1)
 }
 
+// ExtendWithOptions mocks base method
+func (_m *MockTxDatabase) ExtendWithOptions(recordType string, schema RecordSchema, options ExtendOptions) (bool, error) {
+	ret := _m.ctrl.Call(_m, "ExtendWithOptions", recordType, schema, options)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtendWithOptions indicates an expected call of ExtendWithOptions
+func (_mr *MockTxDatabaseMockRecorder) ExtendWithOptions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendWithOptions", reflect.TypeOf((*MockTxDatabase)(nil).ExtendWithOptions), arg0, arg1, arg2)
+}
+
+// ExtendMany mocks base method
+func (_m *MockTxDatabase) ExtendMany(schemas map[string]RecordSchema) error {
+	ret := _m.ctrl.Call(_m, "ExtendMany", schemas)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendMany indicates an expected call of ExtendMany
+func (_mr *MockTxDatabaseMockRecorder) ExtendMany(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendMany", reflect.TypeOf((*MockTxDatabase)(nil).ExtendMany), arg0)
+}
+
 // RenameSchema mocks base method
 func (_m *MockTxDatabase) RenameSchema(recordType string, oldColumnName string, newColumnName string) error {
 	ret := _m.ctrl.Call(_m, "RenameSchema", recordType, oldColumnName, newColumnName)
@@ -692,6 +1425,56 @@ func (_mr *MockTxDatabaseMockRecorder) GetRecordSchemas() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRecordSchemas", reflect.TypeOf((*MockTxDatabase)(nil).GetRecordSchemas))
 }
 
+// CheckSchema mocks base method
+func (_m *MockTxDatabase) CheckSchema(expected map[string]RecordSchema) ([]SchemaDiff, error) {
+	ret := _m.ctrl.Call(_m, "CheckSchema", expected)
+	ret0, _ := ret[0].([]SchemaDiff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckSchema indicates an expected call of CheckSchema
+func (_mr *MockTxDatabaseMockRecorder) CheckSchema(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CheckSchema", reflect.TypeOf((*MockTxDatabase)(nil).CheckSchema), arg0)
+}
+
+// TypeStats mocks base method
+func (_m *MockTxDatabase) TypeStats() (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "TypeStats")
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TypeStats indicates an expected call of TypeStats
+func (_mr *MockTxDatabaseMockRecorder) TypeStats() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TypeStats", reflect.TypeOf((*MockTxDatabase)(nil).TypeStats))
+}
+
+// AnalyzeType mocks base method
+func (_m *MockTxDatabase) AnalyzeType(recordType string) error {
+	ret := _m.ctrl.Call(_m, "AnalyzeType", recordType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnalyzeType indicates an expected call of AnalyzeType
+func (_mr *MockTxDatabaseMockRecorder) AnalyzeType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AnalyzeType", reflect.TypeOf((*MockTxDatabase)(nil).AnalyzeType), arg0)
+}
+
+// VacuumType mocks base method
+func (_m *MockTxDatabase) VacuumType(recordType string) error {
+	ret := _m.ctrl.Call(_m, "VacuumType", recordType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VacuumType indicates an expected call of VacuumType
+func (_mr *MockTxDatabaseMockRecorder) VacuumType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "VacuumType", reflect.TypeOf((*MockTxDatabase)(nil).VacuumType), arg0)
+}
+
 // GetSubscription mocks base method
 func (_m *MockTxDatabase) GetSubscription(key string, deviceID string, subscription *Subscription) error {
 	ret := _m.ctrl.Call(_m, "GetSubscription", key, deviceID, subscription)
@@ -716,6 +1499,18 @@ func (_mr *MockTxDatabaseMockRecorder) SaveSubscription(arg0 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveSubscription", reflect.TypeOf((*MockTxDatabase)(nil).SaveSubscription), arg0)
 }
 
+// UpdateSubscription mocks base method
+func (_m *MockTxDatabase) UpdateSubscription(subscription *Subscription) error {
+	ret := _m.ctrl.Call(_m, "UpdateSubscription", subscription)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSubscription indicates an expected call of UpdateSubscription
+func (_mr *MockTxDatabaseMockRecorder) UpdateSubscription(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateSubscription", reflect.TypeOf((*MockTxDatabase)(nil).UpdateSubscription), arg0)
+}
+
 // DeleteSubscription mocks base method
 func (_m *MockTxDatabase) DeleteSubscription(key string, deviceID string) error {
 	ret := _m.ctrl.Call(_m, "DeleteSubscription", key, deviceID)
@@ -740,6 +1535,19 @@ func (_mr *MockTxDatabaseMockRecorder) GetSubscriptionsByDeviceID(arg0 interface
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscriptionsByDeviceID", reflect.TypeOf((*MockTxDatabase)(nil).GetSubscriptionsByDeviceID), arg0)
 }
 
+// GetSubscriptionsByDevice mocks base method
+func (_m *MockTxDatabase) GetSubscriptionsByDevice(deviceID string) ([]Subscription, error) {
+	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDevice", deviceID)
+	ret0, _ := ret[0].([]Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptionsByDevice indicates an expected call of GetSubscriptionsByDevice
+func (_mr *MockTxDatabaseMockRecorder) GetSubscriptionsByDevice(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscriptionsByDevice", reflect.TypeOf((*MockTxDatabase)(nil).GetSubscriptionsByDevice), arg0)
+}
+
 // GetMatchingSubscriptions mocks base method
 func (_m *MockTxDatabase) GetMatchingSubscriptions(record *Record) []Subscription {
 	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptions", record)
@@ -752,6 +1560,31 @@ func (_mr *MockTxDatabaseMockRecorder) GetMatchingSubscriptions(arg0 interface{}
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptions", reflect.TypeOf((*MockTxDatabase)(nil).GetMatchingSubscriptions), arg0)
 }
 
+// GetMatchingSubscriptionsBatch mocks base method
+func (_m *MockTxDatabase) GetMatchingSubscriptionsBatch(records []*Record) [][]Subscription {
+	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptionsBatch", records)
+	ret0, _ := ret[0].([][]Subscription)
+	return ret0
+}
+
+// GetMatchingSubscriptionsBatch indicates an expected call of GetMatchingSubscriptionsBatch
+func (_mr *MockTxDatabaseMockRecorder) GetMatchingSubscriptionsBatch(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptionsBatch", reflect.TypeOf((*MockTxDatabase)(nil).GetMatchingSubscriptionsBatch), arg0)
+}
+
+// SubscriptionMatchesRecord mocks base method
+func (_m *MockTxDatabase) SubscriptionMatchesRecord(subscriptionID string, record *Record) (bool, error) {
+	ret := _m.ctrl.Call(_m, "SubscriptionMatchesRecord", subscriptionID, record)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscriptionMatchesRecord indicates an expected call of SubscriptionMatchesRecord
+func (_mr *MockTxDatabaseMockRecorder) SubscriptionMatchesRecord(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SubscriptionMatchesRecord", reflect.TypeOf((*MockTxDatabase)(nil).SubscriptionMatchesRecord), arg0, arg1)
+}
+
 // GetIndexesByRecordType mocks base method
 func (_m *MockTxDatabase) GetIndexesByRecordType(recordType string) (map[string]Index, error) {
 	ret := _m.ctrl.Call(_m, "GetIndexesByRecordType", recordType)
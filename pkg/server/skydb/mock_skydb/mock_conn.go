@@ -105,6 +105,19 @@ func (_mr *MockConnMockRecorder) CreateOAuthInfo(arg0 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateOAuthInfo", reflect.TypeOf((*MockConn)(nil).CreateOAuthInfo), arg0)
 }
 
+// CreateOrGetAuth mocks base method
+func (_m *MockConn) CreateOrGetAuth(_param0 *skydb.AuthInfo) (bool, error) {
+	ret := _m.ctrl.Call(_m, "CreateOrGetAuth", _param0)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrGetAuth indicates an expected call of CreateOrGetAuth
+func (_mr *MockConnMockRecorder) CreateOrGetAuth(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CreateOrGetAuth", reflect.TypeOf((*MockConn)(nil).CreateOrGetAuth), arg0)
+}
+
 // DeleteAuth mocks base method
 func (_m *MockConn) DeleteAuth(_param0 string) error {
 	ret := _m.ctrl.Call(_m, "DeleteAuth", _param0)
@@ -153,6 +166,19 @@ func (_mr *MockConnMockRecorder) DeleteDevicesByToken(arg0, arg1 interface{}) *g
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteDevicesByToken", reflect.TypeOf((*MockConn)(nil).DeleteDevicesByToken), arg0, arg1)
 }
 
+// DeleteDevicesByUser mocks base method
+func (_m *MockConn) DeleteDevicesByUser(_param0 string) (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteDevicesByUser", _param0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteDevicesByUser indicates an expected call of DeleteDevicesByUser
+func (_mr *MockConnMockRecorder) DeleteDevicesByUser(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteDevicesByUser", reflect.TypeOf((*MockConn)(nil).DeleteDevicesByUser), arg0)
+}
+
 // DeleteEmptyDevicesByTime mocks base method
 func (_m *MockConn) DeleteEmptyDevicesByTime(_param0 time.Time) error {
 	ret := _m.ctrl.Call(_m, "DeleteEmptyDevicesByTime", _param0)
@@ -177,6 +203,19 @@ func (_mr *MockConnMockRecorder) DeleteOAuth(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteOAuth", reflect.TypeOf((*MockConn)(nil).DeleteOAuth), arg0, arg1)
 }
 
+// DeleteOrphanedAssets mocks base method
+func (_m *MockConn) DeleteOrphanedAssets() (int, error) {
+	ret := _m.ctrl.Call(_m, "DeleteOrphanedAssets")
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteOrphanedAssets indicates an expected call of DeleteOrphanedAssets
+func (_mr *MockConnMockRecorder) DeleteOrphanedAssets() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "DeleteOrphanedAssets", reflect.TypeOf((*MockConn)(nil).DeleteOrphanedAssets))
+}
+
 // EnsureAuthRecordKeysExist mocks base method
 func (_m *MockConn) EnsureAuthRecordKeysExist(_param0 [][]string) error {
 	ret := _m.ctrl.Call(_m, "EnsureAuthRecordKeysExist", _param0)
@@ -201,6 +240,19 @@ func (_mr *MockConnMockRecorder) EnsureAuthRecordKeysIndexesMatch(arg0 interface
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "EnsureAuthRecordKeysIndexesMatch", reflect.TypeOf((*MockConn)(nil).EnsureAuthRecordKeysIndexesMatch), arg0)
 }
 
+// FetchOutbox mocks base method
+func (_m *MockConn) FetchOutbox(_param0 int) ([]skydb.OutboxEvent, error) {
+	ret := _m.ctrl.Call(_m, "FetchOutbox", _param0)
+	ret0, _ := ret[0].([]skydb.OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchOutbox indicates an expected call of FetchOutbox
+func (_mr *MockConnMockRecorder) FetchOutbox(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "FetchOutbox", reflect.TypeOf((*MockConn)(nil).FetchOutbox), arg0)
+}
+
 // GetAdminRoles mocks base method
 func (_m *MockConn) GetAdminRoles() ([]string, error) {
 	ret := _m.ctrl.Call(_m, "GetAdminRoles")
@@ -389,6 +441,43 @@ func (_mr *MockConnMockRecorder) GetRoles(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRoles", reflect.TypeOf((*MockConn)(nil).GetRoles), arg0)
 }
 
+// MarkOutboxDelivered mocks base method
+func (_m *MockConn) MarkOutboxDelivered(_param0 []int64) error {
+	ret := _m.ctrl.Call(_m, "MarkOutboxDelivered", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkOutboxDelivered indicates an expected call of MarkOutboxDelivered
+func (_mr *MockConnMockRecorder) MarkOutboxDelivered(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "MarkOutboxDelivered", reflect.TypeOf((*MockConn)(nil).MarkOutboxDelivered), arg0)
+}
+
+// MergeUsers mocks base method
+func (_m *MockConn) MergeUsers(_param0 string, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "MergeUsers", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MergeUsers indicates an expected call of MergeUsers
+func (_mr *MockConnMockRecorder) MergeUsers(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "MergeUsers", reflect.TypeOf((*MockConn)(nil).MergeUsers), arg0, arg1)
+}
+
+// NextSequenceValue mocks base method
+func (_m *MockConn) NextSequenceValue(_param0 string) (int64, error) {
+	ret := _m.ctrl.Call(_m, "NextSequenceValue", _param0)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextSequenceValue indicates an expected call of NextSequenceValue
+func (_mr *MockConnMockRecorder) NextSequenceValue(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "NextSequenceValue", reflect.TypeOf((*MockConn)(nil).NextSequenceValue), arg0)
+}
+
 // PrivateDB mocks base method
 func (_m *MockConn) PrivateDB(_param0 string) skydb.Database {
 	ret := _m.ctrl.Call(_m, "PrivateDB", _param0)
@@ -413,6 +502,19 @@ func (_mr *MockConnMockRecorder) PublicDB() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "PublicDB", reflect.TypeOf((*MockConn)(nil).PublicDB))
 }
 
+// QueryDevicesByAppVersion mocks base method
+func (_m *MockConn) QueryDevicesByAppVersion(_param0 string) ([]skydb.Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryDevicesByAppVersion", _param0)
+	ret0, _ := ret[0].([]skydb.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryDevicesByAppVersion indicates an expected call of QueryDevicesByAppVersion
+func (_mr *MockConnMockRecorder) QueryDevicesByAppVersion(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByAppVersion", reflect.TypeOf((*MockConn)(nil).QueryDevicesByAppVersion), arg0)
+}
+
 // QueryDevicesByUser mocks base method
 func (_m *MockConn) QueryDevicesByUser(_param0 string) ([]skydb.Device, error) {
 	ret := _m.ctrl.Call(_m, "QueryDevicesByUser", _param0)
@@ -439,6 +541,19 @@ func (_mr *MockConnMockRecorder) QueryDevicesByUserAndTopic(arg0, arg1 interface
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryDevicesByUserAndTopic", reflect.TypeOf((*MockConn)(nil).QueryDevicesByUserAndTopic), arg0, arg1)
 }
 
+// QueryEmptyDevicesByTime mocks base method
+func (_m *MockConn) QueryEmptyDevicesByTime(_param0 time.Time) ([]skydb.Device, error) {
+	ret := _m.ctrl.Call(_m, "QueryEmptyDevicesByTime", _param0)
+	ret0, _ := ret[0].([]skydb.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryEmptyDevicesByTime indicates an expected call of QueryEmptyDevicesByTime
+func (_mr *MockConnMockRecorder) QueryEmptyDevicesByTime(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryEmptyDevicesByTime", reflect.TypeOf((*MockConn)(nil).QueryEmptyDevicesByTime), arg0)
+}
+
 // QueryRelation mocks base method
 func (_m *MockConn) QueryRelation(_param0 string, _param1 string, _param2 string, _param3 skydb.QueryConfig) []skydb.AuthInfo {
 	ret := _m.ctrl.Call(_m, "QueryRelation", _param0, _param1, _param2, _param3)
@@ -464,6 +579,18 @@ func (_mr *MockConnMockRecorder) QueryRelationCount(arg0, arg1, arg2 interface{}
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryRelationCount", reflect.TypeOf((*MockConn)(nil).QueryRelationCount), arg0, arg1, arg2)
 }
 
+// RegisterDevice mocks base method
+func (_m *MockConn) RegisterDevice(_param0 *skydb.Device) error {
+	ret := _m.ctrl.Call(_m, "RegisterDevice", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RegisterDevice indicates an expected call of RegisterDevice
+func (_mr *MockConnMockRecorder) RegisterDevice(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RegisterDevice", reflect.TypeOf((*MockConn)(nil).RegisterDevice), arg0)
+}
+
 // RemovePasswordHistory mocks base method
 func (_m *MockConn) RemovePasswordHistory(_param0 string, _param1 int, _param2 int) error {
 	ret := _m.ctrl.Call(_m, "RemovePasswordHistory", _param0, _param1, _param2)
@@ -488,6 +615,19 @@ func (_mr *MockConnMockRecorder) RemoveRelation(arg0, arg1, arg2 interface{}) *g
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveRelation", reflect.TypeOf((*MockConn)(nil).RemoveRelation), arg0, arg1, arg2)
 }
 
+// RemoveRelations mocks base method
+func (_m *MockConn) RemoveRelations(_param0 string, _param1 string, _param2 []string) (int, error) {
+	ret := _m.ctrl.Call(_m, "RemoveRelations", _param0, _param1, _param2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveRelations indicates an expected call of RemoveRelations
+func (_mr *MockConnMockRecorder) RemoveRelations(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveRelations", reflect.TypeOf((*MockConn)(nil).RemoveRelations), arg0, arg1, arg2)
+}
+
 // RevokeRoles mocks base method
 func (_m *MockConn) RevokeRoles(_param0 []string, _param1 []string) error {
 	ret := _m.ctrl.Call(_m, "RevokeRoles", _param0, _param1)
@@ -500,6 +640,18 @@ func (_mr *MockConnMockRecorder) RevokeRoles(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RevokeRoles", reflect.TypeOf((*MockConn)(nil).RevokeRoles), arg0, arg1)
 }
 
+// RunInTransaction mocks base method
+func (_m *MockConn) RunInTransaction(_param0 func(skydb.Conn) error) error {
+	ret := _m.ctrl.Call(_m, "RunInTransaction", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunInTransaction indicates an expected call of RunInTransaction
+func (_mr *MockConnMockRecorder) RunInTransaction(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RunInTransaction", reflect.TypeOf((*MockConn)(nil).RunInTransaction), arg0)
+}
+
 // SaveAsset mocks base method
 func (_m *MockConn) SaveAsset(_param0 *skydb.Asset) error {
 	ret := _m.ctrl.Call(_m, "SaveAsset", _param0)
@@ -7,6 +7,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	skydb "github.com/skygeario/skygear-server/pkg/server/skydb"
 	reflect "reflect"
+	time "time"
 )
 
 // MockDatabase is a mock of Database interface
@@ -32,6 +33,69 @@ func (_m *MockDatabase) EXPECT() *MockDatabaseMockRecorder {
 	return _m.recorder
 }
 
+// AcquireLock mocks base method
+func (_m *MockDatabase) AcquireLock(_param0 skydb.RecordID, _param1 string, _param2 time.Duration) (bool, error) {
+	ret := _m.ctrl.Call(_m, "AcquireLock", _param0, _param1, _param2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireLock indicates an expected call of AcquireLock
+func (_mr *MockDatabaseMockRecorder) AcquireLock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AcquireLock", reflect.TypeOf((*MockDatabase)(nil).AcquireLock), arg0, arg1, arg2)
+}
+
+// AddLabel mocks base method
+func (_m *MockDatabase) AddLabel(_param0 skydb.RecordID, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "AddLabel", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddLabel indicates an expected call of AddLabel
+func (_mr *MockDatabaseMockRecorder) AddLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AddLabel", reflect.TypeOf((*MockDatabase)(nil).AddLabel), arg0, arg1)
+}
+
+// AnalyzeType mocks base method
+func (_m *MockDatabase) AnalyzeType(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "AnalyzeType", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnalyzeType indicates an expected call of AnalyzeType
+func (_mr *MockDatabaseMockRecorder) AnalyzeType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AnalyzeType", reflect.TypeOf((*MockDatabase)(nil).AnalyzeType), arg0)
+}
+
+// CheckSchema mocks base method
+func (_m *MockDatabase) CheckSchema(_param0 map[string]skydb.RecordSchema) ([]skydb.SchemaDiff, error) {
+	ret := _m.ctrl.Call(_m, "CheckSchema", _param0)
+	ret0, _ := ret[0].([]skydb.SchemaDiff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckSchema indicates an expected call of CheckSchema
+func (_mr *MockDatabaseMockRecorder) CheckSchema(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CheckSchema", reflect.TypeOf((*MockDatabase)(nil).CheckSchema), arg0)
+}
+
+// Clone mocks base method
+func (_m *MockDatabase) Clone(_param0 skydb.RecordID, _param1 string, _param2 string) (skydb.Record, error) {
+	ret := _m.ctrl.Call(_m, "Clone", _param0, _param1, _param2)
+	ret0, _ := ret[0].(skydb.Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clone indicates an expected call of Clone
+func (_mr *MockDatabaseMockRecorder) Clone(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Clone", reflect.TypeOf((*MockDatabase)(nil).Clone), arg0, arg1, arg2)
+}
+
 // Conn mocks base method
 func (_m *MockDatabase) Conn() skydb.Conn {
 	ret := _m.ctrl.Call(_m, "Conn")
@@ -44,6 +108,19 @@ func (_mr *MockDatabaseMockRecorder) Conn() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Conn", reflect.TypeOf((*MockDatabase)(nil).Conn))
 }
 
+// CountByReference mocks base method
+func (_m *MockDatabase) CountByReference(_param0 string, _param1 string) (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "CountByReference", _param0, _param1)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountByReference indicates an expected call of CountByReference
+func (_mr *MockDatabaseMockRecorder) CountByReference(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CountByReference", reflect.TypeOf((*MockDatabase)(nil).CountByReference), arg0, arg1)
+}
+
 // DatabaseType mocks base method
 func (_m *MockDatabase) DatabaseType() skydb.DatabaseType {
 	ret := _m.ctrl.Call(_m, "DatabaseType")
@@ -117,6 +194,31 @@ func (_mr *MockDatabaseMockRecorder) Extend(arg0, arg1 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Extend", reflect.TypeOf((*MockDatabase)(nil).Extend), arg0, arg1)
 }
 
+// ExtendMany mocks base method
+func (_m *MockDatabase) ExtendMany(_param0 map[string]skydb.RecordSchema) error {
+	ret := _m.ctrl.Call(_m, "ExtendMany", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendMany indicates an expected call of ExtendMany
+func (_mr *MockDatabaseMockRecorder) ExtendMany(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendMany", reflect.TypeOf((*MockDatabase)(nil).ExtendMany), arg0)
+}
+
+// ExtendWithOptions mocks base method
+func (_m *MockDatabase) ExtendWithOptions(_param0 string, _param1 skydb.RecordSchema, _param2 skydb.ExtendOptions) (bool, error) {
+	ret := _m.ctrl.Call(_m, "ExtendWithOptions", _param0, _param1, _param2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtendWithOptions indicates an expected call of ExtendWithOptions
+func (_mr *MockDatabaseMockRecorder) ExtendWithOptions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendWithOptions", reflect.TypeOf((*MockDatabase)(nil).ExtendWithOptions), arg0, arg1, arg2)
+}
+
 // Get mocks base method
 func (_m *MockDatabase) Get(_param0 skydb.RecordID, _param1 *skydb.Record) error {
 	ret := _m.ctrl.Call(_m, "Get", _param0, _param1)
@@ -129,6 +231,19 @@ func (_mr *MockDatabaseMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Get", reflect.TypeOf((*MockDatabase)(nil).Get), arg0, arg1)
 }
 
+// GetAsOf mocks base method
+func (_m *MockDatabase) GetAsOf(_param0 skydb.RecordID, _param1 time.Time) (skydb.Record, error) {
+	ret := _m.ctrl.Call(_m, "GetAsOf", _param0, _param1)
+	ret0, _ := ret[0].(skydb.Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAsOf indicates an expected call of GetAsOf
+func (_mr *MockDatabaseMockRecorder) GetAsOf(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAsOf", reflect.TypeOf((*MockDatabase)(nil).GetAsOf), arg0, arg1)
+}
+
 // GetByIDs mocks base method
 func (_m *MockDatabase) GetByIDs(_param0 []skydb.RecordID, _param1 *skydb.AccessControlOptions) (*skydb.Rows, error) {
 	ret := _m.ctrl.Call(_m, "GetByIDs", _param0, _param1)
@@ -142,6 +257,19 @@ func (_mr *MockDatabaseMockRecorder) GetByIDs(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetByIDs", reflect.TypeOf((*MockDatabase)(nil).GetByIDs), arg0, arg1)
 }
 
+// GetHistory mocks base method
+func (_m *MockDatabase) GetHistory(_param0 skydb.RecordID) ([]skydb.RecordVersion, error) {
+	ret := _m.ctrl.Call(_m, "GetHistory", _param0)
+	ret0, _ := ret[0].([]skydb.RecordVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory
+func (_mr *MockDatabaseMockRecorder) GetHistory(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetHistory", reflect.TypeOf((*MockDatabase)(nil).GetHistory), arg0)
+}
+
 // GetIndexesByRecordType mocks base method
 func (_m *MockDatabase) GetIndexesByRecordType(_param0 string) (map[string]skydb.Index, error) {
 	ret := _m.ctrl.Call(_m, "GetIndexesByRecordType", _param0)
@@ -167,6 +295,31 @@ func (_mr *MockDatabaseMockRecorder) GetMatchingSubscriptions(arg0 interface{})
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptions", reflect.TypeOf((*MockDatabase)(nil).GetMatchingSubscriptions), arg0)
 }
 
+// GetMatchingSubscriptionsBatch mocks base method
+func (_m *MockDatabase) GetMatchingSubscriptionsBatch(_param0 []*skydb.Record) [][]skydb.Subscription {
+	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptionsBatch", _param0)
+	ret0, _ := ret[0].([][]skydb.Subscription)
+	return ret0
+}
+
+// GetMatchingSubscriptionsBatch indicates an expected call of GetMatchingSubscriptionsBatch
+func (_mr *MockDatabaseMockRecorder) GetMatchingSubscriptionsBatch(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptionsBatch", reflect.TypeOf((*MockDatabase)(nil).GetMatchingSubscriptionsBatch), arg0)
+}
+
+// GetRawField mocks base method
+func (_m *MockDatabase) GetRawField(_param0 skydb.RecordID, _param1 string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetRawField", _param0, _param1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRawField indicates an expected call of GetRawField
+func (_mr *MockDatabaseMockRecorder) GetRawField(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRawField", reflect.TypeOf((*MockDatabase)(nil).GetRawField), arg0, arg1)
+}
+
 // GetRecordSchemas mocks base method
 func (_m *MockDatabase) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
 	ret := _m.ctrl.Call(_m, "GetRecordSchemas")
@@ -205,6 +358,19 @@ func (_mr *MockDatabaseMockRecorder) GetSubscription(arg0, arg1, arg2 interface{
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscription", reflect.TypeOf((*MockDatabase)(nil).GetSubscription), arg0, arg1, arg2)
 }
 
+// GetSubscriptionsByDevice mocks base method
+func (_m *MockDatabase) GetSubscriptionsByDevice(_param0 string) ([]skydb.Subscription, error) {
+	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDevice", _param0)
+	ret0, _ := ret[0].([]skydb.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptionsByDevice indicates an expected call of GetSubscriptionsByDevice
+func (_mr *MockDatabaseMockRecorder) GetSubscriptionsByDevice(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscriptionsByDevice", reflect.TypeOf((*MockDatabase)(nil).GetSubscriptionsByDevice), arg0)
+}
+
 // GetSubscriptionsByDeviceID mocks base method
 func (_m *MockDatabase) GetSubscriptionsByDeviceID(_param0 string) []skydb.Subscription {
 	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDeviceID", _param0)
@@ -241,6 +407,44 @@ func (_mr *MockDatabaseMockRecorder) IsReadOnly() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "IsReadOnly", reflect.TypeOf((*MockDatabase)(nil).IsReadOnly))
 }
 
+// OpenCursor mocks base method
+func (_m *MockDatabase) OpenCursor(_param0 *skydb.Query, _param1 string, _param2 *skydb.AccessControlOptions) (skydb.Cursor, error) {
+	ret := _m.ctrl.Call(_m, "OpenCursor", _param0, _param1, _param2)
+	ret0, _ := ret[0].(skydb.Cursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenCursor indicates an expected call of OpenCursor
+func (_mr *MockDatabaseMockRecorder) OpenCursor(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OpenCursor", reflect.TypeOf((*MockDatabase)(nil).OpenCursor), arg0, arg1, arg2)
+}
+
+// OutgoingReferences mocks base method
+func (_m *MockDatabase) OutgoingReferences(_param0 skydb.RecordID) (map[string]skydb.Reference, error) {
+	ret := _m.ctrl.Call(_m, "OutgoingReferences", _param0)
+	ret0, _ := ret[0].(map[string]skydb.Reference)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OutgoingReferences indicates an expected call of OutgoingReferences
+func (_mr *MockDatabaseMockRecorder) OutgoingReferences(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OutgoingReferences", reflect.TypeOf((*MockDatabase)(nil).OutgoingReferences), arg0)
+}
+
+// Patch mocks base method
+func (_m *MockDatabase) Patch(_param0 skydb.RecordID, _param1 string, _param2 map[string]interface{}) error {
+	ret := _m.ctrl.Call(_m, "Patch", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Patch indicates an expected call of Patch
+func (_mr *MockDatabaseMockRecorder) Patch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Patch", reflect.TypeOf((*MockDatabase)(nil).Patch), arg0, arg1, arg2)
+}
+
 // Query mocks base method
 func (_m *MockDatabase) Query(_param0 *skydb.Query, _param1 *skydb.AccessControlOptions) (*skydb.Rows, error) {
 	ret := _m.ctrl.Call(_m, "Query", _param0, _param1)
@@ -254,6 +458,58 @@ func (_mr *MockDatabaseMockRecorder) Query(arg0, arg1 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Query", reflect.TypeOf((*MockDatabase)(nil).Query), arg0, arg1)
 }
 
+// QueryAfterCursor mocks base method
+func (_m *MockDatabase) QueryAfterCursor(_param0 string, _param1 time.Time, _param2 string, _param3 int, _param4 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryAfterCursor", _param0, _param1, _param2, _param3, _param4)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAfterCursor indicates an expected call of QueryAfterCursor
+func (_mr *MockDatabaseMockRecorder) QueryAfterCursor(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryAfterCursor", reflect.TypeOf((*MockDatabase)(nil).QueryAfterCursor), arg0, arg1, arg2, arg3, arg4)
+}
+
+// QueryByLabel mocks base method
+func (_m *MockDatabase) QueryByLabel(_param0 string, _param1 *skydb.Query, _param2 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByLabel", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByLabel indicates an expected call of QueryByLabel
+func (_mr *MockDatabaseMockRecorder) QueryByLabel(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByLabel", reflect.TypeOf((*MockDatabase)(nil).QueryByLabel), arg0, arg1, arg2)
+}
+
+// QueryByRelation mocks base method
+func (_m *MockDatabase) QueryByRelation(_param0 string, _param1 string, _param2 string, _param3 string, _param4 *skydb.Query, _param5 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByRelation", _param0, _param1, _param2, _param3, _param4, _param5)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByRelation indicates an expected call of QueryByRelation
+func (_mr *MockDatabaseMockRecorder) QueryByRelation(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByRelation", reflect.TypeOf((*MockDatabase)(nil).QueryByRelation), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// QueryByUpdater mocks base method
+func (_m *MockDatabase) QueryByUpdater(_param0 string, _param1 string, _param2 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByUpdater", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByUpdater indicates an expected call of QueryByUpdater
+func (_mr *MockDatabaseMockRecorder) QueryByUpdater(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByUpdater", reflect.TypeOf((*MockDatabase)(nil).QueryByUpdater), arg0, arg1, arg2)
+}
+
 // QueryCount mocks base method
 func (_m *MockDatabase) QueryCount(_param0 *skydb.Query, _param1 *skydb.AccessControlOptions) (uint64, error) {
 	ret := _m.ctrl.Call(_m, "QueryCount", _param0, _param1)
@@ -267,6 +523,57 @@ func (_mr *MockDatabaseMockRecorder) QueryCount(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryCount", reflect.TypeOf((*MockDatabase)(nil).QueryCount), arg0, arg1)
 }
 
+// QueryIDs mocks base method
+func (_m *MockDatabase) QueryIDs(_param0 *skydb.Query, _param1 *skydb.AccessControlOptions) ([]skydb.RecordID, error) {
+	ret := _m.ctrl.Call(_m, "QueryIDs", _param0, _param1)
+	ret0, _ := ret[0].([]skydb.RecordID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryIDs indicates an expected call of QueryIDs
+func (_mr *MockDatabaseMockRecorder) QueryIDs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryIDs", reflect.TypeOf((*MockDatabase)(nil).QueryIDs), arg0, arg1)
+}
+
+// QueryTypes mocks base method
+func (_m *MockDatabase) QueryTypes(_param0 string, _param1 *skydb.Query, _param2 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryTypes", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryTypes indicates an expected call of QueryTypes
+func (_mr *MockDatabaseMockRecorder) QueryTypes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryTypes", reflect.TypeOf((*MockDatabase)(nil).QueryTypes), arg0, arg1, arg2)
+}
+
+// QueryUnion mocks base method
+func (_m *MockDatabase) QueryUnion(_param0 []*skydb.Query, _param1 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryUnion", _param0, _param1)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryUnion indicates an expected call of QueryUnion
+func (_mr *MockDatabaseMockRecorder) QueryUnion(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryUnion", reflect.TypeOf((*MockDatabase)(nil).QueryUnion), arg0, arg1)
+}
+
+// ReleaseLock mocks base method
+func (_m *MockDatabase) ReleaseLock(_param0 skydb.RecordID, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "ReleaseLock", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLock indicates an expected call of ReleaseLock
+func (_mr *MockDatabaseMockRecorder) ReleaseLock(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReleaseLock", reflect.TypeOf((*MockDatabase)(nil).ReleaseLock), arg0, arg1)
+}
+
 // RemoteColumnTypes mocks base method
 func (_m *MockDatabase) RemoteColumnTypes(_param0 string) (skydb.RecordSchema, error) {
 	ret := _m.ctrl.Call(_m, "RemoteColumnTypes", _param0)
@@ -280,6 +587,18 @@ func (_mr *MockDatabaseMockRecorder) RemoteColumnTypes(arg0 interface{}) *gomock
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoteColumnTypes", reflect.TypeOf((*MockDatabase)(nil).RemoteColumnTypes), arg0)
 }
 
+// RemoveLabel mocks base method
+func (_m *MockDatabase) RemoveLabel(_param0 skydb.RecordID, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "RemoveLabel", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveLabel indicates an expected call of RemoveLabel
+func (_mr *MockDatabaseMockRecorder) RemoveLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveLabel", reflect.TypeOf((*MockDatabase)(nil).RemoveLabel), arg0, arg1)
+}
+
 // RenameSchema mocks base method
 func (_m *MockDatabase) RenameSchema(_param0 string, _param1 string, _param2 string) error {
 	ret := _m.ctrl.Call(_m, "RenameSchema", _param0, _param1, _param2)
@@ -304,6 +623,18 @@ func (_mr *MockDatabaseMockRecorder) Save(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Save", reflect.TypeOf((*MockDatabase)(nil).Save), arg0)
 }
 
+// SaveIfUnmodified mocks base method
+func (_m *MockDatabase) SaveIfUnmodified(_param0 *skydb.Record, _param1 time.Time) error {
+	ret := _m.ctrl.Call(_m, "SaveIfUnmodified", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIfUnmodified indicates an expected call of SaveIfUnmodified
+func (_mr *MockDatabaseMockRecorder) SaveIfUnmodified(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveIfUnmodified", reflect.TypeOf((*MockDatabase)(nil).SaveIfUnmodified), arg0, arg1)
+}
+
 // SaveIndex mocks base method
 func (_m *MockDatabase) SaveIndex(_param0 string, _param1 string, _param2 skydb.Index) error {
 	ret := _m.ctrl.Call(_m, "SaveIndex", _param0, _param1, _param2)
@@ -316,6 +647,18 @@ func (_mr *MockDatabaseMockRecorder) SaveIndex(arg0, arg1, arg2 interface{}) *go
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveIndex", reflect.TypeOf((*MockDatabase)(nil).SaveIndex), arg0, arg1, arg2)
 }
 
+// SaveNew mocks base method
+func (_m *MockDatabase) SaveNew(_param0 *skydb.Record) error {
+	ret := _m.ctrl.Call(_m, "SaveNew", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveNew indicates an expected call of SaveNew
+func (_mr *MockDatabaseMockRecorder) SaveNew(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveNew", reflect.TypeOf((*MockDatabase)(nil).SaveNew), arg0)
+}
+
 // SaveSubscription mocks base method
 func (_m *MockDatabase) SaveSubscription(_param0 *skydb.Subscription) error {
 	ret := _m.ctrl.Call(_m, "SaveSubscription", _param0)
@@ -328,6 +671,19 @@ func (_mr *MockDatabaseMockRecorder) SaveSubscription(arg0 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveSubscription", reflect.TypeOf((*MockDatabase)(nil).SaveSubscription), arg0)
 }
 
+// SubscriptionMatchesRecord mocks base method
+func (_m *MockDatabase) SubscriptionMatchesRecord(_param0 string, _param1 *skydb.Record) (bool, error) {
+	ret := _m.ctrl.Call(_m, "SubscriptionMatchesRecord", _param0, _param1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscriptionMatchesRecord indicates an expected call of SubscriptionMatchesRecord
+func (_mr *MockDatabaseMockRecorder) SubscriptionMatchesRecord(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SubscriptionMatchesRecord", reflect.TypeOf((*MockDatabase)(nil).SubscriptionMatchesRecord), arg0, arg1)
+}
+
 // TableName mocks base method
 func (_m *MockDatabase) TableName(_param0 string) string {
 	ret := _m.ctrl.Call(_m, "TableName", _param0)
@@ -340,6 +696,31 @@ func (_mr *MockDatabaseMockRecorder) TableName(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TableName", reflect.TypeOf((*MockDatabase)(nil).TableName), arg0)
 }
 
+// TypeStats mocks base method
+func (_m *MockDatabase) TypeStats() (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "TypeStats")
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TypeStats indicates an expected call of TypeStats
+func (_mr *MockDatabaseMockRecorder) TypeStats() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TypeStats", reflect.TypeOf((*MockDatabase)(nil).TypeStats))
+}
+
+// UpdateSubscription mocks base method
+func (_m *MockDatabase) UpdateSubscription(_param0 *skydb.Subscription) error {
+	ret := _m.ctrl.Call(_m, "UpdateSubscription", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSubscription indicates an expected call of UpdateSubscription
+func (_mr *MockDatabaseMockRecorder) UpdateSubscription(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateSubscription", reflect.TypeOf((*MockDatabase)(nil).UpdateSubscription), arg0)
+}
+
 // UserRecordType mocks base method
 func (_m *MockDatabase) UserRecordType() string {
 	ret := _m.ctrl.Call(_m, "UserRecordType")
@@ -351,3 +732,15 @@ func (_m *MockDatabase) UserRecordType() string {
 func (_mr *MockDatabaseMockRecorder) UserRecordType() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UserRecordType", reflect.TypeOf((*MockDatabase)(nil).UserRecordType))
 }
+
+// VacuumType mocks base method
+func (_m *MockDatabase) VacuumType(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "VacuumType", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VacuumType indicates an expected call of VacuumType
+func (_mr *MockDatabaseMockRecorder) VacuumType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "VacuumType", reflect.TypeOf((*MockDatabase)(nil).VacuumType), arg0)
+}
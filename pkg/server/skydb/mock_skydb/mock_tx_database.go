@@ -7,6 +7,7 @@ import (
 	gomock "github.com/golang/mock/gomock"
 	skydb "github.com/skygeario/skygear-server/pkg/server/skydb"
 	reflect "reflect"
+	time "time"
 )
 
 // MockTxDatabase is a mock of TxDatabase interface
@@ -32,6 +33,43 @@ func (_m *MockTxDatabase) EXPECT() *MockTxDatabaseMockRecorder {
 	return _m.recorder
 }
 
+// AcquireLock mocks base method
+func (_m *MockTxDatabase) AcquireLock(_param0 skydb.RecordID, _param1 string, _param2 time.Duration) (bool, error) {
+	ret := _m.ctrl.Call(_m, "AcquireLock", _param0, _param1, _param2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AcquireLock indicates an expected call of AcquireLock
+func (_mr *MockTxDatabaseMockRecorder) AcquireLock(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AcquireLock", reflect.TypeOf((*MockTxDatabase)(nil).AcquireLock), arg0, arg1, arg2)
+}
+
+// AddLabel mocks base method
+func (_m *MockTxDatabase) AddLabel(_param0 skydb.RecordID, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "AddLabel", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddLabel indicates an expected call of AddLabel
+func (_mr *MockTxDatabaseMockRecorder) AddLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AddLabel", reflect.TypeOf((*MockTxDatabase)(nil).AddLabel), arg0, arg1)
+}
+
+// AnalyzeType mocks base method
+func (_m *MockTxDatabase) AnalyzeType(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "AnalyzeType", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnalyzeType indicates an expected call of AnalyzeType
+func (_mr *MockTxDatabaseMockRecorder) AnalyzeType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "AnalyzeType", reflect.TypeOf((*MockTxDatabase)(nil).AnalyzeType), arg0)
+}
+
 // Begin mocks base method
 func (_m *MockTxDatabase) Begin() error {
 	ret := _m.ctrl.Call(_m, "Begin")
@@ -44,6 +82,32 @@ func (_mr *MockTxDatabaseMockRecorder) Begin() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Begin", reflect.TypeOf((*MockTxDatabase)(nil).Begin))
 }
 
+// CheckSchema mocks base method
+func (_m *MockTxDatabase) CheckSchema(_param0 map[string]skydb.RecordSchema) ([]skydb.SchemaDiff, error) {
+	ret := _m.ctrl.Call(_m, "CheckSchema", _param0)
+	ret0, _ := ret[0].([]skydb.SchemaDiff)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CheckSchema indicates an expected call of CheckSchema
+func (_mr *MockTxDatabaseMockRecorder) CheckSchema(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CheckSchema", reflect.TypeOf((*MockTxDatabase)(nil).CheckSchema), arg0)
+}
+
+// Clone mocks base method
+func (_m *MockTxDatabase) Clone(_param0 skydb.RecordID, _param1 string, _param2 string) (skydb.Record, error) {
+	ret := _m.ctrl.Call(_m, "Clone", _param0, _param1, _param2)
+	ret0, _ := ret[0].(skydb.Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Clone indicates an expected call of Clone
+func (_mr *MockTxDatabaseMockRecorder) Clone(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Clone", reflect.TypeOf((*MockTxDatabase)(nil).Clone), arg0, arg1, arg2)
+}
+
 // Commit mocks base method
 func (_m *MockTxDatabase) Commit() error {
 	ret := _m.ctrl.Call(_m, "Commit")
@@ -68,6 +132,19 @@ func (_mr *MockTxDatabaseMockRecorder) Conn() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Conn", reflect.TypeOf((*MockTxDatabase)(nil).Conn))
 }
 
+// CountByReference mocks base method
+func (_m *MockTxDatabase) CountByReference(_param0 string, _param1 string) (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "CountByReference", _param0, _param1)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountByReference indicates an expected call of CountByReference
+func (_mr *MockTxDatabaseMockRecorder) CountByReference(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "CountByReference", reflect.TypeOf((*MockTxDatabase)(nil).CountByReference), arg0, arg1)
+}
+
 // DatabaseType mocks base method
 func (_m *MockTxDatabase) DatabaseType() skydb.DatabaseType {
 	ret := _m.ctrl.Call(_m, "DatabaseType")
@@ -141,6 +218,31 @@ func (_mr *MockTxDatabaseMockRecorder) Extend(arg0, arg1 interface{}) *gomock.Ca
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Extend", reflect.TypeOf((*MockTxDatabase)(nil).Extend), arg0, arg1)
 }
 
+// ExtendMany mocks base method
+func (_m *MockTxDatabase) ExtendMany(_param0 map[string]skydb.RecordSchema) error {
+	ret := _m.ctrl.Call(_m, "ExtendMany", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExtendMany indicates an expected call of ExtendMany
+func (_mr *MockTxDatabaseMockRecorder) ExtendMany(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendMany", reflect.TypeOf((*MockTxDatabase)(nil).ExtendMany), arg0)
+}
+
+// ExtendWithOptions mocks base method
+func (_m *MockTxDatabase) ExtendWithOptions(_param0 string, _param1 skydb.RecordSchema, _param2 skydb.ExtendOptions) (bool, error) {
+	ret := _m.ctrl.Call(_m, "ExtendWithOptions", _param0, _param1, _param2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ExtendWithOptions indicates an expected call of ExtendWithOptions
+func (_mr *MockTxDatabaseMockRecorder) ExtendWithOptions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ExtendWithOptions", reflect.TypeOf((*MockTxDatabase)(nil).ExtendWithOptions), arg0, arg1, arg2)
+}
+
 // Get mocks base method
 func (_m *MockTxDatabase) Get(_param0 skydb.RecordID, _param1 *skydb.Record) error {
 	ret := _m.ctrl.Call(_m, "Get", _param0, _param1)
@@ -153,6 +255,19 @@ func (_mr *MockTxDatabaseMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Get", reflect.TypeOf((*MockTxDatabase)(nil).Get), arg0, arg1)
 }
 
+// GetAsOf mocks base method
+func (_m *MockTxDatabase) GetAsOf(_param0 skydb.RecordID, _param1 time.Time) (skydb.Record, error) {
+	ret := _m.ctrl.Call(_m, "GetAsOf", _param0, _param1)
+	ret0, _ := ret[0].(skydb.Record)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAsOf indicates an expected call of GetAsOf
+func (_mr *MockTxDatabaseMockRecorder) GetAsOf(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetAsOf", reflect.TypeOf((*MockTxDatabase)(nil).GetAsOf), arg0, arg1)
+}
+
 // GetByIDs mocks base method
 func (_m *MockTxDatabase) GetByIDs(_param0 []skydb.RecordID, _param1 *skydb.AccessControlOptions) (*skydb.Rows, error) {
 	ret := _m.ctrl.Call(_m, "GetByIDs", _param0, _param1)
@@ -166,6 +281,19 @@ func (_mr *MockTxDatabaseMockRecorder) GetByIDs(arg0, arg1 interface{}) *gomock.
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetByIDs", reflect.TypeOf((*MockTxDatabase)(nil).GetByIDs), arg0, arg1)
 }
 
+// GetHistory mocks base method
+func (_m *MockTxDatabase) GetHistory(_param0 skydb.RecordID) ([]skydb.RecordVersion, error) {
+	ret := _m.ctrl.Call(_m, "GetHistory", _param0)
+	ret0, _ := ret[0].([]skydb.RecordVersion)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory
+func (_mr *MockTxDatabaseMockRecorder) GetHistory(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetHistory", reflect.TypeOf((*MockTxDatabase)(nil).GetHistory), arg0)
+}
+
 // GetIndexesByRecordType mocks base method
 func (_m *MockTxDatabase) GetIndexesByRecordType(_param0 string) (map[string]skydb.Index, error) {
 	ret := _m.ctrl.Call(_m, "GetIndexesByRecordType", _param0)
@@ -191,6 +319,31 @@ func (_mr *MockTxDatabaseMockRecorder) GetMatchingSubscriptions(arg0 interface{}
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptions", reflect.TypeOf((*MockTxDatabase)(nil).GetMatchingSubscriptions), arg0)
 }
 
+// GetMatchingSubscriptionsBatch mocks base method
+func (_m *MockTxDatabase) GetMatchingSubscriptionsBatch(_param0 []*skydb.Record) [][]skydb.Subscription {
+	ret := _m.ctrl.Call(_m, "GetMatchingSubscriptionsBatch", _param0)
+	ret0, _ := ret[0].([][]skydb.Subscription)
+	return ret0
+}
+
+// GetMatchingSubscriptionsBatch indicates an expected call of GetMatchingSubscriptionsBatch
+func (_mr *MockTxDatabaseMockRecorder) GetMatchingSubscriptionsBatch(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetMatchingSubscriptionsBatch", reflect.TypeOf((*MockTxDatabase)(nil).GetMatchingSubscriptionsBatch), arg0)
+}
+
+// GetRawField mocks base method
+func (_m *MockTxDatabase) GetRawField(_param0 skydb.RecordID, _param1 string) ([]byte, error) {
+	ret := _m.ctrl.Call(_m, "GetRawField", _param0, _param1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRawField indicates an expected call of GetRawField
+func (_mr *MockTxDatabaseMockRecorder) GetRawField(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetRawField", reflect.TypeOf((*MockTxDatabase)(nil).GetRawField), arg0, arg1)
+}
+
 // GetRecordSchemas mocks base method
 func (_m *MockTxDatabase) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
 	ret := _m.ctrl.Call(_m, "GetRecordSchemas")
@@ -229,6 +382,19 @@ func (_mr *MockTxDatabaseMockRecorder) GetSubscription(arg0, arg1, arg2 interfac
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscription", reflect.TypeOf((*MockTxDatabase)(nil).GetSubscription), arg0, arg1, arg2)
 }
 
+// GetSubscriptionsByDevice mocks base method
+func (_m *MockTxDatabase) GetSubscriptionsByDevice(_param0 string) ([]skydb.Subscription, error) {
+	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDevice", _param0)
+	ret0, _ := ret[0].([]skydb.Subscription)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSubscriptionsByDevice indicates an expected call of GetSubscriptionsByDevice
+func (_mr *MockTxDatabaseMockRecorder) GetSubscriptionsByDevice(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "GetSubscriptionsByDevice", reflect.TypeOf((*MockTxDatabase)(nil).GetSubscriptionsByDevice), arg0)
+}
+
 // GetSubscriptionsByDeviceID mocks base method
 func (_m *MockTxDatabase) GetSubscriptionsByDeviceID(_param0 string) []skydb.Subscription {
 	ret := _m.ctrl.Call(_m, "GetSubscriptionsByDeviceID", _param0)
@@ -265,6 +431,44 @@ func (_mr *MockTxDatabaseMockRecorder) IsReadOnly() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "IsReadOnly", reflect.TypeOf((*MockTxDatabase)(nil).IsReadOnly))
 }
 
+// OpenCursor mocks base method
+func (_m *MockTxDatabase) OpenCursor(_param0 *skydb.Query, _param1 string, _param2 *skydb.AccessControlOptions) (skydb.Cursor, error) {
+	ret := _m.ctrl.Call(_m, "OpenCursor", _param0, _param1, _param2)
+	ret0, _ := ret[0].(skydb.Cursor)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenCursor indicates an expected call of OpenCursor
+func (_mr *MockTxDatabaseMockRecorder) OpenCursor(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OpenCursor", reflect.TypeOf((*MockTxDatabase)(nil).OpenCursor), arg0, arg1, arg2)
+}
+
+// OutgoingReferences mocks base method
+func (_m *MockTxDatabase) OutgoingReferences(_param0 skydb.RecordID) (map[string]skydb.Reference, error) {
+	ret := _m.ctrl.Call(_m, "OutgoingReferences", _param0)
+	ret0, _ := ret[0].(map[string]skydb.Reference)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OutgoingReferences indicates an expected call of OutgoingReferences
+func (_mr *MockTxDatabaseMockRecorder) OutgoingReferences(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "OutgoingReferences", reflect.TypeOf((*MockTxDatabase)(nil).OutgoingReferences), arg0)
+}
+
+// Patch mocks base method
+func (_m *MockTxDatabase) Patch(_param0 skydb.RecordID, _param1 string, _param2 map[string]interface{}) error {
+	ret := _m.ctrl.Call(_m, "Patch", _param0, _param1, _param2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Patch indicates an expected call of Patch
+func (_mr *MockTxDatabaseMockRecorder) Patch(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Patch", reflect.TypeOf((*MockTxDatabase)(nil).Patch), arg0, arg1, arg2)
+}
+
 // Query mocks base method
 func (_m *MockTxDatabase) Query(_param0 *skydb.Query, _param1 *skydb.AccessControlOptions) (*skydb.Rows, error) {
 	ret := _m.ctrl.Call(_m, "Query", _param0, _param1)
@@ -278,6 +482,58 @@ func (_mr *MockTxDatabaseMockRecorder) Query(arg0, arg1 interface{}) *gomock.Cal
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Query", reflect.TypeOf((*MockTxDatabase)(nil).Query), arg0, arg1)
 }
 
+// QueryAfterCursor mocks base method
+func (_m *MockTxDatabase) QueryAfterCursor(_param0 string, _param1 time.Time, _param2 string, _param3 int, _param4 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryAfterCursor", _param0, _param1, _param2, _param3, _param4)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryAfterCursor indicates an expected call of QueryAfterCursor
+func (_mr *MockTxDatabaseMockRecorder) QueryAfterCursor(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryAfterCursor", reflect.TypeOf((*MockTxDatabase)(nil).QueryAfterCursor), arg0, arg1, arg2, arg3, arg4)
+}
+
+// QueryByLabel mocks base method
+func (_m *MockTxDatabase) QueryByLabel(_param0 string, _param1 *skydb.Query, _param2 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByLabel", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByLabel indicates an expected call of QueryByLabel
+func (_mr *MockTxDatabaseMockRecorder) QueryByLabel(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByLabel", reflect.TypeOf((*MockTxDatabase)(nil).QueryByLabel), arg0, arg1, arg2)
+}
+
+// QueryByRelation mocks base method
+func (_m *MockTxDatabase) QueryByRelation(_param0 string, _param1 string, _param2 string, _param3 string, _param4 *skydb.Query, _param5 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByRelation", _param0, _param1, _param2, _param3, _param4, _param5)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByRelation indicates an expected call of QueryByRelation
+func (_mr *MockTxDatabaseMockRecorder) QueryByRelation(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByRelation", reflect.TypeOf((*MockTxDatabase)(nil).QueryByRelation), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
+// QueryByUpdater mocks base method
+func (_m *MockTxDatabase) QueryByUpdater(_param0 string, _param1 string, _param2 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryByUpdater", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryByUpdater indicates an expected call of QueryByUpdater
+func (_mr *MockTxDatabaseMockRecorder) QueryByUpdater(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryByUpdater", reflect.TypeOf((*MockTxDatabase)(nil).QueryByUpdater), arg0, arg1, arg2)
+}
+
 // QueryCount mocks base method
 func (_m *MockTxDatabase) QueryCount(_param0 *skydb.Query, _param1 *skydb.AccessControlOptions) (uint64, error) {
 	ret := _m.ctrl.Call(_m, "QueryCount", _param0, _param1)
@@ -291,6 +547,57 @@ func (_mr *MockTxDatabaseMockRecorder) QueryCount(arg0, arg1 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryCount", reflect.TypeOf((*MockTxDatabase)(nil).QueryCount), arg0, arg1)
 }
 
+// QueryIDs mocks base method
+func (_m *MockTxDatabase) QueryIDs(_param0 *skydb.Query, _param1 *skydb.AccessControlOptions) ([]skydb.RecordID, error) {
+	ret := _m.ctrl.Call(_m, "QueryIDs", _param0, _param1)
+	ret0, _ := ret[0].([]skydb.RecordID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryIDs indicates an expected call of QueryIDs
+func (_mr *MockTxDatabaseMockRecorder) QueryIDs(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryIDs", reflect.TypeOf((*MockTxDatabase)(nil).QueryIDs), arg0, arg1)
+}
+
+// QueryTypes mocks base method
+func (_m *MockTxDatabase) QueryTypes(_param0 string, _param1 *skydb.Query, _param2 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryTypes", _param0, _param1, _param2)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryTypes indicates an expected call of QueryTypes
+func (_mr *MockTxDatabaseMockRecorder) QueryTypes(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryTypes", reflect.TypeOf((*MockTxDatabase)(nil).QueryTypes), arg0, arg1, arg2)
+}
+
+// QueryUnion mocks base method
+func (_m *MockTxDatabase) QueryUnion(_param0 []*skydb.Query, _param1 *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	ret := _m.ctrl.Call(_m, "QueryUnion", _param0, _param1)
+	ret0, _ := ret[0].(*skydb.Rows)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QueryUnion indicates an expected call of QueryUnion
+func (_mr *MockTxDatabaseMockRecorder) QueryUnion(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "QueryUnion", reflect.TypeOf((*MockTxDatabase)(nil).QueryUnion), arg0, arg1)
+}
+
+// ReleaseLock mocks base method
+func (_m *MockTxDatabase) ReleaseLock(_param0 skydb.RecordID, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "ReleaseLock", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseLock indicates an expected call of ReleaseLock
+func (_mr *MockTxDatabaseMockRecorder) ReleaseLock(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "ReleaseLock", reflect.TypeOf((*MockTxDatabase)(nil).ReleaseLock), arg0, arg1)
+}
+
 // RemoteColumnTypes mocks base method
 func (_m *MockTxDatabase) RemoteColumnTypes(_param0 string) (skydb.RecordSchema, error) {
 	ret := _m.ctrl.Call(_m, "RemoteColumnTypes", _param0)
@@ -304,6 +611,18 @@ func (_mr *MockTxDatabaseMockRecorder) RemoteColumnTypes(arg0 interface{}) *gomo
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoteColumnTypes", reflect.TypeOf((*MockTxDatabase)(nil).RemoteColumnTypes), arg0)
 }
 
+// RemoveLabel mocks base method
+func (_m *MockTxDatabase) RemoveLabel(_param0 skydb.RecordID, _param1 string) error {
+	ret := _m.ctrl.Call(_m, "RemoveLabel", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveLabel indicates an expected call of RemoveLabel
+func (_mr *MockTxDatabaseMockRecorder) RemoveLabel(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RemoveLabel", reflect.TypeOf((*MockTxDatabase)(nil).RemoveLabel), arg0, arg1)
+}
+
 // RenameSchema mocks base method
 func (_m *MockTxDatabase) RenameSchema(_param0 string, _param1 string, _param2 string) error {
 	ret := _m.ctrl.Call(_m, "RenameSchema", _param0, _param1, _param2)
@@ -328,6 +647,18 @@ func (_mr *MockTxDatabaseMockRecorder) Rollback() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Rollback", reflect.TypeOf((*MockTxDatabase)(nil).Rollback))
 }
 
+// RollbackTo mocks base method
+func (_m *MockTxDatabase) RollbackTo(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "RollbackTo", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RollbackTo indicates an expected call of RollbackTo
+func (_mr *MockTxDatabaseMockRecorder) RollbackTo(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "RollbackTo", reflect.TypeOf((*MockTxDatabase)(nil).RollbackTo), arg0)
+}
+
 // Save mocks base method
 func (_m *MockTxDatabase) Save(_param0 *skydb.Record) error {
 	ret := _m.ctrl.Call(_m, "Save", _param0)
@@ -340,6 +671,18 @@ func (_mr *MockTxDatabaseMockRecorder) Save(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Save", reflect.TypeOf((*MockTxDatabase)(nil).Save), arg0)
 }
 
+// SaveIfUnmodified mocks base method
+func (_m *MockTxDatabase) SaveIfUnmodified(_param0 *skydb.Record, _param1 time.Time) error {
+	ret := _m.ctrl.Call(_m, "SaveIfUnmodified", _param0, _param1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIfUnmodified indicates an expected call of SaveIfUnmodified
+func (_mr *MockTxDatabaseMockRecorder) SaveIfUnmodified(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveIfUnmodified", reflect.TypeOf((*MockTxDatabase)(nil).SaveIfUnmodified), arg0, arg1)
+}
+
 // SaveIndex mocks base method
 func (_m *MockTxDatabase) SaveIndex(_param0 string, _param1 string, _param2 skydb.Index) error {
 	ret := _m.ctrl.Call(_m, "SaveIndex", _param0, _param1, _param2)
@@ -352,6 +695,18 @@ func (_mr *MockTxDatabaseMockRecorder) SaveIndex(arg0, arg1, arg2 interface{}) *
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveIndex", reflect.TypeOf((*MockTxDatabase)(nil).SaveIndex), arg0, arg1, arg2)
 }
 
+// SaveNew mocks base method
+func (_m *MockTxDatabase) SaveNew(_param0 *skydb.Record) error {
+	ret := _m.ctrl.Call(_m, "SaveNew", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveNew indicates an expected call of SaveNew
+func (_mr *MockTxDatabaseMockRecorder) SaveNew(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveNew", reflect.TypeOf((*MockTxDatabase)(nil).SaveNew), arg0)
+}
+
 // SaveSubscription mocks base method
 func (_m *MockTxDatabase) SaveSubscription(_param0 *skydb.Subscription) error {
 	ret := _m.ctrl.Call(_m, "SaveSubscription", _param0)
@@ -364,6 +719,31 @@ func (_mr *MockTxDatabaseMockRecorder) SaveSubscription(arg0 interface{}) *gomoc
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SaveSubscription", reflect.TypeOf((*MockTxDatabase)(nil).SaveSubscription), arg0)
 }
 
+// Savepoint mocks base method
+func (_m *MockTxDatabase) Savepoint(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "Savepoint", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Savepoint indicates an expected call of Savepoint
+func (_mr *MockTxDatabaseMockRecorder) Savepoint(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "Savepoint", reflect.TypeOf((*MockTxDatabase)(nil).Savepoint), arg0)
+}
+
+// SubscriptionMatchesRecord mocks base method
+func (_m *MockTxDatabase) SubscriptionMatchesRecord(_param0 string, _param1 *skydb.Record) (bool, error) {
+	ret := _m.ctrl.Call(_m, "SubscriptionMatchesRecord", _param0, _param1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SubscriptionMatchesRecord indicates an expected call of SubscriptionMatchesRecord
+func (_mr *MockTxDatabaseMockRecorder) SubscriptionMatchesRecord(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "SubscriptionMatchesRecord", reflect.TypeOf((*MockTxDatabase)(nil).SubscriptionMatchesRecord), arg0, arg1)
+}
+
 // TableName mocks base method
 func (_m *MockTxDatabase) TableName(_param0 string) string {
 	ret := _m.ctrl.Call(_m, "TableName", _param0)
@@ -376,6 +756,31 @@ func (_mr *MockTxDatabaseMockRecorder) TableName(arg0 interface{}) *gomock.Call
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TableName", reflect.TypeOf((*MockTxDatabase)(nil).TableName), arg0)
 }
 
+// TypeStats mocks base method
+func (_m *MockTxDatabase) TypeStats() (map[string]int64, error) {
+	ret := _m.ctrl.Call(_m, "TypeStats")
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TypeStats indicates an expected call of TypeStats
+func (_mr *MockTxDatabaseMockRecorder) TypeStats() *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "TypeStats", reflect.TypeOf((*MockTxDatabase)(nil).TypeStats))
+}
+
+// UpdateSubscription mocks base method
+func (_m *MockTxDatabase) UpdateSubscription(_param0 *skydb.Subscription) error {
+	ret := _m.ctrl.Call(_m, "UpdateSubscription", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateSubscription indicates an expected call of UpdateSubscription
+func (_mr *MockTxDatabaseMockRecorder) UpdateSubscription(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UpdateSubscription", reflect.TypeOf((*MockTxDatabase)(nil).UpdateSubscription), arg0)
+}
+
 // UserRecordType mocks base method
 func (_m *MockTxDatabase) UserRecordType() string {
 	ret := _m.ctrl.Call(_m, "UserRecordType")
@@ -387,3 +792,15 @@ func (_m *MockTxDatabase) UserRecordType() string {
 func (_mr *MockTxDatabaseMockRecorder) UserRecordType() *gomock.Call {
 	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "UserRecordType", reflect.TypeOf((*MockTxDatabase)(nil).UserRecordType))
 }
+
+// VacuumType mocks base method
+func (_m *MockTxDatabase) VacuumType(_param0 string) error {
+	ret := _m.ctrl.Call(_m, "VacuumType", _param0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VacuumType indicates an expected call of VacuumType
+func (_mr *MockTxDatabaseMockRecorder) VacuumType(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCallWithMethodType(_mr.mock, "VacuumType", reflect.TypeOf((*MockTxDatabase)(nil).VacuumType), arg0)
+}
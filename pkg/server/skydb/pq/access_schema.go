@@ -193,31 +193,45 @@ func (c *conn) SetRecordFieldAccess(acl skydb.FieldACL) (err error) {
 		return
 	}
 
-	builder := psql.
-		Insert(c.tableName("_record_field_access")).
-		Columns(
-			"record_type",
-			"record_field",
-			"user_role",
-			"writable",
-			"readable",
-			"comparable",
-			"discoverable",
-		)
-
-	for _, entry := range allEntries {
-		builder = builder.Values(
-			entry.RecordType,
-			entry.RecordField,
-			entry.UserRole.String(),
-			entry.Writable,
-			entry.Readable,
-			entry.Comparable,
-			entry.Discoverable,
-		)
+	columns := []string{
+		"record_type",
+		"record_field",
+		"user_role",
+		"writable",
+		"readable",
+		"comparable",
+		"discoverable",
 	}
 
-	_, err = c.ExecWith(builder)
+	// Insert in batches so that each statement is within the limit of
+	// bind parameters.
+	batchSize := builder.MaxBindParameters / len(columns)
+	for start := 0; start < len(allEntries); start += batchSize {
+		end := start + batchSize
+		if end > len(allEntries) {
+			end = len(allEntries)
+		}
+
+		insertBuilder := psql.
+			Insert(c.tableName("_record_field_access")).
+			Columns(columns...)
+
+		for _, entry := range allEntries[start:end] {
+			insertBuilder = insertBuilder.Values(
+				entry.RecordType,
+				entry.RecordField,
+				entry.UserRole.String(),
+				entry.Writable,
+				entry.Readable,
+				entry.Comparable,
+				entry.Discoverable,
+			)
+		}
+
+		if _, err = c.ExecWith(insertBuilder); err != nil {
+			return
+		}
+	}
 	return
 }
 
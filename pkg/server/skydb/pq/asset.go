@@ -16,8 +16,10 @@ package pq
 
 import (
 	"errors"
+	"fmt"
 
 	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
@@ -45,7 +47,7 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 		nameArgs[idx] = interface{}(perName)
 	}
 
-	builder := psql.Select("id", "content_type", "size").
+	builder := psql.Select("id", "content_type", "size", "variants").
 		From(c.tableName("_asset")).
 		Where("id IN ("+sq.Placeholders(len(names))+")", nameArgs...)
 
@@ -58,13 +60,16 @@ func (c *conn) GetAssets(names []string) ([]skydb.Asset, error) {
 	results := []skydb.Asset{}
 	for rows.Next() {
 		a := skydb.Asset{}
+		var variants nullAssetVariants
 		if err := rows.Scan(
 			&a.Name,
 			&a.ContentType,
-			&a.Size); err != nil {
+			&a.Size,
+			&variants); err != nil {
 
 			panic(err)
 		}
+		a.Variants = variants.Variants
 		results = append(results, a)
 	}
 
@@ -78,8 +83,44 @@ func (c *conn) SaveAsset(asset *skydb.Asset) error {
 	data := map[string]interface{}{
 		"content_type": asset.ContentType,
 		"size":         asset.Size,
+		"variants":     assetVariantsValue(asset.Variants),
 	}
 	upsert := builder.UpsertQuery(c.tableName("_asset"), pkData, data)
 	_, err := c.ExecWith(upsert)
 	return err
 }
+
+func (c *conn) DeleteOrphanedAssets() (int, error) {
+	schemas, err := c.PublicDB().GetRecordSchemas()
+	if err != nil {
+		return 0, err
+	}
+
+	builder := psql.Delete(c.tableName("_asset"))
+	for recordType, schema := range schemas {
+		for column, fieldType := range schema {
+			var associated string
+			switch fieldType.Type {
+			case skydb.TypeAsset:
+				associated = fmt.Sprintf("%s = _asset.id", pq.QuoteIdentifier(column))
+			case skydb.TypeAssetList:
+				associated = fmt.Sprintf("_asset.id = ANY(%s)", pq.QuoteIdentifier(column))
+			default:
+				continue
+			}
+			builder = builder.Where(fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s WHERE %s)",
+				c.tableName(recordType), associated))
+		}
+	}
+
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
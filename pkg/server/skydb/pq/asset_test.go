@@ -0,0 +1,133 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAsset(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		Convey("saves and gets asset", func() {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        "picture.png",
+				ContentType: "image/png",
+				Size:        100,
+			}), ShouldBeNil)
+
+			var asset skydb.Asset
+			So(c.GetAsset("picture.png", &asset), ShouldBeNil)
+			So(asset, ShouldResemble, skydb.Asset{
+				Name:        "picture.png",
+				ContentType: "image/png",
+				Size:        100,
+			})
+		})
+
+		Convey("saves and gets asset with variants", func() {
+			variants := map[string]skydb.AssetVariant{
+				"thumbnail": skydb.AssetVariant{
+					Name:        "picture-thumbnail.png",
+					ContentType: "image/png",
+					Size:        10,
+				},
+				"medium": skydb.AssetVariant{
+					Name:        "picture-medium.jpg",
+					ContentType: "image/jpeg",
+					Size:        50,
+				},
+			}
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        "picture.png",
+				ContentType: "image/png",
+				Size:        100,
+				Variants:    variants,
+			}), ShouldBeNil)
+
+			assets, err := c.GetAssets([]string{"picture.png"})
+			So(err, ShouldBeNil)
+			So(assets, ShouldResemble, []skydb.Asset{
+				{
+					Name:        "picture.png",
+					ContentType: "image/png",
+					Size:        100,
+					Variants:    variants,
+				},
+			})
+		})
+
+		Convey("removes variants when saved without variants", func() {
+			So(c.SaveAsset(&skydb.Asset{
+				Name: "picture.png",
+				Variants: map[string]skydb.AssetVariant{
+					"thumbnail": skydb.AssetVariant{Name: "picture-thumbnail.png"},
+				},
+			}), ShouldBeNil)
+			So(c.SaveAsset(&skydb.Asset{
+				Name: "picture.png",
+			}), ShouldBeNil)
+
+			var asset skydb.Asset
+			So(c.GetAsset("picture.png", &asset), ShouldBeNil)
+			So(asset.Variants, ShouldBeNil)
+		})
+
+		Convey("deletes orphaned assets", func() {
+			for _, name := range []string{"cover.png", "page1.png", "orphan1.png", "orphan2.png"} {
+				So(c.SaveAsset(&skydb.Asset{
+					Name:        name,
+					ContentType: "image/png",
+					Size:        100,
+				}), ShouldBeNil)
+			}
+
+			db := c.PublicDB()
+			_, err := db.Extend("note", skydb.RecordSchema{
+				"cover": skydb.FieldType{Type: skydb.TypeAsset},
+				"pages": skydb.FieldType{Type: skydb.TypeAssetList},
+			})
+			So(err, ShouldBeNil)
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("note", "id1"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"cover": &skydb.Asset{Name: "cover.png"},
+					"pages": []*skydb.Asset{{Name: "page1.png"}},
+				},
+			}), ShouldBeNil)
+
+			count, err := c.DeleteOrphanedAssets()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+
+			assets, err := c.GetAssets([]string{"cover.png", "page1.png", "orphan1.png", "orphan2.png"})
+			So(err, ShouldBeNil)
+			So(len(assets), ShouldEqual, 2)
+			names := []string{assets[0].Name, assets[1].Name}
+			So(names, ShouldContain, "cover.png")
+			So(names, ShouldContain, "page1.png")
+
+			count, err = c.DeleteOrphanedAssets()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
@@ -18,9 +18,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
 // expressionSqlizer generates an SQL expression from a skydb.Expression. A SQL
@@ -50,6 +53,11 @@ type expressionSqlizer struct {
 	// available, the field type may be empty.
 	fieldType skydb.FieldType
 
+	// jsonPath is the path within a JSON field of a key path expression
+	// whose key path continues into the JSON field. The value at the
+	// path is extracted as text.
+	jsonPath []string
+
 	skydb.Expression
 }
 
@@ -67,6 +75,7 @@ func newExpressionSqlizer(alias string, fieldType skydb.FieldType, expr skydb.Ex
 		alias,
 		requireCast,
 		fieldType,
+		nil,
 		expr,
 	}
 }
@@ -75,6 +84,13 @@ func (expr expressionSqlizer) ToSql() (sql string, args []interface{}, err error
 	switch expr.Type {
 	case skydb.KeyPath:
 		components := expr.KeyPathComponents()
+		if len(expr.jsonPath) > 0 {
+			column := components[len(components)-len(expr.jsonPath)-1]
+			sql = fmt.Sprintf("(%s #>> ?::text[])", fullQuoteIdentifier(expr.alias, column))
+			args = []interface{}{pq.Array(expr.jsonPath)}
+			return
+		}
+
 		lastComponent := components[len(components)-1]
 		sql = fullQuoteIdentifier(expr.alias, lastComponent)
 		args = []interface{}{}
@@ -119,11 +135,204 @@ func funcToSQLOperand(alias string, fun skydb.Func) (string, []interface{}) {
 		}
 		args := []interface{}{}
 		return sql, args
+	case lengthFunc:
+		column := fullQuoteIdentifier(alias, f.Field)
+		var sql string
+		if f.fieldType == skydb.TypeJSON {
+			// jsonb_array_length raises an error for scalars and objects,
+			// which have no length anyway.
+			sql = fmt.Sprintf("(CASE WHEN jsonb_typeof(%s) = 'array' THEN jsonb_array_length(%s) END)",
+				column, column)
+		} else {
+			sql = fmt.Sprintf("length(%s)", column)
+		}
+		return sql, []interface{}{}
+	case skydb.LowerFunc:
+		sql := fmt.Sprintf("lower(%s)", fullQuoteIdentifier(alias, f.Field))
+		return sql, []interface{}{}
+	case skydb.UpperFunc:
+		sql := fmt.Sprintf("upper(%s)", fullQuoteIdentifier(alias, f.Field))
+		return sql, []interface{}{}
+	case skydb.DateTruncFunc:
+		// Unit is written inline because it is restricted to a fixed
+		// set of values by ResolveFuncExpression.
+		sql := fmt.Sprintf("date_trunc('%s', %s)", f.Unit, fullQuoteIdentifier(alias, f.Field))
+		return sql, []interface{}{}
+	case skydb.GeohashFunc:
+		sql := fmt.Sprintf("ST_GeoHash(%s, ?)", fullQuoteIdentifier(alias, f.Field))
+		return sql, []interface{}{f.Precision}
+	case skydb.FullTextMatchFunc:
+		sql := fmt.Sprintf("ts_rank(%s, plainto_tsquery(%s, ?))",
+			fullTextDocumentSQL(alias, f.Fields), fullTextConfig)
+		return sql, []interface{}{f.Query}
 	default:
 		panic(fmt.Errorf("got unrecgonized skydb.Func = %T", fun))
 	}
 }
 
+// lengthFunc is a skydb.LengthFunc with the type of its field looked up,
+// because the SQL function computing the length depends on it.
+type lengthFunc struct {
+	skydb.LengthFunc
+	fieldType skydb.DataType
+}
+
+// ResolveFuncExpression returns the expression with its function prepared
+// for generating SQL, looking up types of referenced fields in schema.
+// Expressions that are not functions are returned unchanged.
+func ResolveFuncExpression(expr skydb.Expression, schema skydb.RecordSchema) (skydb.Expression, error) {
+	if expr.Type != skydb.Function {
+		return expr, nil
+	}
+
+	switch f := expr.Value.(type) {
+	case skydb.LengthFunc:
+		fieldType, err := lookupFuncFieldType(schema, f.Field)
+		if err != nil {
+			return expr, err
+		}
+		if fieldType.Type != skydb.TypeString && fieldType.Type != skydb.TypeJSON {
+			return expr, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`cannot compute length of field "%s" of type %v`, f.Field, fieldType.Type)
+		}
+		expr.Value = lengthFunc{f, fieldType.Type}
+	case skydb.LowerFunc:
+		if err := checkStringFuncField(schema, "lower", f.Field); err != nil {
+			return expr, err
+		}
+	case skydb.UpperFunc:
+		if err := checkStringFuncField(schema, "upper", f.Field); err != nil {
+			return expr, err
+		}
+	case skydb.DateTruncFunc:
+		fieldType, err := lookupFuncFieldType(schema, f.Field)
+		if err != nil {
+			return expr, err
+		}
+		if fieldType.Type != skydb.TypeDateTime && fieldType.Type != skydb.TypeDateTimeTZ {
+			return expr, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`cannot truncate field "%s" of type %v`, f.Field, fieldType.Type)
+		}
+		switch f.Unit {
+		case "day", "week", "month":
+		default:
+			return expr, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`unsupported unit "%s" for truncating datetime`, f.Unit)
+		}
+	case skydb.GeohashFunc:
+		fieldType, err := lookupFuncFieldType(schema, f.Field)
+		if err != nil {
+			return expr, err
+		}
+		if fieldType.Type != skydb.TypeLocation {
+			return expr, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`cannot compute geohash of field "%s" of type %v`, f.Field, fieldType.Type)
+		}
+		if f.Precision < 1 || f.Precision > maxGeohashPrecision {
+			return expr, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`geohash precision must be between 1 and %d`, maxGeohashPrecision)
+		}
+	case skydb.FullTextMatchFunc:
+		if len(f.Fields) == 0 {
+			return expr, skyerr.NewError(skyerr.RecordQueryInvalid,
+				`full text match must specify at least one field`)
+		}
+		for _, field := range f.Fields {
+			if err := checkStringFuncField(schema, "full text match", field); err != nil {
+				return expr, err
+			}
+		}
+	}
+	return expr, nil
+}
+
+// fullTextConfig is the text search configuration used by
+// FullTextMatchFunc. The simple configuration does not stem words nor
+// drop stop words, so it behaves the same regardless of language.
+const fullTextConfig = "'simple'"
+
+// fullTextDocumentSQL returns SQL of the tsvector searched by
+// FullTextMatchFunc, which concatenates all the searched fields.
+func fullTextDocumentSQL(alias string, fields []string) string {
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = fmt.Sprintf("coalesce(%s, '')", fullQuoteIdentifier(alias, field))
+	}
+	return fmt.Sprintf("to_tsvector(%s, %s)", fullTextConfig, strings.Join(columns, " || ' ' || "))
+}
+
+// maxGeohashPrecision is the longest geohash computed by GeohashFunc. A
+// geohash of 12 characters already locates a point within centimetres.
+const maxGeohashPrecision = 12
+
+func lookupFuncFieldType(schema skydb.RecordSchema, field string) (skydb.FieldType, error) {
+	fieldType, ok := schema[field]
+	if !ok {
+		return fieldType, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`keypath "%s" does not exist`, field)
+	}
+	return fieldType, nil
+}
+
+func checkStringFuncField(schema skydb.RecordSchema, funcName string, field string) error {
+	fieldType, err := lookupFuncFieldType(schema, field)
+	if err != nil {
+		return err
+	}
+	if fieldType.Type != skydb.TypeString {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`cannot apply %s to field "%s" of type %v`, funcName, field, fieldType.Type)
+	}
+	return nil
+}
+
+// MaxBindParameters is the maximum number of bind parameters PostgreSQL
+// accepts in a single statement.
+const MaxBindParameters = 65535
+
+// maxInListPlaceholders is the longest list rendered with one placeholder
+// per element by InToSQL. Longer lists are bound as a single array so that
+// the statement stays well under MaxBindParameters.
+const maxInListPlaceholders = 1000
+
+// InToSQL generates SQL testing whether the operand is a member of the
+// list.
+//
+// A list of strings is always bound as a single array, so that the
+// statement is the same regardless of the length of the list. The array
+// is left untyped for PostgreSQL to infer from the operand, so that
+// members are compared as citext or enum values for such columns.
+func InToSQL(operand string, list []interface{}) (string, []interface{}) {
+	if strs, ok := stringList(list); ok {
+		return operand + " = ANY(" + sq.Placeholders(1) + ")", []interface{}{pq.StringArray(strs)}
+	}
+
+	if len(list) <= maxInListPlaceholders {
+		listSQL, args := LiteralToSQLOperand(list)
+		return operand + " IN " + listSQL, args
+	}
+
+	values := make([]interface{}, len(list))
+	for i, val := range list {
+		values[i] = literalToSQLValue(val)
+	}
+	return operand + " = ANY(" + sq.Placeholders(1) + ")", []interface{}{pq.Array(values)}
+}
+
+// stringList returns the SQL values of the list as strings if all of
+// them are strings.
+func stringList(list []interface{}) ([]string, bool) {
+	strs := make([]string, len(list))
+	for i, val := range list {
+		str, ok := literalToSQLValue(val).(string)
+		if !ok {
+			return nil, false
+		}
+		strs[i] = str
+	}
+	return strs, true
+}
+
 func LiteralToSQLOperand(literal interface{}) (string, []interface{}) {
 	// Array detection is borrowed from squirrel's expr.go
 	switch literalValue := literal.(type) {
@@ -16,6 +16,8 @@ package builder
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 
 	sq "github.com/lann/squirrel"
 	"github.com/lib/pq"
@@ -26,6 +28,7 @@ import (
 type PredicateSqlizerFactory interface {
 	UpdateTypemap(typemap skydb.RecordSchema) skydb.RecordSchema
 	AddJoinsToSelectBuilder(q sq.SelectBuilder) sq.SelectBuilder
+	JoinedTables() []string
 	NewPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error)
 	NewAccessControlSqlizer(user *skydb.AuthInfo, aclLevel skydb.RecordACLLevel) (sq.Sqlizer, error)
 }
@@ -57,18 +60,26 @@ func (f *predicateSqlizerFactory) NewPredicateSqlizer(p skydb.Predicate) (sq.Sql
 	if p.Operator.IsCompound() {
 		return f.newCompoundPredicateSqlizer(p)
 	}
-	return f.newComparisonPredicateSqlizer(p)
+	if p.Operator == skydb.Between {
+		return f.newBetweenPredicateSqlizer(p)
+	}
+	if p.Operator == skydb.NoValue || p.Operator == skydb.HasValue {
+		return f.newNullPredicateSqlizer(p)
+	}
+	if p.Operator.IsBinary() {
+		return f.newComparisonPredicateSqlizer(p)
+	}
+	return nil, skydb.ErrUnsupportedOperator{Operator: p.Operator}
 }
 
 func (f *predicateSqlizerFactory) newCompoundPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
 	switch p.Operator {
 	default:
-		err := fmt.Errorf("compound operator `%v` is not supported", p.Operator)
-		return nil, err
+		return nil, skydb.ErrUnsupportedOperator{Operator: p.Operator}
 	case skydb.And:
 		and := make(sq.And, len(p.Children))
 		for i, child := range p.Children {
-			sqlizer, err := f.NewPredicateSqlizer(child.(skydb.Predicate))
+			sqlizer, err := f.newSubPredicateSqlizer(child)
 			if err != nil {
 				return nil, err
 			}
@@ -76,18 +87,36 @@ func (f *predicateSqlizerFactory) newCompoundPredicateSqlizer(p skydb.Predicate)
 		}
 		return and, nil
 	case skydb.Or:
-		or := make(sq.Or, len(p.Children))
-		for i, child := range p.Children {
-			sqlizer, err := f.NewPredicateSqlizer(child.(skydb.Predicate))
+		or := sq.Or{}
+		for _, child := range p.Children {
+			sqlizer, err := f.newSubPredicateSqlizer(child)
 			if err != nil {
 				return nil, err
 			}
-			or[i] = sqlizer
+			switch sqlizer := sqlizer.(type) {
+			case FalseSqlizer:
+				// a branch that is always false does not contribute
+				// to the result
+			case sq.Or:
+				// flatten nested OR so that it is not parenthesized
+				or = append(or, sqlizer...)
+			default:
+				or = append(or, sqlizer)
+			}
+		}
+		switch len(or) {
+		case 0:
+			return FalseSqlizer{}, nil
+		case 1:
+			return or[0], nil
 		}
 		return or, nil
 	case skydb.Not:
-		pred := p.Children[0].(skydb.Predicate)
-		sqlizer, err := f.NewPredicateSqlizer(pred)
+		if len(p.Children) != 1 {
+			return nil, skyerr.NewError(skyerr.RecordQueryInvalid,
+				"not predicate must have exactly one predicate")
+		}
+		sqlizer, err := f.newSubPredicateSqlizer(p.Children[0])
 		if err != nil {
 			return nil, err
 		}
@@ -95,6 +124,17 @@ func (f *predicateSqlizerFactory) newCompoundPredicateSqlizer(p skydb.Predicate)
 	}
 }
 
+// newSubPredicateSqlizer returns the sqlizer of a child of a compound
+// predicate, which must be a predicate itself.
+func (f *predicateSqlizerFactory) newSubPredicateSqlizer(child interface{}) (sq.Sqlizer, error) {
+	pred, ok := child.(skydb.Predicate)
+	if !ok {
+		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			"compound predicate must have predicates only, got %T", child)
+	}
+	return f.NewPredicateSqlizer(pred)
+}
+
 func (f *predicateSqlizerFactory) newFunctionalPredicateSqlizer(predicate skydb.Predicate) (sq.Sqlizer, error) {
 	expr := predicate.Children[0].(skydb.Expression)
 	if expr.Type != skydb.Function {
@@ -103,6 +143,19 @@ func (f *predicateSqlizerFactory) newFunctionalPredicateSqlizer(predicate skydb.
 	switch fn := expr.Value.(type) {
 	case skydb.UserRelationFunc:
 		return f.newUserRelationFunctionalPredicateSqlizer(fn)
+	case skydb.IsPublicReadableFunc:
+		return publicReadablePredicateSqlizer{f.primaryTable}, nil
+	case skydb.ACLContainsRoleFunc:
+		return aclContainsRolePredicateSqlizer{f.primaryTable, fn.Role}, nil
+	case skydb.FullTextMatchFunc:
+		schema, err := f.db.RemoteColumnTypes(f.primaryTable)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := ResolveFuncExpression(expr, schema); err != nil {
+			return nil, err
+		}
+		return fullTextMatchPredicateSqlizer{f.primaryTable, fn}, nil
 	default:
 		panic("the specified function cannot be used as a functional predicate")
 	}
@@ -147,6 +200,27 @@ func (f *predicateSqlizerFactory) newComparisonPredicateSqlizer(p skydb.Predicat
 		return sqlizer, nil
 	}
 
+	if p.Operator == skydb.Contains || p.Operator == skydb.IContains {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+		p = containsToLikePredicate(p)
+	}
+
+	if p.Operator == skydb.JSONHasPath {
+		return f.newJSONHasPathPredicateSqlizer(p)
+	}
+
+	if p.Operator == skydb.ContainsAll {
+		return f.newContainsAllPredicateSqlizer(p)
+	}
+
+	if p.Operator == skydb.Regex || p.Operator == skydb.IRegex {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	sqlizers := []expressionSqlizer{}
 	for _, child := range p.Children {
 		sqlizer, err := f.newExpressionSqlizer(child.(skydb.Expression))
@@ -157,11 +231,156 @@ func (f *predicateSqlizerFactory) newComparisonPredicateSqlizer(p skydb.Predicat
 	}
 
 	if p.Operator == skydb.In {
-		return &containsComparisonPredicateSqlizer{sqlizers}, nil
+		// Nothing is a member of an empty list. Short-circuit here so
+		// that the generated SQL does not depend on the element type
+		// of the list, and negating the predicate yields TRUE rather
+		// than NULL.
+		if isEmptyListLiteral(p.Children[1].(skydb.Expression)) {
+			return FalseSqlizer{}, nil
+		}
+		sqlizer := &containsComparisonPredicateSqlizer{sqlizers}
+		if !sqlizer.canCompare() {
+			return nil, skyerr.NewError(skyerr.RecordQueryInvalid,
+				ErrCannotCompareUsingInOperator.Error())
+		}
+		return sqlizer, nil
 	}
 	return &comparisonPredicateSqlizer{sqlizers, p.Operator}, nil
 }
 
+// newBetweenPredicateSqlizer creates a sqlizer testing whether the
+// field of the predicate is within the bounds. The field must be a
+// number or a datetime, of the same type as the bounds.
+func (f *predicateSqlizerFactory) newBetweenPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	sqlizers := []expressionSqlizer{}
+	for _, child := range p.Children {
+		sqlizer, err := f.newExpressionSqlizer(child.(skydb.Expression))
+		if err != nil {
+			return nil, err
+		}
+		sqlizers = append(sqlizers, sqlizer)
+	}
+	field, lower, upper := sqlizers[0], sqlizers[1], sqlizers[2]
+
+	fieldType := field.fieldType.Type
+	switch {
+	case fieldType.IsNumberCompatibleType() && lower.fieldType.Type.IsNumberCompatibleType():
+	case (fieldType == skydb.TypeDateTime || fieldType == skydb.TypeDateTimeTZ) && lower.fieldType.Type == skydb.TypeDateTime:
+	default:
+		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`cannot compare field "%s" of type %s with bounds of type %s`,
+			field.Expression.Value, fieldType, lower.fieldType.Type)
+	}
+	return &betweenPredicateSqlizer{field, lower, upper}, nil
+}
+
+// newNullPredicateSqlizer creates a sqlizer testing whether the field
+// of a NoValue predicate is null, or the field of a HasValue predicate
+// is not null.
+func (f *predicateSqlizerFactory) newNullPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	field, err := f.newExpressionSqlizer(p.Children[0].(skydb.Expression))
+	if err != nil {
+		return nil, err
+	}
+	return &nullPredicateSqlizer{field, p.Operator == skydb.HasValue}, nil
+}
+
+// newJSONHasPathPredicateSqlizer creates a sqlizer testing whether
+// the path exists in the JSON field on the left side of the predicate.
+func (f *predicateSqlizerFactory) newJSONHasPathPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	field, err := f.newExpressionSqlizer(p.Children[0].(skydb.Expression))
+	if err != nil {
+		return nil, err
+	}
+	if field.fieldType.Type != skydb.TypeJSON {
+		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`cannot test json path of non-json field "%s"`, field.Expression.Value)
+	}
+
+	path := p.Children[1].(skydb.Expression).Value.(string)
+	return &jsonHasPathPredicateSqlizer{field, strings.Split(path, ".")}, nil
+}
+
+// newContainsAllPredicateSqlizer creates a sqlizer testing whether the
+// JSON field on the left side of the predicate contains all elements of
+// the array on the right side.
+func (f *predicateSqlizerFactory) newContainsAllPredicateSqlizer(p skydb.Predicate) (sq.Sqlizer, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	field, err := f.newExpressionSqlizer(p.Children[0].(skydb.Expression))
+	if err != nil {
+		return nil, err
+	}
+	if field.fieldType.Type != skydb.TypeJSON {
+		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`cannot test containment of non-json field "%s"`, field.Expression.Value)
+	}
+
+	// Every record contains all of no elements, including the records
+	// without value in the field.
+	elements := p.Children[1].(skydb.Expression).Value.([]interface{})
+	if len(elements) == 0 {
+		return TrueSqlizer{}, nil
+	}
+	return &containsAllPredicateSqlizer{field, elements}, nil
+}
+
+// containsToLikePredicate rewrites a Contains or IContains predicate into
+// the equivalent Like or ILike predicate. The substring is escaped so
+// that wildcard characters in it are matched literally.
+//
+// The predicate must have been validated.
+func containsToLikePredicate(p skydb.Predicate) skydb.Predicate {
+	operator := skydb.Like
+	if p.Operator == skydb.IContains {
+		operator = skydb.ILike
+	}
+
+	substr := p.Children[1].(skydb.Expression).Value.(string)
+	return skydb.Predicate{
+		Operator: operator,
+		Children: []interface{}{
+			p.Children[0],
+			skydb.Expression{
+				Type:  skydb.Literal,
+				Value: "%" + escapeLikePattern(substr) + "%",
+			},
+		},
+	}
+}
+
+// escapeLikePattern escapes characters having special meaning in
+// a LIKE pattern, using backslash as the escape character.
+func escapeLikePattern(s string) string {
+	return likePatternEscaper.Replace(s)
+}
+
+var likePatternEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// isEmptyListLiteral returns true if the expression is a literal list
+// (of any element type) containing no elements.
+func isEmptyListLiteral(expr skydb.Expression) bool {
+	if expr.Type != skydb.Literal || expr.Value == nil {
+		return false
+	}
+	v := reflect.ValueOf(expr.Value)
+	return v.Kind() == reflect.Slice && v.Len() == 0
+}
+
 // tryOptimizeDistancePredicate returns a sqlizer that is more efficient
 // at querying whether two points are within certain distance.
 //
@@ -222,6 +441,17 @@ func (f *predicateSqlizerFactory) newExpressionSqlizer(expr skydb.Expression) (e
 		if !ok {
 			panic(`expression value is not a function`)
 		}
+		switch funcInterface.(type) {
+		case skydb.LengthFunc, skydb.LowerFunc, skydb.UpperFunc, skydb.DateTruncFunc, skydb.GeohashFunc,
+			skydb.FullTextMatchFunc:
+			schema, err := f.db.RemoteColumnTypes(f.primaryTable)
+			if err != nil {
+				return expressionSqlizer{}, err
+			}
+			if expr, err = ResolveFuncExpression(expr, schema); err != nil {
+				return expressionSqlizer{}, err
+			}
+		}
 		return newExpressionSqlizer(f.primaryTable, skydb.FieldType{Type: funcInterface.DataType()}, expr), nil
 	}
 
@@ -236,16 +466,16 @@ func (f *predicateSqlizerFactory) newExpressionSqlizerForKeyPath(expr skydb.Expr
 
 	components := expr.KeyPathComponents()
 	keyPath := expr.Value.(string)
-	if len(components) > 2 {
-		return expressionSqlizer{}, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
-			`keypath "%s" with more than 2 components is not supported`, keyPath)
-	}
 
 	alias := f.primaryTable
 	fields, err := skydb.TraverseColumnTypes(f.db, f.primaryTable, keyPath)
 	if err != nil {
 		return expressionSqlizer{}, skyerr.NewError(skyerr.RecordQueryInvalid, err.Error())
 	}
+	if len(fields) > 2 {
+		return expressionSqlizer{}, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`keypath "%s" with more than 2 components is not supported`, keyPath)
+	}
 
 	field := skydb.FieldType{}
 	for i, keyPathField := range fields {
@@ -255,6 +485,20 @@ func (f *predicateSqlizerFactory) newExpressionSqlizerForKeyPath(expr skydb.Expr
 			alias = f.createLeftJoin(field.ReferenceType, components[i], "_id")
 		}
 	}
+
+	if field.Encrypted {
+		// The stored ciphertexts tell nothing about the values.
+		return expressionSqlizer{}, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`cannot query by keypath "%s" because it is an encrypted field`, keyPath)
+	}
+
+	if len(fields) < len(components) {
+		// The key path continues into a JSON field, the value at the
+		// path is compared as text.
+		sqlizer := newExpressionSqlizer(alias, skydb.FieldType{Type: skydb.TypeString}, expr)
+		sqlizer.jsonPath = components[len(fields):]
+		return sqlizer, nil
+	}
 	return newExpressionSqlizer(alias, field, expr), nil
 }
 
@@ -298,6 +542,15 @@ func (f *predicateSqlizerFactory) AddJoinsToSelectBuilder(q sq.SelectBuilder) sq
 	return q
 }
 
+// JoinedTables returns the names of the tables joined to the primary table
+func (f *predicateSqlizerFactory) JoinedTables() []string {
+	tables := make([]string, len(f.joinedTables))
+	for i, alias := range f.joinedTables {
+		tables[i] = alias.secondaryTable
+	}
+	return tables
+}
+
 func (f *predicateSqlizerFactory) addExtraColumn(key string, fieldType skydb.DataType, expr skydb.Expression) {
 	if f.extraColumns == nil {
 		f.extraColumns = map[string]skydb.FieldType{}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
@@ -46,15 +47,12 @@ func (p accessPredicateSqlizer) ToSql() (string, []interface{}, error) {
 	args := []interface{}{}
 
 	if p.user != nil {
-		if p.user.ID == "" {
+		// A user without ID only occurs when querying as roles
+		// without an owner.
+		if p.user.ID == "" && len(p.user.Roles) == 0 {
 			panic("cannot build access predicate without user")
 		}
 
-		escapedID, err := json.Marshal(p.user.ID)
-		if err != nil {
-			panic("unexpected serialize error on user_id")
-		}
-
 		for _, role := range p.user.Roles {
 			escapedRole, err := json.Marshal(role)
 			if err != nil {
@@ -62,10 +60,17 @@ func (p accessPredicateSqlizer) ToSql() (string, []interface{}, error) {
 			}
 			b.WriteString(fmt.Sprintf(`%s @> '[{"role": %s}]' OR `, fullQuoteIdentifier(p.alias, "_access"), escapedRole))
 		}
-		b.WriteString(fmt.Sprintf(`%s @> '[{"user_id": %s}]' OR `, fullQuoteIdentifier(p.alias, "_access"), escapedID))
 
-		b.WriteString(fmt.Sprintf(`%s = ? OR `, fullQuoteIdentifier(p.alias, "_owner_id")))
-		args = append(args, p.user.ID)
+		if p.user.ID != "" {
+			escapedID, err := json.Marshal(p.user.ID)
+			if err != nil {
+				panic("unexpected serialize error on user_id")
+			}
+			b.WriteString(fmt.Sprintf(`%s @> '[{"user_id": %s}]' OR `, fullQuoteIdentifier(p.alias, "_access"), escapedID))
+
+			b.WriteString(fmt.Sprintf(`%s = ? OR `, fullQuoteIdentifier(p.alias, "_owner_id")))
+			args = append(args, p.user.ID)
+		}
 	}
 
 	if p.level == skydb.ReadLevel {
@@ -79,6 +84,95 @@ func (p accessPredicateSqlizer) ToSql() (string, []interface{}, error) {
 	return b.String(), args, nil
 }
 
+// publicReadablePredicateSqlizer builds the json matching expression
+// for records readable by the public, which includes records without ACL.
+//
+// `"_access" @> '[{"public": true}]' OR "_access" IS NULL`
+type publicReadablePredicateSqlizer struct {
+	alias string
+}
+
+func (p publicReadablePredicateSqlizer) ToSql() (string, []interface{}, error) {
+	sql := fmt.Sprintf(`(%s @> '[{"public": true}]' OR %s IS NULL)`,
+		fullQuoteIdentifier(p.alias, "_access"),
+		fullQuoteIdentifier(p.alias, "_access"))
+	return sql, []interface{}{}, nil
+}
+
+// aclContainsRolePredicateSqlizer builds the json matching expression
+// for records having an ACE of the role, regardless of its level.
+//
+// `"_access" @> '[{"role":"admin"}]'`
+type aclContainsRolePredicateSqlizer struct {
+	alias string
+	role  string
+}
+
+func (p aclContainsRolePredicateSqlizer) ToSql() (string, []interface{}, error) {
+	ace, err := json.Marshal([]map[string]string{{"role": p.role}})
+	if err != nil {
+		panic("unexpected serialize error on role")
+	}
+	sql := fmt.Sprintf(`%s @> ?::jsonb`, fullQuoteIdentifier(p.alias, "_access"))
+	return sql, []interface{}{string(ace)}, nil
+}
+
+// fullTextMatchPredicateSqlizer generates SQL matching records containing
+// all words of the search query in any of the fields.
+// Fields are concatenated into a single document, with NULL fields
+// treated as empty strings.
+type fullTextMatchPredicateSqlizer struct {
+	alias string
+	fn    skydb.FullTextMatchFunc
+}
+
+func (p fullTextMatchPredicateSqlizer) ToSql() (string, []interface{}, error) {
+	sql := fmt.Sprintf("%s @@ plainto_tsquery(%s, ?)",
+		fullTextDocumentSQL(p.alias, p.fn.Fields), fullTextConfig)
+	return sql, []interface{}{p.fn.Query}, nil
+}
+
+// jsonHasPathPredicateSqlizer generates SQL testing whether a path exists
+// in a JSON field. Extracting a missing path yields NULL, whereas a path
+// to JSON null yields the JSON value null, so the path exists.
+//
+// `("note"."config" #> '{feature,enabled}') IS NOT NULL`
+type jsonHasPathPredicateSqlizer struct {
+	field expressionSqlizer
+	path  []string
+}
+
+func (p *jsonHasPathPredicateSqlizer) ToSql() (string, []interface{}, error) {
+	sql, args, err := p.field.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	sql = fmt.Sprintf(`(%s #> ?::text[]) IS NOT NULL`, sql)
+	return sql, append(args, pq.Array(p.path)), nil
+}
+
+// containsAllPredicateSqlizer generates SQL testing whether a JSON field
+// contains all elements of an array.
+//
+// `"note"."tags" @> '["important","work"]'::jsonb`
+type containsAllPredicateSqlizer struct {
+	field    expressionSqlizer
+	elements []interface{}
+}
+
+func (p *containsAllPredicateSqlizer) ToSql() (string, []interface{}, error) {
+	sql, args, err := p.field.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	elements, err := json.Marshal(p.elements)
+	if err != nil {
+		return "", nil, err
+	}
+	sql = fmt.Sprintf(`%s @> ?::jsonb`, sql)
+	return sql, append(args, string(elements)), nil
+}
+
 type userRelationPredicateSqlizer struct {
 	outwardAlias string
 	inwardAlias  string
@@ -109,6 +203,23 @@ type containsComparisonPredicateSqlizer struct {
 	sqlizers []expressionSqlizer
 }
 
+// canCompare returns whether SQL can be generated for the operands.
+//
+// Note: "In" operator may be used to compare other types of values
+// but the generated SQL depends on the types of values being compared.
+// It is currently not supported to compare two keypaths,
+// unless they are geometry types.  cf. #345
+func (p *containsComparisonPredicateSqlizer) canCompare() bool {
+	lhs := p.sqlizers[0]
+	rhs := p.sqlizers[1]
+
+	if lhs.fieldType.Type.IsGeometryCompatibleType() && rhs.fieldType.Type.IsGeometryCompatibleType() {
+		return true
+	}
+	return (lhs.Type == skydb.Literal && rhs.Type == skydb.KeyPath) ||
+		(lhs.Type == skydb.KeyPath && rhs.Type == skydb.Literal)
+}
+
 func (p *containsComparisonPredicateSqlizer) ToSql() (sql string, args []interface{}, err error) {
 	var buffer bytes.Buffer
 	lhs := p.sqlizers[0]
@@ -165,6 +276,12 @@ func (p *containsComparisonPredicateSqlizer) ToSql() (sql string, args []interfa
 		if err != nil {
 			return "", nil, err
 		}
+
+		if list, ok := rhs.Value.([]interface{}); ok {
+			sql, listArgs := InToSQL(sqlOperand, list)
+			return sql, append(opArgs, listArgs...), nil
+		}
+
 		buffer.WriteString(sqlOperand)
 		args = append(args, opArgs...)
 
@@ -181,10 +298,6 @@ func (p *containsComparisonPredicateSqlizer) ToSql() (sql string, args []interfa
 		return sql, args, err
 	}
 
-	// Note: "In" operator may be used to compare other types of values
-	// but the generated SQL depends on the types of values being compared.
-	// It is currently not supported to compare two keypaths,
-	// unless they are geometry types.  cf. #345
 	return "", []interface{}{}, ErrCannotCompareUsingInOperator
 }
 
@@ -233,7 +346,7 @@ func (p *comparisonPredicateSqlizer) ToSql() (sql string, args []interface{}, er
 
 		sql = buffer.String()
 	} else {
-		err = fmt.Errorf("comparison operator `%v` is not supported", p.operator)
+		err = skydb.ErrUnsupportedOperator{Operator: p.operator}
 	}
 
 	return
@@ -242,7 +355,7 @@ func (p *comparisonPredicateSqlizer) ToSql() (sql string, args []interface{}, er
 func (p *comparisonPredicateSqlizer) writeOperator(buffer *bytes.Buffer) error {
 	switch p.operator {
 	default:
-		return fmt.Errorf("comparison operator `%v` is not supported", p.operator)
+		return skydb.ErrUnsupportedOperator{Operator: p.operator}
 	case skydb.Equal:
 		buffer.WriteString(`=`)
 	case skydb.GreaterThan:
@@ -259,6 +372,10 @@ func (p *comparisonPredicateSqlizer) writeOperator(buffer *bytes.Buffer) error {
 		buffer.WriteString(` LIKE `)
 	case skydb.ILike:
 		buffer.WriteString(` ILIKE `)
+	case skydb.Regex:
+		buffer.WriteString(` ~ `)
+	case skydb.IRegex:
+		buffer.WriteString(` ~* `)
 	}
 	return nil
 }
@@ -275,6 +392,50 @@ func (p *comparisonPredicateSqlizer) writeOperatorForNullOperand(buffer *bytes.B
 	return nil
 }
 
+// betweenPredicateSqlizer generates SQL condition testing whether the
+// field is within the inclusive bounds.
+type betweenPredicateSqlizer struct {
+	field expressionSqlizer
+	lower expressionSqlizer
+	upper expressionSqlizer
+}
+
+func (p *betweenPredicateSqlizer) ToSql() (sql string, args []interface{}, err error) {
+	args = []interface{}{}
+	operands := make([]string, 3)
+	for i, sqlizer := range []expressionSqlizer{p.field, p.lower, p.upper} {
+		operand, operandArgs, err := sqlizer.ToSql()
+		if err != nil {
+			return "", nil, err
+		}
+		operands[i] = operand
+		args = append(args, operandArgs...)
+	}
+
+	sql = fmt.Sprintf("%s BETWEEN %s AND %s", operands[0], operands[1], operands[2])
+	return
+}
+
+// nullPredicateSqlizer generates SQL condition testing whether the
+// field has no value.
+//
+// `"note"."category" IS NULL`
+type nullPredicateSqlizer struct {
+	field   expressionSqlizer
+	notNull bool
+}
+
+func (p *nullPredicateSqlizer) ToSql() (string, []interface{}, error) {
+	sql, args, err := p.field.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.notNull {
+		return sql + " IS NOT NULL", args, nil
+	}
+	return sql + " IS NULL", args, nil
+}
+
 // NotSqlizer generates SQL condition that negates a boolean condition
 type NotSqlizer struct {
 	Predicate sq.Sqlizer
@@ -299,6 +460,15 @@ func (s FalseSqlizer) ToSql() (sql string, args []interface{}, err error) {
 	return "FALSE", []interface{}{}, nil
 }
 
+// TrueSqlizer generates SQL condition that evaluates to true
+type TrueSqlizer struct {
+}
+
+// ToSql generates SQL for TrueSqlizer
+func (s TrueSqlizer) ToSql() (sql string, args []interface{}, err error) {
+	return "TRUE", []interface{}{}, nil
+}
+
 // distancePredicateSqlizer generates SQL condition that calculates if a
 // location is within a certain distance.
 type distancePredicateSqlizer struct {
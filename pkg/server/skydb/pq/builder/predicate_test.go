@@ -15,9 +15,12 @@
 package builder
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/lib/pq"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
@@ -69,79 +72,716 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 		db.EXPECT().RemoteColumnTypes(gomock.Eq("note")).
 			Return(
 				skydb.RecordSchema{
-					"title":   skydb.FieldType{Type: skydb.TypeString},
-					"content": skydb.FieldType{Type: skydb.TypeString},
+					"title":       skydb.FieldType{Type: skydb.TypeString},
+					"content":     skydb.FieldType{Type: skydb.TypeString},
+					"order":       skydb.FieldType{Type: skydb.TypeNumber},
+					"tags":        skydb.FieldType{Type: skydb.TypeJSON},
+					"done":        skydb.FieldType{Type: skydb.TypeBoolean},
+					"_created_at": skydb.FieldType{Type: skydb.TypeDateTime},
+					"location":    skydb.FieldType{Type: skydb.TypeLocation},
+					"category": skydb.FieldType{
+						Type:          skydb.TypeReference,
+						ReferenceType: "category",
+					},
 				}, nil,
 			).AnyTimes()
 
 		f := NewPredicateSqlizerFactory(db, "note").(*predicateSqlizerFactory)
 
-		Convey("keypath equal null", func() {
+		Convey("keypath equal null", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, nil},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, "\"note\".\"content\" IS NULL")
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("null equal keypath", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Literal, nil},
+					skydb.Expression{skydb.KeyPath, "content"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, "\"note\".\"content\" IS NULL")
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath not equal null", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.NotEqual,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, nil},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, "\"note\".\"content\" IS NOT NULL")
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath equal boolean", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.IsFalse("done"))
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."done"=?`)
+			So(args, ShouldResemble, []interface{}{false})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath is in array of values", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, []string{"hello", "world"}},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, "\"note\".\"content\" IN ?")
+			So(args, ShouldResemble, []interface{}{[]string{"hello", "world"}})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath is in long array of values", func() {
+			values := make([]interface{}, 70000)
+			for i := range values {
+				values[i] = skydb.NewReference("note", fmt.Sprintf("id%d", i))
+			}
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, values},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" = ANY(?)`)
+			So(len(args), ShouldEqual, 1)
+			array := args[0].(pq.StringArray)
+			So(len(array), ShouldEqual, 70000)
+			So(array[69999], ShouldEqual, "id69999")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath is in list of strings", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, []interface{}{"hello", "world"}},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" = ANY(?)`)
+			So(args, ShouldResemble, []interface{}{pq.StringArray{"hello", "world"}})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath is in long list of numbers", func() {
+			values := make([]interface{}, 2000)
+			for i := range values {
+				values[i] = float64(i)
+			}
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "order"},
+					skydb.Expression{skydb.Literal, values},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."order" = ANY(?)`)
+			So(len(args), ShouldEqual, 1)
+			array := args[0].(pq.GenericArray).A.([]interface{})
+			So(len(array), ShouldEqual, 2000)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath is in empty array of values", func() {
+			for _, value := range []interface{}{
+				[]interface{}{},
+				[]string{},
+				[]float64{},
+				[]skydb.Reference{},
+			} {
+				sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+					skydb.In,
+					[]interface{}{
+						skydb.Expression{skydb.KeyPath, "content"},
+						skydb.Expression{skydb.Literal, value},
+					},
+				})
+				So(err, ShouldBeNil)
+				So(sqlizer, ShouldResemble, FalseSqlizer{})
+			}
+		})
+
+		Convey("number keypath is in empty array of values", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "order"},
+					skydb.Expression{skydb.Literal, []interface{}{}},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, "FALSE")
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("reference keypath is in empty array of values", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "category"},
+					skydb.Expression{skydb.Literal, []interface{}{}},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, "FALSE")
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("non-existent keypath is in empty array of values", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "wrong_title"},
+					skydb.Expression{skydb.Literal, []interface{}{}},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("keypath is in keypath", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "title"},
+					skydb.Expression{skydb.KeyPath, "content"},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("non-existent keypath for equality", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "wrong_title"},
+					skydb.Expression{skydb.Literal, "hello world"},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("non-existent keypath is in array of values", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.In,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "wrong_title"},
+					skydb.Expression{skydb.Literal, []string{"hello", "world"}},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("keypath contains substring", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Contains,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, "llo Wo"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" LIKE ?`)
+			So(args, ShouldResemble, []interface{}{"%llo Wo%"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("nested json keypath contains substring", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Contains,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "tags.meta.note"},
+					skydb.Expression{skydb.Literal, "urgent"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `("note"."tags" #>> ?::text[]) LIKE ?`)
+			So(args, ShouldResemble, []interface{}{pq.Array([]string{"meta", "note"}), "%urgent%"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath contains substring case-insensitively", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.IContains,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, "LLO wo"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" ILIKE ?`)
+			So(args, ShouldResemble, []interface{}{"%LLO wo%"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath contains substring with wildcard characters", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Contains,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, `100%_\`},
+				},
+			})
+			So(err, ShouldBeNil)
+			_, args, err := sqlizer.ToSql()
+			So(args, ShouldResemble, []interface{}{`%100\%\_\\%`})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("length of string keypath", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.GreaterThan,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.LengthFunc{"title"}},
+					skydb.Expression{skydb.Literal, 100.0},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `length("note"."title")>?`)
+			So(args, ShouldResemble, []interface{}{100.0})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("length of list keypath", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.GreaterThan,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.LengthFunc{"tags"}},
+					skydb.Expression{skydb.Literal, 3.0},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `(CASE WHEN jsonb_typeof("note"."tags") = 'array' THEN jsonb_array_length("note"."tags") END)>?`)
+			So(args, ShouldResemble, []interface{}{3.0})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("length of number keypath", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.GreaterThan,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.LengthFunc{"order"}},
+					skydb.Expression{skydb.Literal, 3.0},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("length of non-existent keypath", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.GreaterThan,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.LengthFunc{"wrong_title"}},
+					skydb.Expression{skydb.Literal, 3.0},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("lower case of string keypath", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.LowerFunc{"title"}},
+					skydb.Expression{skydb.Literal, "hello world"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `lower("note"."title")=?`)
+			So(args, ShouldResemble, []interface{}{"hello world"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("upper case of string keypath", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.UpperFunc{"title"}},
+					skydb.Expression{skydb.Literal, "HELLO WORLD"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `upper("note"."title")=?`)
+			So(args, ShouldResemble, []interface{}{"HELLO WORLD"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("lower case of number keypath", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.LowerFunc{"order"}},
+					skydb.Expression{skydb.Literal, "1"},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("datetime keypath truncated to day", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.DateTruncFunc{"_created_at", "day"}},
+					skydb.Expression{skydb.Literal, time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `date_trunc('day', "note"."_created_at")=?`)
+			So(args, ShouldResemble, []interface{}{time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath matching regex", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Regex,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, "^Hello"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" ~ ?`)
+			So(args, ShouldResemble, []interface{}{"^Hello"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath matching case insensitive regex", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.IRegex,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, "^hello"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" ~* ?`)
+			So(args, ShouldResemble, []interface{}{"^hello"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath matching non-string regex", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Regex,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, float64(1)},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("datetime keypath truncated to unsupported unit", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.DateTruncFunc{"_created_at", "day'); DROP TABLE note; --"}},
+					skydb.Expression{skydb.Literal, time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("string keypath truncated to day", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.DateTruncFunc{"title", "day"}},
+					skydb.Expression{skydb.Literal, time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("reference keypath is null", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.IsNull("category"))
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."category" IS NULL`)
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("reference keypath is not null", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.IsNotNull("category"))
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."category" IS NOT NULL`)
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath equal to null", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, nil},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" IS NULL`)
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("keypath not equal to null", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.NotEqual,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.Literal, nil},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."content" IS NOT NULL`)
+			So(args, ShouldResemble, []interface{}{})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("null predicate of a literal", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.NoValue,
+				[]interface{}{
+					skydb.Expression{skydb.Literal, "content"},
+				},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("geohash of location keypath", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.GeohashFunc{"location", 5}},
+					skydb.Expression{skydb.Literal, "gcpuv"},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `ST_GeoHash("note"."location", ?)=?`)
+			So(args, ShouldResemble, []interface{}{5, "gcpuv"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("geohash with out of range precision", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.GeohashFunc{"location", 0}},
+					skydb.Expression{skydb.Literal, "gcpuv"},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("geohash of string keypath", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Equal,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.GeohashFunc{"title", 5}},
+					skydb.Expression{skydb.Literal, "gcpuv"},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("full text match of string keypaths", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Functional,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.FullTextMatchFunc{
+						[]string{"title", "content"}, "chinese food",
+					}},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `to_tsvector('simple', coalesce("note"."title", '') || ' ' || coalesce("note"."content", '')) @@ plainto_tsquery('simple', ?)`)
+			So(args, ShouldResemble, []interface{}{"chinese food"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("full text match score compared", func() {
+			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.GreaterThan,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.FullTextMatchFunc{
+						[]string{"title"}, "chinese",
+					}},
+					skydb.Expression{skydb.Literal, 0.05},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `ts_rank(to_tsvector('simple', coalesce("note"."title", '')), plainto_tsquery('simple', ?))>?`)
+			So(args, ShouldResemble, []interface{}{"chinese", 0.05})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("full text match of number keypath", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Functional,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.FullTextMatchFunc{
+						[]string{"title", "order"}, "chinese",
+					}},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("keypath contains non-string", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.Contains,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "order"},
+					skydb.Expression{skydb.Literal, 1.0},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("json keypath has nested path", func() {
 			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
-				skydb.Equal,
+				skydb.JSONHasPath,
 				[]interface{}{
-					skydb.Expression{skydb.KeyPath, "content"},
-					skydb.Expression{skydb.Literal, nil},
+					skydb.Expression{skydb.KeyPath, "tags"},
+					skydb.Expression{skydb.Literal, "feature.enabled"},
 				},
 			})
 			So(err, ShouldBeNil)
 			sql, args, err := sqlizer.ToSql()
-			So(sql, ShouldEqual, "\"note\".\"content\" IS NULL")
-			So(args, ShouldResemble, []interface{}{})
 			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `("note"."tags" #> ?::text[]) IS NOT NULL`)
+			So(args, ShouldResemble, []interface{}{pq.Array([]string{"feature", "enabled"})})
 		})
 
-		Convey("null equal keypath", func() {
-			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
-				skydb.Equal,
+		Convey("non-json keypath has path", func() {
+			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
+				skydb.JSONHasPath,
 				[]interface{}{
-					skydb.Expression{skydb.Literal, nil},
-					skydb.Expression{skydb.KeyPath, "content"},
+					skydb.Expression{skydb.KeyPath, "title"},
+					skydb.Expression{skydb.Literal, "feature"},
 				},
 			})
-			So(err, ShouldBeNil)
-			sql, args, err := sqlizer.ToSql()
-			So(sql, ShouldEqual, "\"note\".\"content\" IS NULL")
-			So(args, ShouldResemble, []interface{}{})
-			So(err, ShouldBeNil)
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
 		})
 
-		Convey("keypath not equal null", func() {
+		Convey("json keypath contains all elements", func() {
 			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
-				skydb.NotEqual,
+				skydb.ContainsAll,
 				[]interface{}{
-					skydb.Expression{skydb.KeyPath, "content"},
-					skydb.Expression{skydb.Literal, nil},
+					skydb.Expression{skydb.KeyPath, "tags"},
+					skydb.Expression{skydb.Literal, []interface{}{"important", "work"}},
 				},
 			})
 			So(err, ShouldBeNil)
 			sql, args, err := sqlizer.ToSql()
-			So(sql, ShouldEqual, "\"note\".\"content\" IS NOT NULL")
-			So(args, ShouldResemble, []interface{}{})
 			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `"note"."tags" @> ?::jsonb`)
+			So(args, ShouldResemble, []interface{}{`["important","work"]`})
 		})
 
-		Convey("keypath is in array of values", func() {
+		Convey("json keypath contains all of no elements", func() {
 			sqlizer, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
-				skydb.In,
+				skydb.ContainsAll,
 				[]interface{}{
-					skydb.Expression{skydb.KeyPath, "content"},
-					skydb.Expression{skydb.Literal, []string{"hello", "world"}},
+					skydb.Expression{skydb.KeyPath, "tags"},
+					skydb.Expression{skydb.Literal, []interface{}{}},
 				},
 			})
 			So(err, ShouldBeNil)
 			sql, args, err := sqlizer.ToSql()
-			So(sql, ShouldEqual, "\"note\".\"content\" IN ?")
-			So(args, ShouldResemble, []interface{}{[]string{"hello", "world"}})
 			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `TRUE`)
+			So(args, ShouldBeEmpty)
 		})
 
-		Convey("non-existent keypath for equality", func() {
+		Convey("non-json keypath contains all elements", func() {
 			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
-				skydb.Equal,
+				skydb.ContainsAll,
 				[]interface{}{
-					skydb.Expression{skydb.KeyPath, "wrong_title"},
-					skydb.Expression{skydb.Literal, "hello world"},
+					skydb.Expression{skydb.KeyPath, "title"},
+					skydb.Expression{skydb.Literal, []interface{}{"important"}},
 				},
 			})
 			builderError, ok := err.(skyerr.Error)
@@ -149,18 +789,333 @@ func TestPredicateSqlizerFactory(t *testing.T) {
 			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
 		})
 
-		Convey("non-existent keypath is in array of values", func() {
+		Convey("json keypath has path with empty key", func() {
 			_, err := f.newComparisonPredicateSqlizer(skydb.Predicate{
-				skydb.In,
+				skydb.JSONHasPath,
 				[]interface{}{
-					skydb.Expression{skydb.KeyPath, "wrong_title"},
-					skydb.Expression{skydb.Literal, []string{"hello", "world"}},
+					skydb.Expression{skydb.KeyPath, "tags"},
+					skydb.Expression{skydb.Literal, "feature..enabled"},
+				},
+			})
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+
+	Convey("Predicate on encrypted field", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		db := mock_skydb.NewMockDatabase(ctrl)
+		db.EXPECT().RemoteColumnTypes(gomock.Eq("note")).
+			Return(
+				skydb.RecordSchema{
+					"secret": skydb.FieldType{Type: skydb.TypeString, Encrypted: true},
+				}, nil,
+			).AnyTimes()
+
+		f := NewPredicateSqlizerFactory(db, "note").(*predicateSqlizerFactory)
+
+		_, err := f.NewPredicateSqlizer(skydb.Predicate{
+			skydb.Equal,
+			[]interface{}{
+				skydb.Expression{skydb.KeyPath, "secret"},
+				skydb.Expression{skydb.Literal, "hello"},
+			},
+		})
+		builderError, ok := err.(skyerr.Error)
+		So(ok, ShouldBeTrue)
+		So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+	})
+
+	Convey("Compound Predicate", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		db := mock_skydb.NewMockDatabase(ctrl)
+		db.EXPECT().RemoteColumnTypes(gomock.Eq("note")).
+			Return(
+				skydb.RecordSchema{
+					"content": skydb.FieldType{Type: skydb.TypeString},
+					"order":   skydb.FieldType{Type: skydb.TypeNumber},
+				}, nil,
+			).AnyTimes()
+
+		f := NewPredicateSqlizerFactory(db, "note").(*predicateSqlizerFactory)
+
+		likeContent := skydb.Predicate{
+			skydb.Like,
+			[]interface{}{
+				skydb.Expression{skydb.KeyPath, "content"},
+				skydb.Expression{skydb.Literal, "hello%"},
+			},
+		}
+		equalOrder := skydb.Predicate{
+			skydb.Equal,
+			[]interface{}{
+				skydb.Expression{skydb.KeyPath, "order"},
+				skydb.Expression{skydb.Literal, float64(2)},
+			},
+		}
+		inEmpty := skydb.Predicate{
+			skydb.In,
+			[]interface{}{
+				skydb.Expression{skydb.KeyPath, "content"},
+				skydb.Expression{skydb.Literal, []interface{}{}},
+			},
+		}
+
+		Convey("or across different keypaths", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Or,
+				[]interface{}{likeContent, equalOrder},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `("note"."content" LIKE ? OR "note"."order"=?)`)
+			So(args, ShouldResemble, []interface{}{"hello%", float64(2)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("nested or is flattened", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Or,
+				[]interface{}{
+					likeContent,
+					skydb.Predicate{
+						skydb.Or,
+						[]interface{}{equalOrder, likeContent},
+					},
+				},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `("note"."content" LIKE ? OR "note"."order"=? OR "note"."content" LIKE ?)`)
+			So(args, ShouldResemble, []interface{}{"hello%", float64(2), "hello%"})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("or omits branch that is always false", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Or,
+				[]interface{}{inEmpty, equalOrder},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."order"=?`)
+			So(args, ShouldResemble, []interface{}{float64(2)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("or of branches that are always false", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Or,
+				[]interface{}{inEmpty, inEmpty},
+			})
+			So(err, ShouldBeNil)
+			So(sqlizer, ShouldResemble, FalseSqlizer{})
+		})
+
+		Convey("not of a comparison", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Not,
+				[]interface{}{equalOrder},
+			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `NOT ("note"."order"=?)`)
+			So(args, ShouldResemble, []interface{}{float64(2)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("not of a compound predicate", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Not,
+				[]interface{}{
+					skydb.Predicate{
+						skydb.Or,
+						[]interface{}{likeContent, equalOrder},
+					},
 				},
 			})
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `NOT (("note"."content" LIKE ? OR "note"."order"=?))`)
+			So(args, ShouldResemble, []interface{}{"hello%", float64(2)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("not with more than one child", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Not,
+				[]interface{}{likeContent, equalOrder},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("not without child", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Not,
+				[]interface{}{},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("not of an expression", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Not,
+				[]interface{}{skydb.Expression{skydb.KeyPath, "content"}},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("and of an expression", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.And,
+				[]interface{}{likeContent, skydb.Expression{skydb.KeyPath, "content"}},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+
+	Convey("Between Predicate", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		db := mock_skydb.NewMockDatabase(ctrl)
+		db.EXPECT().RemoteColumnTypes(gomock.Eq("note")).
+			Return(
+				skydb.RecordSchema{
+					"content":     skydb.FieldType{Type: skydb.TypeString},
+					"order":       skydb.FieldType{Type: skydb.TypeNumber},
+					"serial":      skydb.FieldType{Type: skydb.TypeSequence},
+					"_created_at": skydb.FieldType{Type: skydb.TypeDateTime},
+				}, nil,
+			).AnyTimes()
+
+		f := NewPredicateSqlizerFactory(db, "note").(*predicateSqlizerFactory)
+
+		between := func(keyPath string, lower interface{}, upper interface{}) skydb.Predicate {
+			return skydb.Predicate{
+				skydb.Between,
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, keyPath},
+					skydb.Expression{skydb.Literal, lower},
+					skydb.Expression{skydb.Literal, upper},
+				},
+			}
+		}
+
+		Convey("number between numbers", func() {
+			sqlizer, err := f.NewPredicateSqlizer(between("order", float64(1), float64(2)))
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."order" BETWEEN ? AND ?`)
+			So(args, ShouldResemble, []interface{}{float64(1), float64(2)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("sequence between numbers", func() {
+			sqlizer, err := f.NewPredicateSqlizer(between("serial", int64(10), int64(20)))
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."serial" BETWEEN ? AND ?`)
+			So(args, ShouldResemble, []interface{}{int64(10), int64(20)})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("datetime between datetimes", func() {
+			lower := time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)
+			upper := time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC)
+			sqlizer, err := f.NewPredicateSqlizer(between("_created_at", lower, upper))
+			So(err, ShouldBeNil)
+			sql, args, err := sqlizer.ToSql()
+			So(sql, ShouldEqual, `"note"."_created_at" BETWEEN ? AND ?`)
+			So(args, ShouldResemble, []interface{}{lower, upper})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("number between datetimes", func() {
+			lower := time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)
+			upper := time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC)
+			_, err := f.NewPredicateSqlizer(between("order", lower, upper))
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("string between numbers", func() {
+			_, err := f.NewPredicateSqlizer(between("content", float64(1), float64(2)))
 			builderError, ok := err.(skyerr.Error)
 			So(ok, ShouldBeTrue)
 			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
 		})
+
+		Convey("bounds of mismatched types", func() {
+			_, err := f.NewPredicateSqlizer(between("order", float64(1), "2"))
+			builderError, ok := err.(skyerr.Error)
+			So(ok, ShouldBeTrue)
+			So(builderError.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+
+	Convey("Unsupported Operator", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		db := mock_skydb.NewMockDatabase(ctrl)
+		db.EXPECT().RemoteColumnTypes(gomock.Eq("note")).
+			Return(
+				skydb.RecordSchema{
+					"title": skydb.FieldType{Type: skydb.TypeString},
+				}, nil,
+			).AnyTimes()
+
+		f := NewPredicateSqlizerFactory(db, "note").(*predicateSqlizerFactory)
+
+		Convey("bogus operator", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Operator(999),
+				[]interface{}{
+					skydb.Expression{skydb.KeyPath, "title"},
+					skydb.Expression{skydb.Literal, "hello world"},
+				},
+			})
+			So(err, ShouldResemble, skydb.ErrUnsupportedOperator{skydb.Operator(999)})
+		})
+
+		Convey("bogus operator nested in compound predicate", func() {
+			_, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.And,
+				[]interface{}{
+					skydb.Predicate{
+						skydb.Operator(999),
+						[]interface{}{
+							skydb.Expression{skydb.KeyPath, "title"},
+							skydb.Expression{skydb.Literal, "hello world"},
+						},
+					},
+				},
+			})
+			So(err, ShouldResemble, skydb.ErrUnsupportedOperator{skydb.Operator(999)})
+		})
+
+		Convey("bogus operator in comparison sqlizer", func() {
+			sqlizer := &comparisonPredicateSqlizer{
+				[]expressionSqlizer{
+					newExpressionSqlizer("note", skydb.FieldType{Type: skydb.TypeString}, skydb.Expression{skydb.KeyPath, "title"}),
+					newExpressionSqlizer("note", skydb.FieldType{Type: skydb.TypeString}, skydb.Expression{skydb.Literal, "hello world"}),
+				},
+				skydb.Operator(999),
+			}
+			_, _, err := sqlizer.ToSql()
+			So(err, ShouldResemble, skydb.ErrUnsupportedOperator{skydb.Operator(999)})
+		})
 	})
 
 	Convey("Distance Predicate", t, func() {
@@ -307,6 +1262,66 @@ func TestAccessPredicateSqlizer(t *testing.T) {
 					`"_access" IS NULL)`)
 			So(args, ShouldResemble, []interface{}{"userid"})
 		})
+
+		Convey("serialized for roles without user ID", func() {
+			authinfo := skydb.AuthInfo{
+				Roles: []string{"admin", "writer"},
+			}
+			sqlizer := &accessPredicateSqlizer{
+				"",
+				&authinfo,
+				skydb.ReadLevel,
+			}
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual,
+				`("_access" @> '[{"role": "admin"}]' OR `+
+					`"_access" @> '[{"role": "writer"}]' OR `+
+					`"_access" @> '[{"public": true}]' OR `+
+					`"_access" IS NULL)`)
+			So(args, ShouldResemble, []interface{}{})
+		})
+	})
+}
+
+func TestACLPredicateSqlizer(t *testing.T) {
+	Convey("Functional Predicate on ACL", t, func() {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+
+		db := mock_skydb.NewMockDatabase(ctrl)
+		f := NewPredicateSqlizerFactory(db, "note").(*predicateSqlizerFactory)
+
+		Convey("public readable", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Functional,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.IsPublicReadableFunc{}},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual,
+				`("note"."_access" @> '[{"public": true}]' OR "note"."_access" IS NULL)`)
+			So(args, ShouldBeEmpty)
+		})
+
+		Convey("acl contains role", func() {
+			sqlizer, err := f.NewPredicateSqlizer(skydb.Predicate{
+				skydb.Functional,
+				[]interface{}{
+					skydb.Expression{skydb.Function, skydb.ACLContainsRoleFunc{"o'reilly"}},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			sql, args, err := sqlizer.ToSql()
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `"note"."_access" @> ?::jsonb`)
+			So(args, ShouldResemble, []interface{}{`[{"role":"o'reilly"}]`})
+		})
 	})
 }
 
@@ -17,16 +17,41 @@ package builder
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
 func SortOrderBySQL(alias string, sort skydb.Sort) (string, error) {
+	return sortOrderBySQL(alias, sort, false)
+}
+
+// ByteOrderSortOrderBySQL is like SortOrderBySQL, except that a text
+// column is compared as bytes instead of by the collation of the
+// database, which is how Go compares strings.
+func ByteOrderSortOrderBySQL(alias string, sort skydb.Sort) (string, error) {
+	return sortOrderBySQL(alias, sort, true)
+}
+
+func sortOrderBySQL(alias string, sort skydb.Sort, byteOrder bool) (string, error) {
 	var expr string
+	nullsLast := false
 
 	switch sort.Expression.Type {
 	case skydb.KeyPath:
-		expr = fullQuoteIdentifier(alias, sort.Expression.Value.(string))
+		components := sort.Expression.KeyPathComponents()
+		if len(components) > 1 {
+			expr = jsonNumberOrderBySQL(alias, components[0], components[1:])
+			nullsLast = true
+		} else {
+			expr = fullQuoteIdentifier(alias, sort.Expression.Value.(string))
+			if sort.CaseInsensitive {
+				expr = fmt.Sprintf("LOWER(%s)", expr)
+			}
+			if byteOrder {
+				expr = fmt.Sprintf(`%s::text COLLATE "C"`, expr)
+			}
+		}
 	case skydb.Function:
 		var err error
 		expr, err = funcOrderBySQL(alias, sort.Expression.Value.(skydb.Func))
@@ -41,10 +66,26 @@ func SortOrderBySQL(alias string, sort skydb.Sort) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if nullsLast {
+		order += " NULLS LAST"
+	}
 
 	return fmt.Sprintf(expr + " " + order), nil
 }
 
+// jsonNumberOrderBySQL returns SQL of the number at the path within a
+// JSON field. Values that are not numbers are NULL.
+func jsonNumberOrderBySQL(alias string, field string, path []string) string {
+	column := fullQuoteIdentifier(alias, field)
+	quotedPath := make([]string, len(path))
+	for i, key := range path {
+		quotedPath[i] = QuoteLiteral(key)
+	}
+	pathArray := fmt.Sprintf("ARRAY[%s]", strings.Join(quotedPath, ", "))
+	return fmt.Sprintf("(CASE WHEN jsonb_typeof(%s #> %s) = 'number' THEN (%s #>> %s)::numeric END)",
+		column, pathArray, column, pathArray)
+}
+
 // due to sq not being able to pass args in OrderBy, we can't re-use funcToSQLOperand
 func funcOrderBySQL(alias string, fun skydb.Func) (string, error) {
 	switch f := fun.(type) {
@@ -56,11 +97,26 @@ func funcOrderBySQL(alias string, fun skydb.Func) (string, error) {
 			f.Location.Lat(),
 		)
 		return sql, nil
+	case skydb.FullTextMatchFunc:
+		sql := fmt.Sprintf(
+			"ts_rank(%s, plainto_tsquery(%s, %s))",
+			fullTextDocumentSQL(alias, f.Fields),
+			fullTextConfig,
+			QuoteLiteral(f.Query),
+		)
+		return sql, nil
 	default:
 		return "", fmt.Errorf("got unrecgonized skydb.Func = %T", fun)
 	}
 }
 
+// QuoteLiteral quotes s as a string literal, relying on
+// standard_conforming_strings being on so that backslashes are not
+// escape characters.
+func QuoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
 func sortOrderOrderBySQL(order skydb.SortOrder) (string, error) {
 	switch order {
 	case skydb.Asc:
@@ -0,0 +1,87 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func TestSortOrderBySQL(t *testing.T) {
+	Convey("SortOrderBySQL", t, func() {
+		Convey("keypath", func() {
+			sql, err := SortOrderBySQL("note", skydb.Sort{
+				Expression: skydb.Expression{skydb.KeyPath, "title"},
+				Order:      skydb.Desc,
+			})
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `"note"."title" DESC`)
+		})
+
+		Convey("case insensitive keypath", func() {
+			sql, err := SortOrderBySQL("note", skydb.Sort{
+				Expression:      skydb.Expression{skydb.KeyPath, "title"},
+				Order:           skydb.Asc,
+				CaseInsensitive: true,
+			})
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `LOWER("note"."title") ASC`)
+		})
+
+		Convey("json keypath", func() {
+			sql, err := SortOrderBySQL("note", skydb.Sort{
+				Expression: skydb.Expression{skydb.KeyPath, "stats.views"},
+				Order:      skydb.Desc,
+			})
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `(CASE WHEN jsonb_typeof("note"."stats" #> ARRAY['views']) = 'number' `+
+				`THEN ("note"."stats" #>> ARRAY['views'])::numeric END) DESC NULLS LAST`)
+		})
+
+		Convey("json keypath with quote", func() {
+			sql, err := SortOrderBySQL("note", skydb.Sort{
+				Expression: skydb.Expression{skydb.KeyPath, "stats.it's"},
+				Order:      skydb.Asc,
+			})
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `(CASE WHEN jsonb_typeof("note"."stats" #> ARRAY['it''s']) = 'number' `+
+				`THEN ("note"."stats" #>> ARRAY['it''s'])::numeric END) ASC NULLS LAST`)
+		})
+	})
+
+	Convey("ByteOrderSortOrderBySQL", t, func() {
+		Convey("keypath", func() {
+			sql, err := ByteOrderSortOrderBySQL("note", skydb.Sort{
+				Expression: skydb.Expression{skydb.KeyPath, "title"},
+				Order:      skydb.Desc,
+			})
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `"note"."title"::text COLLATE "C" DESC`)
+		})
+
+		Convey("case insensitive keypath", func() {
+			sql, err := ByteOrderSortOrderBySQL("note", skydb.Sort{
+				Expression:      skydb.Expression{skydb.KeyPath, "title"},
+				Order:           skydb.Asc,
+				CaseInsensitive: true,
+			})
+			So(err, ShouldBeNil)
+			So(sql, ShouldEqual, `LOWER("note"."title")::text COLLATE "C" ASC`)
+		})
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"strconv"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// fieldTypeCompatible returns whether a value of fieldType can be saved
+// to a column of columnType. In addition to skydb.FieldType's own rule,
+// numbers can be saved to string columns when the conn coerces them.
+func (db *database) fieldTypeCompatible(columnType, fieldType skydb.FieldType) bool {
+	if db.c.coerceStringFields && columnType.Type == skydb.TypeString && fieldType.Type == skydb.TypeNumber {
+		return true
+	}
+	return columnType.DefinitionCompatibleTo(fieldType)
+}
+
+// schemaCompatible returns whether a record of schema can be saved to
+// a table of remoteSchema without adding or altering columns.
+func (db *database) schemaCompatible(remoteSchema, schema skydb.RecordSchema) bool {
+	for key, fieldType := range schema {
+		columnType, ok := remoteSchema[key]
+		if !ok || !db.fieldTypeCompatible(columnType, fieldType) {
+			return false
+		}
+	}
+	return true
+}
+
+// coerceStringFields converts numbers in the record data to strings
+// for the fields of TypeString in schema.
+func coerceStringFields(schema skydb.RecordSchema, record *skydb.Record) {
+	for key, value := range record.Data {
+		if number, ok := value.(float64); ok && schema[key].Type == skydb.TypeString {
+			record.Data[key] = formatNumber(number)
+		}
+	}
+}
+
+// coerceStringComparisons returns a copy of the predicate in which
+// numbers compared with fields of TypeString in schema are converted
+// to strings.
+func coerceStringComparisons(p skydb.Predicate, schema skydb.RecordSchema) skydb.Predicate {
+	if p.Operator.IsCompound() {
+		children := make([]interface{}, len(p.Children))
+		for i, child := range p.Children {
+			children[i] = coerceStringComparisons(child.(skydb.Predicate), schema)
+		}
+		return skydb.Predicate{Operator: p.Operator, Children: children}
+	}
+
+	if !p.Operator.IsBinary() {
+		return p
+	}
+
+	isStringField := func(expr skydb.Expression) bool {
+		return expr.IsKeyPath() && schema[expr.Value.(string)].Type == skydb.TypeString
+	}
+
+	lhs := p.Children[0].(skydb.Expression)
+	rhs := p.Children[1].(skydb.Expression)
+	children := []interface{}{lhs, rhs}
+	if isStringField(lhs) {
+		children[1] = coerceStringLiteral(rhs)
+	}
+	if isStringField(rhs) {
+		children[0] = coerceStringLiteral(lhs)
+	}
+	return skydb.Predicate{Operator: p.Operator, Children: children}
+}
+
+// coerceStringLiteral converts a number literal, or numbers in a list
+// literal, to strings.
+func coerceStringLiteral(expr skydb.Expression) skydb.Expression {
+	if expr.Type != skydb.Literal {
+		return expr
+	}
+
+	switch value := expr.Value.(type) {
+	case float64:
+		return skydb.Expression{Type: skydb.Literal, Value: formatNumber(value)}
+	case []interface{}:
+		values := make([]interface{}, len(value))
+		for i, item := range value {
+			if number, ok := item.(float64); ok {
+				values[i] = formatNumber(number)
+			} else {
+				values[i] = item
+			}
+		}
+		return skydb.Expression{Type: skydb.Literal, Value: values}
+	}
+	return expr
+}
+
+// formatNumber formats a number in the shortest representation,
+// without exponent, e.g. 1 for 1.0.
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
@@ -0,0 +1,113 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCoerceStringFields(t *testing.T) {
+	Convey("coerceStringFields", t, func() {
+		schema := skydb.RecordSchema{
+			"code":   skydb.FieldType{Type: skydb.TypeString},
+			"amount": skydb.FieldType{Type: skydb.TypeNumber},
+		}
+
+		Convey("converts numbers of string fields", func() {
+			record := skydb.Record{
+				ID: skydb.NewRecordID("note", "id"),
+				Data: map[string]interface{}{
+					"code":   float64(42),
+					"amount": float64(1.5),
+					"other":  float64(1),
+				},
+			}
+			coerceStringFields(schema, &record)
+			So(record.Data, ShouldResemble, skydb.Data{
+				"code":   "42",
+				"amount": float64(1.5),
+				"other":  float64(1),
+			})
+		})
+	})
+}
+
+func TestCoerceStringComparisons(t *testing.T) {
+	Convey("coerceStringComparisons", t, func() {
+		schema := skydb.RecordSchema{
+			"code":   skydb.FieldType{Type: skydb.TypeString},
+			"amount": skydb.FieldType{Type: skydb.TypeNumber},
+		}
+
+		Convey("converts numbers compared with string fields", func() {
+			p := coerceStringComparisons(skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.Literal, Value: float64(0.25)},
+							skydb.Expression{Type: skydb.KeyPath, Value: "code"},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.In,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "code"},
+							skydb.Expression{Type: skydb.Literal, Value: []interface{}{float64(1), "2"}},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.GreaterThan,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "amount"},
+							skydb.Expression{Type: skydb.Literal, Value: float64(3)},
+						},
+					},
+				},
+			}, schema)
+
+			So(p, ShouldResemble, skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.Literal, Value: "0.25"},
+							skydb.Expression{Type: skydb.KeyPath, Value: "code"},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.In,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "code"},
+							skydb.Expression{Type: skydb.Literal, Value: []interface{}{"1", "2"}},
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.GreaterThan,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "amount"},
+							skydb.Expression{Type: skydb.Literal, Value: float64(3)},
+						},
+					},
+				},
+			})
+		})
+	})
+}
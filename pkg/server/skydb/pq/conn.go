@@ -20,15 +20,27 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	sq "github.com/lann/squirrel"
 	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
 
 var psql = sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
+// maxTransactionAttempts is the number of times RunInTransaction runs
+// a transaction before giving up.
+const maxTransactionAttempts = 5
+
+// transactionRetryDelay returns how long to wait before running
+// a transaction again after the specified number of failed attempts.
+var transactionRetryDelay = func(attempt int) time.Duration {
+	return time.Duration(1<<uint(attempt-1)) * 20 * time.Millisecond
+}
+
 // providerInfoValue implements sql.Valuer and sql.Scanner s.t.
 // skydb.ProviderInfo can be saved into and recovered from postgresql
 type providerInfoValue struct {
@@ -77,6 +89,7 @@ type conn struct {
 	db                     *sqlx.DB // database wrapper
 	tx                     *sqlx.Tx // transaction wrapper, nil when no transaction
 	RecordSchema           map[string]skydb.RecordSchema
+	recordTypeOptions      map[string]skydb.ExtendOptions
 	FieldACL               *skydb.FieldACL
 	appName                string
 	option                 string
@@ -84,6 +97,17 @@ type conn struct {
 	accessModel            skydb.AccessModel
 	canMigrate             bool
 	passwordHistoryEnabled bool
+	exactTypeStats         bool
+	coerceStringFields     bool
+	queryCache             *queryCache
+	modifiedRecordTypes    []string // record types modified in the transaction
+	outboxEnabled          bool
+	recordHistoryEnabled   bool
+	redactSQLArgs          bool // see skydb.DBConfig.LogMutatingSQL
+	maxRecordSize          int
+	fieldKeyProvider       skydb.FieldKeyProvider
+	defaultQueryLimit      uint64
+	sequences              map[string]bool // named sequences known to exist
 	context                context.Context
 }
 
@@ -121,10 +145,20 @@ func (c *conn) Commit() error {
 
 	if err := c.tx.Commit(); err != nil {
 		log.Errorf("%p: Unable to commit transaction %p: %v", c, c.tx, err)
+		// the transaction is finished even if it fails to commit
+		c.tx = nil
+		c.modifiedRecordTypes = nil
 		return err
 	}
 	c.tx = nil
 	log.Debugf("%p: Committed transaction", c)
+
+	// queries run by others before the commit might have cached records
+	// without the modification
+	for _, recordType := range c.modifiedRecordTypes {
+		c.queryCache.invalidate(recordType)
+	}
+	c.modifiedRecordTypes = nil
 	return nil
 }
 
@@ -139,10 +173,87 @@ func (c *conn) Rollback() error {
 		return err
 	}
 	c.tx = nil
+	c.modifiedRecordTypes = nil
 	log.Debugf("%p: Rolled back transaction", c)
 	return nil
 }
 
+// invalidateQueryCache discards cached query results reading from the
+// table after it is modified. The table is either a record type or a
+// table joined by queries, such as a relation table.
+func (c *conn) invalidateQueryCache(table string) {
+	if c.queryCache == nil {
+		return
+	}
+
+	c.queryCache.invalidate(table)
+	if c.tx != nil {
+		c.modifiedRecordTypes = append(c.modifiedRecordTypes, table)
+	}
+}
+
+// Savepoint establishes a savepoint in the current transaction.
+func (c *conn) Savepoint(name string) error {
+	if c.tx == nil {
+		return skydb.ErrDatabaseTxDidNotBegin
+	}
+
+	if _, err := c.Exec("SAVEPOINT " + pq.QuoteIdentifier(name)); err != nil {
+		log.Errorf("%p: Unable to establish savepoint %s in transaction %p: %v", c, name, c.tx, err)
+		return err
+	}
+	log.Debugf("%p: Established savepoint %s", c, name)
+	return nil
+}
+
+// RollbackTo rollbacks a transaction to a savepoint.
+func (c *conn) RollbackTo(name string) error {
+	if c.tx == nil {
+		return skydb.ErrDatabaseTxDidNotBegin
+	}
+
+	if _, err := c.Exec("ROLLBACK TO SAVEPOINT " + pq.QuoteIdentifier(name)); err != nil {
+		log.Errorf("%p: Unable to rollback transaction %p to savepoint %s: %v", c, c.tx, name, err)
+		return err
+	}
+	log.Debugf("%p: Rolled back to savepoint %s", c, name)
+	return nil
+}
+
+// RunInTransaction calls fn within a transaction, retrying it if the
+// transaction is aborted because of serialization failure or deadlock.
+func (c *conn) RunInTransaction(fn func(tx skydb.Conn) error) (err error) {
+	for attempt := 1; ; attempt++ {
+		err = c.runInTransaction(fn)
+		if err == nil || !isTransactionRetryable(err) || attempt >= maxTransactionAttempts {
+			return
+		}
+
+		delay := transactionRetryDelay(attempt)
+		log.WithFields(logrus.Fields{
+			"attempt": attempt,
+			"delay":   delay,
+			"error":   err,
+		}).Warnln("Transaction aborted, retrying")
+		time.Sleep(delay)
+	}
+}
+
+func (c *conn) runInTransaction(fn func(tx skydb.Conn) error) error {
+	if err := c.Begin(); err != nil {
+		return err
+	}
+
+	if err := fn(c); err != nil {
+		if rbErr := c.Rollback(); rbErr != nil {
+			log.Errorf("%p: Failed to rollback: %v", c, rbErr)
+		}
+		return err
+	}
+
+	return c.Commit()
+}
+
 func (c *conn) PublicDB() skydb.Database {
 	return &database{
 		c:            c,
@@ -169,7 +280,7 @@ func (c *conn) Close() error { return nil }
 
 // return the raw unquoted schema name of this app
 func (c *conn) schemaName() string {
-	return "app_" + toLowerAndUnderscore(c.appName)
+	return appSchemaName(c.appName)
 }
 
 // return the quoted table name ready to be used as identifier (in the form
@@ -16,6 +16,7 @@ package pq
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 	sq "github.com/lann/squirrel"
@@ -27,7 +28,7 @@ func (c *conn) Get(dest interface{}, query string, args ...interface{}) (err err
 	err = c.Db().GetContext(c.context, dest, query, args...)
 	logFields := logrus.Fields{
 		"sql":            query,
-		"args":           args,
+		"args":           c.logArgs(args),
 		"error":          err,
 		"executionCount": c.statementCount,
 	}
@@ -35,6 +36,7 @@ func (c *conn) Get(dest interface{}, query string, args ...interface{}) (err err
 		log.WithFields(logFields).Errorln("Failed to execute SQL with sql.Get")
 	} else {
 		log.WithFields(logFields).Debugln("Executed SQL successfully with sql.Get")
+		c.logMutatingSQL(query, args)
 	}
 	return
 }
@@ -64,7 +66,7 @@ func (c *conn) Exec(query string, args ...interface{}) (result sql.Result, err e
 
 	logFields := logrus.Fields{
 		"sql":            query,
-		"args":           args,
+		"args":           c.logArgs(args),
 		"error":          err,
 		"executionCount": c.statementCount,
 		"rowsAffected":   rowsAffected,
@@ -73,6 +75,7 @@ func (c *conn) Exec(query string, args ...interface{}) (result sql.Result, err e
 		log.WithFields(logFields).Errorln("Failed to execute SQL with sql.Exec")
 	} else {
 		log.WithFields(logFields).Debugln("Executed SQL successfully with sql.Exec")
+		c.logMutatingSQL(query, args)
 	}
 	return
 }
@@ -90,7 +93,7 @@ func (c *conn) Queryx(query string, args ...interface{}) (rows *sqlx.Rows, err e
 	rows, err = c.Db().QueryxContext(c.context, query, args...)
 	logFields := logrus.Fields{
 		"sql":            query,
-		"args":           args,
+		"args":           c.logArgs(args),
 		"error":          err,
 		"executionCount": c.statementCount,
 	}
@@ -98,6 +101,7 @@ func (c *conn) Queryx(query string, args ...interface{}) (rows *sqlx.Rows, err e
 		log.WithFields(logFields).Errorln("Failed to execute SQL with sql.Queryx")
 	} else {
 		log.WithFields(logFields).Debugln("Executed SQL successfully with sql.Queryx")
+		c.logMutatingSQL(query, args)
 	}
 	return
 }
@@ -115,9 +119,10 @@ func (c *conn) QueryRowx(query string, args ...interface{}) (row *sqlx.Row) {
 	row = c.Db().QueryRowxContext(c.context, query, args...)
 	log.WithFields(logrus.Fields{
 		"sql":            query,
-		"args":           args,
+		"args":           c.logArgs(args),
 		"executionCount": c.statementCount,
 	}).Debugln("Executed SQL with sql.QueryRowx")
+	c.logMutatingSQL(query, args)
 	return
 }
 
@@ -128,3 +133,74 @@ func (c *conn) QueryRowWith(sqlizeri sq.Sqlizer) *sqlx.Row {
 	}
 	return c.QueryRowx(sql, args...)
 }
+
+// mutatingSQLCommands are the SQL commands logged by logMutatingSQL.
+var mutatingSQLCommands = map[string]bool{
+	"INSERT":   true,
+	"UPDATE":   true,
+	"DELETE":   true,
+	"TRUNCATE": true,
+	"CREATE":   true,
+	"ALTER":    true,
+	"DROP":     true,
+}
+
+// logMutatingSQL logs the statement at info level if it modifies data
+// and DBConfig.LogMutatingSQL is set. The values of bound parameters
+// are not logged.
+func (c *conn) logMutatingSQL(query string, args []interface{}) {
+	if !c.redactSQLArgs {
+		return
+	}
+
+	if !isMutatingSQL(query) {
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"sql":  query,
+		"args": redactSQLArgs(args),
+	}).Infoln("Executed SQL modifying data")
+}
+
+// isMutatingSQL returns whether the statement modifies data. A statement
+// with a WITH clause, such as the upsert of builder.UpsertQuery, is
+// mutating if it contains an INSERT, UPDATE or DELETE.
+func isMutatingSQL(query string) bool {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return false
+	}
+
+	command := strings.ToUpper(words[0])
+	if command != "WITH" {
+		return mutatingSQLCommands[command]
+	}
+	for _, word := range words[1:] {
+		switch strings.ToUpper(strings.TrimLeft(word, "(")) {
+		case "INSERT", "UPDATE", "DELETE":
+			return true
+		}
+	}
+	return false
+}
+
+// logArgs returns the bound parameters to be logged with the statement.
+func (c *conn) logArgs(args []interface{}) []interface{} {
+	if c.redactSQLArgs {
+		return redactSQLArgs(args)
+	}
+	return args
+}
+
+// redactSQLArgs replaces the values of bound parameters, keeping only
+// whether they are null.
+func redactSQLArgs(args []interface{}) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg != nil {
+			redacted[i] = "[REDACTED]"
+		}
+	}
+	return redacted
+}
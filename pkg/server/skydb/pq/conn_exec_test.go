@@ -0,0 +1,96 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogMutatingSQL(t *testing.T) {
+	Convey("Conn logging mutating SQL", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		c.redactSQLArgs = true
+
+		var buf bytes.Buffer
+		logger := log.Logger
+		originalOut, originalFormatter, originalLevel := logger.Out, logger.Formatter, logger.Level
+		logger.Out = &buf
+		logger.Formatter = &logrus.JSONFormatter{}
+		logger.Level = logrus.DebugLevel
+		defer func() {
+			logger.Out = originalOut
+			logger.Formatter = originalFormatter
+			logger.Level = originalLevel
+		}()
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		buf.Reset()
+		record := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id"),
+			OwnerID: "user-id",
+			Data: skydb.Data{
+				"content": "my secret note",
+			},
+		}
+		So(db.Save(&record), ShouldBeNil)
+
+		output := buf.String()
+		So(output, ShouldContainSubstring, "Executed SQL modifying data")
+		So(output, ShouldContainSubstring, `INSERT INTO `)
+		So(output, ShouldContainSubstring, `\"note\"`)
+		So(output, ShouldContainSubstring, "[REDACTED]")
+		So(output, ShouldNotContainSubstring, "my secret note")
+		So(output, ShouldNotContainSubstring, "user-id")
+	})
+}
+
+func TestIsMutatingSQL(t *testing.T) {
+	Convey("isMutatingSQL", t, func() {
+		Convey("is true for data modifying commands", func() {
+			So(isMutatingSQL(`INSERT INTO "note" ("_id") VALUES ($1)`), ShouldBeTrue)
+			So(isMutatingSQL(`delete from "note" where "_id" = $1`), ShouldBeTrue)
+			So(isMutatingSQL(`ALTER TABLE "note" ADD COLUMN IF NOT EXISTS "content" text`), ShouldBeTrue)
+		})
+
+		Convey("is true for an upsert with a WITH clause", func() {
+			stmt, _, err := builder.UpsertQuery("note", map[string]interface{}{
+				"_id": "id",
+			}, map[string]interface{}{
+				"content": "my note",
+			}).ToSql()
+			So(err, ShouldBeNil)
+			So(stmt, ShouldContainSubstring, "WITH updated AS (")
+			So(isMutatingSQL(stmt), ShouldBeTrue)
+		})
+
+		Convey("is false for queries", func() {
+			So(isMutatingSQL(`SELECT "_id" FROM "note"`), ShouldBeFalse)
+			So(isMutatingSQL(`WITH t AS (SELECT "update" FROM "note") SELECT * FROM t`), ShouldBeFalse)
+			So(isMutatingSQL(""), ShouldBeFalse)
+		})
+	})
+}
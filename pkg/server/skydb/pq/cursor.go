@@ -0,0 +1,74 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"encoding/base64"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// cursor pages through records by keyset pagination on _id, so that
+// its position is fully described by the last ID returned, which is
+// encoded as the token.
+type cursor struct {
+	db                   *database
+	query                skydb.Query
+	accessControlOptions skydb.AccessControlOptions
+	afterID              string
+}
+
+func (db *database) OpenCursor(query *skydb.Query, token string, accessControlOptions *skydb.AccessControlOptions) (skydb.Cursor, error) {
+	if len(query.Sorts) > 0 || query.Limit != nil || query.Offset > 0 || query.After != nil {
+		return nil, skyerr.NewError(skyerr.InvalidArgument,
+			"cursor does not support sorts, limit, offset or after")
+	}
+
+	afterID, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, skyerr.NewError(skyerr.InvalidArgument, "invalid cursor token")
+	}
+
+	return &cursor{
+		db:                   db,
+		query:                *query,
+		accessControlOptions: *accessControlOptions,
+		afterID:              string(afterID),
+	}, nil
+}
+
+func (c *cursor) Next(batchSize uint64) ([]skydb.Record, string, error) {
+	query := c.query
+	query.Sorts = defaultSorts
+	query.Limit = &batchSize
+	if c.afterID != "" {
+		query.After = &skydb.QueryPosition{ID: c.afterID}
+	}
+
+	rows, err := c.db.Query(&query, &c.accessControlOptions)
+	if err != nil {
+		return nil, "", err
+	}
+	records, _, err := readRows(rows)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(records) > 0 {
+		c.afterID = records[len(records)-1].ID.Key
+	}
+	return records, base64.RawURLEncoding.EncodeToString([]byte(c.afterID)), nil
+}
@@ -0,0 +1,165 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCursor(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"done": skydb.FieldType{Type: skydb.TypeBoolean},
+		})
+		So(err, ShouldBeNil)
+
+		for i, key := range []string{"note1", "note2", "note3", "note4", "note5"} {
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("note", key),
+				OwnerID: "user1",
+				Data: skydb.Data{
+					"done": i%2 == 0,
+				},
+			}), ShouldBeNil)
+		}
+
+		recordKeys := func(records []skydb.Record) []string {
+			keys := []string{}
+			for _, record := range records {
+				keys = append(keys, record.ID.Key)
+			}
+			return keys
+		}
+		bypassAccessControl := skydb.AccessControlOptions{BypassAccessControl: true}
+
+		Convey("continues from a token without gaps", func() {
+			query := skydb.Query{Type: "note"}
+			cursor, err := db.OpenCursor(&query, "", &bypassAccessControl)
+			So(err, ShouldBeNil)
+
+			records, token, err := cursor.Next(2)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note1", "note2"})
+
+			// Reopen with a new connection, like another process would.
+			anotherConn, err := Open(context.Background(), c.appName, skydb.RoleBasedAccess, "", skydb.DBConfig{})
+			So(err, ShouldBeNil)
+			defer anotherConn.Close()
+			cursor, err = anotherConn.PublicDB().OpenCursor(&query, token, &bypassAccessControl)
+			So(err, ShouldBeNil)
+
+			records, _, err = cursor.Next(2)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note3", "note4"})
+
+			records, token, err = cursor.Next(2)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note5"})
+
+			records, nextToken, err := cursor.Next(2)
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+			So(nextToken, ShouldEqual, token)
+		})
+
+		Convey("applies the predicate", func() {
+			cursor, err := db.OpenCursor(&skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "done",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: true,
+						},
+					},
+				},
+			}, "", &bypassAccessControl)
+			So(err, ShouldBeNil)
+
+			records, _, err := cursor.Next(2)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note1", "note3"})
+
+			records, _, err = cursor.Next(2)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note5"})
+		})
+
+		Convey("skips records not readable by the user", func() {
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("note", "note6"),
+				OwnerID: "user1",
+				ACL:     skydb.RecordACL{},
+				Data: skydb.Data{
+					"done": false,
+				},
+			}), ShouldBeNil)
+
+			query := skydb.Query{Type: "note"}
+			cursor, err := db.OpenCursor(&query, "", &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user2"},
+			})
+			So(err, ShouldBeNil)
+
+			records, token, err := cursor.Next(3)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note1", "note2", "note3"})
+
+			cursor, err = db.OpenCursor(&query, token, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user2"},
+			})
+			So(err, ShouldBeNil)
+
+			records, _, err = cursor.Next(3)
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note4", "note5"})
+		})
+
+		Convey("rejects invalid token", func() {
+			_, err := db.OpenCursor(&skydb.Query{Type: "note"}, "!!!", &bypassAccessControl)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+
+		Convey("rejects query with sorts", func() {
+			_, err := db.OpenCursor(&skydb.Query{
+				Type: "note",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "done",
+						},
+					},
+				},
+			}, "", &bypassAccessControl)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
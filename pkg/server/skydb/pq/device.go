@@ -20,79 +20,98 @@ import (
 	"fmt"
 	"time"
 
+	sq "github.com/lann/squirrel"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
-func (c *conn) GetDevice(id string, device *skydb.Device) error {
-	builder := psql.Select("type", "token", "auth_id", "topic", "last_registered_at").
-		From(c.tableName("_device")).
-		Where("id = ?", id)
+// deviceColumns are the columns of a device scanned by scanDevice.
+var deviceColumns = []string{
+	"id", "type", "token", "auth_id", "topic", "last_registered_at",
+	"app_version", "os_version", "metadata",
+}
+
+type deviceScanner interface {
+	Scan(dest ...interface{}) error
+}
 
-	nullableToken := sql.NullString{}
-	nullableTopic := sql.NullString{}
-	nullableUserID := sql.NullString{}
-	err := c.QueryRowWith(builder).Scan(
+func scanDevice(scanner deviceScanner, device *skydb.Device) error {
+	var (
+		nullableToken      sql.NullString
+		nullableUserID     sql.NullString
+		nullableTopic      sql.NullString
+		nullableAppVersion sql.NullString
+		nullableOSVersion  sql.NullString
+		metadata           nullJSON
+	)
+	if err := scanner.Scan(
+		&device.ID,
 		&device.Type,
 		&nullableToken,
 		&nullableUserID,
 		&nullableTopic,
 		&device.LastRegisteredAt,
-	)
-
-	if err == sql.ErrNoRows {
-		return skydb.ErrDeviceNotFound
-	} else if err != nil {
+		&nullableAppVersion,
+		&nullableOSVersion,
+		&metadata,
+	); err != nil {
 		return err
 	}
 
 	device.Token = nullableToken.String
-	device.Topic = nullableTopic.String
 	device.AuthInfoID = nullableUserID.String
-	device.LastRegisteredAt = device.LastRegisteredAt.In(time.UTC)
-	device.ID = id
-
+	device.Topic = nullableTopic.String
+	device.LastRegisteredAt = device.LastRegisteredAt.UTC()
+	device.AppVersion = nullableAppVersion.String
+	device.OSVersion = nullableOSVersion.String
+	device.Metadata, _ = metadata.JSON.(map[string]interface{})
 	return nil
 }
 
-func (c *conn) QueryDevicesByUser(user string) ([]skydb.Device, error) {
-	builder := psql.Select("id", "type", "token", "auth_id", "topic", "last_registered_at").
+func (c *conn) GetDevice(id string, device *skydb.Device) error {
+	builder := psql.Select(deviceColumns...).
 		From(c.tableName("_device")).
-		Where("auth_id = ?", user)
-
-	rows, err := c.QueryWith(builder)
-	if err != nil {
-		panic(err)
-	}
-	defer rows.Close()
-	results := []skydb.Device{}
-	for rows.Next() {
-		nullableToken := sql.NullString{}
-		nullableTopic := sql.NullString{}
-		d := skydb.Device{}
-		if err := rows.Scan(
-			&d.ID,
-			&d.Type,
-			&nullableToken,
-			&d.AuthInfoID,
-			&nullableTopic,
-			&d.LastRegisteredAt); err != nil {
+		Where("id = ?", id)
 
-			panic(err)
-		}
-		d.Token = nullableToken.String
-		d.Topic = nullableTopic.String
-		d.LastRegisteredAt = d.LastRegisteredAt.UTC()
-		results = append(results, d)
+	err := scanDevice(c.QueryRowWith(builder), device)
+	if err == sql.ErrNoRows {
+		return skydb.ErrDeviceNotFound
 	}
+	return err
+}
 
-	return results, nil
+func (c *conn) QueryDevicesByUser(user string) ([]skydb.Device, error) {
+	return c.queryDevices(sq.Eq{"auth_id": user})
 }
 
 func (c *conn) QueryDevicesByUserAndTopic(user, topic string) ([]skydb.Device, error) {
-	builder := psql.Select("id", "type", "token", "auth_id", "topic", "last_registered_at").
+	return c.queryDevices(sq.Eq{"auth_id": user, "topic": topic})
+}
+
+func (c *conn) QueryDevicesByAppVersion(appVersion string) ([]skydb.Device, error) {
+	return c.queryDevices(sq.Eq{"app_version": appVersion})
+}
+
+func (c *conn) QueryEmptyDevicesByTime(t time.Time) ([]skydb.Device, error) {
+	return c.queryDevices(emptyDevicesPredicate(t))
+}
+
+// emptyDevicesPredicate matches devices without a token last registered
+// before t, regardless of when they are registered if t is ZeroTime.
+func emptyDevicesPredicate(t time.Time) sq.Sqlizer {
+	pred := sq.And{sq.Expr("token IS NULL")}
+	if t != skydb.ZeroTime {
+		pred = append(pred, sq.Expr("last_registered_at < ?", t))
+	}
+	return pred
+}
+
+func (c *conn) queryDevices(pred sq.Sqlizer) ([]skydb.Device, error) {
+	builder := psql.Select(deviceColumns...).
 		From(c.tableName("_device")).
-		Where("auth_id = ? AND topic = ?", user, topic)
+		Where(pred).
+		OrderBy("id")
 
 	rows, err := c.QueryWith(builder)
 	if err != nil {
@@ -101,20 +120,10 @@ func (c *conn) QueryDevicesByUserAndTopic(user, topic string) ([]skydb.Device, e
 	defer rows.Close()
 	results := []skydb.Device{}
 	for rows.Next() {
-		var nullableToken sql.NullString
 		d := skydb.Device{}
-		if err := rows.Scan(
-			&d.ID,
-			&d.Type,
-			&nullableToken,
-			&d.AuthInfoID,
-			&d.Topic,
-			&d.LastRegisteredAt); err != nil {
-
+		if err := scanDevice(rows, &d); err != nil {
 			panic(err)
 		}
-		d.Token = nullableToken.String
-		d.LastRegisteredAt = d.LastRegisteredAt.UTC()
 		results = append(results, d)
 	}
 
@@ -145,11 +154,47 @@ func (c *conn) SaveDevice(device *skydb.Device) error {
 		data["topic"] = device.Topic
 	}
 
+	if device.AppVersion != "" {
+		data["app_version"] = device.AppVersion
+	}
+
+	if device.OSVersion != "" {
+		data["os_version"] = device.OSVersion
+	}
+
+	if device.Metadata != nil {
+		data["metadata"] = jsonMapValue(device.Metadata)
+	}
+
 	upsert := builder.UpsertQuery(c.tableName("_device"), pkData, data)
 	_, err := c.ExecWith(upsert)
 	return err
 }
 
+func (c *conn) RegisterDevice(device *skydb.Device) error {
+	if device.Token != "" {
+		builder := psql.Select("id").
+			From(c.tableName("_device")).
+			Where("type = ? AND token = ?", device.Type, device.Token).
+			OrderBy("last_registered_at DESC").
+			Limit(1)
+
+		var id string
+		err := c.QueryRowWith(builder).Scan(&id)
+		if err == nil {
+			device.ID = id
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	if device.ID == "" {
+		device.ID = uuid.New()
+	}
+	device.LastRegisteredAt = timeNow()
+	return c.SaveDevice(device)
+}
+
 func (c *conn) DeleteDevice(id string) error {
 	builder := psql.Delete(c.tableName("_device")).
 		Where("id = ?", id)
@@ -195,12 +240,26 @@ func (c *conn) DeleteDevicesByToken(token string, t time.Time) error {
 	return nil
 }
 
-func (c *conn) DeleteEmptyDevicesByTime(t time.Time) error {
+func (c *conn) DeleteDevicesByUser(user string) (int, error) {
 	builder := psql.Delete(c.tableName("_device")).
-		Where("token IS NULL")
-	if t != skydb.ZeroTime {
-		builder = builder.Where("last_registered_at < ?", t)
+		Where("auth_id = ?", user)
+	result, err := c.ExecWith(builder)
+
+	if err != nil {
+		return 0, err
 	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (c *conn) DeleteEmptyDevicesByTime(t time.Time) error {
+	builder := psql.Delete(c.tableName("_device")).
+		Where(emptyDevicesPredicate(t))
 	result, err := c.ExecWith(builder)
 
 	if err != nil {
@@ -272,6 +272,56 @@ func TestDevice(t *testing.T) {
 			So(device, ShouldResemble, device1)
 		})
 
+		Convey("queries empty devices the delete would remove", func() {
+			before := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+			for _, device := range []skydb.Device{
+				{
+					ID:               "deviceid0",
+					Type:             "ios",
+					AuthInfoID:       "userid",
+					LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 4, 0, time.UTC),
+				},
+				{
+					ID:               "deviceid1",
+					Type:             "ios",
+					Token:            "DEVICE_TOKEN",
+					AuthInfoID:       "userid",
+					LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 4, 0, time.UTC),
+				},
+				{
+					ID:               "deviceid2",
+					Type:             "android",
+					AuthInfoID:       "userid",
+					LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 3, 0, time.UTC),
+				},
+				{
+					ID:               "deviceid3",
+					Type:             "ios",
+					AuthInfoID:       "userid",
+					LastRegisteredAt: before,
+				},
+			} {
+				So(c.SaveDevice(&device), ShouldBeNil)
+			}
+
+			devices, err := c.QueryEmptyDevicesByTime(before)
+			So(err, ShouldBeNil)
+			ids := []string{}
+			for _, device := range devices {
+				ids = append(ids, device.ID)
+			}
+			So(ids, ShouldResemble, []string{"deviceid0", "deviceid2"})
+
+			So(c.DeleteEmptyDevicesByTime(before), ShouldBeNil)
+			for _, id := range ids {
+				So(c.GetDevice(id, &skydb.Device{}), ShouldEqual, skydb.ErrDeviceNotFound)
+			}
+			var count int
+			err = c.QueryRowx("SELECT COUNT(*) FROM _device").Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 4-len(ids))
+		})
+
 		Convey("fails to delete an existing record by type with a later LastRegisteredAt", func() {
 			device := skydb.Device{
 				ID:               "deviceid",
@@ -286,6 +336,90 @@ func TestDevice(t *testing.T) {
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
+		Convey("registers device by token idempotently", func() {
+			now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+			originalTimeNow := timeNow
+			timeNow = func() time.Time { return now }
+			defer func() {
+				timeNow = originalTimeNow
+			}()
+
+			device := skydb.Device{
+				Type:       "ios",
+				Token:      "devicetoken",
+				AuthInfoID: "userid",
+			}
+			So(c.RegisterDevice(&device), ShouldBeNil)
+			So(device.ID, ShouldNotBeEmpty)
+			firstID := device.ID
+
+			now = now.Add(time.Hour)
+			device = skydb.Device{
+				Type:       "ios",
+				Token:      "devicetoken",
+				AuthInfoID: "userid",
+			}
+			So(c.RegisterDevice(&device), ShouldBeNil)
+			So(device.ID, ShouldEqual, firstID)
+
+			devices, err := c.QueryDevicesByUser("userid")
+			So(err, ShouldBeNil)
+			So(devices, ShouldResemble, []skydb.Device{
+				{
+					ID:               firstID,
+					Type:             "ios",
+					Token:            "devicetoken",
+					AuthInfoID:       "userid",
+					LastRegisteredAt: time.Date(2006, 1, 2, 16, 4, 5, 0, time.UTC),
+				},
+			})
+		})
+
+		Convey("registers device without token by ID", func() {
+			device := skydb.Device{
+				ID:         "deviceid",
+				Type:       "android",
+				AuthInfoID: "userid",
+			}
+			So(c.RegisterDevice(&device), ShouldBeNil)
+			So(c.RegisterDevice(&device), ShouldBeNil)
+
+			devices, err := c.QueryDevicesByUser("userid")
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 1)
+			So(devices[0].ID, ShouldEqual, "deviceid")
+		})
+
+		Convey("deletes all devices of user", func() {
+			addUser(t, c, "otheruserid")
+			for _, device := range []skydb.Device{
+				{ID: "device1", Type: "ios", Token: "token1", AuthInfoID: "userid"},
+				{ID: "device2", Type: "android", Token: "token2", AuthInfoID: "userid"},
+				{ID: "device3", Type: "ios", AuthInfoID: "userid"},
+				{ID: "device4", Type: "ios", Token: "token4", AuthInfoID: "otheruserid"},
+			} {
+				device.LastRegisteredAt = time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+				So(c.SaveDevice(&device), ShouldBeNil)
+			}
+
+			count, err := c.DeleteDevicesByUser("userid")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+
+			devices, err := c.QueryDevicesByUser("userid")
+			So(err, ShouldBeNil)
+			So(devices, ShouldBeEmpty)
+
+			devices, err = c.QueryDevicesByUser("otheruserid")
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 1)
+			So(devices[0].ID, ShouldEqual, "device4")
+
+			count, err = c.DeleteDevicesByUser("userid")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
 		Convey("query devices by user", func() {
 			device := skydb.Device{
 				ID:               "device",
@@ -332,6 +466,52 @@ func TestDevice(t *testing.T) {
 			So(len(devices), ShouldEqual, 0)
 		})
 
+		Convey("saves device with versions and metadata", func() {
+			device := skydb.Device{
+				ID:               "deviceid",
+				Type:             "ios",
+				Token:            "devicetoken",
+				AuthInfoID:       "userid",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+				AppVersion:       "1.2.0",
+				OSVersion:        "10.3",
+				Metadata: map[string]interface{}{
+					"model": "iPhone9,1",
+				},
+			}
+			So(c.SaveDevice(&device), ShouldBeNil)
+
+			saved := skydb.Device{}
+			So(c.GetDevice("deviceid", &saved), ShouldBeNil)
+			So(saved, ShouldResemble, device)
+
+			devices, err := c.QueryDevicesByUser("userid")
+			So(err, ShouldBeNil)
+			So(devices, ShouldResemble, []skydb.Device{device})
+		})
+
+		Convey("query devices by app version", func() {
+			for _, device := range []skydb.Device{
+				{ID: "device1", Type: "ios", Token: "token1", AuthInfoID: "userid", AppVersion: "1.2.0"},
+				{ID: "device2", Type: "android", Token: "token2", AuthInfoID: "userid", AppVersion: "1.1.0"},
+				{ID: "device3", Type: "android", Token: "token3", AuthInfoID: "userid", AppVersion: "1.2.0"},
+				{ID: "device4", Type: "ios", Token: "token4", AuthInfoID: "userid"},
+			} {
+				device.LastRegisteredAt = time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+				So(c.SaveDevice(&device), ShouldBeNil)
+			}
+
+			devices, err := c.QueryDevicesByAppVersion("1.2.0")
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 2)
+			So(devices[0].ID, ShouldEqual, "device1")
+			So(devices[1].ID, ShouldEqual, "device3")
+
+			devices, err = c.QueryDevicesByAppVersion("2.0.0")
+			So(err, ShouldBeNil)
+			So(devices, ShouldBeEmpty)
+		})
+
 		Convey("query devices by user and topic", func() {
 			device := skydb.Device{
 				ID:               "device",
@@ -0,0 +1,67 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// connStringWithSSL returns a connection string with the SSL options in
+// config appended, converting URL connection string to the key/value
+// form if necessary. Since lib/pq takes the last occurrence of a key,
+// the appended options override those in connString.
+func connStringWithSSL(connString string, config skydb.DBConfig) (string, error) {
+	options := []struct {
+		key   string
+		value string
+	}{
+		{"sslmode", config.SSLMode},
+		{"sslrootcert", config.SSLRootCert},
+		{"sslcert", config.SSLCert},
+		{"sslkey", config.SSLKey},
+	}
+
+	pairs := []string{}
+	for _, option := range options {
+		if option.value != "" {
+			pairs = append(pairs, option.key+"="+quoteConnStringValue(option.value))
+		}
+	}
+	if len(pairs) == 0 {
+		return connString, nil
+	}
+
+	if strings.HasPrefix(connString, "postgres://") || strings.HasPrefix(connString, "postgresql://") {
+		var err error
+		connString, err = pq.ParseURL(connString)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if connString != "" {
+		pairs = append([]string{connString}, pairs...)
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+func quoteConnStringValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `'`, `\'`, -1)
+	return "'" + value + "'"
+}
@@ -0,0 +1,70 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnStringWithSSL(t *testing.T) {
+	Convey("connStringWithSSL", t, func() {
+		config := skydb.DBConfig{
+			SSLMode:     "verify-full",
+			SSLRootCert: "/etc/ssl/root.crt",
+			SSLCert:     "/etc/ssl/client.crt",
+			SSLKey:      "/etc/ssl/client key.pem",
+		}
+
+		Convey("returns connection string as is without SSL options", func() {
+			connString, err := connStringWithSSL("postgres://postgres:@localhost/postgres?sslmode=disable", skydb.DBConfig{})
+			So(err, ShouldBeNil)
+			So(connString, ShouldEqual, "postgres://postgres:@localhost/postgres?sslmode=disable")
+		})
+
+		Convey("appends SSL options to key/value connection string", func() {
+			connString, err := connStringWithSSL("host=localhost dbname=postgres sslmode=disable", config)
+			So(err, ShouldBeNil)
+			So(connString, ShouldEqual, "host=localhost dbname=postgres sslmode=disable "+
+				"sslmode='verify-full' "+
+				"sslrootcert='/etc/ssl/root.crt' "+
+				"sslcert='/etc/ssl/client.crt' "+
+				"sslkey='/etc/ssl/client key.pem'")
+		})
+
+		Convey("converts URL connection string", func() {
+			connString, err := connStringWithSSL("postgres://postgres@localhost/postgres?sslmode=disable", skydb.DBConfig{
+				SSLMode: "require",
+			})
+			So(err, ShouldBeNil)
+			So(connString, ShouldEqual, "dbname=postgres host=localhost sslmode=disable user=postgres sslmode='require'")
+		})
+
+		Convey("appends SSL options to empty connection string", func() {
+			connString, err := connStringWithSSL("", skydb.DBConfig{
+				SSLCert: `/etc/ssl/it's.crt`,
+			})
+			So(err, ShouldBeNil)
+			So(connString, ShouldEqual, `sslcert='/etc/ssl/it\'s.crt'`)
+		})
+
+		Convey("returns error for malformed URL", func() {
+			_, err := connStringWithSSL("postgres://%zz", config)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
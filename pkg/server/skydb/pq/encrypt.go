@@ -0,0 +1,102 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// Values of encrypted fields are stored in bytea columns as the nonce
+// followed by the AES-GCM sealed value.
+
+func fieldKey(provider skydb.FieldKeyProvider) ([]byte, error) {
+	if provider == nil {
+		return nil, skyerr.NewError(skyerr.NotConfigured,
+			"field key provider is not configured for encrypted fields")
+	}
+	return provider.FieldKey()
+}
+
+func newFieldAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptFieldValue(key []byte, value string) ([]byte, error) {
+	aead, err := newFieldAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, []byte(value), nil), nil
+}
+
+func decryptFieldValue(key []byte, ciphertext []byte) (string, error) {
+	aead, err := newFieldAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(ciphertext) < aead.NonceSize() {
+		return "", errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// encryptFields replaces the strings in data of the encrypted fields in
+// schema with their ciphertexts. Values of other types are left for
+// the schema check to reject.
+func (db *database) encryptFields(schema skydb.RecordSchema, data map[string]interface{}) error {
+	var key []byte
+	for column, fieldType := range schema {
+		value, ok := data[column].(string)
+		if !fieldType.Encrypted || !ok {
+			continue
+		}
+
+		if key == nil {
+			var err error
+			if key, err = fieldKey(db.c.fieldKeyProvider); err != nil {
+				return err
+			}
+		}
+
+		ciphertext, err := encryptFieldValue(key, value)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt field %s: %s", column, err)
+		}
+		data[column] = ciphertext
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// Every version of a record is kept in the history as the row of the
+// record in JSON, live from the time it is written until the next
+// version of the record. A deleted record has a version without row.
+
+// writeHistory writes the stored record to the history. It must be
+// called in the transaction modifying the record, after the record is
+// saved.
+func (db *database) writeHistory(id skydb.RecordID) error {
+	stmt := fmt.Sprintf(`
+INSERT INTO %s (record_type, record_id, database_id, record, valid_from)
+SELECT $1, t._id, t._database_id, row_to_json(t)::jsonb, $2
+FROM %s AS t
+WHERE t._id = $3 AND t._database_id = $4;`,
+		db.TableName("_record_history"),
+		db.TableName(id.Type),
+	)
+	_, err := db.c.Exec(stmt, id.Type, timeNow(), id.Key, db.userID)
+	return err
+}
+
+// writeHistoryDeletion writes to the history that the record is
+// deleted.
+func (db *database) writeHistoryDeletion(id skydb.RecordID) error {
+	insert := psql.Insert(db.TableName("_record_history")).
+		Columns("record_type", "record_id", "database_id", "record", "valid_from").
+		Values(id.Type, id.Key, db.userID, nil, timeNow())
+	_, err := db.c.ExecWith(insert)
+	return err
+}
+
+func (db *database) GetAsOf(id skydb.RecordID, at time.Time) (skydb.Record, error) {
+	typemap, err := db.RemoteColumnTypes(id.Type)
+	if err != nil {
+		return skydb.Record{}, err
+	}
+	if len(typemap) == 0 { // record type has not been created
+		return skydb.Record{}, skydb.ErrRecordNotFound
+	}
+
+	var (
+		historyID int64
+		deleted   bool
+	)
+	err = db.c.QueryRowWith(
+		psql.Select("id", "record IS NULL").
+			From(db.TableName("_record_history")).
+			Where("record_type = ? AND record_id = ? AND database_id = ? AND valid_from <= ?",
+				id.Type, id.Key, db.userID, at).
+			OrderBy("valid_from DESC", "id DESC").
+			Limit(1),
+	).Scan(&historyID, &deleted)
+	if err == sql.ErrNoRows || (err == nil && deleted) {
+		return skydb.Record{}, skydb.ErrRecordNotFound
+	} else if err != nil {
+		return skydb.Record{}, err
+	}
+
+	return db.getHistoryRecord(id, typemap, historyID)
+}
+
+func (db *database) GetHistory(id skydb.RecordID) ([]skydb.RecordVersion, error) {
+	typemap, err := db.RemoteColumnTypes(id.Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(typemap) == 0 { // record type has not been created
+		return nil, skydb.ErrRecordNotFound
+	}
+
+	type historyEntry struct {
+		id        int64
+		validFrom time.Time
+		deleted   bool
+	}
+	entries := []historyEntry{}
+	rows, err := db.c.QueryWith(
+		psql.Select("id", "valid_from", "record IS NULL").
+			From(db.TableName("_record_history")).
+			Where("record_type = ? AND record_id = ? AND database_id = ?",
+				id.Type, id.Key, db.userID).
+			OrderBy("valid_from", "id"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var entry historyEntry
+		if err := rows.Scan(&entry.id, &entry.validFrom, &entry.deleted); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, skydb.ErrRecordNotFound
+	}
+
+	versions := make([]skydb.RecordVersion, len(entries))
+	for i, entry := range entries {
+		if entry.deleted {
+			// who deleted the record is not known
+			versions[i] = skydb.RecordVersion{UpdatedAt: entry.validFrom}
+			continue
+		}
+
+		record, err := db.getHistoryRecord(id, typemap, entry.id)
+		if err != nil {
+			return nil, err
+		}
+		versions[i] = skydb.RecordVersion{
+			Record:    &record,
+			UpdatedAt: record.UpdatedAt,
+			UpdaterID: record.UpdaterID,
+		}
+	}
+	return versions, nil
+}
+
+// getHistoryRecord returns the record in the history identified by
+// historyID.
+func (db *database) getHistoryRecord(id skydb.RecordID, typemap skydb.RecordSchema, historyID int64) (skydb.Record, error) {
+	// The row in JSON is turned back into a row of the record table, so
+	// that it is read the same way as a stored record. Columns added
+	// since then are NULL.
+	q := db.selectColumns(psql.Select(), id.Type, typemap).
+		From(fmt.Sprintf("%s AS h, jsonb_populate_record(NULL::%s, h.record) AS %s",
+			db.TableName("_record_history"),
+			db.TableName(id.Type),
+			pq.QuoteIdentifier(id.Type),
+		)).
+		Where("h.id = ?", historyID)
+
+	record := skydb.Record{}
+	row := db.c.QueryRowWith(q)
+	if err := newRecordScanner(id.Type, typemap, row, db.c.fieldKeyProvider).Scan(&record); err != nil {
+		return skydb.Record{}, err
+	}
+	return record, nil
+}
@@ -0,0 +1,210 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetAsOf(t *testing.T) {
+	Convey("Database with record history", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		t0 := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		now := t0
+		originalTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = originalTimeNow
+		}()
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		c.recordHistoryEnabled = true
+
+		record := skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"content": "Hello World",
+			},
+		}
+
+		at := func(hours int) time.Time {
+			return t0.Add(time.Duration(hours) * time.Hour)
+		}
+
+		Convey("gets versions live at intermediate times", func() {
+			So(db.Save(&record), ShouldBeNil)
+			now = at(1)
+			record.Set("content", "Bye World")
+			So(db.Save(&record), ShouldBeNil)
+			now = at(2)
+			So(db.Patch(record.ID, "user_id", map[string]interface{}{
+				"content": "Good Hello",
+			}), ShouldBeNil)
+
+			past, err := db.GetAsOf(record.ID, at(0).Add(30*time.Minute))
+			So(err, ShouldBeNil)
+			So(past.ID, ShouldResemble, record.ID)
+			So(past.OwnerID, ShouldEqual, "user_id")
+			So(past.Data["content"], ShouldEqual, "Hello World")
+
+			past, err = db.GetAsOf(record.ID, at(1).Add(30*time.Minute))
+			So(err, ShouldBeNil)
+			So(past.Data["content"], ShouldEqual, "Bye World")
+
+			past, err = db.GetAsOf(record.ID, at(3))
+			So(err, ShouldBeNil)
+			So(past.Data["content"], ShouldEqual, "Good Hello")
+		})
+
+		Convey("gets no version before the record is created", func() {
+			So(db.Save(&record), ShouldBeNil)
+
+			_, err := db.GetAsOf(record.ID, at(-1))
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("gets no version after the record is deleted", func() {
+			So(db.Save(&record), ShouldBeNil)
+			now = at(1)
+			So(db.Delete(record.ID), ShouldBeNil)
+
+			past, err := db.GetAsOf(record.ID, at(0))
+			So(err, ShouldBeNil)
+			So(past.Data["content"], ShouldEqual, "Hello World")
+
+			_, err = db.GetAsOf(record.ID, at(1))
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("writes history in the transaction saving the record", func() {
+			So(c.Begin(), ShouldBeNil)
+			So(db.Save(&record), ShouldBeNil)
+			So(c.Rollback(), ShouldBeNil)
+
+			_, err := db.GetAsOf(record.ID, now)
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("does not write history when it is disabled", func() {
+			c.recordHistoryEnabled = false
+			So(db.Save(&record), ShouldBeNil)
+
+			_, err := db.GetAsOf(record.ID, now)
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+	})
+}
+
+func TestGetHistory(t *testing.T) {
+	Convey("Database with record history", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		t0 := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		now := t0
+		originalTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = originalTimeNow
+		}()
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		c.recordHistoryEnabled = true
+
+		record := skydb.Record{
+			ID:        skydb.NewRecordID("note", "note1"),
+			OwnerID:   "user1",
+			CreatorID: "user1",
+			CreatedAt: t0,
+			Data:      map[string]interface{}{},
+		}
+		update := func(content string, updaterID string, at time.Time) {
+			now = at
+			record.UpdaterID = updaterID
+			record.UpdatedAt = at
+			record.Set("content", content)
+			So(db.Save(&record), ShouldBeNil)
+		}
+
+		Convey("lists versions in order with updaters", func() {
+			update("first", "user1", t0)
+			update("second", "user2", t0.Add(time.Hour))
+			update("third", "user3", t0.Add(2*time.Hour))
+
+			versions, err := db.GetHistory(record.ID)
+			So(err, ShouldBeNil)
+			So(versions, ShouldHaveLength, 3)
+
+			So(versions[0].UpdaterID, ShouldEqual, "user1")
+			So(versions[0].UpdatedAt, ShouldResemble, t0)
+			So(versions[0].Record.Data["content"], ShouldEqual, "first")
+
+			So(versions[1].UpdaterID, ShouldEqual, "user2")
+			So(versions[1].UpdatedAt, ShouldResemble, t0.Add(time.Hour))
+			So(versions[1].Record.Data["content"], ShouldEqual, "second")
+
+			So(versions[2].UpdaterID, ShouldEqual, "user3")
+			So(versions[2].UpdatedAt, ShouldResemble, t0.Add(2*time.Hour))
+			So(versions[2].Record.Data["content"], ShouldEqual, "third")
+		})
+
+		Convey("lists patch with its updater", func() {
+			update("first", "user1", t0)
+			now = t0.Add(time.Hour)
+			So(db.Patch(record.ID, "user2", map[string]interface{}{
+				"content": "patched",
+			}), ShouldBeNil)
+
+			versions, err := db.GetHistory(record.ID)
+			So(err, ShouldBeNil)
+			So(versions, ShouldHaveLength, 2)
+			So(versions[1].UpdaterID, ShouldEqual, "user2")
+			So(versions[1].UpdatedAt, ShouldResemble, t0.Add(time.Hour))
+			So(versions[1].Record.Data["content"], ShouldEqual, "patched")
+		})
+
+		Convey("lists deletion without record", func() {
+			update("first", "user1", t0)
+			now = t0.Add(time.Hour)
+			So(db.Delete(record.ID), ShouldBeNil)
+
+			versions, err := db.GetHistory(record.ID)
+			So(err, ShouldBeNil)
+			So(versions, ShouldHaveLength, 2)
+			So(versions[1].Record, ShouldBeNil)
+			So(versions[1].UpdatedAt, ShouldResemble, t0.Add(time.Hour))
+		})
+
+		Convey("returns ErrRecordNotFound without history", func() {
+			_, err := db.GetHistory(record.ID)
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+	})
+}
@@ -0,0 +1,155 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"fmt"
+
+	sq "github.com/lann/squirrel"
+	"github.com/lib/pq"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+func (db *database) AddLabel(id skydb.RecordID, label string) error {
+	if db.IsReadOnly() {
+		return skydb.ErrDatabaseIsReadOnly
+	}
+	if id.Type == "" || id.Key == "" {
+		return fmt.Errorf("add label %s: got empty record id", id)
+	}
+
+	exists, err := db.recordExists(id)
+	if err != nil {
+		return err
+	} else if !exists {
+		return skydb.ErrRecordNotFound
+	}
+
+	pkData := map[string]interface{}{
+		"record_type": id.Type,
+		"record_id":   id.Key,
+		"database_id": db.userID,
+		"label":       label,
+	}
+	upsert := builder.UpsertQuery(db.TableName("_label"), pkData, nil)
+	if _, err := db.c.ExecWith(upsert); err != nil {
+		return err
+	}
+	db.c.invalidateQueryCache(id.Type)
+	return nil
+}
+
+func (db *database) RemoveLabel(id skydb.RecordID, label string) error {
+	if db.IsReadOnly() {
+		return skydb.ErrDatabaseIsReadOnly
+	}
+
+	builder := psql.Delete(db.TableName("_label")).
+		Where("record_type = ? AND record_id = ? AND database_id = ? AND label = ?",
+			id.Type, id.Key, db.userID, label)
+	if _, err := db.c.ExecWith(builder); err != nil {
+		return err
+	}
+	db.c.invalidateQueryCache(id.Type)
+	return nil
+}
+
+func (db *database) deleteLabels(id skydb.RecordID) error {
+	builder := psql.Delete(db.TableName("_label")).
+		Where("record_type = ? AND record_id = ? AND database_id = ?", id.Type, id.Key, db.userID)
+	_, err := db.c.ExecWith(builder)
+	return err
+}
+
+// recordExists returns whether the record identified by id exists in
+// this database.
+func (db *database) recordExists(id skydb.RecordID) (bool, error) {
+	typemap, err := db.RemoteColumnTypes(id.Type)
+	if err != nil || len(typemap) == 0 { // error or record type has not been created
+		return false, err
+	}
+
+	var exists bool
+	err = db.c.QueryRowx(
+		fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE _id = $1 AND _database_id = $2);`, db.TableName(id.Type)),
+		id.Key,
+		db.userID,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (db *database) QueryByLabel(label string, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	if label == "" {
+		return nil, skyerr.NewError(skyerr.InvalidArgument, "label is empty")
+	}
+
+	recordTypes, err := db.labelRecordTypes(label)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := []*skydb.Query{}
+	for _, recordType := range recordTypes {
+		typeQuery := *query
+		typeQuery.Type = recordType
+		typeQuery.WithLabel = label
+		queries = append(queries, &typeQuery)
+	}
+
+	return db.QueryUnion(queries, accessControlOptions)
+}
+
+// labelRecordTypes returns the record types having records in this
+// database attached with label, sorted by name.
+func (db *database) labelRecordTypes(label string) ([]string, error) {
+	q := psql.Select("DISTINCT record_type").
+		From(db.TableName("_label")).
+		Where("label = ?", label).
+		OrderBy("record_type")
+	if db.DatabaseType() != skydb.UnionDatabase {
+		q = q.Where("database_id = ?", db.userID)
+	}
+	rows, err := db.c.QueryWith(q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordTypes := []string{}
+	for rows.Next() {
+		var recordType string
+		if err := rows.Scan(&recordType); err != nil {
+			return nil, err
+		}
+		recordTypes = append(recordTypes, recordType)
+	}
+	return recordTypes, rows.Err()
+}
+
+// labelSqlizer restricts the records of recordType to those attached
+// with label in the _label table, in the database of the record.
+func (db *database) labelSqlizer(recordType string, label string) sq.Sqlizer {
+	return sq.Expr(
+		fmt.Sprintf(
+			`(%[1]s."_id", %[1]s."_database_id") IN (SELECT record_id, database_id FROM %[2]s WHERE record_type = ? AND label = ?)`,
+			pq.QuoteIdentifier(recordType),
+			db.TableName("_label"),
+		),
+		recordType,
+		label,
+	)
+}
@@ -0,0 +1,210 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLabel(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend("photo", skydb.RecordSchema{
+			"caption": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		note1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "userid",
+			Data: map[string]interface{}{
+				"content": "first",
+			},
+		}
+		note2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "note2"),
+			OwnerID: "userid",
+			Data: map[string]interface{}{
+				"content": "second",
+			},
+		}
+		photo1 := skydb.Record{
+			ID:      skydb.NewRecordID("photo", "photo1"),
+			OwnerID: "userid",
+			Data: map[string]interface{}{
+				"caption": "sunset",
+			},
+		}
+		So(db.Save(&note1), ShouldBeNil)
+		So(db.Save(&note2), ShouldBeNil)
+		So(db.Save(&photo1), ShouldBeNil)
+
+		accessControlOptions := skydb.AccessControlOptions{}
+
+		Convey("queries records by label", func() {
+			So(db.AddLabel(note1.ID, "starred"), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:      "note",
+				WithLabel: "starred",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note1})
+
+			count, err := db.QueryCount(&skydb.Query{
+				Type:      "note",
+				WithLabel: "starred",
+			}, &accessControlOptions)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("queries records by label across record types", func() {
+			So(db.AddLabel(note2.ID, "starred"), ShouldBeNil)
+			So(db.AddLabel(photo1.ID, "starred"), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:      "note",
+				WithLabel: "starred",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note2})
+
+			records, err = exhaustRows(db.Query(&skydb.Query{
+				Type:      "photo",
+				WithLabel: "starred",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{photo1})
+		})
+
+		Convey("queries records by label of every record type", func() {
+			So(db.AddLabel(note2.ID, "starred"), ShouldBeNil)
+			So(db.AddLabel(photo1.ID, "starred"), ShouldBeNil)
+			So(db.AddLabel(note1.ID, "archived"), ShouldBeNil)
+
+			records, err := exhaustRows(db.QueryByLabel("starred", &skydb.Query{}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note2, photo1})
+		})
+
+		Convey("does not query labels of another database", func() {
+			otherDB := c.PrivateDB("otheruserid")
+			note3 := skydb.Record{
+				ID:      skydb.NewRecordID("note", "note3"),
+				OwnerID: "otheruserid",
+				Data: map[string]interface{}{
+					"content": "third",
+				},
+			}
+			So(otherDB.Save(&note3), ShouldBeNil)
+			So(otherDB.AddLabel(note3.ID, "starred"), ShouldBeNil)
+			So(db.AddLabel(note1.ID, "starred"), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:      "note",
+				WithLabel: "starred",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note1})
+
+			records, err = exhaustRows(otherDB.QueryByLabel("starred", &skydb.Query{}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note3})
+		})
+
+		Convey("refuses to label record of another database", func() {
+			err := c.PrivateDB("otheruserid").AddLabel(note1.ID, "starred")
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("refuses to label record not exist", func() {
+			err := db.AddLabel(skydb.NewRecordID("note", "notexist"), "starred")
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+
+			err = db.AddLabel(skydb.NewRecordID("article", "article1"), "starred")
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("adds the same label twice", func() {
+			So(db.AddLabel(note1.ID, "starred"), ShouldBeNil)
+			So(db.AddLabel(note1.ID, "starred"), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:      "note",
+				WithLabel: "starred",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note1})
+		})
+
+		Convey("removes label", func() {
+			So(db.AddLabel(note1.ID, "starred"), ShouldBeNil)
+			So(db.AddLabel(note1.ID, "archived"), ShouldBeNil)
+			So(db.RemoveLabel(note1.ID, "starred"), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:      "note",
+				WithLabel: "starred",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+
+			records, err = exhaustRows(db.Query(&skydb.Query{
+				Type:      "note",
+				WithLabel: "archived",
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note1})
+		})
+
+		Convey("removes labels of deleted record", func() {
+			So(db.AddLabel(note1.ID, "starred"), ShouldBeNil)
+			So(db.Delete(note1.ID), ShouldBeNil)
+
+			var count int
+			err := c.QueryRowx("SELECT COUNT(*) FROM _label WHERE record_id = 'note1'").Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("keeps the record if its labels cannot be removed", func() {
+			_, err := c.Exec("DROP TABLE _label")
+			So(err, ShouldBeNil)
+
+			err = db.Delete(note1.ID)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "_label")
+
+			record := skydb.Record{}
+			So(db.Get(note1.ID, &record), ShouldBeNil)
+		})
+
+		Convey("refuses to label in union database", func() {
+			err := c.UnionDB().AddLabel(note1.ID, "starred")
+			So(err, ShouldEqual, skydb.ErrDatabaseIsReadOnly)
+		})
+	})
+}
@@ -34,7 +34,8 @@ var appEventChannelsMap map[string][]chan skydb.RecordEvent
 
 // Assume all app resist on one Database
 func (c *conn) Subscribe(recordEventChan chan skydb.RecordEvent) error {
-	appName := toLowerAndUnderscore(c.appName)
+	// notifications carry the schema name of the app
+	appName := strings.TrimPrefix(c.schemaName(), "app_")
 	channels := appEventChannelsMap[appName]
 	appEventChannelsMap[appName] = append(channels, recordEventChan)
 
@@ -51,8 +52,9 @@ func emit(n *notification) {
 	for _, channel := range channels {
 		go func(ch chan skydb.RecordEvent) {
 			ch <- skydb.RecordEvent{
-				Record: &n.Record,
-				Event:  n.ChangeEvent,
+				Record:   &n.Record,
+				Original: n.Original,
+				Event:    n.ChangeEvent,
 			}
 		}(channel)
 	}
@@ -65,13 +67,15 @@ type notification struct {
 	AppName     string
 	ChangeEvent skydb.RecordHookEvent
 	Record      skydb.Record
+	Original    *skydb.Record // only for update
 }
 
 type rawNotification struct {
-	AppName    string
-	Op         string
-	RecordType string
-	Record     []byte
+	AppName        string
+	Op             string
+	RecordType     string
+	Record         []byte
+	OriginalRecord []byte `db:"original_record"`
 }
 
 type recordListener struct {
@@ -142,7 +146,7 @@ func (l *recordListener) Listen() {
 // NOTE(limouren): pending_notification.id is integer in database.
 func (l *recordListener) fetchNotification(notificationID string, n *notification) error {
 	var rawNoti rawNotification
-	err := l.db.QueryRowx("SELECT op, appname, recordtype, record FROM public.pending_notification WHERE id = $1", notificationID).
+	err := l.db.QueryRowx("SELECT op, appname, recordtype, record, original_record FROM public.pending_notification WHERE id = $1", notificationID).
 		StructScan(&rawNoti)
 	if err != nil {
 		log.WithFields(logrus.Fields{
@@ -199,6 +203,14 @@ func parseNotification(raw *rawNotification, n *notification) error {
 	}
 	n.Record.ID.Type = raw.RecordType
 
+	if raw.OriginalRecord != nil {
+		n.Original = &skydb.Record{}
+		if err := parseRecordData(raw.OriginalRecord, n.Original); err != nil {
+			return err
+		}
+		n.Original.ID.Type = raw.RecordType
+	}
+
 	return nil
 }
 
@@ -0,0 +1,64 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+func (db *database) AcquireLock(id skydb.RecordID, owner string, ttl time.Duration) (bool, error) {
+	if db.IsReadOnly() {
+		return false, skydb.ErrDatabaseIsReadOnly
+	}
+	if id.Type == "" || id.Key == "" {
+		return false, fmt.Errorf("acquire lock %s: got empty record id", id)
+	}
+
+	// The lock is taken over only if it is held by the same owner, in
+	// which case it is extended, or if it has expired.
+	now := timeNow()
+	stmt := fmt.Sprintf(`
+INSERT INTO %[1]s (record_type, record_id, database_id, owner, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (record_type, record_id, database_id) DO UPDATE
+SET owner = EXCLUDED.owner, expires_at = EXCLUDED.expires_at
+WHERE %[1]s.owner = EXCLUDED.owner OR %[1]s.expires_at <= $6`, db.TableName("_record_lock"))
+
+	result, err := db.c.Exec(stmt, id.Type, id.Key, db.userID, owner, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+func (db *database) ReleaseLock(id skydb.RecordID, owner string) error {
+	if db.IsReadOnly() {
+		return skydb.ErrDatabaseIsReadOnly
+	}
+
+	builder := psql.Delete(db.TableName("_record_lock")).
+		Where("record_type = ? AND record_id = ? AND database_id = ? AND owner = ?",
+			id.Type, id.Key, db.userID, owner)
+	_, err := db.c.ExecWith(builder)
+	return err
+}
@@ -0,0 +1,131 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecordLock(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		originalTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = originalTimeNow
+		}()
+
+		db := c.PublicDB()
+		id := skydb.NewRecordID("note", "note1")
+
+		Convey("acquires lock", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("extends lock held by the same owner", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			ok, err = db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("does not acquire lock held by another owner", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			ok, err = db.AcquireLock(id, "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("acquires locks of different records", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			ok, err = db.AcquireLock(skydb.NewRecordID("note", "note2"), "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("acquires locks of the same record in different databases", func() {
+			ok, err := c.PrivateDB("alice").AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			ok, err = c.PrivateDB("bob").AcquireLock(id, "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			// releasing in one database keeps the lock in the other
+			So(c.PrivateDB("bob").ReleaseLock(id, "alice"), ShouldBeNil)
+			ok, err = c.PrivateDB("alice").AcquireLock(id, "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("acquires lock released by another owner", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			So(db.ReleaseLock(id, "alice"), ShouldBeNil)
+
+			ok, err = db.AcquireLock(id, "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("does not release lock held by another owner", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			So(db.ReleaseLock(id, "bob"), ShouldBeNil)
+
+			ok, err = db.AcquireLock(id, "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("acquires expired lock held by another owner", func() {
+			ok, err := db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			now = now.Add(time.Minute)
+			ok, err = db.AcquireLock(id, "bob", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+
+			ok, err = db.AcquireLock(id, "alice", time.Minute)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,45 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_2e8b5c7a1f03 struct {
+}
+
+func (r *revision_2e8b5c7a1f03) Version() string {
+	return "2e8b5c7a1f03"
+}
+
+func (r *revision_2e8b5c7a1f03) Up(tx *sqlx.Tx) error {
+	// Existing subscriptions are left without an equality index and
+	// remain candidates of every record of their type.
+	stmt := `
+	ALTER TABLE _subscription ADD COLUMN eq_key text;
+	ALTER TABLE _subscription ADD COLUMN eq_value jsonb;
+	CREATE INDEX ON _subscription (auth_id, eq_key, eq_value);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_2e8b5c7a1f03) Down(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _subscription DROP COLUMN eq_key;
+	ALTER TABLE _subscription DROP COLUMN eq_value;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
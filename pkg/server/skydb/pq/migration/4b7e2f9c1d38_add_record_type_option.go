@@ -0,0 +1,41 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_4b7e2f9c1d38 struct {
+}
+
+func (r *revision_4b7e2f9c1d38) Version() string {
+	return "4b7e2f9c1d38"
+}
+
+func (r *revision_4b7e2f9c1d38) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _record_type_option (
+		record_type text PRIMARY KEY,
+		preserve_updated_at boolean NOT NULL DEFAULT FALSE
+	);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_4b7e2f9c1d38) Down(tx *sqlx.Tx) error {
+	stmt := `DROP TABLE _record_type_option;`
+	_, err := tx.Exec(stmt)
+	return err
+}
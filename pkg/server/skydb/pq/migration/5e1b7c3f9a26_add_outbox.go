@@ -0,0 +1,48 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_5e1b7c3f9a26 struct {
+}
+
+func (r *revision_5e1b7c3f9a26) Version() string {
+	return "5e1b7c3f9a26"
+}
+
+func (r *revision_5e1b7c3f9a26) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _outbox (
+		id bigserial PRIMARY KEY,
+		op text NOT NULL,
+		record_type text NOT NULL,
+		record jsonb NOT NULL,
+		created_at timestamp without time zone NOT NULL,
+		delivered_at timestamp without time zone
+	);
+	CREATE INDEX ON _outbox (id) WHERE delivered_at IS NULL;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_5e1b7c3f9a26) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _outbox;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
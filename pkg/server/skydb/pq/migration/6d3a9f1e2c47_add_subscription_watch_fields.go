@@ -0,0 +1,81 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_6d3a9f1e2c47 struct {
+}
+
+func (r *revision_6d3a9f1e2c47) Version() string {
+	return "6d3a9f1e2c47"
+}
+
+func (r *revision_6d3a9f1e2c47) Up(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _subscription ADD COLUMN watch_fields text[];
+	ALTER TABLE public.pending_notification ADD COLUMN IF NOT EXISTS original_record jsonb;
+	CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
+		DECLARE
+			affected_record RECORD;
+			original_record jsonb;
+			inserted_id integer;
+		BEGIN
+			IF (TG_OP = 'DELETE') THEN
+				affected_record := OLD;
+			ELSE
+				affected_record := NEW;
+			END IF;
+			IF (TG_OP = 'UPDATE') THEN
+				original_record := row_to_json(OLD)::jsonb;
+			END IF;
+			INSERT INTO public.pending_notification (op, appname, recordtype, record, original_record)
+				VALUES (TG_OP, TG_TABLE_SCHEMA, TG_TABLE_NAME, row_to_json(affected_record)::jsonb, original_record)
+				RETURNING id INTO inserted_id;
+			PERFORM pg_notify('record_change', inserted_id::TEXT);
+			RETURN affected_record;
+		END;
+	$$ LANGUAGE plpgsql;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_6d3a9f1e2c47) Down(tx *sqlx.Tx) error {
+	// public.pending_notification is shared by all apps, its column is
+	// kept for the apps not migrated down.
+	stmt := `
+	ALTER TABLE _subscription DROP COLUMN watch_fields;
+	CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
+		DECLARE
+			affected_record RECORD;
+			inserted_id integer;
+		BEGIN
+			IF (TG_OP = 'DELETE') THEN
+				affected_record := OLD;
+			ELSE
+				affected_record := NEW;
+			END IF;
+			INSERT INTO public.pending_notification (op, appname, recordtype, record)
+				VALUES (TG_OP, TG_TABLE_SCHEMA, TG_TABLE_NAME, row_to_json(affected_record)::jsonb)
+				RETURNING id INTO inserted_id;
+			PERFORM pg_notify('record_change', inserted_id::TEXT);
+			RETURN affected_record;
+		END;
+	$$ LANGUAGE plpgsql;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
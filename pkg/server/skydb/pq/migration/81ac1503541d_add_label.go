@@ -0,0 +1,46 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_81ac1503541d struct {
+}
+
+func (r *revision_81ac1503541d) Version() string {
+	return "81ac1503541d"
+}
+
+func (r *revision_81ac1503541d) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _label (
+		record_type TEXT NOT NULL,
+		record_id TEXT NOT NULL,
+		label TEXT NOT NULL,
+		PRIMARY KEY (record_type, record_id, label)
+	);
+	CREATE INDEX ON _label (label, record_type);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_81ac1503541d) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _label;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
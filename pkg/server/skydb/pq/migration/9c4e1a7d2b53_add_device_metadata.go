@@ -0,0 +1,47 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_9c4e1a7d2b53 struct {
+}
+
+func (r *revision_9c4e1a7d2b53) Version() string {
+	return "9c4e1a7d2b53"
+}
+
+func (r *revision_9c4e1a7d2b53) Up(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _device
+		ADD COLUMN app_version text,
+		ADD COLUMN os_version text,
+		ADD COLUMN metadata jsonb;
+	CREATE INDEX ON _device (app_version);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_9c4e1a7d2b53) Down(tx *sqlx.Tx) error {
+	stmt := `
+	ALTER TABLE _device
+		DROP COLUMN app_version,
+		DROP COLUMN os_version,
+		DROP COLUMN metadata;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
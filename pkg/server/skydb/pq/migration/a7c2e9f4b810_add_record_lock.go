@@ -0,0 +1,46 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_a7c2e9f4b810 struct {
+}
+
+func (r *revision_a7c2e9f4b810) Version() string {
+	return "a7c2e9f4b810"
+}
+
+func (r *revision_a7c2e9f4b810) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _record_lock (
+		record_type TEXT NOT NULL,
+		record_id TEXT NOT NULL,
+		owner TEXT NOT NULL,
+		expires_at timestamp without time zone NOT NULL,
+		PRIMARY KEY (record_type, record_id)
+	);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_a7c2e9f4b810) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP TABLE _record_lock;
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
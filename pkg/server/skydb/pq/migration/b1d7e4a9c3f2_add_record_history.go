@@ -0,0 +1,46 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_b1d7e4a9c3f2 struct {
+}
+
+func (r *revision_b1d7e4a9c3f2) Version() string {
+	return "b1d7e4a9c3f2"
+}
+
+func (r *revision_b1d7e4a9c3f2) Up(tx *sqlx.Tx) error {
+	stmt := `
+	CREATE TABLE _record_history (
+		id bigserial PRIMARY KEY,
+		record_type text NOT NULL,
+		record_id text NOT NULL,
+		database_id text NOT NULL,
+		record jsonb,
+		valid_from timestamp without time zone NOT NULL
+	);
+	CREATE INDEX ON _record_history (record_type, record_id, database_id, valid_from);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_b1d7e4a9c3f2) Down(tx *sqlx.Tx) error {
+	stmt := `DROP TABLE _record_history;`
+	_, err := tx.Exec(stmt)
+	return err
+}
@@ -0,0 +1,65 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_c4f81d2b7a65 struct {
+}
+
+func (r *revision_c4f81d2b7a65) Version() string {
+	return "c4f81d2b7a65"
+}
+
+func (r *revision_c4f81d2b7a65) Up(tx *sqlx.Tx) error {
+	// Existing locks take the database of the locked record. Locks of
+	// records that no longer exist are dropped.
+	stmt := `
+	ALTER TABLE _record_lock ADD COLUMN database_id text;
+	DO $$
+		DECLARE
+			lock_record_type text;
+		BEGIN
+			FOR lock_record_type IN SELECT DISTINCT record_type FROM _record_lock LOOP
+				IF to_regclass(quote_ident(lock_record_type)) IS NOT NULL THEN
+					EXECUTE format(
+						'UPDATE _record_lock SET database_id = t._database_id FROM %I t WHERE _record_lock.record_type = %L AND _record_lock.record_id = t._id',
+						lock_record_type, lock_record_type);
+				END IF;
+			END LOOP;
+		END;
+	$$;
+	DELETE FROM _record_lock WHERE database_id IS NULL;
+	ALTER TABLE _record_lock ALTER COLUMN database_id SET NOT NULL;
+	ALTER TABLE _record_lock DROP CONSTRAINT _record_lock_pkey;
+	ALTER TABLE _record_lock ADD PRIMARY KEY (record_type, record_id, database_id);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_c4f81d2b7a65) Down(tx *sqlx.Tx) error {
+	// Locks of the same record in different databases cannot be kept
+	// under the old primary key, so all locks are dropped.
+	stmt := `
+	DELETE FROM _record_lock;
+	ALTER TABLE _record_lock DROP CONSTRAINT _record_lock_pkey;
+	ALTER TABLE _record_lock DROP COLUMN database_id;
+	ALTER TABLE _record_lock ADD PRIMARY KEY (record_type, record_id);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
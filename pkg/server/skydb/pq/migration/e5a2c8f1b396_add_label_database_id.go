@@ -0,0 +1,65 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import "github.com/jmoiron/sqlx"
+
+type revision_e5a2c8f1b396 struct {
+}
+
+func (r *revision_e5a2c8f1b396) Version() string {
+	return "e5a2c8f1b396"
+}
+
+func (r *revision_e5a2c8f1b396) Up(tx *sqlx.Tx) error {
+	// Existing labels take the database of the labeled record. Labels of
+	// records that no longer exist are dropped.
+	stmt := `
+	ALTER TABLE _label ADD COLUMN database_id text;
+	DO $$
+		DECLARE
+			label_record_type text;
+		BEGIN
+			FOR label_record_type IN SELECT DISTINCT record_type FROM _label LOOP
+				IF to_regclass(quote_ident(label_record_type)) IS NOT NULL THEN
+					EXECUTE format(
+						'UPDATE _label SET database_id = t._database_id FROM %I t WHERE _label.record_type = %L AND _label.record_id = t._id',
+						label_record_type, label_record_type);
+				END IF;
+			END LOOP;
+		END;
+	$$;
+	DELETE FROM _label WHERE database_id IS NULL;
+	ALTER TABLE _label ALTER COLUMN database_id SET NOT NULL;
+	ALTER TABLE _label DROP CONSTRAINT _label_pkey;
+	ALTER TABLE _label ADD PRIMARY KEY (record_type, record_id, database_id, label);
+	DROP INDEX _label_label_record_type_idx;
+	CREATE INDEX ON _label (label, database_id, record_type);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
+
+func (r *revision_e5a2c8f1b396) Down(tx *sqlx.Tx) error {
+	stmt := `
+	DROP INDEX _label_label_database_id_record_type_idx;
+	ALTER TABLE _label DROP CONSTRAINT _label_pkey;
+	ALTER TABLE _label DROP COLUMN database_id;
+	ALTER TABLE _label ADD PRIMARY KEY (record_type, record_id, label);
+	CREATE INDEX ON _label (label, record_type);
+	`
+	_, err := tx.Exec(stmt)
+	return err
+}
@@ -23,7 +23,7 @@ import (
 type fullMigration struct {
 }
 
-func (r *fullMigration) Version() string { return "7469be11899e" }
+func (r *fullMigration) Version() string { return "c4f81d2b7a65" }
 
 func (r *fullMigration) createTable(tx *sqlx.Tx) error {
 	const stmt = `
@@ -36,9 +36,11 @@ CREATE TABLE IF NOT EXISTS public.pending_notification (
 	recordtype text NOT NULL,
 	record jsonb NOT NULL
 );
+ALTER TABLE public.pending_notification ADD COLUMN IF NOT EXISTS original_record jsonb;
 CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
 	DECLARE
 		affected_record RECORD;
+		original_record jsonb;
 		inserted_id integer;
 	BEGIN
 		IF (TG_OP = 'DELETE') THEN
@@ -46,8 +48,11 @@ CREATE OR REPLACE FUNCTION public.notify_record_change() RETURNS TRIGGER AS $$
 		ELSE
 			affected_record := NEW;
 		END IF;
-		INSERT INTO public.pending_notification (op, appname, recordtype, record)
-			VALUES (TG_OP, TG_TABLE_SCHEMA, TG_TABLE_NAME, row_to_json(affected_record)::jsonb)
+		IF (TG_OP = 'UPDATE') THEN
+			original_record := row_to_json(OLD)::jsonb;
+		END IF;
+		INSERT INTO public.pending_notification (op, appname, recordtype, record, original_record)
+			VALUES (TG_OP, TG_TABLE_SCHEMA, TG_TABLE_NAME, row_to_json(affected_record)::jsonb, original_record)
 			RETURNING id INTO inserted_id;
 		PERFORM pg_notify('record_change', inserted_id::TEXT);
 		RETURN affected_record;
@@ -80,7 +85,8 @@ CREATE TABLE _auth_role (
 CREATE TABLE _asset (
 	id text PRIMARY KEY,
 	content_type text NOT NULL,
-	size bigint NOT NULL
+	size bigint NOT NULL,
+	variants jsonb
 );
 CREATE TABLE _device (
 	id text PRIMARY KEY,
@@ -89,9 +95,13 @@ CREATE TABLE _device (
 	token text,
 	topic text,
 	last_registered_at timestamp without time zone NOT NULL,
+	app_version text,
+	os_version text,
+	metadata jsonb,
 	UNIQUE (auth_id, type, token)
 );
 CREATE INDEX ON _device (token, last_registered_at);
+CREATE INDEX ON _device (app_version);
 CREATE TABLE _subscription (
 	id text NOT NULL,
 	auth_id text NOT NULL,
@@ -99,8 +109,12 @@ CREATE TABLE _subscription (
 	type text NOT NULL,
 	notification_info jsonb,
 	query jsonb,
+	watch_fields text[],
+	eq_key text,
+	eq_value jsonb,
 	PRIMARY KEY(auth_id, device_id, id)
 );
+CREATE INDEX ON _subscription (auth_id, eq_key, eq_value);
 CREATE TABLE _friend (
 	left_id text NOT NULL,
 	right_id text REFERENCES _auth (id) NOT NULL,
@@ -124,6 +138,10 @@ CREATE TABLE _record_default_access (
     UNIQUE (record_type)
 );
 CREATE INDEX _record_default_access_unique_record_type ON _record_default_access (record_type);
+CREATE TABLE _record_type_option (
+    record_type text PRIMARY KEY,
+    preserve_updated_at boolean NOT NULL DEFAULT FALSE
+);
 CREATE TABLE _record_field_access (
     record_type text NOT NULL,
     record_field text NOT NULL,
@@ -220,6 +238,41 @@ CREATE TABLE _verify_code (
 	created_at TIMESTAMP WITHOUT TIME ZONE NOT NULL
 );
 CREATE INDEX ON _verify_code (auth_id, code, consumed);
+
+CREATE TABLE _label (
+	record_type TEXT NOT NULL,
+	record_id TEXT NOT NULL,
+	database_id TEXT NOT NULL,
+	label TEXT NOT NULL,
+	PRIMARY KEY (record_type, record_id, database_id, label)
+);
+CREATE INDEX ON _label (label, database_id, record_type);
+CREATE TABLE _record_lock (
+	record_type TEXT NOT NULL,
+	record_id TEXT NOT NULL,
+	database_id TEXT NOT NULL,
+	owner TEXT NOT NULL,
+	expires_at timestamp without time zone NOT NULL,
+	PRIMARY KEY (record_type, record_id, database_id)
+);
+CREATE TABLE _outbox (
+	id bigserial PRIMARY KEY,
+	op text NOT NULL,
+	record_type text NOT NULL,
+	record jsonb NOT NULL,
+	created_at timestamp without time zone NOT NULL,
+	delivered_at timestamp without time zone
+);
+CREATE INDEX ON _outbox (id) WHERE delivered_at IS NULL;
+CREATE TABLE _record_history (
+	id bigserial PRIMARY KEY,
+	record_type text NOT NULL,
+	record_id text NOT NULL,
+	database_id text NOT NULL,
+	record jsonb,
+	valid_from timestamp without time zone NOT NULL
+);
+CREATE INDEX ON _record_history (record_type, record_id, database_id, valid_from);
 `
 	_, err := tx.Exec(stmt)
 	return err
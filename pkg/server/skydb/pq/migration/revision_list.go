@@ -45,4 +45,15 @@ var revisions = []Revision{
 	&revision_94ffce762644{},
 	&revision_b3163d49bd6d{},
 	&revision_7469be11899e{},
+	&revision_81ac1503541d{},
+	&revision_3d8f2b6a1c94{},
+	&revision_a7c2e9f4b810{},
+	&revision_5e1b7c3f9a26{},
+	&revision_9c4e1a7d2b53{},
+	&revision_4b7e2f9c1d38{},
+	&revision_6d3a9f1e2c47{},
+	&revision_2e8b5c7a1f03{},
+	&revision_b1d7e4a9c3f2{},
+	&revision_e5a2c8f1b396{},
+	&revision_c4f81d2b7a65{},
 }
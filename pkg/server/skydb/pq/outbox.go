@@ -0,0 +1,125 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+)
+
+// outboxOps are the names of events in the outbox, which are the same
+// as those in record change notifications. See parseChangeEvent.
+var outboxOps = map[skydb.RecordHookEvent]string{
+	skydb.RecordCreated: "INSERT",
+	skydb.RecordUpdated: "UPDATE",
+	skydb.RecordDeleted: "DELETE",
+}
+
+// outboxSaveEvent returns the event to be written to the outbox when the
+// record is saved.
+func (db *database) outboxSaveEvent(id skydb.RecordID) (skydb.RecordHookEvent, error) {
+	var exists bool
+	err := db.c.QueryRowx(
+		fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM %s WHERE _id = $1 AND _database_id = $2);`, db.TableName(id.Type)),
+		id.Key,
+		db.userID,
+	).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+
+	if exists {
+		return skydb.RecordUpdated, nil
+	}
+	return skydb.RecordCreated, nil
+}
+
+// writeOutbox writes the event with the stored record to the outbox. It
+// must be called in the transaction modifying the record, after the
+// record is saved or before it is deleted.
+func (db *database) writeOutbox(event skydb.RecordHookEvent, id skydb.RecordID) error {
+	stmt := fmt.Sprintf(`
+INSERT INTO %s (op, record_type, record, created_at)
+SELECT $1, $2, row_to_json(t)::jsonb, $3
+FROM %s AS t
+WHERE t._id = $4 AND t._database_id = $5;`,
+		db.TableName("_outbox"),
+		db.TableName(id.Type),
+	)
+	_, err := db.c.Exec(stmt, outboxOps[event], id.Type, timeNow(), id.Key, db.userID)
+	return err
+}
+
+func (c *conn) FetchOutbox(limit int) ([]skydb.OutboxEvent, error) {
+	query := psql.Select("id", "op", "record_type", "record", "created_at").
+		From(c.tableName("_outbox")).
+		Where("delivered_at IS NULL").
+		OrderBy("id").
+		Limit(uint64(limit))
+
+	rows, err := c.QueryWith(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []skydb.OutboxEvent{}
+	for rows.Next() {
+		var (
+			event      skydb.OutboxEvent
+			op         string
+			recordType string
+			data       []byte
+		)
+		if err := rows.Scan(&event.ID, &op, &recordType, &data, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		if err := parseChangeEvent(op, &event.Event); err != nil {
+			return nil, err
+		}
+
+		event.Record = &skydb.Record{}
+		if err := parseRecordData(data, event.Record); err != nil {
+			return nil, err
+		}
+		event.Record.ID.Type = recordType
+		event.CreatedAt = event.CreatedAt.In(time.UTC)
+
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (c *conn) MarkOutboxDelivered(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	idArgs := make([]interface{}, len(ids))
+	for i, id := range ids {
+		idArgs[i] = id
+	}
+
+	inCause, inArgs := builder.InToSQL("id", idArgs)
+	update := psql.Update(c.tableName("_outbox")).
+		Set("delivered_at", timeNow()).
+		Where(inCause, inArgs...)
+	_, err := c.ExecWith(update)
+	return err
+}
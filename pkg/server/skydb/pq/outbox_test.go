@@ -0,0 +1,136 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOutbox(t *testing.T) {
+	Convey("Database with outbox", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		originalTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = originalTimeNow
+		}()
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		c.outboxEnabled = true
+
+		record := skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"content": "Hello World",
+			},
+		}
+
+		countOutbox := func() int {
+			var count int
+			err := c.QueryRowx("SELECT count(*) FROM _outbox").Scan(&count)
+			So(err, ShouldBeNil)
+			return count
+		}
+
+		Convey("writes event of created record", func() {
+			So(db.Save(&record), ShouldBeNil)
+
+			events, err := c.FetchOutbox(10)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Event, ShouldEqual, skydb.RecordCreated)
+			So(events[0].Record.ID, ShouldResemble, record.ID)
+			So(events[0].Record.OwnerID, ShouldEqual, "user_id")
+			So(events[0].Record.Data, ShouldResemble, skydb.Data{
+				"content": "Hello World",
+			})
+			So(events[0].CreatedAt, ShouldResemble, now)
+		})
+
+		Convey("writes events of updated and deleted record in order", func() {
+			So(db.Save(&record), ShouldBeNil)
+			record.Set("content", "Bye World")
+			So(db.Save(&record), ShouldBeNil)
+			So(db.Patch(record.ID, "user_id", map[string]interface{}{
+				"content": "Good Hello",
+			}), ShouldBeNil)
+			So(db.Delete(record.ID), ShouldBeNil)
+
+			events, err := c.FetchOutbox(10)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 4)
+			So(events[0].Event, ShouldEqual, skydb.RecordCreated)
+			So(events[1].Event, ShouldEqual, skydb.RecordUpdated)
+			So(events[1].Record.Data["content"], ShouldEqual, "Bye World")
+			So(events[2].Event, ShouldEqual, skydb.RecordUpdated)
+			So(events[2].Record.Data["content"], ShouldEqual, "Good Hello")
+			So(events[3].Event, ShouldEqual, skydb.RecordDeleted)
+			So(events[3].Record.Data["content"], ShouldEqual, "Good Hello")
+		})
+
+		Convey("writes event in the transaction saving the record", func() {
+			So(c.Begin(), ShouldBeNil)
+			So(db.Save(&record), ShouldBeNil)
+			So(countOutbox(), ShouldEqual, 1)
+			So(c.Rollback(), ShouldBeNil)
+
+			So(countOutbox(), ShouldEqual, 0)
+		})
+
+		Convey("does not write event when record is not saved", func() {
+			record.OwnerID = ""
+			So(db.Save(&record), ShouldNotBeNil)
+			So(db.Delete(skydb.NewRecordID("note", "notexist")), ShouldEqual, skydb.ErrRecordNotFound)
+
+			So(countOutbox(), ShouldEqual, 0)
+		})
+
+		Convey("fetches events not marked delivered", func() {
+			So(db.Save(&record), ShouldBeNil)
+			So(db.Delete(record.ID), ShouldBeNil)
+
+			events, err := c.FetchOutbox(1)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Event, ShouldEqual, skydb.RecordCreated)
+
+			So(c.MarkOutboxDelivered([]int64{events[0].ID}), ShouldBeNil)
+
+			events, err = c.FetchOutbox(10)
+			So(err, ShouldBeNil)
+			So(len(events), ShouldEqual, 1)
+			So(events[0].Event, ShouldEqual, skydb.RecordDeleted)
+		})
+
+		Convey("does not write event when outbox is disabled", func() {
+			c.outboxEnabled = false
+			So(db.Save(&record), ShouldBeNil)
+
+			So(countOutbox(), ShouldEqual, 0)
+		})
+	})
+}
@@ -16,17 +16,22 @@ package pq
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 
 	"github.com/skygeario/skygear-server/pkg/server/logging"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/migration"
 )
 
@@ -40,6 +45,118 @@ func toLowerAndUnderscore(s string) string {
 	return underscoreRe.ReplaceAllLiteralString(strings.ToLower(s), "_")
 }
 
+// unsafeSchemaCharsRe matches the characters not allowed in an
+// unquoted identifier of PostgreSQL, other than upper case letters.
+var unsafeSchemaCharsRe = regexp.MustCompile(`[^a-z0-9_$\x{80}-\x{10FFFF}]+`)
+
+// maxIdentifierLength is the number of bytes of an identifier kept by
+// PostgreSQL, the rest are truncated.
+const maxIdentifierLength = 63
+
+// appSchemaName returns the name of the schema of the app, which is the
+// app name prefixed with "app_", in lower case and with dots and colons
+// replaced by underscores. Names too long for an identifier are
+// truncated as PostgreSQL does, so that they match the schemas created
+// by earlier versions.
+//
+// Earlier versions created the schema without quoting its name, so
+// names containing characters not allowed in an unquoted identifier,
+// such as dashes, never worked. Those characters are replaced by
+// underscores and the name is suffixed by a hash of the app name to
+// keep it distinct from the names of other apps.
+func appSchemaName(appName string) string {
+	name := toLowerAndUnderscore(appName)
+	if !unsafeSchemaCharsRe.MatchString(name) {
+		return truncateIdentifier("app_"+name, maxIdentifierLength)
+	}
+
+	sum := sha256.Sum256([]byte(appName))
+	suffix := "_" + hex.EncodeToString(sum[:8])
+	schema := "app_" + unsafeSchemaCharsRe.ReplaceAllLiteralString(name, "_")
+	return truncateIdentifier(schema, maxIdentifierLength-len(suffix)) + suffix
+}
+
+// truncateIdentifier returns the longest prefix of s of at most length
+// bytes that does not split a character, as PostgreSQL truncates
+// identifiers.
+func truncateIdentifier(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	for length > 0 && !utf8.RuneStart(s[length]) {
+		length--
+	}
+	return s[:length]
+}
+
+var appSchemas = struct {
+	sync.Mutex
+	appNames map[string]string
+}{appNames: map[string]string{}}
+
+// claimAppSchema returns the name of the schema of the app. An error is
+// returned if the schema is already claimed by another app in this
+// process, e.g. "com.example" and "com_example" which share the same
+// schema name. See also recordAppSchemaOwner.
+func claimAppSchema(appName string) (string, error) {
+	schema := appSchemaName(appName)
+
+	appSchemas.Lock()
+	defer appSchemas.Unlock()
+	if claimedBy, ok := appSchemas.appNames[schema]; ok && claimedBy != appName {
+		return "", fmt.Errorf(`app name "%s" is ambiguous with "%s" for schema "%s"`,
+			appName, claimedBy, schema)
+	}
+	appSchemas.appNames[schema] = appName
+	return schema, nil
+}
+
+// appSchemaCommentPrefix prefixes the name of the app owning a schema
+// in the comment of the schema.
+const appSchemaCommentPrefix = "skygear:app:"
+
+// recordAppSchemaOwner records the app as the owner of its schema in
+// the comment of the schema, so that another app sharing the schema
+// name is rejected even if it is served by another process. The first
+// app to claim a schema without an owner, such as one created by an
+// earlier version, becomes its owner.
+func recordAppSchemaOwner(db *sqlx.DB, schema string, appName string) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialize processes claiming the schema at the same time.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, schema); err != nil {
+		return err
+	}
+
+	var comment string
+	err = tx.QueryRowx(`
+SELECT COALESCE(pg_catalog.obj_description(oid, 'pg_namespace'), '')
+FROM pg_catalog.pg_namespace
+WHERE nspname = $1`, schema).Scan(&comment)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(comment, appSchemaCommentPrefix) {
+		if owner := strings.TrimPrefix(comment, appSchemaCommentPrefix); owner != appName {
+			return fmt.Errorf(`app name "%s" is ambiguous with "%s" for schema "%s"`,
+				appName, owner, schema)
+		}
+		return nil
+	}
+
+	_, err = tx.Exec(fmt.Sprintf(`COMMENT ON SCHEMA %s IS %s`,
+		pq.QuoteIdentifier(schema), builder.QuoteLiteral(appSchemaCommentPrefix+appName)))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func isForeignKeyViolated(err error) bool {
 	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
 		return true
@@ -61,6 +178,11 @@ func isInvalidInputSyntax(err error) bool {
 	return ok && (pqErr.Code == "22P02" || pqErr.Code == "22P03")
 }
 
+func isInvalidRegularExpression(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code == "2201B"
+}
+
 func isUndefinedTable(err error) bool {
 	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "42P01" {
 		return true
@@ -69,6 +191,51 @@ func isUndefinedTable(err error) bool {
 	return false
 }
 
+// missingReferenceTarget returns the reference field in schema, and its
+// referenced record type, reported by an undefined table error.
+func missingReferenceTarget(err error, schema skydb.RecordSchema) (string, string) {
+	pqErr := err.(*pq.Error)
+	for column, fieldType := range schema {
+		if fieldType.Type != skydb.TypeReference {
+			continue
+		}
+		if strings.Contains(pqErr.Message, pq.QuoteIdentifier(fieldType.ReferenceType)) {
+			return column, fieldType.ReferenceType
+		}
+	}
+	return "", ""
+}
+
+// missingAsset returns the name of the asset in data reported by a
+// foreign key violation error, if the violated constraint is the one
+// of an asset field in schema.
+func missingAsset(err error, schema skydb.RecordSchema, data skydb.Data) (string, bool) {
+	pqErr := err.(*pq.Error)
+	for column, fieldType := range schema {
+		if fieldType.Type != skydb.TypeAsset {
+			continue
+		}
+		if pqErr.Constraint != foreignKeyConstraintName(column, "_asset", "id") {
+			continue
+		}
+		if asset, ok := data[column].(*skydb.Asset); ok {
+			return asset.Name, true
+		}
+	}
+	return "", false
+}
+
+// isTransactionRetryable returns true if the transaction is aborted
+// because of serialization failure or deadlock, such that running the
+// same transaction again might succeed.
+func isTransactionRetryable(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+
+	return false
+}
+
 func isNetworkError(err error) bool {
 	_, ok := err.(*net.OpError)
 	return ok
@@ -76,6 +243,15 @@ func isNetworkError(err error) bool {
 
 // Open returns a new connection to postgresql implementation
 func Open(ctx context.Context, appName string, accessModel skydb.AccessModel, connString string, config skydb.DBConfig) (skydb.Conn, error) {
+	connString, err := connStringWithSSL(connString, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse connection string: %s", err)
+	}
+
+	if _, err := claimAppSchema(appName); err != nil {
+		return nil, err
+	}
+
 	db, err := getDB(appName, connString, config.CanMigrate)
 	if err != nil {
 		return nil, err
@@ -84,7 +260,7 @@ func Open(ctx context.Context, appName string, accessModel skydb.AccessModel, co
 		return nil, fmt.Errorf("Unsupported AccessModel: RelationBasedAccess")
 	}
 
-	return &conn{
+	c := &conn{
 		db:                     db,
 		RecordSchema:           map[string]skydb.RecordSchema{},
 		appName:                appName,
@@ -92,8 +268,20 @@ func Open(ctx context.Context, appName string, accessModel skydb.AccessModel, co
 		accessModel:            accessModel,
 		canMigrate:             config.CanMigrate,
 		passwordHistoryEnabled: config.PasswordHistoryEnabled,
+		exactTypeStats:         config.ExactTypeStats,
+		coerceStringFields:     config.CoerceStringFields,
+		outboxEnabled:          config.OutboxEnabled,
+		recordHistoryEnabled:   config.RecordHistoryEnabled,
+		redactSQLArgs:          config.LogMutatingSQL,
+		maxRecordSize:          config.MaxRecordSize,
+		fieldKeyProvider:       config.FieldKeyProvider,
+		defaultQueryLimit:      config.DefaultQueryLimit,
 		context:                ctx,
-	}, nil
+	}
+	if config.QueryCacheSize > 0 {
+		c.queryCache = getQueryCache(connString, config.QueryCacheSize, config.QueryCacheTTL)
+	}
+	return c, nil
 }
 
 type getDBReq struct {
@@ -148,7 +336,7 @@ func dbInitializer() {
 
 // mustInitDB initialize database objects for an application.
 func mustInitDB(db *sqlx.DB, appName string, migrate bool) error {
-	schema := "app_" + toLowerAndUnderscore(appName)
+	schema := appSchemaName(appName)
 	err := migration.EnsureLatest(db, schema, migrate)
 
 	if err != nil {
@@ -162,6 +350,10 @@ func mustInitDB(db *sqlx.DB, appName string, migrate bool) error {
 			return fmt.Errorf("skydb/pq: unable to migrate database because of an error = %v", err)
 		}
 	}
+
+	if err := recordAppSchemaOwner(db, schema, appName); err != nil {
+		return fmt.Errorf("skydb/pq: unable to claim the schema of the app = %v", err)
+	}
 	return nil
 }
 
@@ -20,11 +20,14 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
 )
 
 // NOTE(limouren): postgresql uses this error to signify a non-exist
@@ -41,7 +44,7 @@ func testAppName() string {
 	return "io.skygear.test"
 }
 
-func getTestConn(t *testing.T) *conn {
+func getTestConn(t testing.TB) *conn {
 	if runtime.GOMAXPROCS(0) > 1 {
 		t.Skip("skipping zmq test in GOMAXPROCS>1")
 	}
@@ -70,7 +73,7 @@ func getTestConn(t *testing.T) *conn {
 	return c.(*conn)
 }
 
-func dropAllRecordTables(t *testing.T, c *conn) {
+func dropAllRecordTables(t testing.TB, c *conn) {
 	tx, err := c.db.Beginx()
 	if err != nil {
 		t.Fatal(err)
@@ -88,7 +91,7 @@ func dropAllRecordTables(t *testing.T, c *conn) {
 	}
 }
 
-func cleanupConn(t *testing.T, c *conn) {
+func cleanupConn(t testing.TB, c *conn) {
 	if len(c.RecordSchema) > 0 {
 		dropAllRecordTables(t, c)
 	}
@@ -97,7 +100,7 @@ func cleanupConn(t *testing.T, c *conn) {
 	// we don't want a cancelled context preventing clean up.
 	ctx := context.Background()
 
-	schemaName := fmt.Sprintf("app_%s", toLowerAndUnderscore(c.appName))
+	schemaName := appSchemaName(c.appName)
 	_, err := c.db.ExecContext(ctx, fmt.Sprintf("DROP SCHEMA if exists %s CASCADE", schemaName))
 	if err != nil && !isInvalidSchemaName(err) {
 		t.Fatal(err)
@@ -170,3 +173,122 @@ func exhaustRows(rows *skydb.Rows, errin error) (records []skydb.Record, err err
 	err = rows.Err()
 	return
 }
+
+func TestAppSchemaName(t *testing.T) {
+	Convey("appSchemaName", t, func() {
+		Convey("replaces dots and colons with underscores", func() {
+			So(appSchemaName("com.oursky.skygear"), ShouldEqual, "app_com_oursky_skygear")
+			So(appSchemaName("io.skygear:Test"), ShouldEqual, "app_io_skygear_test")
+		})
+
+		Convey("sanitizes and hashes unsafe characters", func() {
+			schema := appSchemaName("com.oursky-skygear")
+			So(schema, ShouldStartWith, "app_com_oursky_skygear_")
+			So(schema, ShouldHaveLength, len("app_com_oursky_skygear_")+16)
+			So(schema, ShouldEqual, appSchemaName("com.oursky-skygear"))
+		})
+
+		Convey("keeps names distinct if they differ only by unsafe characters", func() {
+			names := []string{
+				"com.oursky.skygear",
+				"com.oursky-skygear",
+				"com-oursky.skygear",
+				"com-oursky-skygear",
+			}
+			schemas := map[string]string{}
+			for _, name := range names {
+				schema := appSchemaName(name)
+				_, exists := schemas[schema]
+				So(exists, ShouldBeFalse)
+				So(schema, ShouldNotContainSubstring, "-")
+				schemas[schema] = name
+			}
+		})
+
+		Convey("keeps non-ASCII letters as earlier versions did", func() {
+			So(appSchemaName("com.oursky.skygéar"), ShouldEqual, "app_com_oursky_skygéar")
+			So(appSchemaName("com.oursky.SKYGÉAR"), ShouldEqual, "app_com_oursky_skygéar")
+		})
+
+		Convey("truncates long names as PostgreSQL does", func() {
+			longName := "com.oursky." + strings.Repeat("a", 100)
+			schema := appSchemaName(longName)
+			So(schema, ShouldEqual, ("app_com_oursky_" + strings.Repeat("a", 100))[:maxIdentifierLength])
+			So(appSchemaName(longName+"b"), ShouldEqual, schema)
+		})
+
+		Convey("truncates long names without splitting a character", func() {
+			longName := "com.oursky." + strings.Repeat("é", 50)
+			schema := appSchemaName(longName)
+			So(schema, ShouldEqual, "app_com_oursky_"+strings.Repeat("é", 24))
+			So(utf8.ValidString(schema), ShouldBeTrue)
+		})
+
+		Convey("truncates long names with unsafe characters before the hash", func() {
+			longName := "com-oursky." + strings.Repeat("a", 100)
+			schema := appSchemaName(longName)
+			So(schema, ShouldHaveLength, maxIdentifierLength)
+			So(schema, ShouldNotEqual, appSchemaName(longName+"b"))
+		})
+	})
+}
+
+func TestClaimAppSchema(t *testing.T) {
+	Convey("claimAppSchema", t, func() {
+		Convey("claims the schema of an app more than once", func() {
+			schema, err := claimAppSchema("com.example.claim")
+			So(err, ShouldBeNil)
+			So(schema, ShouldEqual, "app_com_example_claim")
+
+			schema, err = claimAppSchema("com.example.claim")
+			So(err, ShouldBeNil)
+			So(schema, ShouldEqual, "app_com_example_claim")
+		})
+
+		Convey("rejects apps colliding on the same schema", func() {
+			_, err := claimAppSchema("com.example.collide")
+			So(err, ShouldBeNil)
+
+			_, err = claimAppSchema("com_example_collide")
+			So(err, ShouldNotBeNil)
+			_, err = claimAppSchema("com:example.collide")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("does not reject apps differing by unsafe characters", func() {
+			_, err := claimAppSchema("com.example.dash")
+			So(err, ShouldBeNil)
+			_, err = claimAppSchema("com-example-dash")
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestRecordAppSchemaOwner(t *testing.T) {
+	Convey("recordAppSchemaOwner", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		schema := appSchemaName(c.appName)
+
+		Convey("records the app owning the schema", func() {
+			var comment string
+			err := c.QueryRowx(`
+SELECT obj_description(oid, 'pg_namespace')
+FROM pg_namespace
+WHERE nspname = $1`, schema).Scan(&comment)
+			So(err, ShouldBeNil)
+			So(comment, ShouldEqual, "skygear:app:"+c.appName)
+		})
+
+		Convey("accepts the app owning the schema", func() {
+			err := recordAppSchemaOwner(c.db, schema, c.appName)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("rejects another app sharing the schema", func() {
+			err := recordAppSchemaOwner(c.db, schema, "io_skygear_test")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
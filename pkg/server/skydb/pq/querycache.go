@@ -0,0 +1,212 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+
+	sq "github.com/lann/squirrel"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// queryCache keeps the records returned by queries, keyed by the rendered
+// SQL and arguments of the query. Entries are evicted in least recently
+// used order when the cache is full, and expire after ttl if ttl is
+// positive.
+//
+// Each entry is tagged with the record types the query reads from, and
+// the tables it joins, such as relation tables. It is invalidated when
+// any of those is modified through a conn sharing the cache.
+type queryCache struct {
+	mutex       sync.Mutex
+	size        int
+	ttl         time.Duration
+	entries     map[string]*list.Element
+	lru         *list.List
+	generations map[string]uint64
+}
+
+type queryCacheEntry struct {
+	key         string
+	recordTypes []string
+	records     []skydb.Record
+	recordCount *uint64
+	expiresAt   time.Time
+}
+
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	return &queryCache{
+		size:        size,
+		ttl:         ttl,
+		entries:     map[string]*list.Element{},
+		lru:         list.New(),
+		generations: map[string]uint64{},
+	}
+}
+
+var queryCaches = map[string]*queryCache{}
+var queryCachesMutex sync.Mutex
+
+// getQueryCache returns the query cache shared by conns connected with
+// the same connection string.
+func getQueryCache(connString string, size int, ttl time.Duration) *queryCache {
+	queryCachesMutex.Lock()
+	defer queryCachesMutex.Unlock()
+
+	cache, ok := queryCaches[connString]
+	if !ok {
+		cache = newQueryCache(size, ttl)
+		queryCaches[connString] = cache
+	}
+	return cache
+}
+
+func queryCacheKey(sql string, args []interface{}) string {
+	return fmt.Sprintf("%s %#v", sql, args)
+}
+
+// generation returns a token to be passed to put, such that the result
+// of a query is not cached if any of its record types is invalidated
+// while the query is running.
+func (c *queryCache) generation(recordTypes []string) []uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	generation := make([]uint64, len(recordTypes))
+	for i, recordType := range recordTypes {
+		generation[i] = c.generations[recordType]
+	}
+	return generation
+}
+
+// get returns copies of the cached records, so that callers can modify
+// them freely.
+func (c *queryCache) get(key string) ([]skydb.Record, *uint64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+
+	entry := element.Value.(*queryCacheEntry)
+	if c.ttl > 0 && timeNow().After(entry.expiresAt) {
+		c.remove(element)
+		return nil, nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	records := make([]skydb.Record, len(entry.records))
+	for i := range entry.records {
+		records[i] = entry.records[i].Copy()
+	}
+	return records, entry.recordCount, true
+}
+
+func (c *queryCache) put(key string, recordTypes []string, generation []uint64, records []skydb.Record, recordCount *uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, recordType := range recordTypes {
+		if c.generations[recordType] != generation[i] {
+			return
+		}
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	cached := make([]skydb.Record, len(records))
+	for i := range records {
+		cached[i] = records[i].Copy()
+	}
+	c.entries[key] = c.lru.PushFront(&queryCacheEntry{
+		key:         key,
+		recordTypes: recordTypes,
+		records:     cached,
+		recordCount: recordCount,
+		expiresAt:   timeNow().Add(c.ttl),
+	})
+
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate removes the entries of queries reading from the record type.
+func (c *queryCache) invalidate(recordType string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generations[recordType]++
+	for element := c.lru.Front(); element != nil; {
+		next := element.Next()
+		for _, entryRecordType := range element.Value.(*queryCacheEntry).recordTypes {
+			if entryRecordType == recordType {
+				c.remove(element)
+				break
+			}
+		}
+		element = next
+	}
+}
+
+func (c *queryCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*queryCacheEntry).key)
+}
+
+// queryWithCache runs the select query, or returns the records from the
+// cache if the same query is run before. Records that cannot be scanned
+// are skipped.
+func (db *database) queryWithCache(q sq.SelectBuilder, recordType string, typemap skydb.RecordSchema, recordTypes []string) (*skydb.Rows, error) {
+	sql, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	cache := db.c.queryCache
+	key := queryCacheKey(sql, args)
+	if records, recordCount, ok := cache.get(key); ok {
+		log.WithField("sql", sql).Debugln("Using cached query result")
+		return skydb.NewRows(bufferedRowsIter{
+			skydb.NewMemoryRows(records),
+			recordCount,
+		}), nil
+	}
+
+	generation := cache.generation(recordTypes)
+	sqlRows, err := db.c.Queryx(sql, args...)
+	rows, err := newRows(recordType, typemap, sqlRows, err, db.c.fieldKeyProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	records, recordCount, err := readRows(rows)
+	if err != nil {
+		return nil, err
+	}
+	cache.put(key, recordTypes, generation, records, recordCount)
+
+	return skydb.NewRows(bufferedRowsIter{
+		skydb.NewMemoryRows(records),
+		recordCount,
+	}), nil
+}
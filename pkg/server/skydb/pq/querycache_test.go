@@ -0,0 +1,112 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryCacheEntries(t *testing.T) {
+	Convey("queryCache", t, func() {
+		now := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		originalTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = originalTimeNow
+		}()
+
+		cache := newQueryCache(2, time.Minute)
+		note := skydb.Record{
+			ID: skydb.NewRecordID("note", "id"),
+			Data: skydb.Data{
+				"content": "Hello World",
+			},
+		}
+		put := func(key string, recordTypes ...string) {
+			generation := cache.generation(recordTypes)
+			cache.put(key, recordTypes, generation, []skydb.Record{note}, nil)
+		}
+
+		Convey("gets copies of cached records", func() {
+			put("query1", "note")
+
+			records, _, ok := cache.get("query1")
+			So(ok, ShouldBeTrue)
+			So(records, ShouldResemble, []skydb.Record{note})
+
+			records[0].Data["content"] = "Bye World"
+			records, _, _ = cache.get("query1")
+			So(records[0].Data["content"], ShouldEqual, "Hello World")
+		})
+
+		Convey("evicts least recently used entry", func() {
+			put("query1", "note")
+			put("query2", "note")
+			cache.get("query1")
+			put("query3", "note")
+
+			_, _, ok := cache.get("query1")
+			So(ok, ShouldBeTrue)
+			_, _, ok = cache.get("query2")
+			So(ok, ShouldBeFalse)
+			_, _, ok = cache.get("query3")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("expires entry after ttl", func() {
+			put("query1", "note")
+
+			now = now.Add(time.Minute - time.Second)
+			_, _, ok := cache.get("query1")
+			So(ok, ShouldBeTrue)
+
+			now = now.Add(2 * time.Second)
+			_, _, ok = cache.get("query1")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("invalidates entries of record type", func() {
+			put("query1", "note")
+			put("query2", "category", "note")
+			cache.invalidate("note")
+
+			_, _, ok := cache.get("query1")
+			So(ok, ShouldBeFalse)
+			_, _, ok = cache.get("query2")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("keeps entries of other record types", func() {
+			put("query1", "category")
+			cache.invalidate("note")
+
+			_, _, ok := cache.get("query1")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("does not cache result of query invalidated while running", func() {
+			generation := cache.generation([]string{"note"})
+			cache.invalidate("note")
+			cache.put("query1", []string{"note"}, generation, []skydb.Record{note}, nil)
+
+			_, _, ok := cache.get("query1")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
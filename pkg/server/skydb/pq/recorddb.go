@@ -16,10 +16,12 @@ package pq
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
@@ -30,6 +32,7 @@ import (
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
 func (db *database) Get(id skydb.RecordID, record *skydb.Record) error {
@@ -44,7 +47,7 @@ func (db *database) Get(id skydb.RecordID, record *skydb.Record) error {
 
 	builder := db.selectQuery(psql.Select(), id.Type, typemap).Where("_id = ?", id.Key)
 	row := db.c.QueryRowWith(builder)
-	if err := newRecordScanner(id.Type, typemap, row).Scan(record); err == sql.ErrNoRows {
+	if err := newRecordScanner(id.Type, typemap, row, db.c.fieldKeyProvider).Scan(record); err == sql.ErrNoRows {
 		return skydb.ErrRecordNotFound
 	} else if err != nil {
 		return err
@@ -52,6 +55,35 @@ func (db *database) Get(id skydb.RecordID, record *skydb.Record) error {
 	return nil
 }
 
+func (db *database) GetRawField(id skydb.RecordID, field string) ([]byte, error) {
+	typemap, err := db.RemoteColumnTypes(id.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(typemap) == 0 { // record type has not been created
+		return nil, skydb.ErrRecordNotFound
+	}
+
+	if fieldType, ok := typemap[field]; !ok || fieldType.Type != skydb.TypeJSON {
+		return nil, skyerr.NewErrorf(skyerr.InvalidArgument,
+			`field "%s" of %s is not a json field`, field, id.Type)
+	}
+
+	builder := psql.Select(pq.QuoteIdentifier(field)).
+		From(db.TableName(id.Type)).
+		Where("_id = ?", id.Key)
+	builder = db.whereDatabase(builder, id.Type)
+
+	var raw []byte
+	if err := db.c.QueryRowWith(builder).Scan(&raw); err == sql.ErrNoRows {
+		return nil, skydb.ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
 // GetByIDs using SQL IN cause
 // GetByIDs only support one type of records at a time. If you want to query
 // array of ids belongs to different type, you need to call this method multiple
@@ -81,9 +113,9 @@ func (db *database) GetByIDs(ids []skydb.RecordID, accessControlOptions *skydb.A
 		return nil, skydb.ErrRecordNotFound
 	}
 
-	inCause, inArgs := builder.LiteralToSQLOperand(idStrs)
+	inCause, inArgs := builder.InToSQL(pq.QuoteIdentifier("_id"), idStrs)
 	query := db.selectQuery(psql.Select(), recordType, typemap).
-		Where(pq.QuoteIdentifier("_id")+" IN "+inCause, inArgs...)
+		Where(inCause, inArgs...)
 
 	if db.DatabaseType() == skydb.PublicDatabase && !accessControlOptions.BypassAccessControl {
 		factory := builder.NewPredicateSqlizerFactory(db, recordType)
@@ -99,7 +131,32 @@ func (db *database) GetByIDs(ids []skydb.RecordID, accessControlOptions *skydb.A
 		log.Debugf("Getting records by ID failed %v", err)
 		return nil, err
 	}
-	return newRows(recordType, typemap, rows, err)
+	return newRows(recordType, typemap, rows, err, db.c.fieldKeyProvider)
+}
+
+// OutgoingReferences reads the reference fields of a record according
+// to the remote schema of its record type.
+func (db *database) OutgoingReferences(id skydb.RecordID) (map[string]skydb.Reference, error) {
+	var record skydb.Record
+	if err := db.Get(id, &record); err != nil {
+		return nil, err
+	}
+
+	typemap, err := db.RemoteColumnTypes(id.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	references := map[string]skydb.Reference{}
+	for key, fieldType := range typemap {
+		if fieldType.Type != skydb.TypeReference {
+			continue
+		}
+		if ref, ok := record.Get(key).(skydb.Reference); ok {
+			references[key] = ref
+		}
+	}
+	return references, nil
 }
 
 // Save attempts to do a upsert
@@ -114,6 +171,10 @@ func (db *database) Save(record *skydb.Record) error {
 		return fmt.Errorf("db.save %s: got empty OwnerID", record.ID.Key)
 	}
 
+	if err := db.checkRecordSize(record); err != nil {
+		return err
+	}
+
 	var pkData map[string]interface{}
 	switch db.DatabaseType() {
 	case skydb.UnionDatabase:
@@ -127,11 +188,24 @@ func (db *database) Save(record *skydb.Record) error {
 		}
 	}
 
+	if (db.c.outboxEnabled || db.c.recordHistoryEnabled) && db.c.tx == nil {
+		// The outbox event and the history are written in the same
+		// transaction as the record, so that none is written without
+		// the others.
+		return db.c.RunInTransaction(func(skydb.Conn) error {
+			return db.Save(record)
+		})
+	}
+
 	typemap, err := db.RemoteColumnTypes(record.ID.Type)
 	if err != nil {
 		return err
 	}
 
+	if db.c.coerceStringFields {
+		coerceStringFields(typemap, record)
+	}
+
 	wrappers := map[string]func(string) string{}
 	for column, fieldType := range typemap {
 		if fieldType.Type == skydb.TypeGeometry {
@@ -141,10 +215,41 @@ func (db *database) Save(record *skydb.Record) error {
 		}
 	}
 
-	upsert := builder.UpsertQueryWithWrappers(db.TableName(record.ID.Type), pkData, convert(record), wrappers).
+	data := convert(record)
+	if err := db.encryptFields(typemap, data); err != nil {
+		return err
+	}
+	applyDefaultAccess := false
+	if record.ACL == nil {
+		defaultAccess, err := db.c.GetRecordDefaultAccess(record.ID.Type)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if defaultAccess != nil {
+			data["_access"] = aclValue(defaultAccess)
+			applyDefaultAccess = true
+		}
+	}
+
+	upsert := builder.UpsertQueryWithWrappers(db.TableName(record.ID.Type), pkData, data, wrappers).
 		IgnoreKeyOnUpdate("_owner_id").
 		IgnoreKeyOnUpdate("_created_at").
 		IgnoreKeyOnUpdate("_created_by")
+	if applyDefaultAccess {
+		// The default access only applies to a new record, an existing
+		// record keeps its access when saved without ACL.
+		upsert = upsert.IgnoreKeyOnUpdate("_access")
+	}
+
+	options, err := db.getExtendOptions(record.ID.Type)
+	if err != nil {
+		return err
+	}
+	if options.PreserveUpdatedAt {
+		upsert = upsert.
+			IgnoreKeyOnUpdate("_updated_at").
+			IgnoreKeyOnUpdate("_updated_by")
+	}
 
 	// record type is empty in the following statement because upsert
 	// only concerns with one record type, and that specifying the
@@ -158,8 +263,29 @@ func (db *database) Save(record *skydb.Record) error {
 		return err
 	}
 
+	if err := db.checkAssetLists(typemap, record.Data); err != nil {
+		return err
+	}
+
+	if err := checkEnumValues(typemap, record); err != nil {
+		return err
+	}
+
+	var outboxEvent skydb.RecordHookEvent
+	if db.c.outboxEnabled {
+		if outboxEvent, err = db.outboxSaveEvent(record.ID); err != nil {
+			return err
+		}
+	}
+
 	row := db.c.QueryRowWith(upsert)
-	if err = newRecordScanner(record.ID.Type, typemap, row).Scan(record); err != nil {
+	if err = newRecordScanner(record.ID.Type, typemap, row, db.c.fieldKeyProvider).Scan(record); err != nil {
+		if isForeignKeyViolated(err) {
+			if name, ok := missingAsset(err, typemap, record.Data); ok {
+				return skydb.ErrAssetNotFound{AssetName: name}
+			}
+		}
+
 		if isUniqueViolated(err) {
 			return skyerr.NewErrorf(
 				skyerr.Duplicated,
@@ -175,11 +301,282 @@ func (db *database) Save(record *skydb.Record) error {
 		}
 		return skyerr.MakeError(err)
 	}
+	db.c.invalidateQueryCache(record.ID.Type)
+
+	if db.c.outboxEnabled {
+		if err := db.writeOutbox(outboxEvent, record.ID); err != nil {
+			return err
+		}
+	}
+	if db.c.recordHistoryEnabled {
+		if err := db.writeHistory(record.ID); err != nil {
+			return err
+		}
+	}
 
 	record.DatabaseID = db.userID
 	return nil
 }
 
+// checkRecordSize returns an ErrRecordTooLarge if the record is larger
+// than the maximum record size, measured by the values stored in its
+// columns.
+func (db *database) checkRecordSize(record *skydb.Record) error {
+	if db.c.maxRecordSize <= 0 {
+		return nil
+	}
+
+	size := 0
+	for _, value := range convert(record) {
+		if valuer, ok := value.(driver.Valuer); ok {
+			var err error
+			if value, err = valuer.Value(); err != nil {
+				return err
+			}
+		}
+		switch value := value.(type) {
+		case string:
+			size += len(value)
+		case []byte:
+			size += len(value)
+		}
+	}
+
+	if size > db.c.maxRecordSize {
+		return skydb.ErrRecordTooLarge{
+			RecordID: record.ID,
+			Size:     size,
+			MaxSize:  db.c.maxRecordSize,
+		}
+	}
+	return nil
+}
+
+// checkPatchedRecordSize checks the size of the record identified by id
+// as if the data were patched onto it, so that the limit cannot be
+// exceeded by patching fields one by one.
+func (db *database) checkPatchedRecordSize(id skydb.RecordID, data skydb.Data) error {
+	if db.c.maxRecordSize <= 0 {
+		return nil
+	}
+
+	patched := skydb.Record{}
+	if err := db.Get(id, &patched); err != nil {
+		return err
+	}
+	if patched.Data == nil {
+		patched.Data = skydb.Data{}
+	}
+	for key, value := range data {
+		if value == skydb.Null {
+			delete(patched.Data, key)
+		} else {
+			patched.Data[key] = value
+		}
+	}
+	return db.checkRecordSize(&patched)
+}
+
+func (db *database) SaveNew(record *skydb.Record) error {
+	if record.ID.Key == "" {
+		record.ID.Key = uuid.New()
+	}
+	return db.Save(record)
+}
+
+func (db *database) SaveIfUnmodified(record *skydb.Record, updatedAt time.Time) error {
+	save := func() error {
+		if err := db.checkUnmodified(record.ID, updatedAt); err != nil {
+			return err
+		}
+		return db.Save(record)
+	}
+
+	// The stored record is locked until the transaction ends, so that
+	// it cannot be modified by others between the check and the save.
+	if db.c.tx != nil {
+		return save()
+	}
+	return db.c.RunInTransaction(func(skydb.Conn) error {
+		return save()
+	})
+}
+
+func (db *database) Clone(sourceID skydb.RecordID, newKey string, newOwner string) (skydb.Record, error) {
+	if db.DatabaseType() == skydb.UnionDatabase {
+		return skydb.Record{}, skydb.ErrDatabaseIsReadOnly
+	}
+
+	source := skydb.Record{}
+	if err := db.Get(sourceID, &source); err != nil {
+		return skydb.Record{}, err
+	}
+
+	if newKey == "" {
+		newKey = uuid.New()
+	}
+	now := timeNow()
+	// References and assets are stored by their IDs and names, so a
+	// shallow copy of the data is sufficient.
+	record := skydb.Record{
+		ID:        skydb.NewRecordID(sourceID.Type, newKey),
+		OwnerID:   newOwner,
+		CreatedAt: now,
+		CreatorID: newOwner,
+		UpdatedAt: now,
+		UpdaterID: newOwner,
+		Data:      source.Data.Copy(),
+	}
+
+	if err := db.SaveIfUnmodified(&record, time.Time{}); err != nil {
+		return skydb.Record{}, err
+	}
+	return record, nil
+}
+
+func (db *database) Patch(id skydb.RecordID, updaterID string, fields map[string]interface{}) error {
+	if id.Key == "" {
+		return errors.New("db.patch: got empty record id")
+	}
+	if id.Type == "" {
+		return fmt.Errorf("db.patch %s: got empty record type", id.Key)
+	}
+	if db.DatabaseType() == skydb.UnionDatabase {
+		return skydb.ErrDatabaseIsReadOnly
+	}
+
+	if (db.c.outboxEnabled || db.c.recordHistoryEnabled) && db.c.tx == nil {
+		return db.c.RunInTransaction(func(skydb.Conn) error {
+			return db.Patch(id, updaterID, fields)
+		})
+	}
+
+	typemap, err := db.RemoteColumnTypes(id.Type)
+	if err != nil {
+		return err
+	}
+	if len(typemap) == 0 { // record type has not been created
+		return skydb.ErrRecordNotFound
+	}
+
+	record := skydb.Record{ID: id, Data: skydb.Data{}}
+	for key, value := range fields {
+		if _, ok := typemap[key]; !ok || strings.HasPrefix(key, "_") {
+			return skyerr.NewErrorf(skyerr.InvalidArgument,
+				`failed to patch %s: field "%s" cannot be patched`, id, key)
+		}
+		record.Data[key] = value
+	}
+
+	if db.c.coerceStringFields {
+		coerceStringFields(typemap, &record)
+	}
+
+	if err := db.preSave(typemap, &record); err != nil {
+		return err
+	}
+
+	if err := db.checkAssetLists(typemap, record.Data); err != nil {
+		return err
+	}
+
+	if err := checkEnumValues(typemap, &record); err != nil {
+		return err
+	}
+
+	if err := db.checkPatchedRecordSize(id, record.Data); err != nil {
+		return err
+	}
+
+	data := convertData(record.Data)
+	if err := db.encryptFields(typemap, data); err != nil {
+		return err
+	}
+
+	update := psql.Update(db.TableName(id.Type)).
+		Set("_updated_at", timeNow()).
+		Set("_updated_by", updaterID).
+		Where("_id = ? AND _database_id = ?", id.Key, db.userID)
+	for column, value := range data {
+		if typemap[column].Type == skydb.TypeGeometry {
+			value = sq.Expr("ST_GeomFromGeoJSON(?)", value)
+		}
+		update = update.Set(pq.QuoteIdentifier(column), value)
+	}
+
+	result, err := db.c.ExecWith(update)
+	if err != nil {
+		if isForeignKeyViolated(err) {
+			if name, ok := missingAsset(err, typemap, record.Data); ok {
+				return skydb.ErrAssetNotFound{AssetName: name}
+			}
+		}
+
+		if isUniqueViolated(err) {
+			return skyerr.NewErrorf(
+				skyerr.Duplicated,
+				fmt.Sprintf("violate unique constraint"),
+			)
+		}
+
+		if isInvalidInputSyntax(err) {
+			return skyerr.NewErrorf(
+				skyerr.InvalidArgument,
+				fmt.Sprintf("failed to patch %s: %s", id, err),
+			)
+		}
+		return skyerr.MakeError(err)
+	}
+	db.c.invalidateQueryCache(id.Type)
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("patch %s: failed to retrieve update status", id)
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrRecordNotFound
+	}
+
+	if db.c.outboxEnabled {
+		if err := db.writeOutbox(skydb.RecordUpdated, id); err != nil {
+			return err
+		}
+	}
+	if db.c.recordHistoryEnabled {
+		return db.writeHistory(id)
+	}
+	return nil
+}
+
+func (db *database) checkUnmodified(id skydb.RecordID, updatedAt time.Time) error {
+	// _updated_at is compared in the database, such that updatedAt is
+	// rounded to the precision of the column the same way as when it
+	// is saved.
+	builder := psql.Select().
+		Column("_updated_at = ?", updatedAt).
+		From(db.TableName(id.Type)).
+		Where("_id = ? AND _database_id = ?", id.Key, db.userID).
+		Suffix("FOR UPDATE")
+
+	var unmodified bool
+	err := db.c.QueryRowWith(builder).Scan(&unmodified)
+	if err == sql.ErrNoRows {
+		if updatedAt.IsZero() {
+			return nil
+		}
+		return skydb.ErrRecordNotFound
+	} else if isUndefinedTable(err) {
+		return skydb.ErrRecordNotFound
+	} else if err != nil {
+		return err
+	}
+
+	if updatedAt.IsZero() || !unmodified {
+		return skydb.ErrRecordStale
+	}
+	return nil
+}
+
 func (db *database) preSave(schema skydb.RecordSchema, record *skydb.Record) error {
 	const SetSequenceMaxValue = `SELECT setval($1, GREATEST(max(%v), $2)) FROM %v;`
 
@@ -197,9 +594,83 @@ func (db *database) preSave(schema skydb.RecordSchema, record *skydb.Record) err
 	return nil
 }
 
+// checkAssetLists returns an ErrAssetNotFound if an asset list field in
+// data contains an asset that does not exist. Unlike an asset field, an
+// asset list field is not protected by a foreign key constraint.
+func (db *database) checkAssetLists(schema skydb.RecordSchema, data skydb.Data) error {
+	names := []string{}
+	for key, value := range data {
+		assets, ok := value.([]*skydb.Asset)
+		if !ok || schema[key].Type != skydb.TypeAssetList {
+			continue
+		}
+		names = append(names, assetNames(assets)...)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	assets, err := db.c.GetAssets(names)
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, asset := range assets {
+		existing[asset.Name] = true
+	}
+	for _, name := range names {
+		if !existing[name] {
+			return skydb.ErrAssetNotFound{AssetName: name}
+		}
+	}
+	return nil
+}
+
+// checkEnumValues returns an ErrInvalidEnumValue if a field of TypeEnum
+// is set to a value not allowed, which the database would otherwise
+// reject with a less informative error.
+func checkEnumValues(schema skydb.RecordSchema, record *skydb.Record) error {
+	for key, value := range record.Data {
+		fieldType := schema[key]
+		if fieldType.Type != skydb.TypeEnum || value == nil || value == skydb.Null {
+			continue
+		}
+
+		str, _ := value.(string)
+		allowed := false
+		for _, enumValue := range fieldType.EnumValues {
+			if str == enumValue {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return skydb.ErrInvalidEnumValue{
+				RecordID: record.ID,
+				Field:    key,
+				Value:    value,
+				Allowed:  fieldType.EnumValues,
+			}
+		}
+	}
+	return nil
+}
+
 func convert(r *skydb.Record) map[string]interface{} {
+	m := convertData(r.Data)
+	m["_owner_id"] = r.OwnerID
+	m["_access"] = aclValue(r.ACL)
+	m["_created_at"] = r.CreatedAt
+	m["_created_by"] = r.CreatorID
+	m["_updated_at"] = r.UpdatedAt
+	m["_updated_by"] = r.UpdaterID
+	return m
+}
+
+func convertData(data skydb.Data) map[string]interface{} {
 	m := map[string]interface{}{}
-	for key, rawValue := range r.Data {
+	for key, rawValue := range data {
 		switch value := rawValue.(type) {
 		case []interface{}:
 			m[key] = jsonSliceValue(value)
@@ -207,12 +678,16 @@ func convert(r *skydb.Record) map[string]interface{} {
 			m[key] = jsonMapValue(value)
 		case *skydb.Asset:
 			m[key] = assetValue(*value)
+		case []*skydb.Asset:
+			m[key] = assetListValue(value)
 		case skydb.Reference:
 			m[key] = referenceValue(value)
 		case skydb.Location:
 			m[key] = locationValue(value)
 		case skydb.Geometry:
 			m[key] = geometryValue(value)
+		case skydb.NullValue:
+			m[key] = nil
 		case skydb.Unknown:
 			// Do not modify columns with unknown type because they are
 			// managed by the developer.
@@ -220,12 +695,6 @@ func convert(r *skydb.Record) map[string]interface{} {
 			m[key] = rawValue
 		}
 	}
-	m["_owner_id"] = r.OwnerID
-	m["_access"] = aclValue(r.ACL)
-	m["_created_at"] = r.CreatedAt
-	m["_created_by"] = r.CreatorID
-	m["_updated_at"] = r.UpdatedAt
-	m["_updated_by"] = r.UpdaterID
 	return m
 }
 
@@ -242,6 +711,25 @@ func (db *database) Delete(id skydb.RecordID) error {
 		builder = builder.Where("_database_id = ?", db.userID)
 	}
 
+	// The record is deleted along with its labels, and its outbox and
+	// history entries if enabled, in one transaction.
+	if db.c.tx == nil {
+		return db.c.RunInTransaction(func(skydb.Conn) error {
+			return db.Delete(id)
+		})
+	}
+
+	if db.c.outboxEnabled {
+		// The deleted record is written to the outbox, so it is
+		// written before the record is deleted.
+		err := db.writeOutbox(skydb.RecordDeleted, id)
+		if isUndefinedTable(err) {
+			return skydb.ErrRecordNotFound
+		} else if err != nil {
+			return err
+		}
+	}
+
 	result, err := db.c.ExecWith(builder)
 	if isUndefinedTable(err) {
 		return skydb.ErrRecordNotFound
@@ -269,53 +757,388 @@ func (db *database) Delete(id skydb.RecordID) error {
 		}).Errorln("Unexpected rows deleted")
 		return fmt.Errorf("delete %s: got %v rows deleted, want 1", id, rowsAffected)
 	}
+	db.c.invalidateQueryCache(id.Type)
+
+	if db.c.recordHistoryEnabled {
+		if err := db.writeHistoryDeletion(id); err != nil {
+			return err
+		}
+	}
+
+	if err := db.deleteLabels(id); err != nil {
+		return fmt.Errorf("delete %s: failed to remove labels: %v", id, err)
+	}
+
+	return nil
+}
+
+func (db *database) applyQueryPredicate(q sq.SelectBuilder, factory builder.PredicateSqlizerFactory, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (sq.SelectBuilder, error) {
+	if p := query.Predicate; !p.IsEmpty() {
+		if db.c.coerceStringFields {
+			typemap, err := db.RemoteColumnTypes(query.Type)
+			if err != nil {
+				return q, err
+			}
+			p = coerceStringComparisons(p, typemap)
+		}
+
+		sqlizer, err := factory.NewPredicateSqlizer(p)
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(sqlizer)
+		q = factory.AddJoinsToSelectBuilder(q)
+	}
+
+	if query.WithLabel != "" {
+		q = q.Where(db.labelSqlizer(query.Type, query.WithLabel))
+	}
+
+	if db.DatabaseType() == skydb.PublicDatabase && !accessControlOptions.BypassAccessControl {
+		user, err := db.queryACLUser(query, accessControlOptions)
+		if err != nil {
+			return q, err
+		}
+		aclSqlizer, err := factory.NewAccessControlSqlizer(user, skydb.ReadLevel)
+		if err != nil {
+			return q, err
+		}
+		q = q.Where(aclSqlizer)
+	}
+
+	return q, nil
+}
+
+// queryACLUser returns the user whose access to records is checked when
+// filtering records of the query, taking Query.AsRoles and
+// Query.AsOwner into account.
+func (db *database) queryACLUser(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.AuthInfo, error) {
+	if len(query.AsRoles) == 0 && query.AsOwner == "" {
+		return accessControlOptions.ViewAsUser, nil
+	}
+
+	if db.c.accessModel != skydb.RoleBasedAccess {
+		return nil, skyerr.NewErrorf(skyerr.NotSupported,
+			"querying as roles is not supported with %v", db.c.accessModel)
+	}
+
+	return &skydb.AuthInfo{
+		ID:    query.AsOwner,
+		Roles: query.AsRoles,
+	}, nil
+}
+
+func (db *database) Query(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	sel, err := db.selectRecords(query, accessControlOptions, false)
+	if err != nil {
+		return nil, err
+	}
+	if sel == nil {
+		return skydb.EmptyRows, nil
+	}
+
+	var rows *skydb.Rows
+	// Queries in a transaction might read uncommitted modifications,
+	// which are not to be shared with others.
+	if db.c.queryCache != nil && db.c.tx == nil {
+		rows, err = db.queryWithCache(sel.q, query.Type, sel.typemap, sel.recordTypes)
+	} else {
+		sqlRows, queryErr := db.c.QueryWith(sel.q)
+		rows, err = newRows(query.Type, sel.typemap, sqlRows, queryErr, db.c.fieldKeyProvider)
+	}
+	if err != nil {
+		return nil, queryError(err)
+	}
+	rows = inTimeZone(rows, sel.typemap, query.TimeZone)
+	if sel.defaultLimitApplied {
+		return truncateRows(rows, db.c.defaultQueryLimit)
+	}
+	return rows, nil
+}
+
+// recordSelect is the statement of a record query, with what is needed
+// to read its rows.
+type recordSelect struct {
+	q                   sq.SelectBuilder
+	typemap             skydb.RecordSchema
+	recordTypes         []string // the record types and joined tables read by q
+	defaultLimitApplied bool
+}
+
+// selectRecords builds the statement of the query. It returns nil if
+// the record type has not been created. If byteOrder is true, text
+// columns are sorted as bytes, which is how UnionRows compares them.
+func (db *database) selectRecords(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions, byteOrder bool) (*recordSelect, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	typemap, err := db.RemoteColumnTypes(query.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(typemap) == 0 { // record type has not been created
+		return nil, nil
+	}
+
+	q := psql.Select()
+	factory := builder.NewPredicateSqlizerFactory(db, query.Type)
+	q, err = db.applyQueryPredicate(q, factory, query, accessControlOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSortKeyPaths(typemap, query.Sorts); err != nil {
+		return nil, err
+	}
+	for _, sort := range caseInsensitiveStringSorts(typemap, querySorts(query)) {
+		sortOrderBySQL := builder.SortOrderBySQL
+		if byteOrder && isTextSort(typemap, sort) {
+			sortOrderBySQL = builder.ByteOrderSortOrderBySQL
+		}
+		orderBy, err := sortOrderBySQL(query.Type, sort)
+		if err != nil {
+			return nil, err
+		}
+		q = q.OrderBy(orderBy)
+	}
+	// Records of the same sort value are ordered by ID, so that a page
+	// ends at an unambiguous position to be continued with After.
+	if column, ok := query.KeysetSortKey(); ok && column != "_id" {
+		orderBy, err := builder.SortOrderBySQL(query.Type, skydb.Sort{
+			Expression: skydb.Expression{
+				Type:  skydb.KeyPath,
+				Value: "_id",
+			},
+			Order: query.Sorts[0].Order,
+		})
+		if err != nil {
+			return nil, err
+		}
+		q = q.OrderBy(orderBy)
+	}
+
+	limit := query.Limit
+	defaultLimitApplied := false
+	if limit == nil && db.c.defaultQueryLimit > 0 {
+		// One more record is queried to tell whether any record is
+		// left out by the default limit.
+		extraLimit := db.c.defaultQueryLimit + 1
+		limit = &extraLimit
+		defaultLimitApplied = true
+	}
+
+	if limit != nil {
+		q = q.Limit(*limit)
+	}
+
+	if query.After != nil {
+		q = seekAfter(q, query)
+	}
+
+	if query.Offset > 0 {
+		q = q.Offset(query.Offset)
+	}
+
+	// Select columns to return, this is the last step so that predicate
+	// have a chance to change typemap, and the generated sql
+	// depends on the alias name used in table joins.
+	typemap, err = updateTypemapForQuery(query, typemap)
+	if err != nil {
+		return nil, err
+	}
+	typemap = factory.UpdateTypemap(typemap)
+
+	return &recordSelect{
+		q:                   db.selectQuery(q, query.Type, typemap),
+		typemap:             typemap,
+		recordTypes:         append([]string{query.Type}, factory.JoinedTables()...),
+		defaultLimitApplied: defaultLimitApplied,
+	}, nil
+}
+
+// queryError converts the error of executing a record query.
+func queryError(err error) error {
+	if isInvalidRegularExpression(err) {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			"invalid regular expression: %s", err.(*pq.Error).Message)
+	}
+	return err
+}
+
+// seekAfter restricts q to the records after query.After in the order
+// of the query, which is sorted by a single reserved column as checked
+// by Query.Validate. Records of the same sort value are ordered by ID
+// as in selectRecords, so that the position of a record is unambiguous.
+// Comparing the sort
+// column and ID together as a row lets Postgres seek to the position
+// with an index on them, such as the primary key for _id, rather than
+// reading every record before it as OFFSET does.
+func seekAfter(q sq.SelectBuilder, query *skydb.Query) sq.SelectBuilder {
+	column, _ := query.KeysetSortKey()
+	order := querySorts(query)[0].Order
+	quotedColumn := pq.QuoteIdentifier(query.Type) + "." + pq.QuoteIdentifier(column)
+	quotedID := pq.QuoteIdentifier(query.Type) + "." + pq.QuoteIdentifier("_id")
+
+	comparison := ">"
+	if order == skydb.Descending {
+		comparison = "<"
+	}
+
+	if column == "_id" {
+		return q.Where(quotedID+" "+comparison+" ?", query.After.ID)
+	}
+
+	sortValue := query.After.SortValue
+	if t, ok := sortValue.(time.Time); ok {
+		sortValue = t.UTC()
+	}
+	return q.Where(
+		fmt.Sprintf("(%s, %s) %s (?, ?)", quotedColumn, quotedID, comparison),
+		sortValue, query.After.ID,
+	)
+}
+
+// truncateRows reads at most limit records of rows into memory and
+// closes it. The returned Rows is marked truncated if rows has more
+// records than limit.
+func truncateRows(rows *skydb.Rows, limit uint64) (*skydb.Rows, error) {
+	records, recordCount, err := readRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	truncated := uint64(len(records)) > limit
+	if truncated {
+		records = records[:limit]
+	}
+
+	result := skydb.NewRows(bufferedRowsIter{
+		skydb.NewMemoryRows(records),
+		recordCount,
+	})
+	result.Truncated = truncated
+	return result, nil
+}
+
+// inTimeZone returns rows returning the times of TypeDateTimeTZ fields
+// of the records in the time zone.
+func inTimeZone(rows *skydb.Rows, typemap skydb.RecordSchema, location *time.Location) *skydb.Rows {
+	if location == nil {
+		return rows
+	}
+	return skydb.NewRows(timeZoneRowsIter{rows, typemap, location})
+}
 
-	return err
+type timeZoneRowsIter struct {
+	rows     *skydb.Rows
+	typemap  skydb.RecordSchema
+	location *time.Location
 }
 
-func (db *database) applyQueryPredicate(q sq.SelectBuilder, factory builder.PredicateSqlizerFactory, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (sq.SelectBuilder, error) {
-	if p := query.Predicate; !p.IsEmpty() {
-		sqlizer, err := factory.NewPredicateSqlizer(p)
-		if err != nil {
-			return q, err
+func (rowsi timeZoneRowsIter) Close() error {
+	return rowsi.rows.Close()
+}
+
+func (rowsi timeZoneRowsIter) Next(record *skydb.Record) error {
+	if !rowsi.rows.Scan() {
+		if err := rowsi.rows.Err(); err != nil {
+			return err
 		}
-		q = q.Where(sqlizer)
-		q = factory.AddJoinsToSelectBuilder(q)
+		return io.EOF
 	}
 
-	if db.DatabaseType() == skydb.PublicDatabase && !accessControlOptions.BypassAccessControl {
-		aclSqlizer, err := factory.NewAccessControlSqlizer(accessControlOptions.ViewAsUser, skydb.ReadLevel)
-		if err != nil {
-			return q, err
+	*record = rowsi.rows.Record()
+	for key, fieldType := range rowsi.typemap {
+		if fieldType.Type != skydb.TypeDateTimeTZ {
+			continue
+		}
+		if t, ok := record.Data[key].(time.Time); ok {
+			record.Data[key] = t.In(rowsi.location)
 		}
-		q = q.Where(aclSqlizer)
 	}
+	return nil
+}
 
-	return q, nil
+func (rowsi timeZoneRowsIter) OverallRecordCount() *uint64 {
+	return rowsi.rows.OverallRecordCount()
 }
 
-func (db *database) Query(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
-	if query.Type == "" {
-		return nil, errors.New("got empty query type")
+func (db *database) QueryCount(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (uint64, error) {
+	if err := query.Validate(); err != nil {
+		return 0, err
 	}
 
 	typemap, err := db.RemoteColumnTypes(query.Type)
+	if err != nil || len(typemap) == 0 { // error or record type has not been created
+		return 0, err
+	}
+
+	typemap = skydb.RecordSchema{
+		"_record_count": skydb.FieldType{
+			Type: skydb.TypeNumber,
+			Expression: skydb.Expression{
+				Type: skydb.Function,
+				Value: skydb.CountFunc{
+					OverallRecords: false,
+				},
+			},
+		},
+	}
+
+	q := db.selectQuery(psql.Select(), query.Type, typemap)
+	factory := builder.NewPredicateSqlizerFactory(db, query.Type)
+	q, err = db.applyQueryPredicate(q, factory, query, accessControlOptions)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := db.c.QueryWith(q)
+	if isInvalidRegularExpression(err) {
+		return 0, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			"invalid regular expression: %s", err.(*pq.Error).Message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		panic("Unexpected zero rows returned for aggregate count function.")
+	}
+
+	var recordCount uint64
+	err = rows.Scan(&recordCount)
 	if err != nil {
+		return 0, err
+	}
+
+	return recordCount, nil
+}
+
+func (db *database) QueryIDs(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) ([]skydb.RecordID, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
 
-	if len(typemap) == 0 { // record type has not been created
-		return skydb.EmptyRows, nil
+	typemap, err := db.RemoteColumnTypes(query.Type)
+	if err != nil || len(typemap) == 0 { // error or record type has not been created
+		return nil, err
 	}
 
-	q := psql.Select()
+	q := psql.Select(fmt.Sprintf(`%s."_id"`, pq.QuoteIdentifier(query.Type)))
+	q = db.selectQuery(q, query.Type, skydb.RecordSchema{})
 	factory := builder.NewPredicateSqlizerFactory(db, query.Type)
 	q, err = db.applyQueryPredicate(q, factory, query, accessControlOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, sort := range query.Sorts {
+	if err := checkSortKeyPaths(typemap, query.Sorts); err != nil {
+		return nil, err
+	}
+	for _, sort := range caseInsensitiveStringSorts(typemap, querySorts(query)) {
 		orderBy, err := builder.SortOrderBySQL(query.Type, sort)
 		if err != nil {
 			return nil, err
@@ -323,74 +1146,318 @@ func (db *database) Query(query *skydb.Query, accessControlOptions *skydb.Access
 		q = q.OrderBy(orderBy)
 	}
 
-	if query.Limit != nil {
-		q = q.Limit(*query.Limit)
+	limit := query.Limit
+	if limit == nil && db.c.defaultQueryLimit > 0 {
+		defaultLimit := db.c.defaultQueryLimit
+		limit = &defaultLimit
+	}
+
+	if limit != nil {
+		q = q.Limit(*limit)
 	}
 
 	if query.Offset > 0 {
 		q = q.Offset(query.Offset)
 	}
 
-	// Select columns to return, this is the last step so that predicate
-	// have a chance to change typemap, and the generated sql
-	// depends on the alias name used in table joins.
-	typemap, err = updateTypemapForQuery(query, typemap)
+	rows, err := db.c.QueryWith(q)
 	if err != nil {
 		return nil, err
 	}
-	typemap = factory.UpdateTypemap(typemap)
-	q = db.selectQuery(q, query.Type, typemap)
+	defer rows.Close()
 
-	rows, err := db.c.QueryWith(q)
-	return newRows(query.Type, typemap, rows, err)
+	ids := []skydb.RecordID{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		ids = append(ids, skydb.NewRecordID(query.Type, key))
+	}
+	return ids, rows.Err()
 }
 
-func (db *database) QueryCount(query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (uint64, error) {
-	if query.Type == "" {
-		return 0, errors.New("got empty query type")
+func (db *database) QueryTypes(pattern string, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	if pattern == "" {
+		return nil, skyerr.NewError(skyerr.InvalidArgument, "record type pattern is empty")
 	}
 
-	typemap, err := db.RemoteColumnTypes(query.Type)
-	if err != nil || len(typemap) == 0 { // error or record type has not been created
-		return 0, err
+	recordTypes, err := db.recordTypes()
+	if err != nil {
+		return nil, err
 	}
+	sort.Strings(recordTypes)
 
-	typemap = skydb.RecordSchema{
-		"_record_count": skydb.FieldType{
-			Type: skydb.TypeNumber,
-			Expression: skydb.Expression{
+	queries := []*skydb.Query{}
+	for _, recordType := range recordTypes {
+		if !strings.HasPrefix(recordType, pattern) {
+			continue
+		}
+		typeQuery := *query
+		typeQuery.Type = recordType
+		queries = append(queries, &typeQuery)
+	}
+
+	return db.QueryUnion(queries, accessControlOptions)
+}
+
+func (db *database) QueryByUpdater(recordType string, updaterID string, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	query := skydb.Query{
+		Type: recordType,
+		Predicate: skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "_updated_by",
+				},
+				skydb.Expression{
+					Type:  skydb.Literal,
+					Value: skydb.NewReference("_auth", updaterID),
+				},
+			},
+		},
+		Sorts: []skydb.Sort{
+			skydb.Sort{
+				Expression: skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "_updated_at",
+				},
+				Order: skydb.Descending,
+			},
+		},
+	}
+	return db.Query(&query, accessControlOptions)
+}
+
+func (db *database) QueryAfterCursor(recordType string, updatedAt time.Time, id string, limit int, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	keyPath := func(key string) skydb.Expression {
+		return skydb.Expression{Type: skydb.KeyPath, Value: key}
+	}
+	literal := func(value interface{}) skydb.Expression {
+		return skydb.Expression{Type: skydb.Literal, Value: value}
+	}
+
+	query := skydb.Query{
+		Type: recordType,
+		Sorts: []skydb.Sort{
+			{Expression: keyPath("_updated_at"), Order: skydb.Ascending},
+			{Expression: keyPath("_id"), Order: skydb.Ascending},
+		},
+	}
+	if !updatedAt.IsZero() || id != "" {
+		query.Predicate = skydb.Predicate{
+			Operator: skydb.Or,
+			Children: []interface{}{
+				skydb.Predicate{
+					Operator: skydb.GreaterThan,
+					Children: []interface{}{keyPath("_updated_at"), literal(updatedAt)},
+				},
+				skydb.Predicate{
+					Operator: skydb.And,
+					Children: []interface{}{
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{keyPath("_updated_at"), literal(updatedAt)},
+						},
+						skydb.Predicate{
+							Operator: skydb.GreaterThan,
+							Children: []interface{}{keyPath("_id"), literal(id)},
+						},
+					},
+				},
+			},
+		}
+	}
+	if limit > 0 {
+		queryLimit := uint64(limit)
+		query.Limit = &queryLimit
+	}
+
+	return db.Query(&query, accessControlOptions)
+}
+
+func (db *database) QueryByRelation(recordType string, relationName string, direction string, userID string, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	relationQuery := skydb.Query{}
+	if query != nil {
+		relationQuery = *query
+	}
+	relationQuery.Type = recordType
+
+	related := skydb.Predicate{
+		Operator: skydb.Functional,
+		Children: []interface{}{
+			skydb.Expression{
 				Type: skydb.Function,
-				Value: skydb.CountFunc{
-					OverallRecords: false,
+				Value: skydb.UserRelationFunc{
+					KeyPath:           "_owner",
+					RelationName:      relationName,
+					RelationDirection: direction,
+					User:              userID,
 				},
 			},
 		},
 	}
+	if relationQuery.Predicate.IsEmpty() {
+		relationQuery.Predicate = related
+	} else {
+		relationQuery.Predicate = skydb.Predicate{
+			Operator: skydb.And,
+			Children: []interface{}{relationQuery.Predicate, related},
+		}
+	}
 
-	q := db.selectQuery(psql.Select(), query.Type, typemap)
-	factory := builder.NewPredicateSqlizerFactory(db, query.Type)
-	q, err = db.applyQueryPredicate(q, factory, query, accessControlOptions)
+	return db.Query(&relationQuery, accessControlOptions)
+}
+
+func (db *database) CountByReference(recordType string, refField string) (map[string]int64, error) {
+	typemap, err := db.RemoteColumnTypes(recordType)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if len(typemap) == 0 { // record type has not been created
+		return map[string]int64{}, nil
 	}
 
+	fieldType, ok := typemap[refField]
+	if !ok {
+		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`keypath "%s" does not exist`, refField)
+	}
+	if fieldType.Type != skydb.TypeReference {
+		return nil, skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`cannot count by non-reference field "%s"`, refField)
+	}
+
+	column := pq.QuoteIdentifier(recordType) + "." + pq.QuoteIdentifier(refField)
+	q := db.selectQuery(psql.Select(column, "count(*)"), recordType, skydb.RecordSchema{}).
+		Where(column + " IS NOT NULL").
+		GroupBy(column)
+
 	rows, err := db.c.QueryWith(q)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	if !rows.Next() {
-		panic("Unexpected zero rows returned for aggregate count function.")
+	counts := map[string]int64{}
+	for rows.Next() {
+		var (
+			key   string
+			count int64
+		)
+		if err := rows.Scan(&key, &count); err != nil {
+			return nil, err
+		}
+		counts[key] = count
+	}
+	return counts, rows.Err()
+}
+
+// defaultSorts is the order of queried records when the query does not
+// specify one, so that the order does not depend on how rows are stored.
+var defaultSorts = []skydb.Sort{
+	skydb.Sort{
+		Expression: skydb.Expression{
+			Type:  skydb.KeyPath,
+			Value: "_id",
+		},
+		Order: skydb.Ascending,
+	},
+}
+
+// checkSortKeyPaths returns an error if a sort has a key path
+// continuing into a field that is not a JSON field, or a key path of
+// an encrypted field.
+func checkSortKeyPaths(typemap skydb.RecordSchema, sorts []skydb.Sort) error {
+	for _, sort := range sorts {
+		if !sort.Expression.IsKeyPath() {
+			continue
+		}
+		components := sort.Expression.KeyPathComponents()
+		if typemap[components[0]].Encrypted {
+			return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`cannot sort by keypath "%s" because it is an encrypted field`,
+				sort.Expression.Value)
+		}
+		if len(components) < 2 {
+			continue
+		}
+		if typemap[components[0]].Type != skydb.TypeJSON {
+			return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`cannot sort by keypath "%s" because "%s" is not a json field`,
+				sort.Expression.Value, components[0])
+		}
 	}
+	return nil
+}
 
-	var recordCount uint64
-	err = rows.Scan(&recordCount)
-	if err != nil {
-		return 0, err
+// caseInsensitiveStringSorts returns the sorts with CaseInsensitive
+// unset on fields that are not strings, such as the metadata
+// _created_at, which cannot be converted to lower case.
+func caseInsensitiveStringSorts(typemap skydb.RecordSchema, sorts []skydb.Sort) []skydb.Sort {
+	result := make([]skydb.Sort, len(sorts))
+	for i, sort := range sorts {
+		if sort.CaseInsensitive && sort.Expression.IsKeyPath() {
+			field := sort.Expression.Value.(string)
+			sort.CaseInsensitive = typemap[field].Type == skydb.TypeString
+		}
+		result[i] = sort
 	}
+	return result
+}
 
-	return recordCount, nil
+// isTextSort returns whether the sort is by a column stored as text,
+// such as a string or a reference.
+func isTextSort(typemap skydb.RecordSchema, sort skydb.Sort) bool {
+	if !sort.Expression.IsKeyPath() || len(sort.Expression.KeyPathComponents()) > 1 {
+		return false
+	}
+	switch typemap[sort.Expression.Value.(string)].Type {
+	case skydb.TypeString, skydb.TypeReference, skydb.TypeEnum:
+		return true
+	default:
+		return false
+	}
+}
+
+func querySorts(query *skydb.Query) []skydb.Sort {
+	if len(query.Sorts) == 0 {
+		return defaultSorts
+	}
+	return query.Sorts
+}
+
+// bufferedRowsIter is a RowsIter of records read into memory in advance.
+type bufferedRowsIter struct {
+	*skydb.MemoryRows
+	recordCount *uint64
+}
+
+func (rowsi bufferedRowsIter) OverallRecordCount() *uint64 {
+	return rowsi.recordCount
+}
+
+// readRows reads all records of rows and closes it. The error of a
+// record that cannot be scanned is returned, so that the records read
+// are not mistaken for all records of rows.
+func readRows(rows *skydb.Rows) ([]skydb.Record, *uint64, error) {
+	defer rows.Close()
+
+	records := []skydb.Record{}
+	for {
+		if rows.Scan() {
+			records = append(records, rows.Record())
+			continue
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+		break
+	}
+
+	return records, rows.OverallRecordCount(), nil
 }
 
 // columnsScanner wraps over sqlx.Rows and sqlx.Row to provide
@@ -407,11 +1474,36 @@ type recordScanner struct {
 	columns     []string
 	err         error
 	recordCount *uint64
+	fieldKeys   skydb.FieldKeyProvider
+	fieldKey    []byte // fetched from fieldKeys on first use
 }
 
-func newRecordScanner(recordType string, typemap skydb.RecordSchema, cs columnsScanner) *recordScanner {
+func newRecordScanner(recordType string, typemap skydb.RecordSchema, cs columnsScanner, fieldKeys skydb.FieldKeyProvider) *recordScanner {
 	columns, err := cs.Columns()
-	return &recordScanner{recordType, typemap, cs, columns, err, nil}
+	return &recordScanner{
+		recordType: recordType,
+		typemap:    typemap,
+		cs:         cs,
+		columns:    columns,
+		err:        err,
+		fieldKeys:  fieldKeys,
+	}
+}
+
+func (rs *recordScanner) decrypt(column string, ciphertext []byte) (string, error) {
+	if rs.fieldKey == nil {
+		key, err := fieldKey(rs.fieldKeys)
+		if err != nil {
+			return "", err
+		}
+		rs.fieldKey = key
+	}
+
+	value, err := decryptFieldValue(rs.fieldKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt field %s: %s", column, err)
+	}
+	return value, nil
 }
 
 // nolint: gocyclo
@@ -426,14 +1518,19 @@ func (rs *recordScanner) Scan(record *skydb.Record) error {
 		if !ok {
 			return fmt.Errorf("received unknown column = %s", column)
 		}
+		if schema.Encrypted {
+			var ciphertext []byte
+			values = append(values, &ciphertext)
+			continue
+		}
 		switch schema.Type {
 		case skydb.TypeNumber:
 			var number sql.NullFloat64
 			values = append(values, &number)
-		case skydb.TypeString, skydb.TypeReference, skydb.TypeACL:
+		case skydb.TypeString, skydb.TypeReference, skydb.TypeACL, skydb.TypeEnum:
 			var str sql.NullString
 			values = append(values, &str)
-		case skydb.TypeDateTime:
+		case skydb.TypeDateTime, skydb.TypeDateTimeTZ:
 			var ts pq.NullTime
 			values = append(values, &ts)
 		case skydb.TypeBoolean:
@@ -442,6 +1539,9 @@ func (rs *recordScanner) Scan(record *skydb.Record) error {
 		case skydb.TypeAsset:
 			var asset nullAsset
 			values = append(values, &asset)
+		case skydb.TypeAssetList:
+			var assets nullAssetList
+			values = append(values, &assets)
 		case skydb.TypeJSON:
 			var j nullJSON
 			values = append(values, &j)
@@ -465,6 +1565,9 @@ func (rs *recordScanner) Scan(record *skydb.Record) error {
 	}
 
 	if err := rs.cs.Scan(values...); err != nil {
+		if rowErr := rs.rowScanError(values, err); rowErr != nil {
+			return rowErr
+		}
 		rs.err = err
 		return err
 	}
@@ -524,6 +1627,10 @@ func (rs *recordScanner) Scan(record *skydb.Record) error {
 			if svalue.Valid {
 				record.Set(column, svalue.Asset)
 			}
+		case *nullAssetList:
+			if svalue.Valid {
+				record.Set(column, svalue.Assets)
+			}
 		case *nullJSON:
 			if svalue.Valid {
 				record.Set(column, svalue.JSON)
@@ -548,6 +1655,14 @@ func (rs *recordScanner) Scan(record *skydb.Record) error {
 			if svalue.Valid {
 				record.Set(column, svalue.Int64)
 			}
+		case *[]byte:
+			if *svalue != nil {
+				str, err := rs.decrypt(column, *svalue)
+				if err != nil {
+					return err
+				}
+				record.Set(column, str)
+			}
 		}
 
 	}
@@ -555,6 +1670,59 @@ func (rs *recordScanner) Scan(record *skydb.Record) error {
 	return nil
 }
 
+// rowScanError scans the current row again column by column to find
+// out the column that cannot be scanned into values, so that the error
+// can be reported along with the offending record.
+//
+// It returns nil if err does not concern a single row, or if the current
+// row cannot be scanned again, which is the case for sqlx.Row.
+func (rs *recordScanner) rowScanError(values []interface{}, err error) *skydb.RowScanError {
+	rows, ok := rs.cs.(*sqlx.Rows)
+	if !ok {
+		return nil
+	}
+
+	discarded := func() []interface{} {
+		dest := make([]interface{}, len(values))
+		for i := range dest {
+			dest[i] = new(interface{})
+		}
+		return dest
+	}
+
+	if rows.Scan(discarded()...) != nil {
+		return nil
+	}
+
+	rowErr := &skydb.RowScanError{
+		RecordID: skydb.NewRecordID(rs.recordType, ""),
+		Err:      err,
+	}
+	for i, column := range rs.columns {
+		if column != "_id" {
+			continue
+		}
+		var id sql.NullString
+		dest := discarded()
+		dest[i] = &id
+		if rows.Scan(dest...) == nil {
+			rowErr.RecordID.Key = id.String
+		}
+	}
+
+	for i, column := range rs.columns {
+		dest := discarded()
+		dest[i] = values[i]
+		if columnErr := rows.Scan(dest...); columnErr != nil {
+			rowErr.Column = column
+			rowErr.Err = columnErr
+			break
+		}
+	}
+
+	return rowErr
+}
+
 type rowsIter struct {
 	rows *sqlx.Rows
 	rs   *recordScanner
@@ -578,11 +1746,11 @@ func (rowsi rowsIter) OverallRecordCount() *uint64 {
 	return rowsi.rs.recordCount
 }
 
-func newRows(recordType string, typemap skydb.RecordSchema, rows *sqlx.Rows, err error) (*skydb.Rows, error) {
+func newRows(recordType string, typemap skydb.RecordSchema, rows *sqlx.Rows, err error, fieldKeys skydb.FieldKeyProvider) (*skydb.Rows, error) {
 	if err != nil {
 		return nil, err
 	}
-	rs := newRecordScanner(recordType, typemap, rows)
+	rs := newRecordScanner(recordType, typemap, rows, fieldKeys)
 	return skydb.NewRows(rowsIter{rows, rs}), nil
 }
 
@@ -607,13 +1775,13 @@ func columnSqlizersForSelect(recordType string, typemap skydb.RecordSchema) map[
 }
 
 func (db *database) selectQuery(q sq.SelectBuilder, recordType string, typemap skydb.RecordSchema) sq.SelectBuilder {
-	for column, e := range columnSqlizersForSelect(recordType, typemap) {
-		sqlOperand, opArgs, _ := e.ToSql()
-		q = q.Column(sqlOperand+" as "+pq.QuoteIdentifier(column), opArgs...)
-	}
-
-	q = q.From(db.TableName(recordType))
+	q = db.selectColumns(q, recordType, typemap).From(db.TableName(recordType))
+	return db.whereDatabase(q, recordType)
+}
 
+// whereDatabase filters q for records of the record type in this
+// database.
+func (db *database) whereDatabase(q sq.SelectBuilder, recordType string) sq.SelectBuilder {
 	switch db.DatabaseType() {
 	case skydb.UnionDatabase:
 		// no filter on `_database_id` column
@@ -625,13 +1793,31 @@ func (db *database) selectQuery(q sq.SelectBuilder, recordType string, typemap s
 	return q
 }
 
+// selectColumns adds the columns of the record type to q, to be read by
+// a recordScanner.
+func (db *database) selectColumns(q sq.SelectBuilder, recordType string, typemap skydb.RecordSchema) sq.SelectBuilder {
+	for column, e := range columnSqlizersForSelect(recordType, typemap) {
+		sqlOperand, opArgs, _ := e.ToSql()
+		q = q.Column(sqlOperand+" as "+pq.QuoteIdentifier(column), opArgs...)
+	}
+	return q
+}
+
 func updateTypemapForQuery(query *skydb.Query, typemap skydb.RecordSchema) (skydb.RecordSchema, error) {
+	schema := typemap
 	if query.DesiredKeys != nil {
 		newtypemap, err := whitelistedRecordSchema(typemap, query.DesiredKeys)
 		if err != nil {
 			return nil, err
 		}
 		typemap = newtypemap
+	} else {
+		// The schema is shared with the connection's schema cache, so
+		// columns specific to this query must not be added to it.
+		typemap = skydb.RecordSchema{}
+		for key, value := range schema {
+			typemap[key] = value
+		}
 	}
 
 	for key, value := range query.ComputedKeys {
@@ -640,9 +1826,16 @@ func updateTypemapForQuery(query *skydb.Query, typemap skydb.RecordSchema) (skyd
 			continue
 		}
 
-		v := value // because value will be overwritten in the next loop
+		v, err := builder.ResolveFuncExpression(value, schema)
+		if err != nil {
+			return nil, err
+		}
+		dataType := skydb.TypeNumber
+		if fn, ok := v.Value.(skydb.Func); ok {
+			dataType = fn.DataType()
+		}
 		typemap["_transient_"+key] = skydb.FieldType{
-			Type:       skydb.TypeNumber,
+			Type:       dataType,
 			Expression: v,
 		}
 	}
@@ -15,9 +15,11 @@
 package pq
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -25,6 +27,7 @@ import (
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/skygeario/skygear-server/pkg/server/skytest"
 )
 
@@ -68,6 +71,45 @@ func TestGet(t *testing.T) {
 			So(record.Data["datetime"].(time.Time), ShouldResemble, time.Date(1988, 2, 6, 0, 0, 0, 0, time.UTC))
 		})
 
+		Convey("gets an existing record not modified", func() {
+			record := skydb.Record{}
+			err := db.Get(skydb.NewRecordID("record", "id1"), &record)
+			So(err, ShouldBeNil)
+			So(record.WasModified(), ShouldBeFalse)
+		})
+
+		Convey("gets created and updated time of a modified record", func() {
+			createdAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+			updatedAt := createdAt.Add(time.Hour)
+			record := skydb.Record{
+				ID:        skydb.NewRecordID("record", "id2"),
+				OwnerID:   "getuser",
+				CreatedAt: createdAt,
+				CreatorID: "getuser",
+				UpdatedAt: createdAt,
+				UpdaterID: "getuser",
+				Data: map[string]interface{}{
+					"string": "string",
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.WasModified(), ShouldBeFalse)
+
+			record.CreatedAt = updatedAt
+			record.UpdatedAt = updatedAt
+			record.Set("string", "modified")
+			So(db.Save(&record), ShouldBeNil)
+
+			fetched = skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.CreatedAt, ShouldResemble, createdAt)
+			So(fetched.UpdatedAt, ShouldResemble, updatedAt)
+			So(fetched.WasModified(), ShouldBeTrue)
+		})
+
 		Convey("errors if gets a non-existing record", func() {
 			record := skydb.Record{}
 			err := db.Get(skydb.NewRecordID("record", "notexistid"), &record)
@@ -186,6 +228,24 @@ func TestGetByIDs(t *testing.T) {
 			So(noMore, ShouldEqual, false)
 		})
 
+		Convey("get records with many record IDs", func() {
+			ids := make([]skydb.RecordID, 70000)
+			for i := range ids {
+				ids[i] = skydb.NewRecordID("record", fmt.Sprintf("id%d", i+2))
+			}
+			ids[69999] = skydb.NewRecordID("record", "id1")
+
+			scanner, err := db.GetByIDs(ids, &skydb.AccessControlOptions{})
+			So(err, ShouldBeNil)
+
+			scanner.Scan()
+			record := scanner.Record()
+			So(record.ID, ShouldResemble, skydb.NewRecordID("record", "id1"))
+
+			noMore := scanner.Scan()
+			So(noMore, ShouldEqual, false)
+		})
+
 	})
 }
 
@@ -239,6 +299,74 @@ func TestSave(t *testing.T) {
 			So(ownerID, ShouldEqual, "user_id")
 		})
 
+		Convey("creates record with generated id if key is empty", func() {
+			record.ID.Key = ""
+			err := db.SaveNew(&record)
+			So(err, ShouldBeNil)
+			So(record.ID.Type, ShouldEqual, "note")
+			So(record.ID.Key, ShouldNotBeEmpty)
+
+			var content string
+			err = c.QueryRowx("SELECT content FROM note WHERE _id = $1 and _database_id = ''", record.ID.Key).
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "some content")
+		})
+
+		Convey("creates record with the supplied id", func() {
+			err := db.SaveNew(&record)
+			So(err, ShouldBeNil)
+			So(record.ID.Key, ShouldEqual, "someid")
+		})
+
+		Convey("creates record without ACL with default access of type", func() {
+			err := c.SetRecordDefaultAccess("note", skydb.RecordACL{
+				skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
+			})
+			So(err, ShouldBeNil)
+
+			err = db.Save(&record)
+			So(err, ShouldBeNil)
+			So(record.ACL, ShouldResemble, skydb.RecordACL{
+				skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
+			})
+
+			query := skydb.Query{Type: "note"}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{
+				ViewAsUser: nil,
+			}))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID, ShouldResemble, skydb.NewRecordID("note", "someid"))
+
+			Convey("keeps access of existing record saved without ACL", func() {
+				record.ACL = skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("user_id", skydb.WriteLevel),
+				}
+				So(db.Save(&record), ShouldBeNil)
+
+				record.ACL = nil
+				So(db.Save(&record), ShouldBeNil)
+				So(record.ACL, ShouldResemble, skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("user_id", skydb.WriteLevel),
+				})
+			})
+
+			Convey("creates record with explicit ACL", func() {
+				otherRecord := skydb.Record{
+					ID:      skydb.NewRecordID("note", "otherid"),
+					OwnerID: "user_id",
+					ACL: skydb.RecordACL{
+						skydb.NewRecordACLEntryDirect("user_id", skydb.WriteLevel),
+					},
+				}
+				So(db.Save(&otherRecord), ShouldBeNil)
+				So(otherRecord.ACL, ShouldResemble, skydb.RecordACL{
+					skydb.NewRecordACLEntryDirect("user_id", skydb.WriteLevel),
+				})
+			})
+		})
+
 		Convey("updates record if it already exists", func() {
 			err := db.Save(&record)
 			So(err, ShouldBeNil)
@@ -364,6 +492,344 @@ func TestSave(t *testing.T) {
 			err = db.Save(&record)
 			So(err, ShouldNotBeNil)
 		})
+
+		Convey("saves record if it is unmodified", func() {
+			So(db.Save(&record), ShouldBeNil)
+			lastUpdatedAt := record.UpdatedAt
+
+			record.Set("content", "more content")
+			record.UpdatedAt = time.Date(2006, 1, 2, 15, 4, 6, 0, time.UTC)
+			err := db.SaveIfUnmodified(&record, lastUpdatedAt)
+			So(err, ShouldBeNil)
+
+			var content string
+			err = c.QueryRowx("SELECT content FROM note WHERE _id = 'someid' and _database_id = ''").
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "more content")
+		})
+
+		Convey("returns ErrRecordStale if record is modified", func() {
+			So(db.Save(&record), ShouldBeNil)
+			staleUpdatedAt := time.Date(2006, 1, 2, 15, 4, 4, 0, time.UTC)
+
+			record.Set("content", "more content")
+			err := db.SaveIfUnmodified(&record, staleUpdatedAt)
+			So(err, ShouldEqual, skydb.ErrRecordStale)
+
+			var content string
+			err = c.QueryRowx("SELECT content FROM note WHERE _id = 'someid' and _database_id = ''").
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "some content")
+		})
+
+		Convey("saves new record if it is expected to be new", func() {
+			err := db.SaveIfUnmodified(&record, time.Time{})
+			So(err, ShouldBeNil)
+
+			err = db.SaveIfUnmodified(&record, time.Time{})
+			So(err, ShouldEqual, skydb.ErrRecordStale)
+		})
+
+		Convey("returns ErrRecordNotFound if record to be updated does not exist", func() {
+			err := db.SaveIfUnmodified(&record, record.UpdatedAt)
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("checks record is unmodified in existing transaction", func() {
+			So(db.Save(&record), ShouldBeNil)
+			So(c.Begin(), ShouldBeNil)
+			defer c.Rollback()
+
+			err := db.SaveIfUnmodified(&record, record.UpdatedAt)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("patches only the supplied fields", func() {
+			So(db.Save(&record), ShouldBeNil)
+
+			now := time.Date(2006, 1, 2, 15, 4, 6, 0, time.UTC)
+			originalTimeNow := timeNow
+			timeNow = func() time.Time { return now }
+			defer func() {
+				timeNow = originalTimeNow
+			}()
+
+			err := db.Patch(record.ID, "patcher", map[string]interface{}{
+				"number": float64(2),
+			})
+			So(err, ShouldBeNil)
+
+			var (
+				content   string
+				number    float64
+				timestamp time.Time
+				ownerID   string
+				updatedAt time.Time
+				updatedBy string
+			)
+			err = c.QueryRowx(
+				"SELECT content, number, timestamp, _owner_id, _updated_at, _updated_by "+
+					"FROM note WHERE _id = 'someid' and _database_id = ''").
+				Scan(&content, &number, &timestamp, &ownerID, &updatedAt, &updatedBy)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "some content")
+			So(number, ShouldEqual, float64(2))
+			So(timestamp.In(time.UTC), ShouldResemble, time.Date(1988, 2, 6, 1, 1, 1, 0, time.UTC))
+			So(ownerID, ShouldEqual, "user_id")
+			So(updatedAt.In(time.UTC), ShouldResemble, now)
+			So(updatedBy, ShouldEqual, "patcher")
+		})
+
+		Convey("patches field to null", func() {
+			So(db.Save(&record), ShouldBeNil)
+
+			err := db.Patch(record.ID, "user_id", map[string]interface{}{
+				"content": skydb.Null,
+			})
+			So(err, ShouldBeNil)
+
+			var (
+				content sql.NullString
+				number  float64
+			)
+			err = c.QueryRowx("SELECT content, number FROM note WHERE _id = 'someid' and _database_id = ''").
+				Scan(&content, &number)
+			So(err, ShouldBeNil)
+			So(content.Valid, ShouldBeFalse)
+			So(number, ShouldEqual, float64(1))
+		})
+
+		Convey("returns ErrRecordNotFound when patching non-existent record", func() {
+			err := db.Patch(record.ID, "user_id", map[string]interface{}{
+				"number": float64(2),
+			})
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("returns error when patching reserved or unknown field", func() {
+			So(db.Save(&record), ShouldBeNil)
+
+			for _, key := range []string{"_owner_id", "notexist"} {
+				err := db.Patch(record.ID, "user_id", map[string]interface{}{
+					key: "value",
+				})
+				So(err, ShouldNotBeNil)
+				So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+			}
+		})
+	})
+}
+
+func TestSaveMaxRecordSize(t *testing.T) {
+	Convey("Database with maximum record size", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		c.maxRecordSize = 1024
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"title":    skydb.FieldType{Type: skydb.TypeString},
+			"metadata": skydb.FieldType{Type: skydb.TypeJSON},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("saves record within the limit", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "small"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"title":    "Short Note",
+					"metadata": map[string]interface{}{"tags": []interface{}{"a", "b"}},
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.Data["title"], ShouldEqual, "Short Note")
+		})
+
+		Convey("rejects record with oversized JSON field", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "large"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"title": "Large Note",
+					"metadata": map[string]interface{}{
+						"blob": strings.Repeat("x", 2048),
+					},
+				},
+			}
+			err := db.Save(&record)
+			So(err, ShouldHaveSameTypeAs, skydb.ErrRecordTooLarge{})
+			tooLarge := err.(skydb.ErrRecordTooLarge)
+			So(tooLarge.RecordID, ShouldResemble, record.ID)
+			So(tooLarge.Size, ShouldBeGreaterThan, 2048)
+			So(tooLarge.MaxSize, ShouldEqual, 1024)
+			So(tooLarge.Code(), ShouldEqual, skyerr.InvalidArgument)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("rejects patch making record oversized", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "patched"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"title": strings.Repeat("x", 600),
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			err := db.Patch(record.ID, "user_id", map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"blob": strings.Repeat("x", 600),
+				},
+			})
+			So(err, ShouldHaveSameTypeAs, skydb.ErrRecordTooLarge{})
+			So(err.(skydb.ErrRecordTooLarge).Size, ShouldBeGreaterThan, 1200)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.Data["metadata"], ShouldBeNil)
+		})
+
+		Convey("patches field replacing a larger value within the limit", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "patched"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"title": strings.Repeat("x", 1000),
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			So(db.Patch(record.ID, "user_id", map[string]interface{}{
+				"title": strings.Repeat("y", 1000),
+			}), ShouldBeNil)
+		})
+	})
+}
+
+func TestEncryptedField(t *testing.T) {
+	Convey("Database with encrypted field", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		c.fieldKeyProvider = skydb.StaticFieldKey("0123456789abcdef0123456789abcdef")
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"title":  skydb.FieldType{Type: skydb.TypeString},
+			"secret": skydb.FieldType{Type: skydb.TypeString, Encrypted: true},
+		})
+		So(err, ShouldBeNil)
+
+		record := skydb.Record{
+			ID:      skydb.NewRecordID("note", "note1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"title":  "Note",
+				"secret": "top secret",
+			},
+		}
+		So(db.Save(&record), ShouldBeNil)
+		So(record.Data["secret"], ShouldEqual, "top secret")
+
+		Convey("reads the field type back", func() {
+			schema, err := db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(schema["secret"], ShouldResemble, skydb.FieldType{
+				Type:           skydb.TypeString,
+				Encrypted:      true,
+				UnderlyingType: TypeBytea,
+			})
+		})
+
+		Convey("stores ciphertext in the column", func() {
+			var raw []byte
+			err := c.QueryRowx(`SELECT "secret" FROM "note" WHERE "_id" = 'note1'`).Scan(&raw)
+			So(err, ShouldBeNil)
+			So(raw, ShouldNotBeEmpty)
+			So(bytes.Contains(raw, []byte("top secret")), ShouldBeFalse)
+		})
+
+		Convey("decrypts the field on get and query", func() {
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.Data["secret"], ShouldEqual, "top secret")
+
+			records, err := exhaustRows(db.Query(&skydb.Query{Type: "note"}, &skydb.AccessControlOptions{
+				BypassAccessControl: true,
+			}))
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].Data["secret"], ShouldEqual, "top secret")
+		})
+
+		Convey("rejects query by the field", func() {
+			_, err := db.Query(&skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{Type: skydb.KeyPath, Value: "secret"},
+						skydb.Expression{Type: skydb.Literal, Value: "top secret"},
+					},
+				},
+			}, &skydb.AccessControlOptions{BypassAccessControl: true})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("rejects sort by the field", func() {
+			_, err := db.Query(&skydb.Query{
+				Type: "note",
+				Sorts: []skydb.Sort{{
+					Expression: skydb.Expression{Type: skydb.KeyPath, Value: "secret"},
+					Order:      skydb.Ascending,
+				}},
+			}, &skydb.AccessControlOptions{BypassAccessControl: true})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("encrypts the field on patch", func() {
+			So(db.Patch(record.ID, "user_id", map[string]interface{}{
+				"secret": "new secret",
+			}), ShouldBeNil)
+
+			var raw []byte
+			err := c.QueryRowx(`SELECT "secret" FROM "note" WHERE "_id" = 'note1'`).Scan(&raw)
+			So(err, ShouldBeNil)
+			So(bytes.Contains(raw, []byte("new secret")), ShouldBeFalse)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.Data["secret"], ShouldEqual, "new secret")
+		})
+
+		Convey("does not decrypt bytea column created by developer", func() {
+			_, err := c.Exec(`ALTER TABLE "note" ADD "blob" bytea`)
+			So(err, ShouldBeNil)
+			delete(c.RecordSchema, "note")
+
+			schema, err := db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(schema["blob"].Type, ShouldEqual, skydb.TypeUnknown)
+			So(schema["blob"].Encrypted, ShouldBeFalse)
+		})
+
+		Convey("cannot read the field without the key", func() {
+			c.fieldKeyProvider = nil
+
+			fetched := skydb.Record{}
+			err := db.Get(record.ID, &fetched)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.NotConfigured)
+		})
 	})
 }
 
@@ -414,23 +880,110 @@ func TestDelete(t *testing.T) {
 	})
 }
 
-func TestQuery(t *testing.T) {
+func TestClone(t *testing.T) {
 	Convey("Database", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
-		// fixture
-		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id1"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(1),
-				"content":   "Hello World",
-				"emotion":   nil,
-			},
-		}
-		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id2"),
+		now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+		originalTimeNow := timeNow
+		timeNow = func() time.Time { return now }
+		defer func() {
+			timeNow = originalTimeNow
+		}()
+
+		db := c.PublicDB()
+		_, err := db.Extend("category", skydb.RecordSchema{})
+		So(err, ShouldBeNil)
+		_, err = db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+			"category": skydb.FieldType{
+				Type:          skydb.TypeReference,
+				ReferenceType: "category",
+			},
+		})
+		So(err, ShouldBeNil)
+
+		category := skydb.Record{
+			ID:      skydb.NewRecordID("category", "important"),
+			OwnerID: "alice",
+		}
+		So(db.Save(&category), ShouldBeNil)
+		note := skydb.Record{
+			ID:        skydb.NewRecordID("note", "source"),
+			OwnerID:   "alice",
+			CreatorID: "alice",
+			UpdaterID: "alice",
+			CreatedAt: time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+			UpdatedAt: time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC),
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("alice", skydb.WriteLevel),
+			},
+			Data: skydb.Data{
+				"content":  "some content",
+				"category": skydb.NewReference("category", "important"),
+			},
+		}
+		So(db.Save(&note), ShouldBeNil)
+
+		Convey("clones data of record to new ID and owner", func() {
+			clone, err := db.Clone(note.ID, "copy", "bob")
+			So(err, ShouldBeNil)
+			So(clone.ID, ShouldResemble, skydb.NewRecordID("note", "copy"))
+			So(clone.OwnerID, ShouldEqual, "bob")
+
+			source := skydb.Record{}
+			So(db.Get(note.ID, &source), ShouldBeNil)
+			cloned := skydb.Record{}
+			So(db.Get(clone.ID, &cloned), ShouldBeNil)
+
+			So(cloned.Data, ShouldResemble, source.Data)
+			So(cloned.ID, ShouldNotResemble, source.ID)
+			So(cloned.OwnerID, ShouldEqual, "bob")
+			So(cloned.CreatorID, ShouldEqual, "bob")
+			So(cloned.UpdaterID, ShouldEqual, "bob")
+			So(cloned.CreatedAt, ShouldResemble, now)
+			So(cloned.UpdatedAt, ShouldResemble, now)
+			So(cloned.ACL, ShouldBeNil)
+			So(source.OwnerID, ShouldEqual, "alice")
+		})
+
+		Convey("generates key if new key is empty", func() {
+			clone, err := db.Clone(note.ID, "", "bob")
+			So(err, ShouldBeNil)
+			So(clone.ID.Key, ShouldNotBeEmpty)
+			So(clone.ID.Key, ShouldNotEqual, note.ID.Key)
+		})
+
+		Convey("returns ErrRecordNotFound if source does not exist", func() {
+			_, err := db.Clone(skydb.NewRecordID("note", "notexistid"), "copy", "bob")
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("returns ErrRecordStale if record of new key exists", func() {
+			_, err := db.Clone(note.ID, "source", "bob")
+			So(err, ShouldEqual, skydb.ErrRecordStale)
+		})
+	})
+}
+
+func TestQuery(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		// fixture
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"noteOrder": float64(1),
+				"content":   "Hello World",
+				"emotion":   nil,
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id2"),
 			OwnerID: "user_id",
 			Data: map[string]interface{}{
 				"noteOrder": float64(2),
@@ -463,7 +1016,22 @@ func TestQuery(t *testing.T) {
 		err = db.Save(&record3)
 		So(err, ShouldBeNil)
 
-		Convey("queries records", func() {
+		Convey("queries records sorted by id by default", func() {
+			query := skydb.Query{
+				Type: "note",
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1, record2, record3})
+		})
+
+		Convey("queries records sorted by id regardless of row placement", func() {
+			// updating a row moves it to the end of the table
+			record1.Data["content"] = "Hello World!"
+			So(db.Save(&record1), ShouldBeNil)
+
 			query := skydb.Query{
 				Type: "note",
 			}
@@ -471,10 +1039,10 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records[0], ShouldResemble, record2)
-			So(records[1], ShouldResemble, record1)
-			So(records[2], ShouldResemble, record3)
 			So(len(records), ShouldEqual, 3)
+			So(records[0].ID, ShouldResemble, record1.ID)
+			So(records[1].ID, ShouldResemble, record2.ID)
+			So(records[2].ID, ShouldResemble, record3.ID)
 		})
 
 		Convey("sorts queried records ascendingly", func() {
@@ -550,19 +1118,23 @@ func TestQuery(t *testing.T) {
 			So(len(records), ShouldEqual, 1)
 		})
 
-		Convey("query records by content matching", func() {
+		Convey("query records by note order range", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.Like,
+					Operator: skydb.Between,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "content",
+							Value: "noteOrder",
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: "Hello%",
+							Value: int64(2),
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: float64(3),
 						},
 					},
 				},
@@ -571,15 +1143,42 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records[0], ShouldResemble, record1)
-			So(len(records), ShouldEqual, 1)
+			So(records, ShouldResemble, []skydb.Record{record2, record3})
 		})
 
-		Convey("query records by case insensitive content matching", func() {
+		Convey("query records by note order range with datetime bounds", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.ILike,
+					Operator: skydb.Between,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC),
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC),
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			_, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("query records by content matching", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Like,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
@@ -587,7 +1186,7 @@ func TestQuery(t *testing.T) {
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: "hello%",
+							Value: "Hello%",
 						},
 					},
 				},
@@ -600,11 +1199,11 @@ func TestQuery(t *testing.T) {
 			So(len(records), ShouldEqual, 1)
 		})
 
-		Convey("query records by check array members", func() {
+		Convey("query records by content matching regex", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.In,
+					Operator: skydb.Regex,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
@@ -612,17 +1211,32 @@ func TestQuery(t *testing.T) {
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: []interface{}{"Bye World", "Good Hello", "Anything"},
+							Value: "^Hello",
 						},
 					},
 				},
-				Sorts: []skydb.Sort{
-					skydb.Sort{
-						Expression: skydb.Expression{
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("query records by content matching case insensitive regex", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.IRegex,
+					Children: []interface{}{
+						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "noteOrder",
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "hello$",
 						},
-						Order: skydb.Descending,
 					},
 				},
 			}
@@ -630,16 +1244,14 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records[0], ShouldResemble, record3)
-			So(records[1], ShouldResemble, record2)
-			So(len(records), ShouldEqual, 2)
+			So(records, ShouldResemble, []skydb.Record{record3})
 		})
 
-		Convey("query records by checking empty array", func() {
+		Convey("query records by content matching invalid regex", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.In,
+					Operator: skydb.Regex,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
@@ -647,43 +1259,31 @@ func TestQuery(t *testing.T) {
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: []interface{}{},
+							Value: "(Hello",
 						},
 					},
 				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			_, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
-			So(err, ShouldBeNil)
-			So(len(records), ShouldEqual, 0)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
 		})
 
-		Convey("query records by note order using or predicate", func() {
-			keyPathExpr := skydb.Expression{
-				Type:  skydb.KeyPath,
-				Value: "noteOrder",
-			}
-			value1 := skydb.Expression{
-				Type:  skydb.Literal,
-				Value: int64(2),
-			}
-			value2 := skydb.Expression{
-				Type:  skydb.Literal,
-				Value: int64(3),
-			}
+		Convey("query records by case insensitive content matching", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.Or,
+					Operator: skydb.ILike,
 					Children: []interface{}{
-						skydb.Predicate{
-							Operator: skydb.Equal,
-							Children: []interface{}{keyPathExpr, value1},
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "content",
 						},
-						skydb.Predicate{
-							Operator: skydb.Equal,
-							Children: []interface{}{keyPathExpr, value2},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "hello%",
 						},
 					},
 				},
@@ -692,59 +1292,74 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records[0], ShouldResemble, record2)
-			So(records[1], ShouldResemble, record3)
-			So(len(records), ShouldEqual, 2)
+			So(records[0], ShouldResemble, record1)
+			So(len(records), ShouldEqual, 1)
 		})
 
-		Convey("query records by offset and paging", func() {
+		Convey("query records by content containing substring", func() {
 			query := skydb.Query{
-				Type:   "note",
-				Limit:  new(uint64),
-				Offset: 1,
-				Sorts: []skydb.Sort{
-					skydb.Sort{
-						Expression: skydb.Expression{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Contains,
+					Children: []interface{}{
+						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "noteOrder",
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "llo Wo",
 						},
-						Order: skydb.Descending,
 					},
 				},
 			}
-			*query.Limit = 2
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records[0], ShouldResemble, record2)
-			So(records[1], ShouldResemble, record1)
-			So(len(records), ShouldEqual, 2)
+			So(records[0], ShouldResemble, record1)
+			So(len(records), ShouldEqual, 1)
 		})
 
-		Convey("query records for nil item", func() {
+		Convey("query records by content containing substring case insensitively", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.Equal,
+					Operator: skydb.IContains,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "emotion",
+							Value: "content",
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: nil,
+							Value: "O WOR",
 						},
 					},
 				},
-				Sorts: []skydb.Sort{
-					skydb.Sort{
-						Expression: skydb.Expression{
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records[0], ShouldResemble, record1)
+			So(len(records), ShouldEqual, 1)
+		})
+
+		Convey("query records by content containing wildcard character", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Contains,
+					Children: []interface{}{
+						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "noteOrder",
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "o%W",
 						},
-						Order: skydb.Ascending,
 					},
 				},
 			}
@@ -752,24 +1367,22 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records[0], ShouldResemble, record1)
-			So(records[1], ShouldResemble, record2)
-			So(len(records), ShouldEqual, 2)
+			So(len(records), ShouldEqual, 0)
 		})
 
-		Convey("query records for not nil item", func() {
+		Convey("query records by check array members", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.NotEqual,
+					Operator: skydb.In,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "emotion",
+							Value: "content",
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: nil,
+							Value: []interface{}{"Bye World", "Good Hello", "Anything"},
 						},
 					},
 				},
@@ -779,7 +1392,7 @@ func TestQuery(t *testing.T) {
 							Type:  skydb.KeyPath,
 							Value: "noteOrder",
 						},
-						Order: skydb.Ascending,
+						Order: skydb.Descending,
 					},
 				},
 			}
@@ -788,92 +1401,29 @@ func TestQuery(t *testing.T) {
 
 			So(err, ShouldBeNil)
 			So(records[0], ShouldResemble, record3)
-			So(len(records), ShouldEqual, 1)
+			So(records[1], ShouldResemble, record2)
+			So(len(records), ShouldEqual, 2)
 		})
-	})
 
-	Convey("Database with reference", t, func() {
-		c := getTestConn(t)
-		defer cleanupConn(t, c)
+		Convey("query records by checking array with many members", func() {
+			members := make([]interface{}, 70000)
+			for i := range members {
+				members[i] = fmt.Sprintf("Content %d", i)
+			}
+			members[69999] = "Bye World"
 
-		// fixture
-		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id1"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(1),
-			},
-		}
-		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id2"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(2),
-				"category":  skydb.NewReference("category", "important"),
-			},
-		}
-		record3 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id3"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(3),
-				"category":  skydb.NewReference("category", "funny"),
-			},
-		}
-		category1 := skydb.Record{
-			ID:      skydb.NewRecordID("category", "important"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"hidden": false,
-			},
-		}
-		category2 := skydb.Record{
-			ID:      skydb.NewRecordID("category", "funny"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"hidden": true,
-			},
-		}
-
-		db := c.PrivateDB("userid")
-		_, err := db.Extend("category", skydb.RecordSchema{
-			"hidden": skydb.FieldType{Type: skydb.TypeBoolean},
-		})
-		So(err, ShouldBeNil)
-
-		_, err = db.Extend("note", skydb.RecordSchema{
-			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
-			"category": skydb.FieldType{
-				Type:          skydb.TypeReference,
-				ReferenceType: "category",
-			},
-		})
-		So(err, ShouldBeNil)
-
-		err = db.Save(&category1)
-		So(err, ShouldBeNil)
-		err = db.Save(&category2)
-		So(err, ShouldBeNil)
-		err = db.Save(&record2)
-		So(err, ShouldBeNil)
-		err = db.Save(&record1)
-		So(err, ShouldBeNil)
-		err = db.Save(&record3)
-		So(err, ShouldBeNil)
-
-		Convey("query records by reference", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.Equal,
+					Operator: skydb.In,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "category",
+							Value: "content",
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: skydb.NewReference("category", "important"),
+							Value: members,
 						},
 					},
 				},
@@ -882,23 +1432,22 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(len(records), ShouldEqual, 1)
-			So(records[0], ShouldResemble, record2)
+			So(records, ShouldResemble, []skydb.Record{record2})
 		})
 
-		Convey("query records by comparing field in a referenced record", func() {
+		Convey("query records by checking empty array", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.Equal,
+					Operator: skydb.In,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "category.hidden",
+							Value: "content",
 						},
 						skydb.Expression{
 							Type:  skydb.Literal,
-							Value: true,
+							Value: []interface{}{},
 						},
 					},
 				},
@@ -907,64 +1456,34 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(len(records), ShouldEqual, 1)
-			So(records[0], ShouldResemble, record3)
-		})
-	})
-
-	Convey("Database with location", t, func() {
-		c := getTestConn(t)
-		defer cleanupConn(t, c)
-
-		record0 := skydb.Record{
-			ID:      skydb.NewRecordID("point_of_interest", "eiffel_tower"),
-			OwnerID: "someuserid",
-			Data: map[string]interface{}{
-				"location": skydb.NewLocation(2.2945, 48.858222),
-			},
-		}
-		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("point_of_interest", "london_eye"),
-			OwnerID: "someuserid",
-			Data: map[string]interface{}{
-				"location": skydb.NewLocation(-0.1194, 51.5033),
-			},
-		}
-		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("point_of_interest", "stonehenge"),
-			OwnerID: "someuserid",
-			Data: map[string]interface{}{
-				"location": skydb.NewLocation(-1.826189, 51.178844),
-			},
-		}
-
-		westminsterPalaceLocation := skydb.NewLocation(-0.124722, 51.499167)
-
-		db := c.PublicDB()
-		_, err := db.Extend("point_of_interest", skydb.RecordSchema{
-			"location": skydb.FieldType{Type: skydb.TypeLocation},
+			So(len(records), ShouldEqual, 0)
 		})
-		So(err, ShouldBeNil)
-		So(db.Save(&record0), ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
-		So(db.Save(&record2), ShouldBeNil)
 
-		Convey("query within distance", func() {
+		Convey("query records by note order using or predicate", func() {
+			keyPathExpr := skydb.Expression{
+				Type:  skydb.KeyPath,
+				Value: "noteOrder",
+			}
+			value1 := skydb.Expression{
+				Type:  skydb.Literal,
+				Value: int64(2),
+			}
+			value2 := skydb.Expression{
+				Type:  skydb.Literal,
+				Value: int64(3),
+			}
 			query := skydb.Query{
-				Type: "point_of_interest",
+				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.LessThanOrEqual,
+					Operator: skydb.Or,
 					Children: []interface{}{
-						skydb.Expression{
-							Type: skydb.Function,
-							Value: skydb.DistanceFunc{
-								Field:    "location",
-								Location: westminsterPalaceLocation,
-							},
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{keyPathExpr, value1},
 						},
-						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: int64(1000),
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{keyPathExpr, value2},
 						},
 					},
 				},
@@ -973,165 +1492,372 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record1})
+			So(records[0], ShouldResemble, record2)
+			So(records[1], ShouldResemble, record3)
+			So(len(records), ShouldEqual, 2)
 		})
 
-		Convey("query within distance with func on R.H.S.", func() {
+		Convey("query records using or predicate across different keypaths", func() {
 			query := skydb.Query{
-				Type: "point_of_interest",
+				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.GreaterThan,
+					Operator: skydb.Or,
 					Children: []interface{}{
-						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: int64(1000),
+						skydb.Predicate{
+							Operator: skydb.Like,
+							Children: []interface{}{
+								skydb.Expression{
+									Type:  skydb.KeyPath,
+									Value: "content",
+								},
+								skydb.Expression{
+									Type:  skydb.Literal,
+									Value: "Good%",
+								},
+							},
 						},
-						skydb.Expression{
-							Type: skydb.Function,
-							Value: skydb.DistanceFunc{
-								Field:    "location",
-								Location: westminsterPalaceLocation,
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{
+								skydb.Expression{
+									Type:  skydb.KeyPath,
+									Value: "noteOrder",
+								},
+								skydb.Expression{
+									Type:  skydb.Literal,
+									Value: float64(1),
+								},
 							},
 						},
 					},
 				},
+				Sorts: []skydb.Sort{
+					skydb.Sort{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
+						},
+						Order: skydb.Ascending,
+					},
+				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record1})
+			So(records, ShouldResemble, []skydb.Record{record1, record3})
 		})
 
-		Convey("query with computed distance", func() {
+		Convey("query records by offset and paging", func() {
 			query := skydb.Query{
-				Type: "point_of_interest",
-				ComputedKeys: map[string]skydb.Expression{
-					"distance": skydb.Expression{
-						Type: skydb.Function,
-						Value: skydb.DistanceFunc{
-							Field:    "location",
-							Location: westminsterPalaceLocation,
-						},
-					},
-				},
-				Predicate: skydb.Predicate{
-					Operator: skydb.Equal,
-					Children: []interface{}{
-						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: "london_eye",
-						},
-						skydb.Expression{
+				Type:   "note",
+				Limit:  new(uint64),
+				Offset: 1,
+				Sorts: []skydb.Sort{
+					skydb.Sort{
+						Expression: skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "_id",
+							Value: "noteOrder",
 						},
+						Order: skydb.Descending,
 					},
 				},
 			}
+			*query.Limit = 2
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(len(records), ShouldEqual, 1)
-			So(records[0].Transient["distance"], ShouldAlmostEqual, 589, 1)
+			So(records[0], ShouldResemble, record2)
+			So(records[1], ShouldResemble, record1)
+			So(len(records), ShouldEqual, 2)
 		})
 
-		Convey("query records ordered by distance", func() {
+		Convey("query records for nil item", func() {
 			query := skydb.Query{
-				Type: "point_of_interest",
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "emotion",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: nil,
+						},
+					},
+				},
 				Sorts: []skydb.Sort{
-					{
+					skydb.Sort{
 						Expression: skydb.Expression{
-							Type: skydb.Function,
-							Value: skydb.DistanceFunc{
-								Field:    "location",
-								Location: westminsterPalaceLocation,
-							},
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
 						},
-						Order: skydb.Desc,
+						Order: skydb.Ascending,
 					},
 				},
 			}
-
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record0, record2, record1})
+			So(records[0], ShouldResemble, record1)
+			So(records[1], ShouldResemble, record2)
+			So(len(records), ShouldEqual, 2)
+		})
+
+		Convey("query records for not nil item", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.NotEqual,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "emotion",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: nil,
+						},
+					},
+				},
+				Sorts: []skydb.Sort{
+					skydb.Sort{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
+						},
+						Order: skydb.Ascending,
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records[0], ShouldResemble, record3)
+			So(len(records), ShouldEqual, 1)
+		})
+
+		Convey("query records with missing content", func() {
+			record4 := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id4"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"noteOrder": float64(4),
+				},
+			}
+			So(db.Save(&record4), ShouldBeNil)
+
+			Convey("matches IsNull", func() {
+				query := skydb.Query{
+					Type:      "note",
+					Predicate: skydb.IsNull("content"),
+				}
+				records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+				So(err, ShouldBeNil)
+				So(len(records), ShouldEqual, 1)
+				So(records[0].ID, ShouldResemble, record4.ID)
+			})
+
+			Convey("does not match IsNotNull", func() {
+				query := skydb.Query{
+					Type:      "note",
+					Predicate: skydb.IsNotNull("content"),
+				}
+				records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+				So(err, ShouldBeNil)
+				So(records, ShouldResemble, []skydb.Record{record1, record2, record3})
+			})
+
+			Convey("does not match equality against a value", func() {
+				query := skydb.Query{
+					Type: "note",
+					Predicate: skydb.Predicate{
+						Operator: skydb.NotEqual,
+						Children: []interface{}{
+							skydb.Expression{
+								Type:  skydb.KeyPath,
+								Value: "content",
+							},
+							skydb.Expression{
+								Type:  skydb.Literal,
+								Value: "Hello World",
+							},
+						},
+					},
+				}
+				records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+				So(err, ShouldBeNil)
+				So(records, ShouldResemble, []skydb.Record{record2, record3})
+			})
 		})
 	})
 
-	Convey("Database with geometry", t, func() {
+	Convey("Database with reference", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
-		var geom1 skydb.Geometry
-		So(json.Unmarshal([]byte(`{
-          "coordinates": [
-            [ [ 100, 0 ], [ 101, 0 ],
-              [ 101, 1 ], [ 100, 1 ] ]
-          ],
-          "type": "Polygon"
-        }`), &geom1), ShouldBeNil)
-		var geom2 skydb.Geometry
-		So(json.Unmarshal([]byte(`{
-          "coordinates": [
-            [ [ 101, 0 ], [ 102, 0 ],
-              [ 102, 1 ], [ 101, 1 ] ]
-          ],
-          "type": "Polygon"
-        }`), &geom2), ShouldBeNil)
-
-		point1 := skydb.NewLocation(100.5, 0.5)
-		point2 := skydb.NewLocation(101.5, 0.5)
-
+		// fixture
 		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("georecord", "value1"),
-			OwnerID: "someuserid",
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
 			Data: map[string]interface{}{
-				"geom": geom1,
+				"noteOrder": float64(1),
 			},
 		}
 		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("georecord", "value2"),
-			OwnerID: "someuserid",
+			ID:      skydb.NewRecordID("note", "id2"),
+			OwnerID: "user_id",
 			Data: map[string]interface{}{
-				"geom":  geom2,
-				"point": point2,
+				"noteOrder": float64(2),
+				"category":  skydb.NewReference("category", "important"),
+			},
+		}
+		record3 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id3"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"noteOrder": float64(3),
+				"category":  skydb.NewReference("category", "funny"),
+			},
+		}
+		category1 := skydb.Record{
+			ID:      skydb.NewRecordID("category", "important"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"hidden": false,
+			},
+		}
+		category2 := skydb.Record{
+			ID:      skydb.NewRecordID("category", "funny"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"hidden": true,
 			},
 		}
 
-		db := c.PublicDB()
-		_, err := db.Extend("georecord", skydb.RecordSchema{
-			"geom":  skydb.FieldType{Type: skydb.TypeGeometry},
-			"point": skydb.FieldType{Type: skydb.TypeLocation},
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("category", skydb.RecordSchema{
+			"hidden": skydb.FieldType{Type: skydb.TypeBoolean},
 		})
 		So(err, ShouldBeNil)
-		So(db.Save(&record1), ShouldBeNil)
-		So(db.Save(&record2), ShouldBeNil)
 
-		Convey("fetch", func() {
-			record := skydb.Record{}
-			err = db.Get(skydb.NewRecordID("georecord", "value1"), &record)
+		_, err = db.Extend("note", skydb.RecordSchema{
+			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
+			"category": skydb.FieldType{
+				Type:          skydb.TypeReference,
+				ReferenceType: "category",
+			},
+		})
+		So(err, ShouldBeNil)
+
+		err = db.Save(&category1)
+		So(err, ShouldBeNil)
+		err = db.Save(&category2)
+		So(err, ShouldBeNil)
+		err = db.Save(&record2)
+		So(err, ShouldBeNil)
+		err = db.Save(&record1)
+		So(err, ShouldBeNil)
+		err = db.Save(&record3)
+		So(err, ShouldBeNil)
+
+		Convey("lists outgoing references of record", func() {
+			references, err := db.OutgoingReferences(record2.ID)
 			So(err, ShouldBeNil)
-			So(record.Data, ShouldResemble, skydb.Data{
-				"geom": geom1,
+			So(references, ShouldResemble, map[string]skydb.Reference{
+				"category": skydb.NewReference("category", "important"),
 			})
 		})
 
-		Convey("query within geom", func() {
+		Convey("lists no outgoing references of record without reference", func() {
+			references, err := db.OutgoingReferences(record1.ID)
+			So(err, ShouldBeNil)
+			So(references, ShouldBeEmpty)
+		})
+
+		Convey("returns ErrRecordNotFound when listing references of non-existent record", func() {
+			_, err := db.OutgoingReferences(skydb.NewRecordID("note", "notexist"))
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("counts records by reference", func() {
+			record4 := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id4"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"noteOrder": float64(4),
+					"category":  skydb.NewReference("category", "important"),
+				},
+			}
+			err := db.Save(&record4)
+			So(err, ShouldBeNil)
+
+			counts, err := db.CountByReference("note", "category")
+			So(err, ShouldBeNil)
+			So(counts, ShouldResemble, map[string]int64{
+				"important": 2,
+				"funny":     1,
+			})
+		})
+
+		Convey("returns error when counting by non-reference field", func() {
+			_, err := db.CountByReference("note", "noteOrder")
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("query records without reference", func() {
 			query := skydb.Query{
-				Type: "georecord",
+				Type:      "note",
+				Predicate: skydb.IsNull("category"),
+			}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("query records with reference", func() {
+			query := skydb.Query{
+				Type:      "note",
+				Predicate: skydb.IsNotNull("category"),
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
+						},
+						Order: skydb.Asc,
+					},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record3})
+		})
+
+		Convey("query records by reference", func() {
+			query := skydb.Query{
+				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.In,
+					Operator: skydb.Equal,
 					Children: []interface{}{
 						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: point1,
+							Type:  skydb.KeyPath,
+							Value: "category",
 						},
 						skydb.Expression{
-							Type:  skydb.KeyPath,
-							Value: "geom",
+							Type:  skydb.Literal,
+							Value: skydb.NewReference("category", "important"),
 						},
 					},
 				},
@@ -1140,27 +1866,23 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record1})
+			So(len(records), ShouldEqual, 1)
+			So(records[0], ShouldResemble, record2)
 		})
 
-		Convey("query not within geom", func() {
+		Convey("query records by checking empty array of number", func() {
 			query := skydb.Query{
-				Type: "georecord",
+				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.Not,
+					Operator: skydb.In,
 					Children: []interface{}{
-						skydb.Predicate{
-							Operator: skydb.In,
-							Children: []interface{}{
-								skydb.Expression{
-									Type:  skydb.Literal,
-									Value: point1,
-								},
-								skydb.Expression{
-									Type:  skydb.KeyPath,
-									Value: "geom",
-								},
-							},
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: []interface{}{},
 						},
 					},
 				},
@@ -1169,22 +1891,22 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record2})
+			So(len(records), ShouldEqual, 0)
 		})
 
-		Convey("query by comparing keypath", func() {
+		Convey("query records by checking empty array of reference", func() {
 			query := skydb.Query{
-				Type: "georecord",
+				Type: "note",
 				Predicate: skydb.Predicate{
 					Operator: skydb.In,
 					Children: []interface{}{
 						skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "point",
+							Value: "category",
 						},
 						skydb.Expression{
-							Type:  skydb.KeyPath,
-							Value: "geom",
+							Type:  skydb.Literal,
+							Value: []interface{}{},
 						},
 					},
 				},
@@ -1193,112 +1915,1719 @@ func TestQuery(t *testing.T) {
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record2})
+			So(len(records), ShouldEqual, 0)
 		})
-	})
 
-	Convey("Database with multiple fields", t, func() {
+		Convey("query records not in empty array of reference", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Not,
+					Children: []interface{}{
+						skydb.Predicate{
+							Operator: skydb.In,
+							Children: []interface{}{
+								skydb.Expression{
+									Type:  skydb.KeyPath,
+									Value: "category",
+								},
+								skydb.Expression{
+									Type:  skydb.Literal,
+									Value: []interface{}{},
+								},
+							},
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+		})
+
+		Convey("query records by comparing field in a referenced record", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "category.hidden",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: true,
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0], ShouldResemble, record3)
+		})
+	})
+
+	Convey("Database with location", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
 		record0 := skydb.Record{
-			ID:      skydb.NewRecordID("restaurant", "0"),
+			ID:      skydb.NewRecordID("point_of_interest", "eiffel_tower"),
 			OwnerID: "someuserid",
 			Data: map[string]interface{}{
-				"cuisine": "american",
-				"title":   "American Restaurant",
+				"location": skydb.NewLocation(2.2945, 48.858222),
 			},
 		}
 		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("restaurant", "1"),
+			ID:      skydb.NewRecordID("point_of_interest", "london_eye"),
 			OwnerID: "someuserid",
 			Data: map[string]interface{}{
-				"cuisine": "chinese",
-				"title":   "Chinese Restaurant",
+				"location": skydb.NewLocation(-0.1194, 51.5033),
 			},
 		}
 		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("restaurant", "2"),
+			ID:      skydb.NewRecordID("point_of_interest", "stonehenge"),
 			OwnerID: "someuserid",
 			Data: map[string]interface{}{
-				"cuisine": "italian",
-				"title":   "Italian Restaurant",
+				"location": skydb.NewLocation(-1.826189, 51.178844),
 			},
 		}
 
-		recordsInDB := []skydb.Record{record0, record1, record2}
+		westminsterPalaceLocation := skydb.NewLocation(-0.124722, 51.499167)
 
 		db := c.PublicDB()
-		_, err := db.Extend("restaurant", skydb.RecordSchema{
-			"title":   skydb.FieldType{Type: skydb.TypeString},
-			"cuisine": skydb.FieldType{Type: skydb.TypeString},
+		_, err := db.Extend("point_of_interest", skydb.RecordSchema{
+			"location": skydb.FieldType{Type: skydb.TypeLocation},
 		})
 		So(err, ShouldBeNil)
 		So(db.Save(&record0), ShouldBeNil)
 		So(db.Save(&record1), ShouldBeNil)
 		So(db.Save(&record2), ShouldBeNil)
 
-		Convey("query with desired keys", func() {
+		Convey("query within distance", func() {
 			query := skydb.Query{
-				Type:        "restaurant",
-				DesiredKeys: []string{"cuisine"},
+				Type: "point_of_interest",
+				Predicate: skydb.Predicate{
+					Operator: skydb.LessThanOrEqual,
+					Children: []interface{}{
+						skydb.Expression{
+							Type: skydb.Function,
+							Value: skydb.DistanceFunc{
+								Field:    "location",
+								Location: westminsterPalaceLocation,
+							},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: int64(1000),
+						},
+					},
+				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(len(records), ShouldEqual, 3)
-			for i, record := range records {
-				So(record.Data["title"], ShouldBeNil)
-				So(record.Data["cuisine"], ShouldEqual, recordsInDB[i].Data["cuisine"])
-			}
+			So(records, ShouldResemble, []skydb.Record{record1})
 		})
 
-		Convey("query with empty desired keys", func() {
+		Convey("query within distance with func on R.H.S.", func() {
 			query := skydb.Query{
-				Type:        "restaurant",
-				DesiredKeys: []string{},
+				Type: "point_of_interest",
+				Predicate: skydb.Predicate{
+					Operator: skydb.GreaterThan,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: int64(1000),
+						},
+						skydb.Expression{
+							Type: skydb.Function,
+							Value: skydb.DistanceFunc{
+								Field:    "location",
+								Location: westminsterPalaceLocation,
+							},
+						},
+					},
+				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
-			So(len(records), ShouldEqual, 3)
-			for _, record := range records {
-				So(record.Data["title"], ShouldBeNil)
-				So(record.Data["cuisine"], ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("query with computed distance", func() {
+			query := skydb.Query{
+				Type: "point_of_interest",
+				ComputedKeys: map[string]skydb.Expression{
+					"distance": skydb.Expression{
+						Type: skydb.Function,
+						Value: skydb.DistanceFunc{
+							Field:    "location",
+							Location: westminsterPalaceLocation,
+						},
+					},
+				},
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "london_eye",
+						},
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "_id",
+						},
+					},
+				},
 			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].Transient["distance"], ShouldAlmostEqual, 589, 1)
 		})
 
-		Convey("query with nil desired keys", func() {
+		Convey("query with computed geohash", func() {
 			query := skydb.Query{
-				Type:        "restaurant",
-				DesiredKeys: nil,
+				Type: "point_of_interest",
+				ComputedKeys: map[string]skydb.Expression{
+					"geohash": skydb.Expression{
+						Type: skydb.Function,
+						Value: skydb.GeohashFunc{
+							Field:     "location",
+							Precision: 5,
+						},
+					},
+				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
 
 			So(err, ShouldBeNil)
 			So(len(records), ShouldEqual, 3)
-			for i, record := range records {
-				So(record.Data["title"], ShouldEqual, recordsInDB[i].Data["title"])
-				So(record.Data["cuisine"], ShouldEqual, recordsInDB[i].Data["cuisine"])
+			So(records[0].Transient["geohash"], ShouldEqual, "u09tu")
+			So(records[1].Transient["geohash"], ShouldEqual, "gcpuv")
+			So(records[2].Transient["geohash"], ShouldEqual, "gcnen")
+		})
+
+		Convey("query records ordered by distance", func() {
+			query := skydb.Query{
+				Type: "point_of_interest",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type: skydb.Function,
+							Value: skydb.DistanceFunc{
+								Field:    "location",
+								Location: westminsterPalaceLocation,
+							},
+						},
+						Order: skydb.Desc,
+					},
+				},
 			}
+
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record0, record2, record1})
 		})
 
-		Convey("query with non-recognized desired keys", func() {
+		Convey("query records within distance with computed distance", func() {
 			query := skydb.Query{
-				Type:        "restaurant",
-				DesiredKeys: []string{"pricing"},
+				Type: "point_of_interest",
 			}
+			query.WithinDistance("location", westminsterPalaceLocation, 200000)
+
 			accessControlOptions := skydb.AccessControlOptions{}
-			_, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+			So(records[0].ID, ShouldResemble, record1.ID)
+			So(records[1].ID, ShouldResemble, record2.ID)
+			So(records[0].Transient[skydb.DistanceKey], ShouldAlmostEqual, 589, 1)
+			So(records[1].Transient[skydb.DistanceKey], ShouldBeGreaterThan, 589)
+			So(records[1].Transient[skydb.DistanceKey], ShouldBeLessThanOrEqualTo, 200000)
+		})
+	})
+
+	Convey("Database with geometry", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		var geom1 skydb.Geometry
+		So(json.Unmarshal([]byte(`{
+          "coordinates": [
+            [ [ 100, 0 ], [ 101, 0 ],
+              [ 101, 1 ], [ 100, 1 ] ]
+          ],
+          "type": "Polygon"
+        }`), &geom1), ShouldBeNil)
+		var geom2 skydb.Geometry
+		So(json.Unmarshal([]byte(`{
+          "coordinates": [
+            [ [ 101, 0 ], [ 102, 0 ],
+              [ 102, 1 ], [ 101, 1 ] ]
+          ],
+          "type": "Polygon"
+        }`), &geom2), ShouldBeNil)
+
+		point1 := skydb.NewLocation(100.5, 0.5)
+		point2 := skydb.NewLocation(101.5, 0.5)
+
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("georecord", "value1"),
+			OwnerID: "someuserid",
+			Data: map[string]interface{}{
+				"geom": geom1,
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("georecord", "value2"),
+			OwnerID: "someuserid",
+			Data: map[string]interface{}{
+				"geom":  geom2,
+				"point": point2,
+			},
+		}
+
+		db := c.PublicDB()
+		_, err := db.Extend("georecord", skydb.RecordSchema{
+			"geom":  skydb.FieldType{Type: skydb.TypeGeometry},
+			"point": skydb.FieldType{Type: skydb.TypeLocation},
+		})
+		So(err, ShouldBeNil)
+		So(db.Save(&record1), ShouldBeNil)
+		So(db.Save(&record2), ShouldBeNil)
+
+		Convey("fetch", func() {
+			record := skydb.Record{}
+			err = db.Get(skydb.NewRecordID("georecord", "value1"), &record)
+			So(err, ShouldBeNil)
+			So(record.Data, ShouldResemble, skydb.Data{
+				"geom": geom1,
+			})
+		})
+
+		Convey("query within geom", func() {
+			query := skydb.Query{
+				Type: "georecord",
+				Predicate: skydb.Predicate{
+					Operator: skydb.In,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: point1,
+						},
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "geom",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("query not within geom", func() {
+			query := skydb.Query{
+				Type: "georecord",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Not,
+					Children: []interface{}{
+						skydb.Predicate{
+							Operator: skydb.In,
+							Children: []interface{}{
+								skydb.Expression{
+									Type:  skydb.Literal,
+									Value: point1,
+								},
+								skydb.Expression{
+									Type:  skydb.KeyPath,
+									Value: "geom",
+								},
+							},
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2})
+		})
+
+		Convey("query by comparing keypath", func() {
+			query := skydb.Query{
+				Type: "georecord",
+				Predicate: skydb.Predicate{
+					Operator: skydb.In,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "point",
+						},
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "geom",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2})
+		})
+	})
+
+	Convey("Database with multiple fields", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		record0 := skydb.Record{
+			ID:      skydb.NewRecordID("restaurant", "0"),
+			OwnerID: "someuserid",
+			Data: map[string]interface{}{
+				"cuisine": "american",
+				"title":   "American Restaurant",
+			},
+		}
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("restaurant", "1"),
+			OwnerID: "someuserid",
+			Data: map[string]interface{}{
+				"cuisine": "chinese",
+				"title":   "Chinese Restaurant",
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("restaurant", "2"),
+			OwnerID: "someuserid",
+			Data: map[string]interface{}{
+				"cuisine": "italian",
+				"title":   "Italian Restaurant",
+			},
+		}
+
+		recordsInDB := []skydb.Record{record0, record1, record2}
+
+		db := c.PublicDB()
+		_, err := db.Extend("restaurant", skydb.RecordSchema{
+			"title":   skydb.FieldType{Type: skydb.TypeString},
+			"cuisine": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		So(db.Save(&record0), ShouldBeNil)
+		So(db.Save(&record1), ShouldBeNil)
+		So(db.Save(&record2), ShouldBeNil)
+
+		Convey("query sorted by title case insensitively", func() {
+			record3 := skydb.Record{
+				ID:      skydb.NewRecordID("restaurant", "3"),
+				OwnerID: "someuserid",
+				Data: map[string]interface{}{
+					"cuisine": "american",
+					"title":   "apple pie house",
+				},
+			}
+			record4 := skydb.Record{
+				ID:      skydb.NewRecordID("restaurant", "4"),
+				OwnerID: "someuserid",
+				Data: map[string]interface{}{
+					"cuisine": "american",
+					"title":   "ZEBRA Bar",
+				},
+			}
+			So(db.Save(&record3), ShouldBeNil)
+			So(db.Save(&record4), ShouldBeNil)
+
+			query := skydb.Query{
+				Type: "restaurant",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "title",
+						},
+						Order:           skydb.Ascending,
+						CaseInsensitive: true,
+					},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record0, record3, record1, record2, record4})
+		})
+
+		Convey("query sorted by created at with case insensitive sort", func() {
+			query := skydb.Query{
+				Type: "restaurant",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "_created_at",
+						},
+						Order:           skydb.Ascending,
+						CaseInsensitive: true,
+					},
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "_id",
+						},
+						Order: skydb.Ascending,
+					},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record0, record1, record2})
+		})
+
+		Convey("query with desired keys", func() {
+			query := skydb.Query{
+				Type:        "restaurant",
+				DesiredKeys: []string{"cuisine"},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+			for i, record := range records {
+				So(record.Data["title"], ShouldBeNil)
+				So(record.Data["cuisine"], ShouldEqual, recordsInDB[i].Data["cuisine"])
+			}
+		})
+
+		Convey("query with empty desired keys", func() {
+			query := skydb.Query{
+				Type:        "restaurant",
+				DesiredKeys: []string{},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+			for _, record := range records {
+				So(record.Data["title"], ShouldBeNil)
+				So(record.Data["cuisine"], ShouldBeNil)
+			}
+		})
+
+		Convey("query with nil desired keys", func() {
+			query := skydb.Query{
+				Type:        "restaurant",
+				DesiredKeys: nil,
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+			for i, record := range records {
+				So(record.Data["title"], ShouldEqual, recordsInDB[i].Data["title"])
+				So(record.Data["cuisine"], ShouldEqual, recordsInDB[i].Data["cuisine"])
+			}
+		})
+
+		Convey("query with lower case title computed", func() {
+			query := skydb.Query{
+				Type: "restaurant",
+				ComputedKeys: map[string]skydb.Expression{
+					"normalizedTitle": skydb.Expression{
+						Type:  skydb.Function,
+						Value: skydb.LowerFunc{Field: "title"},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+			So(records[0].Transient["normalizedTitle"], ShouldEqual, "american restaurant")
+			So(records[1].Transient["normalizedTitle"], ShouldEqual, "chinese restaurant")
+			So(records[2].Transient["normalizedTitle"], ShouldEqual, "italian restaurant")
+			So(records[0].Data["title"], ShouldEqual, "American Restaurant")
+		})
+
+		Convey("query ordered by full text match score", func() {
+			record3 := skydb.Record{
+				ID:      skydb.NewRecordID("restaurant", "3"),
+				OwnerID: "someuserid",
+				Data: map[string]interface{}{
+					"cuisine": "cantonese",
+					"title":   "Chinese Noodle House",
+				},
+			}
+			So(db.Save(&record3), ShouldBeNil)
+
+			query := skydb.Query{Type: "restaurant"}
+			query.OrderByScore(skydb.FullTextMatchFunc{
+				Fields: []string{"title", "cuisine"},
+				Query:  "Chinese",
+			})
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+			So(records[0].ID, ShouldResemble, record1.ID)
+			So(records[1].ID, ShouldResemble, record3.ID)
+			So(records[0].Transient[skydb.ScoreKey], ShouldBeGreaterThan, records[1].Transient[skydb.ScoreKey])
+			So(records[1].Transient[skydb.ScoreKey], ShouldBeGreaterThan, 0)
+		})
+
+		Convey("query with upper case title computed", func() {
+			query := skydb.Query{
+				Type: "restaurant",
+				ComputedKeys: map[string]skydb.Expression{
+					"shoutedTitle": skydb.Expression{
+						Type:  skydb.Function,
+						Value: skydb.UpperFunc{Field: "title"},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+			So(records[1].Transient["shoutedTitle"], ShouldEqual, "CHINESE RESTAURANT")
+		})
+
+		Convey("query by lower case title", func() {
+			query := skydb.Query{
+				Type: "restaurant",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.LowerFunc{Field: "title"},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "chinese restaurant",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("query by lower case title does not treat wildcards specially", func() {
+			query := skydb.Query{
+				Type: "restaurant",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.LowerFunc{Field: "title"},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "chinese%",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 0)
+		})
+
+		Convey("query by upper case title", func() {
+			query := skydb.Query{
+				Type: "restaurant",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.UpperFunc{Field: "title"},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "ITALIAN RESTAURANT",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2})
+		})
+
+		Convey("query with non-recognized desired keys", func() {
+			query := skydb.Query{
+				Type:        "restaurant",
+				DesiredKeys: []string{"pricing"},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			_, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Database with JSON", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		// fixture
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"primaryTag": "red",
+				"tags":       []interface{}{"red", "green"},
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id2"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"primaryTag": "yellow",
+				"tags":       []interface{}{"red", "green"},
+			},
+		}
+		record3 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id3"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"primaryTag": "green",
+				"tags":       []interface{}{"red", "yellow"},
+			},
+		}
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"primaryTag": skydb.FieldType{Type: skydb.TypeString},
+			"tags":       skydb.FieldType{Type: skydb.TypeJSON},
+		})
+		So(err, ShouldBeNil)
+
+		err = db.Save(&record2)
+		So(err, ShouldBeNil)
+		err = db.Save(&record1)
+		So(err, ShouldBeNil)
+		err = db.Save(&record3)
+		So(err, ShouldBeNil)
+
+		Convey("query records by literal string in JSON", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.In,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "yellow",
+						},
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "tags",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record3})
+		})
+
+		containsAll := func(keyPath string, elements []interface{}) skydb.Query {
+			return skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.ContainsAll,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: keyPath,
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: elements,
+						},
+					},
+				},
+			}
+		}
+
+		Convey("query records containing all literal strings in JSON", func() {
+			query := containsAll("tags", []interface{}{"green", "red"})
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1, record2})
+		})
+
+		Convey("query records containing all of a single literal string in JSON", func() {
+			query := containsAll("tags", []interface{}{"yellow"})
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record3})
+		})
+
+		Convey("query all records containing all of no elements", func() {
+			query := containsAll("tags", []interface{}{})
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1, record2, record3})
+		})
+
+		Convey("gets raw JSON of field as stored", func() {
+			raw := `{"b": [1, 2.50], "aa": 10}`
+			insertRow(t, c.Db(), `INSERT INTO "note" `+
+				`(_database_id, _id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "tags") `+
+				`VALUES ('userid', 'id4', 'user_id', '1988-02-06', 'user_id', '1988-02-06', 'user_id', '`+raw+`')`)
+
+			data, err := db.GetRawField(skydb.NewRecordID("note", "id4"), "tags")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, raw)
+		})
+
+		Convey("gets raw JSON of saved field", func() {
+			data, err := db.GetRawField(record3.ID, "tags")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `["red", "yellow"]`)
+		})
+
+		Convey("returns error getting raw JSON of non-json field", func() {
+			_, err := db.GetRawField(record3.ID, "primaryTag")
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+
+		Convey("returns ErrRecordNotFound getting raw JSON of non-existent record", func() {
+			_, err := db.GetRawField(skydb.NewRecordID("note", "notexist"), "tags")
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+
+		Convey("returns error querying non-json field containing all elements", func() {
+			query := containsAll("primaryTag", []interface{}{"red"})
+			_, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+
+	Convey("Database with JSON dictionary", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		// fixture
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"note":   "urgent: call back",
+					"author": map[string]interface{}{"name": "Alice"},
+					"views":  float64(10),
+				},
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id2"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"note":   "can wait",
+					"author": map[string]interface{}{"name": "Bob"},
+					"views":  float64(9),
+				},
+			},
+		}
+		record3 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id3"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"author": map[string]interface{}{"name": "urgent"},
+					"views":  "many",
+				},
+			},
+		}
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"metadata": skydb.FieldType{Type: skydb.TypeJSON},
+		})
+		So(err, ShouldBeNil)
+
+		So(db.Save(&record1), ShouldBeNil)
+		So(db.Save(&record2), ShouldBeNil)
+		So(db.Save(&record3), ShouldBeNil)
+
+		Convey("query records by substring in nested JSON string", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Contains,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "metadata.note",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "urgent",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID, ShouldResemble, record1.ID)
+		})
+
+		Convey("query records by pattern in deeply nested JSON string", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.ILike,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "metadata.author.name",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "b%",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID, ShouldResemble, record2.ID)
+		})
+
+		Convey("query records sorted by nested JSON number", func() {
+			sortByViews := func(order skydb.SortOrder) []skydb.RecordID {
+				query := skydb.Query{
+					Type: "note",
+					Sorts: []skydb.Sort{
+						{
+							Expression: skydb.Expression{
+								Type:  skydb.KeyPath,
+								Value: "metadata.views",
+							},
+							Order: order,
+						},
+					},
+				}
+				accessControlOptions := skydb.AccessControlOptions{}
+				records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+				So(err, ShouldBeNil)
+
+				ids := []skydb.RecordID{}
+				for _, record := range records {
+					ids = append(ids, record.ID)
+				}
+				return ids
+			}
+
+			So(sortByViews(skydb.Ascending), ShouldResemble, []skydb.RecordID{
+				record2.ID, record1.ID, record3.ID,
+			})
+			So(sortByViews(skydb.Descending), ShouldResemble, []skydb.RecordID{
+				record1.ID, record2.ID, record3.ID,
+			})
+		})
+
+		Convey("query records sorted by nested keypath of non-JSON field", func() {
+			query := skydb.Query{
+				Type: "note",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "_owner_id.views",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			_, err := db.Query(&query, &accessControlOptions)
+
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+
+	Convey("Database with length", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		// fixture
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"title": "Hi",
+				"tags":  []interface{}{"red", "green", "blue", "yellow"},
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id2"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"title": "Hello World",
+				"tags":  []interface{}{"red"},
+			},
+		}
+		record3 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id3"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"title": "Hello",
+				"tags":  map[string]interface{}{"red": true},
+			},
+		}
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"title": skydb.FieldType{Type: skydb.TypeString},
+			"tags":  skydb.FieldType{Type: skydb.TypeJSON},
+		})
+		So(err, ShouldBeNil)
+
+		err = db.Save(&record2)
+		So(err, ShouldBeNil)
+		err = db.Save(&record1)
+		So(err, ShouldBeNil)
+		err = db.Save(&record3)
+		So(err, ShouldBeNil)
+
+		Convey("query records by length of string", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.GreaterThan,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.LengthFunc{Field: "title"},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: float64(5),
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2})
+		})
+
+		Convey("query records by length of array", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.GreaterThan,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.LengthFunc{Field: "tags"},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: float64(3),
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("query records by length of array skips non-array", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.LessThan,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.LengthFunc{Field: "tags"},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: float64(4),
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2})
+		})
+
+		Convey("query records with computed length", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "_id",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "id2",
+						},
+					},
+				},
+				ComputedKeys: map[string]skydb.Expression{
+					"titleLength": skydb.Expression{
+						Type:  skydb.Function,
+						Value: skydb.LengthFunc{Field: "title"},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].Transient["titleLength"], ShouldEqual, float64(11))
+		})
+	})
+
+	Convey("Database with ACL", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		// fixture
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "alice",
+			ACL:     skydb.RecordACL{},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id2"),
+			OwnerID: "alice",
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
+			},
+		}
+		record3 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id3"),
+			OwnerID: "alice",
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("bob", skydb.ReadLevel),
+			},
+		}
+		record4 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id4"),
+			OwnerID: "alice",
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryRole("marketing", skydb.ReadLevel),
+			},
+		}
+		record5 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id5"),
+			OwnerID: "alice",
+			ACL: skydb.RecordACL{
+				skydb.NewRecordACLEntryDirect("bob", skydb.ReadLevel),
+				skydb.NewRecordACLEntryRole("marketing", skydb.ReadLevel),
+			},
+		}
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{})
+		So(err, ShouldBeNil)
+
+		err = db.Save(&record1)
+		So(err, ShouldBeNil)
+		err = db.Save(&record2)
+		So(err, ShouldBeNil)
+		err = db.Save(&record3)
+		So(err, ShouldBeNil)
+		err = db.Save(&record4)
+		So(err, ShouldBeNil)
+		err = db.Save(&record5)
+		So(err, ShouldBeNil)
+
+		sortsByID := []skydb.Sort{
+			skydb.Sort{
+				Expression: skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "_id",
+				},
+				Order: skydb.Ascending,
+			},
+		}
+
+		Convey("can be queried by owner", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "alice"},
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1, record2, record3, record4, record5})
+		})
+
+		Convey("can be queried by public", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: nil,
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2})
+		})
+
+		Convey("can be queried by explicit user", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "bob"},
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record3, record5})
+		})
+
+		Convey("can be queried by explicit role", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{
+					ID:    "carol",
+					Roles: []string{"marketing"},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record4, record5})
+		})
+
+		Convey("can be queried by explicit user and role", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{
+					ID:    "bob",
+					Roles: []string{"marketing"},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record3, record4, record5})
+		})
+
+		Convey("can be queried as roles", func() {
+			record6 := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id6"),
+				OwnerID: "alice",
+				ACL: skydb.RecordACL{
+					skydb.NewRecordACLEntryRole("editor", skydb.ReadLevel),
+				},
+			}
+			err := db.Save(&record6)
+			So(err, ShouldBeNil)
+
+			query := skydb.Query{
+				Type:    "note",
+				Sorts:   sortsByID,
+				AsRoles: []string{"reviewer", "editor"},
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "alice"},
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record6})
+		})
+
+		Convey("can be queried as roles and owner", func() {
+			query := skydb.Query{
+				Type:    "note",
+				Sorts:   sortsByID,
+				AsRoles: []string{"editor", "marketing"},
+				AsOwner: "bob",
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record3, record4, record5})
+		})
+
+		Convey("can be queried with bypass access control", func() {
+			query := skydb.Query{
+				Type:  "note",
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{
+					ID: "dave",
+				},
+				BypassAccessControl: true,
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1, record2, record3, record4, record5})
+		})
+
+		Convey("can be queried for publicly readable records", func() {
+			record6 := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id6"),
+				OwnerID: "alice",
+				ACL:     nil,
+			}
+			err := db.Save(&record6)
+			So(err, ShouldBeNil)
+
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Functional,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.IsPublicReadableFunc{},
+						},
+					},
+				},
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				BypassAccessControl: true,
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record6})
+		})
+
+		Convey("can be queried for records with ACL containing role", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Functional,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.Function,
+							Value: skydb.ACLContainsRoleFunc{Role: "marketing"},
+						},
+					},
+				},
+				Sorts: sortsByID,
+			}
+			accessControlOptions := skydb.AccessControlOptions{
+				BypassAccessControl: true,
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record4, record5})
+		})
+	})
+
+	Convey("Empty Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		Convey("gets no users", func() {
+			authinfo := skydb.AuthInfo{}
+			err := c.GetAuth("notexistuserid", &authinfo)
+			So(err, ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("gets no users with principal", func() {
+			authinfo := skydb.AuthInfo{}
+			err := c.GetAuthByPrincipalID("com.example:johndoe", &authinfo)
+			So(err, ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("updates no users", func() {
+			authinfo := skydb.AuthInfo{
+				ID: "notexistuserid",
+			}
+			err := c.UpdateAuth(&authinfo)
+			So(err, ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("deletes no users", func() {
+			err := c.DeleteAuth("notexistuserid")
+			So(err, ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("gets no devices", func() {
+			device := skydb.Device{}
+			err := c.GetDevice("notexistdeviceid", &device)
+			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
+		})
+
+		Convey("deletes no devices", func() {
+			err := c.DeleteDevice("notexistdeviceid")
+			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
+		})
+
+		Convey("Empty Database", func() {
+			db := c.PublicDB()
+
+			Convey("gets nothing", func() {
+				record := skydb.Record{}
+
+				err := db.Get(skydb.NewRecordID("type", "notexistid"), &record)
+
+				So(err, ShouldEqual, skydb.ErrRecordNotFound)
+			})
+
+			Convey("deletes nothing", func() {
+				err := db.Delete(skydb.NewRecordID("type", "notexistid"))
+				So(err, ShouldEqual, skydb.ErrRecordNotFound)
+			})
+
+			Convey("queries nothing", func() {
+				query := skydb.Query{
+					Type: "notexisttype",
+				}
+
+				accessControlOptions := skydb.AccessControlOptions{}
+				records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+				So(err, ShouldBeNil)
+				So(records, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestQueryCache(t *testing.T) {
+	Convey("Database with query cache", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		c.queryCache = newQueryCache(10, 0)
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		note := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"content": "Hello World",
+			},
+		}
+		So(db.Save(&note), ShouldBeNil)
+
+		query := skydb.Query{
+			Type: "note",
+		}
+		accessControlOptions := skydb.AccessControlOptions{}
+		records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+		So(err, ShouldBeNil)
+		So(records, ShouldResemble, []skydb.Record{note})
+
+		Convey("serves cached query without hitting database", func() {
+			statementCount := c.statementCount
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note})
+			So(c.statementCount, ShouldEqual, statementCount)
+		})
+
+		Convey("invalidates cached query after save", func() {
+			note.Data["content"] = "Bye World"
+			So(db.Save(&note), ShouldBeNil)
+
+			statementCount := c.statementCount
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note})
+			So(c.statementCount, ShouldEqual, statementCount+1)
+		})
+
+		Convey("invalidates cached query after delete", func() {
+			So(db.Delete(note.ID), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
+
+		Convey("keeps cached query after saving other record type", func() {
+			_, err := db.Extend("category", skydb.RecordSchema{
+				"name": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("category", "id1"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"name": "funny",
+				},
+			}), ShouldBeNil)
+
+			statementCount := c.statementCount
+			_, err = exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(c.statementCount, ShouldEqual, statementCount)
+		})
+
+		Convey("invalidates cached relation query after adding relation", func() {
+			addUser(t, c, "userid")
+			addUser(t, c, "user_id")
+
+			records, err := exhaustRows(db.QueryByRelation("note", "_friend", "outward", "userid", nil, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+
+			So(c.AddRelation("userid", "_friend", "user_id"), ShouldBeNil)
+
+			records, err = exhaustRows(db.QueryByRelation("note", "_friend", "outward", "userid", nil, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{note})
+		})
+
+		Convey("invalidates cached query after merging users", func() {
+			addUser(t, c, "userid")
+			addUser(t, c, "user_id")
+			addUser(t, c, "otherid")
+
+			So(c.MergeUsers("user_id", "otherid"), ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].OwnerID, ShouldEqual, "otherid")
+		})
+
+		Convey("does not use cache in transaction", func() {
+			So(c.Begin(), ShouldBeNil)
+			defer c.Rollback()
+
+			statementCount := c.statementCount
+			_, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(c.statementCount, ShouldEqual, statementCount+1)
+		})
+	})
+}
+
+func TestQueryCount(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		// fixture
+		record1 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"noteOrder": float64(1),
+				"content":   "Hello World",
+			},
+		}
+		record2 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id2"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"noteOrder": float64(2),
+				"content":   "Bye World",
+			},
+		}
+		record3 := skydb.Record{
+			ID:      skydb.NewRecordID("note", "id3"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"noteOrder": float64(3),
+				"content":   "Good Hello",
+			},
+		}
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
+			"content":   skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		err = db.Save(&record2)
+		So(err, ShouldBeNil)
+		err = db.Save(&record1)
+		So(err, ShouldBeNil)
+		err = db.Save(&record3)
+		So(err, ShouldBeNil)
+
+		Convey("count records", func() {
+			query := skydb.Query{
+				Type: "note",
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			count, err := db.QueryCount(&query, &accessControlOptions)
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+
+		Convey("count records by content matching", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Like,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "Hello%",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			count, err := db.QueryCount(&query, &accessControlOptions)
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("count records by content with none matching", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Like,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "Not Exist",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			count, err := db.QueryCount(&query, &accessControlOptions)
+
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("count records by negated content matching", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Not,
+					Children: []interface{}{
+						skydb.Predicate{
+							Operator: skydb.Like,
+							Children: []interface{}{
+								skydb.Expression{
+									Type:  skydb.KeyPath,
+									Value: "content",
+								},
+								skydb.Expression{
+									Type:  skydb.Literal,
+									Value: "Hello%",
+								},
+							},
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			count, err := db.QueryCount(&query, &accessControlOptions)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
 
-			So(err, ShouldNotBeNil)
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 2)
 		})
 	})
+}
 
-	Convey("Database with JSON", t, func() {
+func TestQueryIDs(t *testing.T) {
+	Convey("Database", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
@@ -1307,398 +3636,486 @@ func TestQuery(t *testing.T) {
 			ID:      skydb.NewRecordID("note", "id1"),
 			OwnerID: "user_id",
 			Data: map[string]interface{}{
-				"primaryTag": "red",
-				"tags":       []interface{}{"red", "green"},
+				"noteOrder": float64(1),
+				"content":   "Hello World",
 			},
 		}
 		record2 := skydb.Record{
 			ID:      skydb.NewRecordID("note", "id2"),
 			OwnerID: "user_id",
 			Data: map[string]interface{}{
-				"primaryTag": "yellow",
-				"tags":       []interface{}{"red", "green"},
+				"noteOrder": float64(2),
+				"content":   "Bye World",
 			},
 		}
 		record3 := skydb.Record{
 			ID:      skydb.NewRecordID("note", "id3"),
 			OwnerID: "user_id",
 			Data: map[string]interface{}{
-				"primaryTag": "green",
-				"tags":       []interface{}{"red", "yellow"},
+				"noteOrder": float64(3),
+				"content":   "Good Hello",
 			},
 		}
 
 		db := c.PrivateDB("userid")
 		_, err := db.Extend("note", skydb.RecordSchema{
-			"primaryTag": skydb.FieldType{Type: skydb.TypeString},
-			"tags":       skydb.FieldType{Type: skydb.TypeJSON},
+			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
+			"content":   skydb.FieldType{Type: skydb.TypeString},
 		})
 		So(err, ShouldBeNil)
 
-		err = db.Save(&record2)
-		So(err, ShouldBeNil)
-		err = db.Save(&record1)
-		So(err, ShouldBeNil)
-		err = db.Save(&record3)
-		So(err, ShouldBeNil)
+		So(db.Save(&record2), ShouldBeNil)
+		So(db.Save(&record1), ShouldBeNil)
+		So(db.Save(&record3), ShouldBeNil)
 
-		Convey("query records by literal string in JSON", func() {
+		Convey("query ids same as full query", func() {
 			query := skydb.Query{
 				Type: "note",
 				Predicate: skydb.Predicate{
-					Operator: skydb.In,
+					Operator: skydb.Like,
 					Children: []interface{}{
 						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: "yellow",
+							Type:  skydb.KeyPath,
+							Value: "content",
 						},
 						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "%World",
+						},
+					},
+				},
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
 							Type:  skydb.KeyPath,
-							Value: "tags",
+							Value: "noteOrder",
 						},
+						Order: skydb.Descending,
 					},
 				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
 			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
 
+			ids, err := db.QueryIDs(&query, &accessControlOptions)
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record3})
+			So(ids, ShouldResemble, []skydb.RecordID{
+				records[0].ID,
+				records[1].ID,
+			})
+			So(ids, ShouldResemble, []skydb.RecordID{record2.ID, record1.ID})
 		})
-	})
-
-	Convey("Database with ACL", t, func() {
-		c := getTestConn(t)
-		defer cleanupConn(t, c)
-
-		// fixture
-		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id1"),
-			OwnerID: "alice",
-			ACL:     skydb.RecordACL{},
-		}
-		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id2"),
-			OwnerID: "alice",
-			ACL: skydb.RecordACL{
-				skydb.NewRecordACLEntryPublic(skydb.ReadLevel),
-			},
-		}
-		record3 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id3"),
-			OwnerID: "alice",
-			ACL: skydb.RecordACL{
-				skydb.NewRecordACLEntryDirect("bob", skydb.ReadLevel),
-			},
-		}
-		record4 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id4"),
-			OwnerID: "alice",
-			ACL: skydb.RecordACL{
-				skydb.NewRecordACLEntryRole("marketing", skydb.ReadLevel),
-			},
-		}
-		record5 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id5"),
-			OwnerID: "alice",
-			ACL: skydb.RecordACL{
-				skydb.NewRecordACLEntryDirect("bob", skydb.ReadLevel),
-				skydb.NewRecordACLEntryRole("marketing", skydb.ReadLevel),
-			},
-		}
-
-		db := c.PublicDB()
-		_, err := db.Extend("note", skydb.RecordSchema{})
-		So(err, ShouldBeNil)
 
-		err = db.Save(&record1)
-		So(err, ShouldBeNil)
-		err = db.Save(&record2)
-		So(err, ShouldBeNil)
-		err = db.Save(&record3)
-		So(err, ShouldBeNil)
-		err = db.Save(&record4)
-		So(err, ShouldBeNil)
-		err = db.Save(&record5)
-		So(err, ShouldBeNil)
-
-		sortsByID := []skydb.Sort{
-			skydb.Sort{
-				Expression: skydb.Expression{
-					Type:  skydb.KeyPath,
-					Value: "_id",
-				},
-				Order: skydb.Ascending,
-			},
-		}
-
-		Convey("can be queried by owner", func() {
+		Convey("query ids with limit", func() {
+			limit := uint64(2)
 			query := skydb.Query{
 				Type:  "note",
-				Sorts: sortsByID,
-			}
-			accessControlOptions := skydb.AccessControlOptions{
-				ViewAsUser: &skydb.AuthInfo{ID: "alice"},
+				Limit: &limit,
 			}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			ids, err := db.QueryIDs(&query, &skydb.AccessControlOptions{})
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record1, record2, record3, record4, record5})
+			So(ids, ShouldResemble, []skydb.RecordID{record1.ID, record2.ID})
 		})
 
-		Convey("can be queried by public", func() {
-			query := skydb.Query{
-				Type:  "note",
-				Sorts: sortsByID,
-			}
-			accessControlOptions := skydb.AccessControlOptions{
-				ViewAsUser: nil,
+		Convey("query ids readable by the user", func() {
+			record4 := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id4"),
+				OwnerID: "user_id",
+				ACL:     skydb.RecordACL{},
+				Data: map[string]interface{}{
+					"noteOrder": float64(4),
+					"content":   "Secret World",
+				},
 			}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(db.Save(&record4), ShouldBeNil)
+
+			query := skydb.Query{Type: "note"}
+			ids, err := db.QueryIDs(&query, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "another_user_id"},
+			})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []skydb.RecordID{record1.ID, record2.ID, record3.ID})
 
+			ids, err = db.QueryIDs(&query, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user_id"},
+			})
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record2})
+			So(ids, ShouldResemble, []skydb.RecordID{record1.ID, record2.ID, record3.ID, record4.ID})
 		})
 
-		Convey("can be queried by explicit user", func() {
-			query := skydb.Query{
-				Type:  "note",
-				Sorts: sortsByID,
-			}
-			accessControlOptions := skydb.AccessControlOptions{
-				ViewAsUser: &skydb.AuthInfo{ID: "bob"},
-			}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+		Convey("query ids of record type not created", func() {
+			ids, err := db.QueryIDs(&skydb.Query{Type: "article"}, &skydb.AccessControlOptions{})
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record2, record3, record5})
+			So(ids, ShouldBeEmpty)
 		})
+	})
+}
 
-		Convey("can be queried by explicit role", func() {
-			query := skydb.Query{
-				Type:  "note",
-				Sorts: sortsByID,
-			}
-			accessControlOptions := skydb.AccessControlOptions{
-				ViewAsUser: &skydb.AuthInfo{
-					ID:    "carol",
-					Roles: []string{"marketing"},
+func TestQueryDefaultLimit(t *testing.T) {
+	Convey("Database with default query limit", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		c.defaultQueryLimit = 3
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
+		})
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 5; i++ {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", fmt.Sprintf("id%d", i)),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"noteOrder": float64(i),
 				},
 			}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(db.Save(&record), ShouldBeNil)
+		}
 
+		Convey("truncates query without limit", func() {
+			query := skydb.Query{Type: "note"}
+			accessControlOptions := skydb.AccessControlOptions{}
+			rows, err := db.Query(&query, &accessControlOptions)
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record2, record4, record5})
+			records, err := exhaustRows(rows, nil)
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 3)
+			So(records[0].ID.Key, ShouldEqual, "id0")
+			So(records[2].ID.Key, ShouldEqual, "id2")
+			So(rows.Truncated, ShouldBeTrue)
 		})
 
-		Convey("can be queried by explicit user and role", func() {
+		Convey("does not truncate query matching up to the limit", func() {
 			query := skydb.Query{
-				Type:  "note",
-				Sorts: sortsByID,
-			}
-			accessControlOptions := skydb.AccessControlOptions{
-				ViewAsUser: &skydb.AuthInfo{
-					ID:    "bob",
-					Roles: []string{"marketing"},
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.LessThan,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "noteOrder",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: float64(3),
+						},
+					},
 				},
 			}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			accessControlOptions := skydb.AccessControlOptions{}
+			rows, err := db.Query(&query, &accessControlOptions)
+			So(err, ShouldBeNil)
+			records, err := exhaustRows(rows, nil)
 
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record2, record3, record4, record5})
+			So(len(records), ShouldEqual, 3)
+			So(rows.Truncated, ShouldBeFalse)
 		})
 
-		Convey("can be queried with bypass access control", func() {
+		Convey("does not apply default limit to query with limit", func() {
+			limit := uint64(10)
 			query := skydb.Query{
 				Type:  "note",
-				Sorts: sortsByID,
-			}
-			accessControlOptions := skydb.AccessControlOptions{
-				ViewAsUser: &skydb.AuthInfo{
-					ID: "dave",
-				},
-				BypassAccessControl: true,
+				Limit: &limit,
 			}
-			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
-
+			accessControlOptions := skydb.AccessControlOptions{}
+			rows, err := db.Query(&query, &accessControlOptions)
 			So(err, ShouldBeNil)
-			So(records, ShouldResemble, []skydb.Record{record1, record2, record3, record4, record5})
-		})
-	})
+			records, err := exhaustRows(rows, nil)
 
-	Convey("Empty Conn", t, func() {
-		c := getTestConn(t)
-		defer cleanupConn(t, c)
-
-		Convey("gets no users", func() {
-			authinfo := skydb.AuthInfo{}
-			err := c.GetAuth("notexistuserid", &authinfo)
-			So(err, ShouldEqual, skydb.ErrUserNotFound)
-		})
-
-		Convey("gets no users with principal", func() {
-			authinfo := skydb.AuthInfo{}
-			err := c.GetAuthByPrincipalID("com.example:johndoe", &authinfo)
-			So(err, ShouldEqual, skydb.ErrUserNotFound)
-		})
-
-		Convey("updates no users", func() {
-			authinfo := skydb.AuthInfo{
-				ID: "notexistuserid",
-			}
-			err := c.UpdateAuth(&authinfo)
-			So(err, ShouldEqual, skydb.ErrUserNotFound)
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 5)
+			So(rows.Truncated, ShouldBeFalse)
 		})
 
-		Convey("deletes no users", func() {
-			err := c.DeleteAuth("notexistuserid")
-			So(err, ShouldEqual, skydb.ErrUserNotFound)
-		})
+		Convey("applies default limit to query ids without limit", func() {
+			query := skydb.Query{Type: "note"}
+			ids, err := db.QueryIDs(&query, &skydb.AccessControlOptions{})
 
-		Convey("gets no devices", func() {
-			device := skydb.Device{}
-			err := c.GetDevice("notexistdeviceid", &device)
-			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []skydb.RecordID{
+				skydb.NewRecordID("note", "id0"),
+				skydb.NewRecordID("note", "id1"),
+				skydb.NewRecordID("note", "id2"),
+			})
 		})
+	})
+}
 
-		Convey("deletes no devices", func() {
-			err := c.DeleteDevice("notexistdeviceid")
-			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
+func TestQueryUnion(t *testing.T) {
+	Convey("Database with notes and articles", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		updatedAt := func(minute int) time.Time {
+			return time.Date(2006, 1, 2, 15, minute, 0, 0, time.UTC)
+		}
+		records := []skydb.Record{
+			{
+				ID:        skydb.NewRecordID("note", "note1"),
+				OwnerID:   "user_id",
+				UpdatedAt: updatedAt(1),
+				Data:      map[string]interface{}{"content": "first note"},
+			},
+			{
+				ID:        skydb.NewRecordID("article", "article1"),
+				OwnerID:   "user_id",
+				UpdatedAt: updatedAt(2),
+				Data:      map[string]interface{}{"title": "first article"},
+			},
+			{
+				ID:        skydb.NewRecordID("article", "article2"),
+				OwnerID:   "user_id",
+				UpdatedAt: updatedAt(3),
+				Data:      map[string]interface{}{"title": "second article"},
+			},
+			{
+				ID:        skydb.NewRecordID("note", "note2"),
+				OwnerID:   "user_id",
+				UpdatedAt: updatedAt(4),
+				Data:      map[string]interface{}{"content": "second note"},
+			},
+		}
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend("article", skydb.RecordSchema{
+			"title": skydb.FieldType{Type: skydb.TypeString},
 		})
+		So(err, ShouldBeNil)
 
-		Convey("Empty Database", func() {
-			db := c.PublicDB()
+		for i := range records {
+			err = db.Save(&records[i])
+			So(err, ShouldBeNil)
+		}
 
-			Convey("gets nothing", func() {
-				record := skydb.Record{}
+		sortsByUpdatedAt := []skydb.Sort{
+			{
+				Expression: skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "_updated_at",
+				},
+				Order: skydb.Descending,
+			},
+		}
+		queries := []*skydb.Query{
+			{Type: "note", Sorts: sortsByUpdatedAt},
+			{Type: "article", Sorts: sortsByUpdatedAt},
+		}
+		accessControlOptions := skydb.AccessControlOptions{
+			BypassAccessControl: true,
+		}
 
-				err := db.Get(skydb.NewRecordID("type", "notexistid"), &record)
+		Convey("interleaves records of both types by updated at", func() {
+			results, err := exhaustRows(db.QueryUnion(queries, &accessControlOptions))
+			So(err, ShouldBeNil)
 
-				So(err, ShouldEqual, skydb.ErrRecordNotFound)
+			ids := []skydb.RecordID{}
+			for _, record := range results {
+				ids = append(ids, record.ID)
+			}
+			So(ids, ShouldResemble, []skydb.RecordID{
+				skydb.NewRecordID("note", "note2"),
+				skydb.NewRecordID("article", "article2"),
+				skydb.NewRecordID("article", "article1"),
+				skydb.NewRecordID("note", "note1"),
 			})
+			So(results[0].Data["content"], ShouldEqual, "second note")
+			So(results[1].Data["title"], ShouldEqual, "second article")
+		})
 
-			Convey("deletes nothing", func() {
-				err := db.Delete(skydb.NewRecordID("type", "notexistid"))
-				So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		Convey("interleaves records in a transaction", func() {
+			var results []skydb.Record
+			err := c.RunInTransaction(func(tx skydb.Conn) error {
+				var err error
+				results, err = exhaustRows(tx.PublicDB().QueryUnion(queries, &accessControlOptions))
+				return err
 			})
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 4)
+			So(results[0].ID, ShouldResemble, skydb.NewRecordID("note", "note2"))
+			So(results[3].ID, ShouldResemble, skydb.NewRecordID("note", "note1"))
+		})
 
-			Convey("queries nothing", func() {
-				query := skydb.Query{
-					Type: "notexisttype",
-				}
+		Convey("fetches records of each query a batch at a time", func() {
+			unionFetchSize = 1
+			defer func() {
+				unionFetchSize = 100
+			}()
 
-				accessControlOptions := skydb.AccessControlOptions{}
-				records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			results, err := exhaustRows(db.QueryUnion(queries, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 4)
+			So(results[0].ID, ShouldResemble, skydb.NewRecordID("note", "note2"))
+			So(results[1].ID, ShouldResemble, skydb.NewRecordID("article", "article2"))
+			So(results[2].ID, ShouldResemble, skydb.NewRecordID("article", "article1"))
+			So(results[3].ID, ShouldResemble, skydb.NewRecordID("note", "note1"))
+		})
 
-				So(err, ShouldBeNil)
-				So(records, ShouldBeEmpty)
+		Convey("orders strings of every query as bytes", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "Note3"),
+				OwnerID: "user_id",
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			results, err := exhaustRows(db.QueryUnion([]*skydb.Query{
+				{Type: "note"},
+				{Type: "article"},
+			}, &accessControlOptions))
+			So(err, ShouldBeNil)
+
+			ids := []skydb.RecordID{}
+			for _, record := range results {
+				ids = append(ids, record.ID)
+			}
+			So(ids, ShouldResemble, []skydb.RecordID{
+				skydb.NewRecordID("note", "Note3"),
+				skydb.NewRecordID("article", "article1"),
+				skydb.NewRecordID("article", "article2"),
+				skydb.NewRecordID("note", "note1"),
+				skydb.NewRecordID("note", "note2"),
 			})
 		})
+
+		Convey("rejects queries with different sorts", func() {
+			_, err := db.QueryUnion([]*skydb.Query{
+				{Type: "note", Sorts: sortsByUpdatedAt},
+				{Type: "article"},
+			}, &accessControlOptions)
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
 
-func TestQueryCount(t *testing.T) {
-	Convey("Database", t, func() {
+func TestQueryTypes(t *testing.T) {
+	Convey("Database with log types", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
 
-		// fixture
-		record1 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id1"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(1),
-				"content":   "Hello World",
-			},
+		db := c.PublicDB()
+		for _, recordType := range []string{"log_a", "log_b", "note"} {
+			_, err := db.Extend(recordType, skydb.RecordSchema{
+				"message": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
 		}
-		record2 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id2"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(2),
-				"content":   "Bye World",
+
+		records := []skydb.Record{
+			{
+				ID:      skydb.NewRecordID("log_a", "a1"),
+				OwnerID: "user_id",
+				Data:    map[string]interface{}{"message": "1 started"},
 			},
-		}
-		record3 := skydb.Record{
-			ID:      skydb.NewRecordID("note", "id3"),
-			OwnerID: "user_id",
-			Data: map[string]interface{}{
-				"noteOrder": float64(3),
-				"content":   "Good Hello",
+			{
+				ID:      skydb.NewRecordID("log_b", "b1"),
+				OwnerID: "user_id",
+				Data:    map[string]interface{}{"message": "2 received"},
+			},
+			{
+				ID:      skydb.NewRecordID("log_a", "a2"),
+				OwnerID: "user_id",
+				Data:    map[string]interface{}{"message": "3 stopped"},
+			},
+			{
+				ID:      skydb.NewRecordID("note", "note1"),
+				OwnerID: "user_id",
+				Data:    map[string]interface{}{"message": "0 not a log"},
 			},
 		}
+		for i := range records {
+			So(db.Save(&records[i]), ShouldBeNil)
+		}
 
-		db := c.PrivateDB("userid")
-		_, err := db.Extend("note", skydb.RecordSchema{
-			"noteOrder": skydb.FieldType{Type: skydb.TypeNumber},
-			"content":   skydb.FieldType{Type: skydb.TypeString},
-		})
-		So(err, ShouldBeNil)
+		sortsByMessage := []skydb.Sort{
+			{
+				Expression: skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "message",
+				},
+				Order: skydb.Ascending,
+			},
+		}
 
-		err = db.Save(&record2)
-		So(err, ShouldBeNil)
-		err = db.Save(&record1)
-		So(err, ShouldBeNil)
-		err = db.Save(&record3)
-		So(err, ShouldBeNil)
+		Convey("queries all types of the prefix", func() {
+			results, err := exhaustRows(db.QueryTypes("log_", &skydb.Query{
+				Sorts: sortsByMessage,
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
 
-		Convey("count records", func() {
-			query := skydb.Query{
-				Type: "note",
+			ids := []skydb.RecordID{}
+			for _, record := range results {
+				ids = append(ids, record.ID)
 			}
-			accessControlOptions := skydb.AccessControlOptions{}
-			count, err := db.QueryCount(&query, &accessControlOptions)
-
-			So(err, ShouldBeNil)
-			So(count, ShouldEqual, 3)
+			So(ids, ShouldResemble, []skydb.RecordID{
+				skydb.NewRecordID("log_a", "a1"),
+				skydb.NewRecordID("log_b", "b1"),
+				skydb.NewRecordID("log_a", "a2"),
+			})
 		})
 
-		Convey("count records by content matching", func() {
-			query := skydb.Query{
-				Type: "note",
+		Convey("applies the predicate to every type", func() {
+			results, err := exhaustRows(db.QueryTypes("log_", &skydb.Query{
 				Predicate: skydb.Predicate{
-					Operator: skydb.Like,
+					Operator: skydb.NotEqual,
 					Children: []interface{}{
-						skydb.Expression{
-							Type:  skydb.KeyPath,
-							Value: "content",
-						},
-						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: "Hello%",
-						},
+						skydb.Expression{Type: skydb.KeyPath, Value: "message"},
+						skydb.Expression{Type: skydb.Literal, Value: "2 received"},
 					},
 				},
-			}
-			accessControlOptions := skydb.AccessControlOptions{}
-			count, err := db.QueryCount(&query, &accessControlOptions)
-
+				Sorts: sortsByMessage,
+			}, &skydb.AccessControlOptions{}))
 			So(err, ShouldBeNil)
-			So(count, ShouldEqual, 1)
+			So(len(results), ShouldEqual, 2)
+			So(results[0].ID, ShouldResemble, skydb.NewRecordID("log_a", "a1"))
+			So(results[1].ID, ShouldResemble, skydb.NewRecordID("log_a", "a2"))
 		})
 
-		Convey("count records by content with none matching", func() {
-			query := skydb.Query{
-				Type: "note",
-				Predicate: skydb.Predicate{
-					Operator: skydb.Like,
-					Children: []interface{}{
-						skydb.Expression{
-							Type:  skydb.KeyPath,
-							Value: "content",
-						},
-						skydb.Expression{
-							Type:  skydb.Literal,
-							Value: "Not Exist",
-						},
-					},
-				},
+		Convey("applies access control to every type", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("log_b", "b2"),
+				OwnerID: "user_id",
+				ACL:     skydb.RecordACL{},
+				Data:    map[string]interface{}{"message": "4 private"},
 			}
-			accessControlOptions := skydb.AccessControlOptions{}
-			count, err := db.QueryCount(&query, &accessControlOptions)
+			So(db.Save(&record), ShouldBeNil)
 
+			results, err := exhaustRows(db.QueryTypes("log_", &skydb.Query{
+				Sorts: sortsByMessage,
+			}, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "another_user_id"},
+			}))
 			So(err, ShouldBeNil)
-			So(count, ShouldEqual, 0)
+			So(len(results), ShouldEqual, 3)
+
+			results, err = exhaustRows(db.QueryTypes("log_", &skydb.Query{
+				Sorts: sortsByMessage,
+			}, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user_id"},
+			}))
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 4)
+			So(results[3].ID, ShouldResemble, record.ID)
+		})
+
+		Convey("returns no records if no type matches", func() {
+			results, err := exhaustRows(db.QueryTypes("audit_", &skydb.Query{}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(results, ShouldBeEmpty)
+		})
+
+		Convey("rejects empty pattern", func() {
+			_, err := db.QueryTypes("", &skydb.Query{}, &skydb.AccessControlOptions{})
+			So(err, ShouldNotBeNil)
 		})
 	})
 }
@@ -1804,6 +4221,129 @@ func TestAggregateQuery(t *testing.T) {
 			So(recordCount, ShouldNotBeNil)
 			So(*recordCount, ShouldEqual, 2)
 		})
+
+		Convey("queries records with desired keys", func() {
+			for _, desiredKeys := range [][]string{nil, []string{}, []string{"category"}} {
+				query := skydb.Query{
+					Type:        "note",
+					Predicate:   equalCategoryPredicate("funny"),
+					DesiredKeys: desiredKeys,
+					GetCount:    true,
+				}
+				accessControlOptions := skydb.AccessControlOptions{}
+				rows, err := db.Query(&query, &accessControlOptions)
+				records, err := exhaustRows(rows, err)
+
+				So(err, ShouldBeNil)
+				So(len(records), ShouldEqual, 2)
+
+				recordCount := rows.OverallRecordCount()
+				So(recordCount, ShouldNotBeNil)
+				So(*recordCount, ShouldEqual, 2)
+			}
+		})
+
+		Convey("does not count records in subsequent query without count", func() {
+			query := skydb.Query{
+				Type:      "note",
+				Predicate: equalCategoryPredicate("funny"),
+				GetCount:  true,
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			_, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+
+			query.GetCount = false
+			rows, err := db.Query(&query, &accessControlOptions)
+			records, err := exhaustRows(rows, err)
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+			So(rows.OverallRecordCount(), ShouldBeNil)
+		})
+	})
+
+	Convey("Database with records created on different days", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"category": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		createdAts := []time.Time{
+			time.Date(2006, 1, 2, 9, 0, 0, 0, time.UTC),
+			time.Date(2006, 1, 2, 18, 30, 0, 0, time.UTC),
+			time.Date(2006, 1, 3, 8, 0, 0, 0, time.UTC),
+		}
+		for i, createdAt := range createdAts {
+			record := skydb.Record{
+				ID:        skydb.NewRecordID("note", fmt.Sprintf("id%d", i)),
+				OwnerID:   "user_id",
+				CreatedAt: createdAt,
+				UpdatedAt: createdAt,
+				Data: map[string]interface{}{
+					"category": "funny",
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+		}
+
+		Convey("groups records by day of creation", func() {
+			query := skydb.Query{
+				Type: "note",
+				ComputedKeys: map[string]skydb.Expression{
+					"day": skydb.Expression{
+						Type: skydb.Function,
+						Value: skydb.DateTruncFunc{
+							Field: "_created_at",
+							Unit:  "day",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+
+			counts := map[time.Time]int{}
+			for _, record := range records {
+				counts[record.Transient["day"].(time.Time)]++
+			}
+			So(counts, ShouldResemble, map[time.Time]int{
+				time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC): 2,
+				time.Date(2006, 1, 3, 0, 0, 0, 0, time.UTC): 1,
+			})
+		})
+
+		Convey("queries records created on a day", func() {
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type: skydb.Function,
+							Value: skydb.DateTruncFunc{
+								Field: "_created_at",
+								Unit:  "day",
+							},
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC),
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+		})
 	})
 }
 
@@ -1980,6 +4520,60 @@ func TestMetaDataQuery(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(records, ShouldResemble, []skydb.Record{record1})
 		})
+
+		Convey("queries by updater", func() {
+			record2 := skydb.Record{
+				ID:        skydb.NewRecordID("record", "2"),
+				OwnerID:   "ownerID1",
+				CreatedAt: time.Date(2006, 1, 2, 15, 4, 7, 0, time.UTC),
+				CreatorID: "creatorID1",
+				UpdatedAt: time.Date(2006, 1, 2, 15, 4, 7, 0, time.UTC),
+				UpdaterID: "updaterID0",
+				Data:      skydb.Data{},
+			}
+			So(db.Save(&record2), ShouldBeNil)
+
+			bypassAccessControl := skydb.AccessControlOptions{BypassAccessControl: true}
+			records, err := exhaustRows(db.QueryByUpdater("record", "updaterID0", &bypassAccessControl))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record2, record0})
+
+			records, err = exhaustRows(db.QueryByUpdater("record", "updaterID1", &bypassAccessControl))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record1})
+		})
+
+		Convey("queries by updater records readable by the user", func() {
+			record2 := skydb.Record{
+				ID:        skydb.NewRecordID("record", "2"),
+				OwnerID:   "ownerID1",
+				ACL:       skydb.RecordACL{},
+				CreatedAt: time.Date(2006, 1, 2, 15, 4, 7, 0, time.UTC),
+				CreatorID: "creatorID1",
+				UpdatedAt: time.Date(2006, 1, 2, 15, 4, 7, 0, time.UTC),
+				UpdaterID: "updaterID0",
+				Data:      skydb.Data{},
+			}
+			So(db.Save(&record2), ShouldBeNil)
+
+			records, err := exhaustRows(db.QueryByUpdater("record", "updaterID0", &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "updaterID0"},
+			}))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{record0})
+
+			records, err = exhaustRows(db.QueryByUpdater("record", "updaterID0", &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "ownerID1"},
+			}))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+		})
+
+		Convey("queries by updater of non-existent record type", func() {
+			records, err := exhaustRows(db.QueryByUpdater("notexist", "updaterID0", &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
 	})
 }
 
@@ -2228,6 +4822,409 @@ func TestUserRelationQuery(t *testing.T) {
 	})
 }
 
+func TestQueryByRelation(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		addUser(t, c, "user1")
+		addUser(t, c, "user2") // friend of user1
+		addUser(t, c, "user3") // friend of user1
+		addUser(t, c, "user4") // not related to user1
+		c.AddRelation("user1", "_friend", "user2")
+		c.AddRelation("user2", "_friend", "user1")
+		c.AddRelation("user1", "_friend", "user3")
+		c.AddRelation("user3", "_friend", "user1")
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		saveNote := func(key string, owner string, content string, day int) {
+			record := skydb.Record{
+				ID:        skydb.NewRecordID("note", key),
+				OwnerID:   owner,
+				UpdatedAt: time.Date(2017, 1, day, 0, 0, 0, 0, time.UTC),
+				Data: skydb.Data{
+					"content": content,
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+		}
+		saveNote("note1", "user2", "Hello", 1)
+		saveNote("note2", "user3", "Hello", 2)
+		saveNote("note3", "user2", "Bye", 3)
+		saveNote("note4", "user4", "Hello", 4)
+		saveNote("note5", "user1", "Hello", 5)
+
+		byUpdatedAt := []skydb.Sort{
+			{
+				Expression: skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "_updated_at",
+				},
+				Order: skydb.Descending,
+			},
+		}
+		recordKeys := func(records []skydb.Record) []string {
+			keys := []string{}
+			for _, record := range records {
+				keys = append(keys, record.ID.Key)
+			}
+			return keys
+		}
+
+		Convey("query notes of friends sorted by updated at", func() {
+			records, err := exhaustRows(db.QueryByRelation("note", "_friend", "mutual", "user1", &skydb.Query{
+				Sorts: byUpdatedAt,
+			}, &skydb.AccessControlOptions{BypassAccessControl: true}))
+
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note3", "note2", "note1"})
+		})
+
+		Convey("query notes of friends readable by the user", func() {
+			record := skydb.Record{
+				ID:        skydb.NewRecordID("note", "note6"),
+				OwnerID:   "user3",
+				ACL:       skydb.RecordACL{},
+				UpdatedAt: time.Date(2017, 1, 6, 0, 0, 0, 0, time.UTC),
+				Data: skydb.Data{
+					"content": "Secret",
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			records, err := exhaustRows(db.QueryByRelation("note", "_friend", "mutual", "user1", &skydb.Query{
+				Sorts: byUpdatedAt,
+			}, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user1"},
+			}))
+
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note3", "note2", "note1"})
+
+			records, err = exhaustRows(db.QueryByRelation("note", "_friend", "mutual", "user1", &skydb.Query{
+				Sorts: byUpdatedAt,
+			}, &skydb.AccessControlOptions{BypassAccessControl: true}))
+
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note6", "note3", "note2", "note1"})
+		})
+
+		Convey("query notes of friends with predicate and limit", func() {
+			limit := uint64(1)
+			records, err := exhaustRows(db.QueryByRelation("note", "_friend", "mutual", "user1", &skydb.Query{
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "content",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "Hello",
+						},
+					},
+				},
+				Sorts: byUpdatedAt,
+				Limit: &limit,
+			}, &skydb.AccessControlOptions{BypassAccessControl: true}))
+
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note2"})
+		})
+	})
+}
+
+func TestQueryAfterCursor(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		time1 := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		time2 := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+		for _, note := range []struct {
+			key       string
+			updatedAt time.Time
+		}{
+			{"note3", time1},
+			{"note1", time1},
+			{"note2", time1},
+			{"note0", time2},
+		} {
+			So(db.Save(&skydb.Record{
+				ID:        skydb.NewRecordID("note", note.key),
+				OwnerID:   "user1",
+				UpdatedAt: note.updatedAt,
+				Data: skydb.Data{
+					"content": note.key,
+				},
+			}), ShouldBeNil)
+		}
+
+		recordKeys := func(records []skydb.Record) []string {
+			keys := []string{}
+			for _, record := range records {
+				keys = append(keys, record.ID.Key)
+			}
+			return keys
+		}
+		bypassAccessControl := skydb.AccessControlOptions{BypassAccessControl: true}
+
+		Convey("starts from the first record with zero cursor", func() {
+			records, err := exhaustRows(db.QueryAfterCursor("note", time.Time{}, "", 2, &bypassAccessControl))
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note1", "note2"})
+		})
+
+		Convey("continues among records updated at the same time by id", func() {
+			records, err := exhaustRows(db.QueryAfterCursor("note", time1, "note2", 2, &bypassAccessControl))
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note3", "note0"})
+		})
+
+		Convey("returns no records after the last one", func() {
+			records, err := exhaustRows(db.QueryAfterCursor("note", time2, "note0", 2, &bypassAccessControl))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
+
+		Convey("skips records not readable by the user", func() {
+			So(db.Save(&skydb.Record{
+				ID:        skydb.NewRecordID("note", "note4"),
+				OwnerID:   "user1",
+				ACL:       skydb.RecordACL{},
+				UpdatedAt: time2,
+				Data: skydb.Data{
+					"content": "note4",
+				},
+			}), ShouldBeNil)
+
+			records, err := exhaustRows(db.QueryAfterCursor("note", time2, "note0", 2, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user2"},
+			}))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+
+			records, err = exhaustRows(db.QueryAfterCursor("note", time2, "note0", 2, &skydb.AccessControlOptions{
+				ViewAsUser: &skydb.AuthInfo{ID: "user1"},
+			}))
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note4"})
+		})
+	})
+}
+
+func TestQueryAfter(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"index": skydb.FieldType{Type: skydb.TypeNumber},
+		})
+		So(err, ShouldBeNil)
+
+		for i := 0; i < 10; i++ {
+			So(db.Save(&skydb.Record{
+				ID:        skydb.NewRecordID("note", fmt.Sprintf("note%d", i)),
+				OwnerID:   "user1",
+				CreatedAt: time.Date(2017, 1, 1+i, 0, 0, 0, 0, time.UTC),
+				Data: skydb.Data{
+					"index": float64(i),
+				},
+			}), ShouldBeNil)
+		}
+
+		limit := uint64(3)
+		byCreatedAt := []skydb.Sort{
+			{
+				Expression: skydb.Expression{
+					Type:  skydb.KeyPath,
+					Value: "_created_at",
+				},
+				Order: skydb.Descending,
+			},
+		}
+		recordKeys := func(records []skydb.Record) []string {
+			keys := []string{}
+			for _, record := range records {
+				keys = append(keys, record.ID.Key)
+			}
+			return keys
+		}
+
+		Convey("returns the same page as offset", func() {
+			offsetRecords, err := exhaustRows(db.Query(&skydb.Query{
+				Type:   "note",
+				Sorts:  byCreatedAt,
+				Limit:  &limit,
+				Offset: 4,
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+
+			keysetRecords, err := exhaustRows(db.Query(&skydb.Query{
+				Type:  "note",
+				Sorts: byCreatedAt,
+				Limit: &limit,
+				After: &skydb.QueryPosition{
+					SortValue: time.Date(2017, 1, 7, 0, 0, 0, 0, time.UTC),
+					ID:        "note6",
+				},
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+
+			So(recordKeys(keysetRecords), ShouldResemble, []string{"note5", "note4", "note3"})
+			So(keysetRecords, ShouldResemble, offsetRecords)
+		})
+
+		Convey("orders records of the same sort value by id", func() {
+			_, err := c.Exec(`UPDATE note SET _created_at = '2017-01-01'`)
+			So(err, ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:  "note",
+				Sorts: byCreatedAt,
+				Limit: &limit,
+				After: &skydb.QueryPosition{
+					SortValue: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+					ID:        "note6",
+				},
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note5", "note4", "note3"})
+		})
+
+		Convey("orders records of the same sort value by id on the first page", func() {
+			_, err := c.Exec(`UPDATE note SET _created_at = '2017-01-01'`)
+			So(err, ShouldBeNil)
+
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:  "note",
+				Sorts: byCreatedAt,
+				Limit: &limit,
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note9", "note8", "note7"})
+		})
+
+		Convey("pages by id without sort", func() {
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:  "note",
+				Limit: &limit,
+				After: &skydb.QueryPosition{ID: "note2"},
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(recordKeys(records), ShouldResemble, []string{"note3", "note4", "note5"})
+		})
+
+		Convey("returns no records past the end", func() {
+			records, err := exhaustRows(db.Query(&skydb.Query{
+				Type:  "note",
+				Sorts: byCreatedAt,
+				Limit: &limit,
+				After: &skydb.QueryPosition{
+					SortValue: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+					ID:        "note0",
+				},
+			}, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
+
+		Convey("rejects after with sort on other field", func() {
+			_, err := db.Query(&skydb.Query{
+				Type: "note",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "index",
+						},
+					},
+				},
+				After: &skydb.QueryPosition{SortValue: float64(1), ID: "note1"},
+			}, &skydb.AccessControlOptions{})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+}
+
+// BenchmarkQueryDeepPage compares reading a page deep into the records
+// by OFFSET with reading the same page after the last record of the
+// previous page.
+func BenchmarkQueryDeepPage(b *testing.B) {
+	c := getTestConn(b)
+	defer cleanupConn(b, c)
+
+	db := c.PublicDB()
+	if _, err := db.Extend("note", skydb.RecordSchema{
+		"content": skydb.FieldType{Type: skydb.TypeString},
+	}); err != nil {
+		b.Fatal(err)
+	}
+	_, err := c.Exec(`
+		INSERT INTO note (_id, _database_id, _owner_id, _created_at, _updated_at, content)
+		SELECT 'note' || i, '', 'user1', now(), now(), repeat('x', 500)
+		FROM generate_series(1, 50000) AS i`)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	limit := uint64(20)
+	offsetQuery := skydb.Query{
+		Type:   "note",
+		Limit:  &limit,
+		Offset: 45000,
+	}
+
+	// The last record of the previous page is where the keyset query
+	// continues from.
+	one := uint64(1)
+	previous, err := exhaustRows(db.Query(&skydb.Query{
+		Type:   "note",
+		Limit:  &one,
+		Offset: offsetQuery.Offset - 1,
+	}, &skydb.AccessControlOptions{}))
+	if err != nil || len(previous) != 1 {
+		b.Fatalf("failed to read the previous page: %v", err)
+	}
+	keysetQuery := skydb.Query{
+		Type:  "note",
+		Limit: &limit,
+		After: &skydb.QueryPosition{ID: previous[0].ID.Key},
+	}
+
+	for _, bm := range []struct {
+		name  string
+		query skydb.Query
+	}{
+		{"offset", offsetQuery},
+		{"keyset", keysetQuery},
+	} {
+		query := bm.query
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{})); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func TestUnsupportedQuery(t *testing.T) {
 	Convey("Database", t, func() {
 		c := getTestConn(t)
@@ -2271,7 +5268,55 @@ func TestUnsupportedQuery(t *testing.T) {
 				},
 			}
 			accessControlOptions := skydb.AccessControlOptions{}
-			So(func() { db.Query(&query, &accessControlOptions) }, ShouldPanicWith, builder.ErrCannotCompareUsingInOperator)
+			_, err := db.Query(&query, &accessControlOptions)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			So(err.(skyerr.Error).Message(), ShouldEqual, builder.ErrCannotCompareUsingInOperator.Error())
+		})
+
+		Convey("bogus operator", func() {
+			query := skydb.Query{
+				Type: "record",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Operator(999),
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "favoriteCategory",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: "fiction",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			_, err := db.Query(&query, &accessControlOptions)
+			So(err, ShouldResemble, skydb.ErrUnsupportedOperator{skydb.Operator(999)})
+		})
+
+		Convey("equal with one operand", func() {
+			query := skydb.Query{
+				Type: "record",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "favoriteCategory",
+						},
+					},
+				},
+			}
+			accessControlOptions := skydb.AccessControlOptions{}
+			_, err := db.Query(&query, &accessControlOptions)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+
+			_, err = db.QueryCount(&query, &accessControlOptions)
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
 		})
 	})
 }
@@ -2372,16 +5417,89 @@ func TestRecordJSON(t *testing.T) {
 						"string": "",
 						"bool":   false,
 					},
-				},
-			}
+				},
+			}
+
+			So(db.Save(&record), ShouldBeNil)
+
+			var jsonBytes []byte
+			err := c.QueryRowx(`SELECT jsonfield FROM note WHERE _id = '1' and _database_id = ''`).
+				Scan(&jsonBytes)
+			So(err, ShouldBeNil)
+			So(jsonBytes, ShouldEqualJSON, `{"number": 1, "string": "", "bool": false}`)
+		})
+
+		Convey("queries records by existence of json path", func() {
+			configs := map[string]interface{}{
+				"enabled": map[string]interface{}{
+					"feature": map[string]interface{}{"enabled": true},
+				},
+				"null": map[string]interface{}{
+					"feature": map[string]interface{}{"enabled": nil},
+				},
+				"other": map[string]interface{}{
+					"feature": map[string]interface{}{"beta": true},
+				},
+				"scalar": map[string]interface{}{
+					"feature": "enabled",
+				},
+			}
+			for id, config := range configs {
+				record := skydb.Record{
+					ID:      skydb.NewRecordID("note", id),
+					OwnerID: "user_id",
+					Data: map[string]interface{}{
+						"jsonfield": config,
+					},
+				}
+				So(db.Save(&record), ShouldBeNil)
+			}
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("note", "none"),
+				OwnerID: "user_id",
+			}), ShouldBeNil)
+
+			queryIDs := func(path string) []string {
+				query := skydb.Query{
+					Type: "note",
+					Predicate: skydb.Predicate{
+						Operator: skydb.JSONHasPath,
+						Children: []interface{}{
+							skydb.Expression{
+								Type:  skydb.KeyPath,
+								Value: "jsonfield",
+							},
+							skydb.Expression{
+								Type:  skydb.Literal,
+								Value: path,
+							},
+						},
+					},
+					Sorts: []skydb.Sort{
+						{
+							Expression: skydb.Expression{
+								Type:  skydb.KeyPath,
+								Value: "_id",
+							},
+							Order: skydb.Ascending,
+						},
+					},
+				}
+				records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{
+					BypassAccessControl: true,
+				}))
+				So(err, ShouldBeNil)
 
-			So(db.Save(&record), ShouldBeNil)
+				ids := []string{}
+				for _, record := range records {
+					ids = append(ids, record.ID.Key)
+				}
+				return ids
+			}
 
-			var jsonBytes []byte
-			err := c.QueryRowx(`SELECT jsonfield FROM note WHERE _id = '1' and _database_id = ''`).
-				Scan(&jsonBytes)
-			So(err, ShouldBeNil)
-			So(jsonBytes, ShouldEqualJSON, `{"number": 1, "string": "", "bool": false}`)
+			So(queryIDs("feature.enabled"), ShouldResemble, []string{"enabled", "null"})
+			So(queryIDs("feature"), ShouldResemble, []string{"enabled", "null", "other", "scalar"})
+			So(queryIDs("feature.missing"), ShouldBeEmpty)
 		})
 	})
 }
@@ -2422,7 +5540,26 @@ func TestRecordAssetField(t *testing.T) {
 				},
 				OwnerID: "user_id",
 			})
-			So(err, ShouldNotBeNil)
+			So(err, ShouldResemble, skydb.ErrAssetNotFound{AssetName: "notexist.png"})
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.ResourceNotFound)
+			So(err.(skyerr.Error).Info(), ShouldResemble, map[string]interface{}{
+				"name": "notexist.png",
+			})
+		})
+
+		Convey("errors when patched with non-existing asset", func() {
+			So(db.Save(&skydb.Record{
+				ID: skydb.NewRecordID("note", "id"),
+				Data: map[string]interface{}{
+					"image": &skydb.Asset{Name: "picture.png"},
+				},
+				OwnerID: "user_id",
+			}), ShouldBeNil)
+
+			err := db.Patch(skydb.NewRecordID("note", "id"), "user_id", map[string]interface{}{
+				"image": &skydb.Asset{Name: "notexist.png"},
+			})
+			So(err, ShouldResemble, skydb.ErrAssetNotFound{AssetName: "notexist.png"})
 		})
 
 		Convey("REGRESSION #229: can be fetched", func() {
@@ -2448,6 +5585,217 @@ func TestRecordAssetField(t *testing.T) {
 	})
 }
 
+func TestRecordAssetListField(t *testing.T) {
+	Convey("Record Asset List", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		for _, name := range []string{"picture1.png", "picture2.png", "picture3.png"} {
+			So(c.SaveAsset(&skydb.Asset{
+				Name:        name,
+				ContentType: "image/png",
+				Size:        1,
+			}), ShouldBeNil)
+		}
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"gallery": skydb.FieldType{Type: skydb.TypeAssetList},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("can be saved and fetched in order", func() {
+			gallery := []*skydb.Asset{
+				&skydb.Asset{Name: "picture3.png"},
+				&skydb.Asset{Name: "picture1.png"},
+				&skydb.Asset{Name: "picture2.png"},
+			}
+			So(db.Save(&skydb.Record{
+				ID: skydb.NewRecordID("note", "id"),
+				Data: map[string]interface{}{
+					"gallery": gallery,
+				},
+				OwnerID: "user_id",
+			}), ShouldBeNil)
+
+			var record skydb.Record
+			err := db.Get(skydb.NewRecordID("note", "id"), &record)
+			So(err, ShouldBeNil)
+			So(record.Data["gallery"], ShouldResemble, gallery)
+		})
+
+		Convey("is reported as asset list in schema", func() {
+			typemap, err := db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(typemap["gallery"].Type, ShouldEqual, skydb.TypeAssetList)
+		})
+
+		Convey("does not report string array column created by developer as asset list", func() {
+			_, err := c.Exec(`ALTER TABLE "note" ADD "keywords" text[]`)
+			So(err, ShouldBeNil)
+			delete(c.RecordSchema, "note")
+
+			typemap, err := db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(typemap["keywords"].Type, ShouldEqual, skydb.TypeUnknown)
+		})
+
+		Convey("errors when containing non-existing asset", func() {
+			err := db.Save(&skydb.Record{
+				ID: skydb.NewRecordID("note", "id"),
+				Data: map[string]interface{}{
+					"gallery": []*skydb.Asset{
+						&skydb.Asset{Name: "picture1.png"},
+						&skydb.Asset{Name: "notexist.png"},
+						&skydb.Asset{Name: "picture2.png"},
+					},
+				},
+				OwnerID: "user_id",
+			})
+			So(err, ShouldResemble, skydb.ErrAssetNotFound{AssetName: "notexist.png"})
+
+			var record skydb.Record
+			err = db.Get(skydb.NewRecordID("note", "id"), &record)
+			So(err, ShouldEqual, skydb.ErrRecordNotFound)
+		})
+	})
+}
+
+func TestRecordDateTimeTZField(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("event", skydb.RecordSchema{
+			"startsAt": skydb.FieldType{Type: skydb.TypeDateTimeTZ},
+		})
+		So(err, ShouldBeNil)
+
+		hongKong := time.FixedZone("HKT", 8*60*60)
+		startsAt := time.Date(2017, 7, 1, 9, 30, 0, 0, hongKong)
+		event := skydb.Record{
+			ID:      skydb.NewRecordID("event", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"startsAt": startsAt,
+			},
+		}
+		So(db.Save(&event), ShouldBeNil)
+
+		Convey("returns time in UTC by default", func() {
+			record := skydb.Record{}
+			So(db.Get(event.ID, &record), ShouldBeNil)
+			So(record.Data["startsAt"], ShouldResemble, time.Date(2017, 7, 1, 1, 30, 0, 0, time.UTC))
+		})
+
+		Convey("returns time in time zone of query", func() {
+			query := skydb.Query{
+				Type:     "event",
+				TimeZone: hongKong,
+			}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{}))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+
+			returned := records[0].Data["startsAt"].(time.Time)
+			So(returned.Equal(startsAt), ShouldBeTrue)
+			So(returned.Location(), ShouldEqual, hongKong)
+			_, offset := returned.Zone()
+			So(offset, ShouldEqual, 8*60*60)
+			So(returned.Hour(), ShouldEqual, 9)
+		})
+
+		Convey("reports the field type with time zone", func() {
+			typemap, err := db.RemoteColumnTypes("event")
+			So(err, ShouldBeNil)
+			So(typemap["startsAt"].Type, ShouldEqual, skydb.TypeDateTimeTZ)
+		})
+	})
+}
+
+func TestRecordBooleanField(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PrivateDB("userid")
+		_, err := db.Extend("todo", skydb.RecordSchema{
+			"done": skydb.FieldType{Type: skydb.TypeBoolean},
+		})
+		So(err, ShouldBeNil)
+
+		todo1 := skydb.Record{
+			ID:      skydb.NewRecordID("todo", "id1"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"done": true,
+			},
+		}
+		todo2 := skydb.Record{
+			ID:      skydb.NewRecordID("todo", "id2"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"done": false,
+			},
+		}
+		todo3 := skydb.Record{
+			ID:      skydb.NewRecordID("todo", "id3"),
+			OwnerID: "user_id",
+			Data: map[string]interface{}{
+				"done": nil,
+			},
+		}
+		So(db.Save(&todo1), ShouldBeNil)
+		So(db.Save(&todo2), ShouldBeNil)
+		So(db.Save(&todo3), ShouldBeNil)
+
+		accessControlOptions := skydb.AccessControlOptions{}
+
+		Convey("queries records by true value", func() {
+			query := skydb.Query{
+				Type:      "todo",
+				Predicate: skydb.IsTrue("done"),
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{todo1})
+		})
+
+		Convey("queries records by false value", func() {
+			query := skydb.Query{
+				Type:      "todo",
+				Predicate: skydb.IsFalse("done"),
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{todo2})
+		})
+
+		Convey("queries records by equal to bool literal", func() {
+			query := skydb.Query{
+				Type: "todo",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "done",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: true,
+						},
+					},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &accessControlOptions))
+			So(err, ShouldBeNil)
+			So(records, ShouldResemble, []skydb.Record{todo1})
+		})
+	})
+}
+
 func TestRecordLocationField(t *testing.T) {
 	Convey("Database", t, func() {
 		c := getTestConn(t)
@@ -2564,6 +5912,158 @@ func TestRecordSequenceField(t *testing.T) {
 	})
 }
 
+func TestRecordStringFieldCoercion(t *testing.T) {
+	Convey("Database coercing string fields", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		c.coerceStringFields = true
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"code": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("accepts number for string field in schema", func() {
+			extended, err := db.Extend("note", skydb.RecordSchema{
+				"code": skydb.FieldType{Type: skydb.TypeNumber},
+			})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeFalse)
+		})
+
+		Convey("saves number into string field and queries it", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("note", "id1"),
+				OwnerID: "user_id",
+				Data: map[string]interface{}{
+					"code": float64(42),
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+			So(record.Data["code"], ShouldEqual, "42")
+
+			var code string
+			err := c.QueryRowx(`SELECT code FROM note WHERE _id = 'id1' AND _database_id = ''`).
+				Scan(&code)
+			So(err, ShouldBeNil)
+			So(code, ShouldEqual, "42")
+
+			query := skydb.Query{
+				Type: "note",
+				Predicate: skydb.Predicate{
+					Operator: skydb.Equal,
+					Children: []interface{}{
+						skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "code",
+						},
+						skydb.Expression{
+							Type:  skydb.Literal,
+							Value: float64(42),
+						},
+					},
+				},
+			}
+			records, err := exhaustRows(db.Query(&query, &skydb.AccessControlOptions{
+				BypassAccessControl: true,
+			}))
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 1)
+			So(records[0].ID, ShouldResemble, skydb.NewRecordID("note", "id1"))
+		})
+	})
+
+	Convey("Database not coercing string fields", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"code": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("rejects number for string field in schema", func() {
+			_, err := db.Extend("note", skydb.RecordSchema{
+				"code": skydb.FieldType{Type: skydb.TypeNumber},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRecordScanError(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"amount": skydb.FieldType{Type: skydb.TypeNumber},
+		})
+		So(err, ShouldBeNil)
+
+		// The cached schema still says amount is a number, so values
+		// that cannot be parsed as number fails to scan.
+		_, err = c.Exec(`ALTER TABLE "note" ALTER COLUMN "amount" TYPE text;`)
+		So(err, ShouldBeNil)
+		insertRow(t, c.Db(), `INSERT INTO "note" `+
+			`(_database_id, _id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "amount") `+
+			`VALUES ('', 'id0', 'user0', '1988-02-06', 'user0', '1988-02-06', 'user0', 'not a number')`)
+		insertRow(t, c.Db(), `INSERT INTO "note" `+
+			`(_database_id, _id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, "amount") `+
+			`VALUES ('', 'id1', 'user0', '1988-02-06', 'user0', '1988-02-06', 'user0', '1')`)
+
+		Convey("query reports the offending record and column", func() {
+			query := skydb.Query{
+				Type: "note",
+				Sorts: []skydb.Sort{
+					{
+						Expression: skydb.Expression{
+							Type:  skydb.KeyPath,
+							Value: "_id",
+						},
+						Order: skydb.Ascending,
+					},
+				},
+			}
+			rows, err := db.Query(&query, &skydb.AccessControlOptions{
+				BypassAccessControl: true,
+			})
+			So(err, ShouldBeNil)
+			defer rows.Close()
+
+			So(rows.Scan(), ShouldBeFalse)
+			scanErr, ok := rows.Err().(*skydb.RowScanError)
+			So(ok, ShouldBeTrue)
+			So(scanErr.RecordID, ShouldResemble, skydb.NewRecordID("note", "id0"))
+			So(scanErr.Column, ShouldEqual, "amount")
+			So(scanErr.Error(), ShouldContainSubstring, `column "amount" of record note/id0`)
+
+			So(rows.Scan(), ShouldBeTrue)
+			So(rows.Record().ID, ShouldResemble, skydb.NewRecordID("note", "id1"))
+			So(rows.Record().Data["amount"], ShouldEqual, float64(1))
+
+			So(rows.Scan(), ShouldBeFalse)
+			So(rows.Err(), ShouldBeNil)
+		})
+
+		Convey("query read in advance returns the scan error", func() {
+			c.defaultQueryLimit = 10
+			defer func() { c.defaultQueryLimit = 0 }()
+
+			query := skydb.Query{Type: "note"}
+			_, err := db.Query(&query, &skydb.AccessControlOptions{
+				BypassAccessControl: true,
+			})
+			scanErr, ok := err.(*skydb.RowScanError)
+			So(ok, ShouldBeTrue)
+			So(scanErr.RecordID, ShouldResemble, skydb.NewRecordID("note", "id0"))
+		})
+	})
+}
+
 func TestRecordUnknownField(t *testing.T) {
 	Convey("Database", t, func() {
 		c := getTestConn(t)
@@ -105,9 +105,11 @@ func (c *conn) AddRelation(user string, name string, targetUser string) error {
 		if isForeignKeyViolated(err) {
 			return fmt.Errorf("userID not exist")
 		}
+		return err
 	}
 
-	return err
+	c.invalidateQueryCache(name)
+	return nil
 }
 
 func (c *conn) RemoveRelation(user string, name string, targetUser string) error {
@@ -128,5 +130,27 @@ func (c *conn) RemoveRelation(user string, name string, targetUser string) error
 	} else if rowsAffected > 1 {
 		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
 	}
+	c.invalidateQueryCache(name)
 	return nil
 }
+
+func (c *conn) RemoveRelations(user string, name string, targetUsers []string) (int, error) {
+	if len(targetUsers) == 0 {
+		return 0, nil
+	}
+
+	builder := psql.Delete(c.tableName(name)).
+		Where("left_id = ?", user).
+		Where(sq.Eq{"right_id": targetUsers})
+	result, err := c.ExecWith(builder)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	c.invalidateQueryCache(name)
+	return int(rowsAffected), nil
+}
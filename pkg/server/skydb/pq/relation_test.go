@@ -53,6 +53,37 @@ func TestRelation(t *testing.T) {
 			err = c.RemoveRelation("userid", "_friend", "friendid")
 			So(err, ShouldBeNil)
 		})
+
+		Convey("remove relations", func() {
+			addUser(t, c, "friendid2")
+			addUser(t, c, "strangerid")
+			So(c.AddRelation("userid", "_friend", "friendid"), ShouldBeNil)
+			So(c.AddRelation("userid", "_friend", "friendid2"), ShouldBeNil)
+			So(c.AddRelation("friendid", "_friend", "userid"), ShouldBeNil)
+
+			removed, err := c.RemoveRelations("userid", "_friend", []string{
+				"friendid",
+				"friendid2",
+				"strangerid",
+			})
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 2)
+
+			count, err := c.QueryRelationCount("userid", "_friend", "outward")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+			count, err = c.QueryRelationCount("friendid", "_friend", "outward")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
+		Convey("remove relations to no users", func() {
+			So(c.AddRelation("userid", "_friend", "friendid"), ShouldBeNil)
+
+			removed, err := c.RemoveRelations("userid", "_friend", []string{})
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 0)
+		})
 	})
 
 	Convey("Conn Query", t, func() {
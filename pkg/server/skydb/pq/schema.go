@@ -17,7 +17,9 @@ package pq
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -25,7 +27,9 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	"github.com/skygeario/skygear-server/pkg/server/uuid"
 )
 
 func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (extended bool, err error) {
@@ -34,19 +38,13 @@ func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (
 		return
 	}
 
-	if len(remoteRecordSchema) > 0 && remoteRecordSchema.DefinitionCompatibleTo(recordSchema) {
+	if len(remoteRecordSchema) > 0 && db.schemaCompatible(remoteRecordSchema, recordSchema) {
 		// The current record schema is superset of requested record
 		// schema. There is no need to extend the schema.
 		return
 	}
 
-	if !db.c.canMigrate {
-		// The record schemas are different, but the database connection
-		// does not allow migration.
-		err = skyerr.NewError(
-			skyerr.IncompatibleSchema,
-			"Record schema requires migration but migration is disabled.",
-		)
+	if err = db.checkCanMigrate(); err != nil {
 		return
 	}
 
@@ -57,6 +55,12 @@ func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (
 	}
 	defer tx.Rollback()
 
+	cachedRecordSchema := remoteRecordSchema
+	remoteRecordSchema, err = db.lockSchema(tx, recordType)
+	if err != nil {
+		return false, err
+	}
+
 	if len(remoteRecordSchema) == 0 {
 		if err := createTable(tx, db.TableName(recordType)); err != nil {
 			return false, fmt.Errorf("failed to create table: %s", err)
@@ -64,39 +68,276 @@ func (db *database) Extend(recordType string, recordSchema skydb.RecordSchema) (
 		extended = true
 	}
 
+	added, err := db.addColumns(tx, recordType, cachedRecordSchema, remoteRecordSchema, recordSchema)
+	if err != nil {
+		return false, err
+	}
+	extended = extended || added
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("unable to commit transaction for Extend: %s", err)
+	}
+
+	delete(db.c.RecordSchema, recordType)
+
+	return
+}
+
+func (db *database) ExtendWithOptions(recordType string, recordSchema skydb.RecordSchema, options skydb.ExtendOptions) (extended bool, err error) {
+	if extended, err = db.Extend(recordType, recordSchema); err != nil {
+		return
+	}
+
+	upsert := builder.UpsertQuery(db.c.tableName("_record_type_option"), map[string]interface{}{
+		"record_type": recordType,
+	}, map[string]interface{}{
+		"preserve_updated_at": options.PreserveUpdatedAt,
+	})
+	if _, err = db.c.ExecWith(upsert); err != nil {
+		return false, err
+	}
+
+	delete(db.c.recordTypeOptions, recordType)
+	return
+}
+
+// getExtendOptions returns the options of the record type, which are
+// the zero value if the record type is extended without options.
+func (db *database) getExtendOptions(recordType string) (skydb.ExtendOptions, error) {
+	if options, ok := db.c.recordTypeOptions[recordType]; ok {
+		return options, nil
+	}
+
+	options := skydb.ExtendOptions{}
+	query := psql.Select("preserve_updated_at").
+		From(db.c.tableName("_record_type_option")).
+		Where("record_type = ?", recordType)
+	err := db.c.QueryRowWith(query).Scan(&options.PreserveUpdatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return options, err
+	}
+
+	if db.c.recordTypeOptions == nil {
+		db.c.recordTypeOptions = map[string]skydb.ExtendOptions{}
+	}
+	db.c.recordTypeOptions[recordType] = options
+	return options, nil
+}
+
+// ExtendMany creates the tables of all record types before adding
+// columns to any of them, so that reference columns can be added
+// regardless of which record types reference which.
+func (db *database) ExtendMany(schemas map[string]skydb.RecordSchema) error {
+	recordTypes := make([]string, 0, len(schemas))
+	remoteRecordSchemas := map[string]skydb.RecordSchema{}
+	needMigration := false
+	for recordType, recordSchema := range schemas {
+		remoteRecordSchema, err := db.RemoteColumnTypes(recordType)
+		if err != nil {
+			return err
+		}
+
+		recordTypes = append(recordTypes, recordType)
+		remoteRecordSchemas[recordType] = remoteRecordSchema
+		if len(remoteRecordSchema) == 0 || !db.schemaCompatible(remoteRecordSchema, recordSchema) {
+			needMigration = true
+		}
+	}
+	sort.Strings(recordTypes)
+
+	if !needMigration {
+		return nil
+	}
+
+	if err := db.checkCanMigrate(); err != nil {
+		return err
+	}
+
+	tx, err := db.c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locks are acquired in the order of record types so that concurrent
+	// calls do not deadlock.
+	cachedRecordSchemas := remoteRecordSchemas
+	remoteRecordSchemas = map[string]skydb.RecordSchema{}
+	for _, recordType := range recordTypes {
+		remoteRecordSchema, err := db.lockSchema(tx, recordType)
+		if err != nil {
+			return err
+		}
+		remoteRecordSchemas[recordType] = remoteRecordSchema
+	}
+
+	for _, recordType := range recordTypes {
+		if len(remoteRecordSchemas[recordType]) == 0 {
+			if err := createTable(tx, db.TableName(recordType)); err != nil {
+				return fmt.Errorf("failed to create table: %s", err)
+			}
+		}
+	}
+
+	for _, recordType := range recordTypes {
+		_, err := db.addColumns(tx, recordType, cachedRecordSchemas[recordType], remoteRecordSchemas[recordType], schemas[recordType])
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to commit transaction for ExtendMany: %s", err)
+	}
+
+	for _, recordType := range recordTypes {
+		delete(db.c.RecordSchema, recordType)
+	}
+
+	return nil
+}
+
+func (db *database) checkCanMigrate() error {
+	if !db.c.canMigrate {
+		// The record schemas are different, but the database connection
+		// does not allow migration.
+		return skyerr.NewError(
+			skyerr.IncompatibleSchema,
+			"Record schema requires migration but migration is disabled.",
+		)
+	}
+	return nil
+}
+
+// lockSchema acquires a lock on the schema of the record type, which is
+// held until the transaction ends, so that concurrent migrations of the
+// record type are serialized. It returns the schema read after the lock
+// is acquired, since the cached one might have been changed by others.
+func (db *database) lockSchema(tx *sqlx.Tx, recordType string) (skydb.RecordSchema, error) {
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, db.TableName(recordType)); err != nil {
+		return nil, fmt.Errorf("failed to lock schema: %s", err)
+	}
+
+	delete(db.c.RecordSchema, recordType)
+	return db.RemoteColumnTypes(recordType)
+}
+
+// addColumns adds the fields in recordSchema that are not in
+// remoteRecordSchema to the table of the record type. It returns
+// whether any column is added.
+//
+// cachedRecordSchema is the schema known before remoteRecordSchema is
+// read, so that a field added by others in between can be told apart.
+func (db *database) addColumns(tx *sqlx.Tx, recordType string, cachedRecordSchema, remoteRecordSchema, recordSchema skydb.RecordSchema) (bool, error) {
 	// Find new columns
 	updatingSchema := skydb.RecordSchema{}
 	for key, fieldType := range recordSchema {
-		if remoteFieldType, ok := remoteRecordSchema[key]; ok {
-			if !remoteFieldType.DefinitionCompatibleTo(fieldType) {
-				return false, skyerr.NewError(
-					skyerr.IncompatibleSchema,
-					fmt.Sprintf("conflicting schema %v => %v", remoteFieldType, fieldType),
-				)
-			}
-		} else {
+		remoteFieldType, ok := remoteRecordSchema[key]
+		if !ok {
 			updatingSchema[key] = fieldType
+			continue
+		}
+		if db.fieldTypeCompatible(remoteFieldType, fieldType) {
+			continue
+		}
+
+		if _, ok := cachedRecordSchema[key]; !ok {
+			return false, skydb.NewSchemaError(
+				skydb.SchemaFieldDuplicated, recordType, key,
+				fmt.Sprintf(`field "%s" already exists`, key),
+			)
+		}
+		return false, skydb.NewSchemaError(
+			skydb.SchemaTypeConflict, recordType, key,
+			fmt.Sprintf("conflicting schema %v => %v", remoteFieldType, fieldType),
+		)
+	}
+
+	if len(updatingSchema) == 0 {
+		return false, nil
+	}
+
+	for key, fieldType := range updatingSchema {
+		if fieldType.Type != skydb.TypeEnum {
+			continue
+		}
+		typeName, err := db.createEnumType(tx, fieldType.EnumValues)
+		if err != nil {
+			return false, fmt.Errorf("failed to create enum type: %s", err)
 		}
+		fieldType.UnderlyingType = typeName
+		updatingSchema[key] = fieldType
 	}
 
-	if len(updatingSchema) > 0 {
-		stmt := db.addColumnStmt(recordType, updatingSchema)
+	stmt := db.addColumnStmt(recordType, updatingSchema)
 
-		log.WithField("stmt", stmt).Debugln("Adding columns to table")
+	log.WithField("stmt", stmt).Debugln("Adding columns to table")
+	if _, err := tx.Exec(stmt); err != nil {
+		if isUndefinedTable(err) {
+			key, referenceType := missingReferenceTarget(err, updatingSchema)
+			return false, skydb.NewSchemaError(
+				skydb.SchemaReferenceTargetMissing, recordType, key,
+				fmt.Sprintf(`referenced record type "%s" does not exist`, referenceType),
+			)
+		}
+		return false, fmt.Errorf("failed to alter table: %s", err)
+	}
+
+	for column, fieldType := range updatingSchema {
+		comment := columnComment(fieldType)
+		if comment == "" {
+			continue
+		}
+		stmt := fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s",
+			db.TableName(recordType), pq.QuoteIdentifier(column), builder.QuoteLiteral(comment))
 		if _, err := tx.Exec(stmt); err != nil {
-			return false, fmt.Errorf("failed to alter table: %s", err)
+			return false, fmt.Errorf("failed to comment on column: %s", err)
 		}
+	}
 
-		extended = true
+	return true, nil
+}
+
+// The comment on a column marks the field type that cannot be told
+// from the data type of the column alone, since the same data type
+// might be used by columns created by the developer.
+const (
+	encryptedColumnComment = "skygear:encrypted"
+	assetListColumnComment = "skygear:asset_list"
+)
+
+// columnComment returns the comment marking the column of the field
+// type, or an empty string if the column needs no marking.
+func columnComment(fieldType skydb.FieldType) string {
+	if fieldType.Encrypted {
+		return encryptedColumnComment
+	}
+	if fieldType.Type == skydb.TypeAssetList {
+		return assetListColumnComment
 	}
+	return ""
+}
 
-	if err = tx.Commit(); err != nil {
-		return false, fmt.Errorf("unable to commit transaction for Extend: %s", err)
+// createEnumType creates a Postgres enum type of the values for a
+// column of TypeEnum and returns its name. The name is not derived
+// from the column so that the column can be renamed freely.
+func (db *database) createEnumType(tx *sqlx.Tx, values []string) (string, error) {
+	if len(values) == 0 {
+		return "", errors.New("enum has no values")
 	}
 
-	delete(db.c.RecordSchema, recordType)
+	quotedValues := make([]string, len(values))
+	for i, value := range values {
+		quotedValues[i] = builder.QuoteLiteral(value)
+	}
 
-	return
+	typeName := db.TableName("_enum_" + uuid.New())
+	stmt := fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", typeName, strings.Join(quotedValues, ", "))
+	log.WithField("stmt", stmt).Debugln("Creating enum type")
+	if _, err := tx.Exec(stmt); err != nil {
+		return "", err
+	}
+	return typeName, nil
 }
 
 func (db *database) RenameSchema(recordType, oldName, newName string) error {
@@ -124,13 +365,24 @@ func (db *database) DeleteSchema(recordType, columnName string) error {
 		return skyerr.NewError(skyerr.IncompatibleSchema, "Record schema requires migration but migration is disabled.")
 	}
 
-	tableName := db.TableName(recordType)
-	columnName = pq.QuoteIdentifier(columnName)
+	remoteRecordSchema, err := db.RemoteColumnTypes(recordType)
+	if err != nil {
+		return err
+	}
+	fieldType := remoteRecordSchema[columnName]
 
-	stmt := fmt.Sprintf("ALTER TABLE %s DROP %s", tableName, columnName)
+	tableName := db.TableName(recordType)
+	stmt := fmt.Sprintf("ALTER TABLE %s DROP %s", tableName, pq.QuoteIdentifier(columnName))
 	if _, err := db.c.Exec(stmt); err != nil {
 		return fmt.Errorf("failed to alter table: %s", err)
 	}
+
+	// The enum type is used by no other column.
+	if fieldType.Type == skydb.TypeEnum {
+		if _, err := db.c.Exec(fmt.Sprintf("DROP TYPE %s", fieldType.UnderlyingType)); err != nil {
+			return fmt.Errorf("failed to drop enum type: %s", err)
+		}
+	}
 	return nil
 }
 
@@ -142,6 +394,19 @@ func (db *database) GetSchema(recordType string) (skydb.RecordSchema, error) {
 	return remoteRecordSchema, nil
 }
 
+func (db *database) CheckSchema(expected map[string]skydb.RecordSchema) ([]skydb.SchemaDiff, error) {
+	actual := map[string]skydb.RecordSchema{}
+	for recordType := range expected {
+		schema, err := db.RemoteColumnTypes(recordType)
+		if err != nil {
+			return nil, err
+		}
+		actual[recordType] = schema
+	}
+
+	return skydb.DiffSchemas(expected, actual), nil
+}
+
 func (db *database) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
 	schemaName := db.schemaName()
 
@@ -174,6 +439,127 @@ func (db *database) GetRecordSchemas() (map[string]skydb.RecordSchema, error) {
 	return result, nil
 }
 
+func (db *database) TypeStats() (map[string]int64, error) {
+	if db.c.exactTypeStats {
+		return db.exactTypeStats()
+	}
+
+	// reltuples is the row count estimated by the last VACUUM or
+	// ANALYZE, and is negative for tables never analyzed.
+	rows, err := db.c.Queryx(`
+	SELECT c.relname, GREATEST(c.reltuples, 0)::bigint
+	FROM pg_catalog.pg_class c
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind = 'r' AND (c.relname NOT LIKE '\_%') AND n.nspname = $1
+	`, db.schemaName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTypeStats(rows)
+}
+
+func (db *database) exactTypeStats() (map[string]int64, error) {
+	recordTypes, err := db.recordTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recordTypes) == 0 {
+		return map[string]int64{}, nil
+	}
+
+	selects := make([]string, len(recordTypes))
+	args := make([]interface{}, len(recordTypes))
+	for i, recordType := range recordTypes {
+		selects[i] = fmt.Sprintf("SELECT $%d::text, COUNT(*) FROM %s", i+1, db.TableName(recordType))
+		args[i] = recordType
+	}
+
+	rows, err := db.c.Queryx(strings.Join(selects, " UNION ALL "), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanTypeStats(rows)
+}
+
+// recordTypes returns the names of all record tables.
+func (db *database) recordTypes() ([]string, error) {
+	rows, err := db.c.Queryx(`
+	SELECT c.relname
+	FROM pg_catalog.pg_class c
+	JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind = 'r' AND (c.relname NOT LIKE '\_%') AND n.nspname = $1
+	`, db.schemaName())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recordTypes := []string{}
+	for rows.Next() {
+		var recordType string
+		if err := rows.Scan(&recordType); err != nil {
+			return nil, err
+		}
+		recordTypes = append(recordTypes, recordType)
+	}
+	return recordTypes, rows.Err()
+}
+
+func (db *database) AnalyzeType(recordType string) error {
+	if err := db.checkRecordTypeExists(recordType); err != nil {
+		return err
+	}
+
+	_, err := db.c.Exec("ANALYZE " + db.TableName(recordType))
+	return err
+}
+
+func (db *database) VacuumType(recordType string) error {
+	if db.c.tx != nil {
+		// VACUUM cannot run inside a transaction block
+		return skydb.ErrDatabaseTxDidBegin
+	}
+
+	if err := db.checkRecordTypeExists(recordType); err != nil {
+		return err
+	}
+
+	_, err := db.c.Exec("VACUUM " + db.TableName(recordType))
+	return err
+}
+
+// checkRecordTypeExists returns an error if the table of the record type
+// has not been created.
+func (db *database) checkRecordTypeExists(recordType string) error {
+	typemap, err := db.RemoteColumnTypes(recordType)
+	if err != nil {
+		return err
+	}
+	if len(typemap) == 0 {
+		return skyerr.NewErrorf(skyerr.ResourceNotFound,
+			`record type "%s" does not exist`, recordType)
+	}
+	return nil
+}
+
+func scanTypeStats(rows *sqlx.Rows) (map[string]int64, error) {
+	stats := map[string]int64{}
+	for rows.Next() {
+		var recordType string
+		var count int64
+		if err := rows.Scan(&recordType, &count); err != nil {
+			return nil, err
+		}
+		stats[recordType] = count
+	}
+	return stats, rows.Err()
+}
+
 func createTable(tx *sqlx.Tx, tableName string) error {
 	stmt := createTableStmt(tableName)
 	log.WithField("stmt", stmt).Debugln("Creating table")
@@ -321,7 +707,13 @@ WHERE c.relname = $1
 	// STEP 2: Get column name and data type
 	rows, err := db.c.Queryx(`
 SELECT a.attname,
-  pg_catalog.format_type(a.atttypid, a.atttypmod)
+  pg_catalog.format_type(a.atttypid, a.atttypmod),
+  ARRAY(
+    SELECT e.enumlabel FROM pg_catalog.pg_enum e
+    WHERE e.enumtypid = a.atttypid
+    ORDER BY e.enumsortorder
+  ),
+  COALESCE(pg_catalog.col_description(a.attrelid, a.attnum), '')
 FROM pg_catalog.pg_attribute a
 WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 		oid)
@@ -336,25 +728,41 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 		return nil, err
 	}
 
-	var columnName, pqType string
+	var columnName, pqType, comment string
+	var enumValues pq.StringArray
 	var integerColumns = []string{}
 	for rows.Next() {
-		if err := rows.Scan(&columnName, &pqType); err != nil {
+		if err := rows.Scan(&columnName, &pqType, &enumValues, &comment); err != nil {
 			return nil, err
 		}
 
 		schema := skydb.FieldType{
 			UnderlyingType: pqType,
 		}
+		if len(enumValues) > 0 {
+			schema.Type = skydb.TypeEnum
+			schema.EnumValues = enumValues
+			typemap[columnName] = schema
+			continue
+		}
 		switch pqType {
 		case TypeCaseInsensitiveString:
 			fallthrough
 		case TypeString:
 			schema.Type = skydb.TypeString
+		case TypeBytea:
+			if comment == encryptedColumnComment {
+				schema.Type = skydb.TypeString
+				schema.Encrypted = true
+			} else {
+				schema.Type = skydb.TypeUnknown
+			}
 		case TypeNumber:
 			schema.Type = skydb.TypeNumber
 		case TypeTimestamp:
 			schema.Type = skydb.TypeDateTime
+		case TypeTimestampTZ:
+			schema.Type = skydb.TypeDateTimeTZ
 		case TypeBoolean:
 			schema.Type = skydb.TypeBoolean
 		case TypeJSON:
@@ -372,6 +780,12 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 			integerColumns = append(integerColumns, columnName)
 		case TypeGeometry:
 			schema.Type = skydb.TypeGeometry
+		case TypeStringArray:
+			if comment == assetListColumnComment {
+				schema.Type = skydb.TypeAssetList
+			} else {
+				schema.Type = skydb.TypeUnknown
+			}
 		default:
 			schema.Type = skydb.TypeUnknown
 		}
@@ -441,7 +855,7 @@ WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped`,
 	return typemap, nil
 }
 
-// ALTER TABLE app__.note add collection text;
+// ALTER TABLE app__.note ADD COLUMN IF NOT EXISTS collection text;
 // ALTER TABLE app__.note
 // ADD CONSTRAINT fk_note_collection_collection
 // FOREIGN KEY (collection)
@@ -452,10 +866,16 @@ func (db *database) addColumnStmt(recordType string, recordSchema skydb.RecordSc
 	buf.WriteString(db.TableName(recordType))
 	buf.WriteByte(' ')
 	for column, schema := range recordSchema {
-		buf.Write([]byte("ADD "))
+		buf.Write([]byte("ADD COLUMN IF NOT EXISTS "))
 		buf.WriteString(pq.QuoteIdentifier(column))
 		buf.WriteByte(' ')
-		buf.WriteString(pqDataType(schema.Type))
+		if schema.Type == skydb.TypeEnum {
+			buf.WriteString(schema.UnderlyingType)
+		} else if schema.Encrypted {
+			buf.WriteString(TypeBytea)
+		} else {
+			buf.WriteString(pqDataType(schema.Type))
+		}
 		buf.WriteByte(',')
 		switch schema.Type {
 		case skydb.TypeAsset:
@@ -473,7 +893,7 @@ func (db *database) addColumnStmt(recordType string, recordSchema skydb.RecordSc
 
 func (db *database) writeForeignKeyConstraint(buf *bytes.Buffer, localCol, referent, remoteCol string) {
 	buf.Write([]byte(`ADD CONSTRAINT `))
-	buf.WriteString(pq.QuoteIdentifier(fmt.Sprintf(`fk_%s_%s_%s`, localCol, referent, remoteCol)))
+	buf.WriteString(pq.QuoteIdentifier(foreignKeyConstraintName(localCol, referent, remoteCol)))
 	buf.Write([]byte(` FOREIGN KEY (`))
 	buf.WriteString(pq.QuoteIdentifier(localCol))
 	buf.Write([]byte(`) REFERENCES `))
@@ -483,13 +903,18 @@ func (db *database) writeForeignKeyConstraint(buf *bytes.Buffer, localCol, refer
 	buf.Write([]byte(`),`))
 }
 
+func foreignKeyConstraintName(localCol, referent, remoteCol string) string {
+	return fmt.Sprintf(`fk_%s_%s_%s`, localCol, referent, remoteCol)
+}
+
 func (db *database) GetIndexesByRecordType(recordType string) (indexes map[string]skydb.Index, err error) {
 	schemaName := db.schemaName()
 	rows, err := db.c.Queryx(`
 SELECT
     t.relname AS table_name,
     i.relname AS index_name,
-    array_to_string(array_agg(a.attname), ',') AS column_names
+    array_to_string(array_agg(a.attname), ',') AS column_names,
+    bool_or(ix.indexprs IS NOT NULL) AS case_insensitive
 FROM
     pg_class t,
     pg_class i,
@@ -502,7 +927,16 @@ WHERE
     AND ns.oid = t.relnamespace
     AND ns.oid = i.relnamespace
     AND a.attrelid = t.oid
-    AND a.attnum = ANY(ix.indkey)
+    AND (
+        a.attnum = ANY(ix.indkey)
+        OR (ix.indexprs IS NOT NULL AND EXISTS (
+            SELECT 1 FROM pg_depend d
+            WHERE d.classid = 'pg_class'::regclass
+                AND d.objid = i.oid
+                AND d.refobjid = t.oid
+                AND d.refobjsubid = a.attnum
+        ))
+    )
     AND t.relkind = 'r'
     AND ix.indisunique = TRUE
     AND ns.nspname = $1
@@ -522,12 +956,16 @@ GROUP BY
 		var table string
 		var name string
 		var columnNames string
-		if err = rows.Scan(&table, &name, &columnNames); err != nil {
+		var caseInsensitive bool
+		if err = rows.Scan(&table, &name, &columnNames, &caseInsensitive); err != nil {
 			return
 		}
 
+		// Unique indexes on expressions are only created by SaveIndex
+		// for case-insensitive indexes, which index lower(col).
 		indexes[name] = skydb.Index{
-			Fields: strings.Split(columnNames, ","),
+			Fields:          strings.Split(columnNames, ","),
+			CaseInsensitive: caseInsensitive,
 		}
 	}
 
@@ -540,6 +978,10 @@ func (db *database) SaveIndex(recordType, indexName string, index skydb.Index) e
 		quotedColumns = append(quotedColumns, fmt.Sprintf("%s", col))
 	}
 
+	if index.CaseInsensitive {
+		return db.saveCaseInsensitiveIndex(recordType, indexName, index)
+	}
+
 	stmt := fmt.Sprintf(`
 		ALTER TABLE "%s"."%s" ADD CONSTRAINT %s UNIQUE (%s);
 	`, db.schemaName(), recordType, indexName, strings.Join(quotedColumns, ","))
@@ -552,7 +994,46 @@ func (db *database) SaveIndex(recordType, indexName string, index skydb.Index) e
 	return nil
 }
 
+// saveCaseInsensitiveIndex creates a unique index on the lowercased
+// values of the fields. Unlike a unique constraint, a constraint cannot
+// be defined on expressions.
+func (db *database) saveCaseInsensitiveIndex(recordType, indexName string, index skydb.Index) error {
+	loweredColumns := []string{}
+	for _, col := range index.Fields {
+		loweredColumns = append(loweredColumns, fmt.Sprintf("lower(%s)", pq.QuoteIdentifier(col)))
+	}
+
+	stmt := fmt.Sprintf(`
+		CREATE UNIQUE INDEX %s ON "%s"."%s" (%s);
+	`, indexName, db.schemaName(), recordType, strings.Join(loweredColumns, ","))
+	log.WithField("stmt", stmt).Debugln("Creating case-insensitive unique index")
+	if _, err := db.c.Exec(stmt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (db *database) DeleteIndex(recordType string, indexName string) error {
+	var isConstraint bool
+	err := db.c.QueryRowx(`
+SELECT EXISTS (
+    SELECT 1 FROM pg_constraint c
+    JOIN pg_namespace ns ON ns.oid = c.connamespace
+    WHERE ns.nspname = $1 AND c.conname = $2
+)`, db.schemaName(), indexName).Scan(&isConstraint)
+	if err != nil {
+		return err
+	}
+
+	// Case-insensitive indexes are not backed by a constraint.
+	if !isConstraint {
+		stmt := fmt.Sprintf(`DROP INDEX "%s".%s;`, db.schemaName(), indexName)
+		log.WithField("stmt", stmt).Debugln("Dropping unique index")
+		_, err := db.c.Exec(stmt)
+		return err
+	}
+
 	stmt := fmt.Sprintf(`
 		ALTER TABLE "%s"."%s" DROP CONSTRAINT %s;
 	`, db.schemaName(), recordType, indexName)
@@ -15,9 +15,13 @@
 package pq
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -235,6 +239,12 @@ func TestExtend(t *testing.T) {
 				},
 			})
 			So(err, ShouldNotBeNil)
+
+			schemaErr, ok := err.(*skydb.SchemaError)
+			So(ok, ShouldBeTrue)
+			So(schemaErr.Kind, ShouldEqual, skydb.SchemaReferenceTargetMissing)
+			So(schemaErr.RecordType, ShouldEqual, "note")
+			So(schemaErr.Field, ShouldEqual, "tag")
 		})
 
 		Convey("adds new column if table already exist", func() {
@@ -281,6 +291,50 @@ func TestExtend(t *testing.T) {
 			})
 			So(err, ShouldNotBeNil)
 			So(err.Error(), ShouldStartWith, "IncompatibleSchema: conflicting schema")
+
+			schemaErr, ok := err.(*skydb.SchemaError)
+			So(ok, ShouldBeTrue)
+			So(schemaErr.Kind, ShouldEqual, skydb.SchemaTypeConflict)
+			So(schemaErr.RecordType, ShouldEqual, "note")
+			So(schemaErr.Field, ShouldBeIn, "content", "dirty")
+		})
+
+		Convey("adds columns only if they do not exist", func() {
+			stmt := c.PublicDB().(*database).addColumnStmt("note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(stmt, ShouldContainSubstring, `ADD COLUMN IF NOT EXISTS "content" text`)
+		})
+
+		Convey("errors if adding a field duplicated with a different type", func() {
+			extended, err := db.Extend("note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeTrue)
+
+			// cache the schema before the column is added behind its back
+			_, err = db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			_, err = c.Exec(`ALTER TABLE "note" ADD "extra" text`)
+			So(err, ShouldBeNil)
+
+			_, err = db.Extend("note", skydb.RecordSchema{
+				"extra": skydb.FieldType{Type: skydb.TypeNumber},
+			})
+			So(err, ShouldNotBeNil)
+
+			schemaErr, ok := err.(*skydb.SchemaError)
+			So(ok, ShouldBeTrue)
+			So(schemaErr.Kind, ShouldEqual, skydb.SchemaFieldDuplicated)
+			So(schemaErr.RecordType, ShouldEqual, "note")
+			So(schemaErr.Field, ShouldEqual, "extra")
+
+			// the outdated cache is invalidated
+			_, err = db.Extend("note", skydb.RecordSchema{
+				"extra": skydb.FieldType{Type: skydb.TypeNumber},
+			})
+			So(err.(*skydb.SchemaError).Kind, ShouldEqual, skydb.SchemaTypeConflict)
 		})
 
 		Convey("creates empty table", func() {
@@ -560,3 +614,550 @@ func TestExtend(t *testing.T) {
 		})
 	})
 }
+
+func TestConcurrentExtend(t *testing.T) {
+	Convey("concurrent Extend", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		other, err := Open(context.Background(), c.appName, skydb.RoleBasedAccess, "", skydb.DBConfig{
+			CanMigrate: true,
+		})
+		So(err, ShouldBeNil)
+		defer other.Close()
+
+		extendConcurrently := func(recordType string, schema skydb.RecordSchema) []error {
+			errs := make([]error, 2)
+			wg := sync.WaitGroup{}
+			for i, conn := range []skydb.Conn{c, other} {
+				wg.Add(1)
+				go func(i int, db skydb.Database) {
+					defer wg.Done()
+					_, errs[i] = db.Extend(recordType, schema)
+				}(i, conn.PublicDB())
+			}
+			wg.Wait()
+			return errs
+		}
+
+		Convey("adds the same new field", func() {
+			_, err := c.PublicDB().Extend("note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+			_, err = other.PublicDB().RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+
+			errs := extendConcurrently("note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+				"title":   skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(errs, ShouldResemble, []error{nil, nil})
+
+			schema, err := c.PublicDB().RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(schema["title"].Type, ShouldEqual, skydb.TypeString)
+		})
+
+		Convey("creates the same new record type", func() {
+			errs := extendConcurrently("note", skydb.RecordSchema{
+				"content": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(errs, ShouldResemble, []error{nil, nil})
+
+			schema, err := c.PublicDB().RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(schema["content"].Type, ShouldEqual, skydb.TypeString)
+		})
+	})
+}
+
+func TestExtendMany(t *testing.T) {
+	Convey("ExtendMany", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		db := c.PublicDB().(*database)
+
+		Convey("creates referenced record types", func() {
+			err := db.ExtendMany(map[string]skydb.RecordSchema{
+				"note": skydb.RecordSchema{
+					"content": skydb.FieldType{Type: skydb.TypeString},
+					"category": skydb.FieldType{
+						Type:          skydb.TypeReference,
+						ReferenceType: "category",
+					},
+				},
+				"category": skydb.RecordSchema{
+					"name": skydb.FieldType{Type: skydb.TypeString},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			schema, err := db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(schema["content"].Type, ShouldEqual, skydb.TypeString)
+			So(schema["category"].Type, ShouldEqual, skydb.TypeReference)
+			So(schema["category"].ReferenceType, ShouldEqual, "category")
+
+			schema, err = db.RemoteColumnTypes("category")
+			So(err, ShouldBeNil)
+			So(schema["name"].Type, ShouldEqual, skydb.TypeString)
+		})
+
+		Convey("creates record types referencing each other", func() {
+			err := db.ExtendMany(map[string]skydb.RecordSchema{
+				"note": skydb.RecordSchema{
+					"category": skydb.FieldType{
+						Type:          skydb.TypeReference,
+						ReferenceType: "category",
+					},
+				},
+				"category": skydb.RecordSchema{
+					"featuredNote": skydb.FieldType{
+						Type:          skydb.TypeReference,
+						ReferenceType: "note",
+					},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			schema, err := db.RemoteColumnTypes("category")
+			So(err, ShouldBeNil)
+			So(schema["featuredNote"].ReferenceType, ShouldEqual, "note")
+		})
+
+		Convey("adds columns to existing record types", func() {
+			_, err := db.Extend("category", skydb.RecordSchema{
+				"name": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+
+			err = db.ExtendMany(map[string]skydb.RecordSchema{
+				"note": skydb.RecordSchema{
+					"category": skydb.FieldType{
+						Type:          skydb.TypeReference,
+						ReferenceType: "category",
+					},
+				},
+				"category": skydb.RecordSchema{
+					"name":   skydb.FieldType{Type: skydb.TypeString},
+					"hidden": skydb.FieldType{Type: skydb.TypeBoolean},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			schema, err := db.RemoteColumnTypes("category")
+			So(err, ShouldBeNil)
+			So(schema["hidden"].Type, ShouldEqual, skydb.TypeBoolean)
+		})
+
+		Convey("extends nothing if any schema conflicts", func() {
+			_, err := db.Extend("category", skydb.RecordSchema{
+				"name": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+
+			err = db.ExtendMany(map[string]skydb.RecordSchema{
+				"note": skydb.RecordSchema{
+					"content": skydb.FieldType{Type: skydb.TypeString},
+				},
+				"category": skydb.RecordSchema{
+					"name": skydb.FieldType{Type: skydb.TypeNumber},
+				},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(*skydb.SchemaError).Kind, ShouldEqual, skydb.SchemaTypeConflict)
+
+			schema, err := db.RemoteColumnTypes("note")
+			So(err, ShouldBeNil)
+			So(schema, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestExtendWithOptions(t *testing.T) {
+	Convey("ExtendWithOptions", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+		db := c.PublicDB().(*database)
+
+		firstSavedAt := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+		secondSavedAt := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+		saveTwice := func(recordType string) skydb.Record {
+			record := skydb.Record{
+				ID:        skydb.NewRecordID(recordType, "id1"),
+				OwnerID:   "user_id",
+				UpdatedAt: firstSavedAt,
+				UpdaterID: "user_id",
+				Data: map[string]interface{}{
+					"message": "logged in",
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			record.UpdatedAt = secondSavedAt
+			record.UpdaterID = "admin_id"
+			So(db.Save(&record), ShouldBeNil)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			return fetched
+		}
+
+		Convey("preserves updated at of record saved again", func() {
+			extended, err := db.ExtendWithOptions("audit_log", skydb.RecordSchema{
+				"message": skydb.FieldType{Type: skydb.TypeString},
+			}, skydb.ExtendOptions{PreserveUpdatedAt: true})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeTrue)
+
+			record := saveTwice("audit_log")
+			So(record.UpdatedAt, ShouldResemble, firstSavedAt)
+			So(record.UpdaterID, ShouldEqual, "user_id")
+		})
+
+		Convey("bumps updated at of record type without options", func() {
+			_, err := db.Extend("note", skydb.RecordSchema{
+				"message": skydb.FieldType{Type: skydb.TypeString},
+			})
+			So(err, ShouldBeNil)
+
+			record := saveTwice("note")
+			So(record.UpdatedAt, ShouldResemble, secondSavedAt)
+			So(record.UpdaterID, ShouldEqual, "admin_id")
+		})
+
+		Convey("replaces options set previously", func() {
+			schema := skydb.RecordSchema{
+				"message": skydb.FieldType{Type: skydb.TypeString},
+			}
+			_, err := db.ExtendWithOptions("audit_log", schema, skydb.ExtendOptions{PreserveUpdatedAt: true})
+			So(err, ShouldBeNil)
+			extended, err := db.ExtendWithOptions("audit_log", schema, skydb.ExtendOptions{})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeFalse)
+
+			record := saveTwice("audit_log")
+			So(record.UpdatedAt, ShouldResemble, secondSavedAt)
+		})
+	})
+}
+
+func TestTypeStats(t *testing.T) {
+	Convey("TypeStats", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+		_, err = db.Extend("category", skydb.RecordSchema{
+			"name": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		for _, id := range []string{"note1", "note2", "note3"} {
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("note", id),
+				OwnerID: "someuserid",
+				Data:    skydb.Data{"content": id},
+			}), ShouldBeNil)
+		}
+		So(db.Save(&skydb.Record{
+			ID:      skydb.NewRecordID("category", "category1"),
+			OwnerID: "someuserid",
+			Data:    skydb.Data{"name": "funny"},
+		}), ShouldBeNil)
+
+		Convey("counts records of each type exactly", func() {
+			c.exactTypeStats = true
+
+			stats, err := db.TypeStats()
+			So(err, ShouldBeNil)
+			So(stats["note"], ShouldEqual, 3)
+			So(stats["category"], ShouldEqual, 1)
+			for recordType := range stats {
+				So(recordType, ShouldNotStartWith, "_")
+			}
+		})
+
+		Convey("estimates records of each type", func() {
+			_, err := c.Exec(`ANALYZE "note"; ANALYZE "category"`)
+			So(err, ShouldBeNil)
+
+			stats, err := db.TypeStats()
+			So(err, ShouldBeNil)
+			So(stats["note"], ShouldEqual, 3)
+			So(stats["category"], ShouldEqual, 1)
+			for recordType := range stats {
+				So(recordType, ShouldNotStartWith, "_")
+			}
+		})
+	})
+}
+
+func TestAnalyzeAndVacuumType(t *testing.T) {
+	Convey("Database with imported records", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		_, err = c.Exec(`INSERT INTO "note" ` +
+			`(_database_id, _id, _owner_id, _created_at, _created_by, _updated_at, _updated_by, content) ` +
+			`SELECT '', 'note' || i, 'someuserid', now(), 'someuserid', now(), 'someuserid', 'content' ` +
+			`FROM generate_series(1, 1000) AS i`)
+		So(err, ShouldBeNil)
+
+		Convey("analyzes records of a type", func() {
+			err := db.AnalyzeType("note")
+			So(err, ShouldBeNil)
+
+			stats, err := db.TypeStats()
+			So(err, ShouldBeNil)
+			So(stats["note"], ShouldEqual, 1000)
+		})
+
+		Convey("vacuums records of a type", func() {
+			_, err := c.Exec(`DELETE FROM "note" WHERE _id LIKE 'note1%'`)
+			So(err, ShouldBeNil)
+
+			err = db.VacuumType("note")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("errors on type not exist", func() {
+			err := db.AnalyzeType("notexist")
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.ResourceNotFound)
+
+			err = db.VacuumType("notexist")
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.ResourceNotFound)
+		})
+
+		Convey("errors on vacuum in transaction", func() {
+			err := c.RunInTransaction(func(tx skydb.Conn) error {
+				return tx.PublicDB().VacuumType("note")
+			})
+			So(err, ShouldEqual, skydb.ErrDatabaseTxDidBegin)
+		})
+	})
+}
+
+func TestCaseInsensitiveIndex(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB().(*database)
+		_, err := db.Extend("team", skydb.RecordSchema{
+			"name": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		err = db.SaveIndex("team", "team_name_key", skydb.Index{
+			Fields:          []string{"name"},
+			CaseInsensitive: true,
+		})
+		So(err, ShouldBeNil)
+
+		saveTeam := func(key string, name string) error {
+			return db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("team", key),
+				OwnerID: "user1",
+				Data: skydb.Data{
+					"name": name,
+				},
+			})
+		}
+
+		Convey("rejects names differing only in case", func() {
+			So(saveTeam("team1", "Team"), ShouldBeNil)
+
+			err := saveTeam("team2", "team")
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.Duplicated)
+		})
+
+		Convey("accepts different names", func() {
+			So(saveTeam("team1", "Team"), ShouldBeNil)
+			So(saveTeam("team2", "Another Team"), ShouldBeNil)
+		})
+
+		Convey("gets and deletes the index", func() {
+			indexes, err := db.GetIndexesByRecordType("team")
+			So(err, ShouldBeNil)
+			So(indexes["team_name_key"], ShouldResemble, skydb.Index{
+				Fields:          []string{"name"},
+				CaseInsensitive: true,
+			})
+
+			So(db.DeleteIndex("team", "team_name_key"), ShouldBeNil)
+			indexes, err = db.GetIndexesByRecordType("team")
+			So(err, ShouldBeNil)
+			So(indexes, ShouldNotContainKey, "team_name_key")
+		})
+	})
+}
+
+func TestCheckSchema(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"title":   skydb.FieldType{Type: skydb.TypeString},
+			"content": skydb.FieldType{Type: skydb.TypeString},
+			"done":    skydb.FieldType{Type: skydb.TypeBoolean},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("returns differences from the expected schema", func() {
+			diffs, err := db.CheckSchema(map[string]skydb.RecordSchema{
+				"note": skydb.RecordSchema{
+					"title": skydb.FieldType{Type: skydb.TypeString},
+					"done":  skydb.FieldType{Type: skydb.TypeNumber},
+					"order": skydb.FieldType{Type: skydb.TypeNumber},
+				},
+				"comment": skydb.RecordSchema{
+					"body": skydb.FieldType{Type: skydb.TypeString},
+				},
+			})
+			So(err, ShouldBeNil)
+			So(len(diffs), ShouldEqual, 4)
+			So(diffs[0].Kind, ShouldEqual, skydb.SchemaFieldMissing)
+			So(diffs[0].RecordType, ShouldEqual, "comment")
+			So(diffs[0].Field, ShouldEqual, "body")
+			So(diffs[1].Kind, ShouldEqual, skydb.SchemaFieldExtra)
+			So(diffs[1].Field, ShouldEqual, "content")
+			So(diffs[2].Kind, ShouldEqual, skydb.SchemaFieldConflict)
+			So(diffs[2].Field, ShouldEqual, "done")
+			So(diffs[2].Actual.Type, ShouldEqual, skydb.TypeBoolean)
+			So(diffs[3].Kind, ShouldEqual, skydb.SchemaFieldMissing)
+			So(diffs[3].Field, ShouldEqual, "order")
+		})
+
+		Convey("does not change the schema", func() {
+			_, err := db.CheckSchema(map[string]skydb.RecordSchema{
+				"comment": skydb.RecordSchema{
+					"body": skydb.FieldType{Type: skydb.TypeString},
+				},
+			})
+			So(err, ShouldBeNil)
+
+			schema, err := db.RemoteColumnTypes("comment")
+			So(err, ShouldBeNil)
+			So(schema, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestExtendEnum(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+		statusType := skydb.FieldType{
+			Type:       skydb.TypeEnum,
+			EnumValues: []string{"open", "closed"},
+		}
+		_, err := db.Extend("ticket", skydb.RecordSchema{
+			"status": statusType,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("reads the enum values back", func() {
+			schema, err := db.RemoteColumnTypes("ticket")
+			So(err, ShouldBeNil)
+			So(schema["status"].Type, ShouldEqual, skydb.TypeEnum)
+			So(schema["status"].EnumValues, ShouldResemble, []string{"open", "closed"})
+
+			extended, err := db.Extend("ticket", skydb.RecordSchema{
+				"status": statusType,
+			})
+			So(err, ShouldBeNil)
+			So(extended, ShouldBeFalse)
+		})
+
+		Convey("saves an allowed value", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("ticket", "ticket1"),
+				OwnerID: "user1",
+				Data: skydb.Data{
+					"status": "open",
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			fetched := skydb.Record{}
+			So(db.Get(record.ID, &fetched), ShouldBeNil)
+			So(fetched.Data["status"], ShouldEqual, "open")
+		})
+
+		Convey("rejects a value not allowed", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("ticket", "ticket1"),
+				OwnerID: "user1",
+				Data: skydb.Data{
+					"status": "pending",
+				},
+			}
+			err := db.Save(&record)
+			So(err, ShouldHaveSameTypeAs, skydb.ErrInvalidEnumValue{})
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+		})
+
+		Convey("rejects patching a value not allowed", func() {
+			record := skydb.Record{
+				ID:      skydb.NewRecordID("ticket", "ticket1"),
+				OwnerID: "user1",
+				Data: skydb.Data{
+					"status": "open",
+				},
+			}
+			So(db.Save(&record), ShouldBeNil)
+
+			err := db.Patch(record.ID, "user1", map[string]interface{}{
+				"status": "pending",
+			})
+			So(err, ShouldHaveSameTypeAs, skydb.ErrInvalidEnumValue{})
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+
+			So(db.Patch(record.ID, "user1", map[string]interface{}{
+				"status": skydb.Null,
+			}), ShouldBeNil)
+		})
+
+		Convey("rejects extending with different values", func() {
+			_, err := db.Extend("ticket", skydb.RecordSchema{
+				"status": skydb.FieldType{
+					Type:       skydb.TypeEnum,
+					EnumValues: []string{"open"},
+				},
+			})
+			So(err, ShouldHaveSameTypeAs, &skydb.SchemaError{})
+		})
+
+		Convey("drops the enum type with the column", func() {
+			So(db.DeleteSchema("ticket", "status"), ShouldBeNil)
+
+			var count int
+			err := c.QueryRowx(`
+				SELECT COUNT(*) FROM pg_type t
+				JOIN pg_namespace n ON n.oid = t.typnamespace
+				WHERE n.nspname = $1 AND t.typtype = 'e'`,
+				c.schemaName()).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+	})
+}
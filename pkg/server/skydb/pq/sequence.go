@@ -0,0 +1,74 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"errors"
+	"fmt"
+)
+
+func (c *conn) NextSequenceValue(name string) (int64, error) {
+	if name == "" {
+		return 0, errors.New("next sequence value: got empty sequence name")
+	}
+
+	// Sequences of fields are named after the record type, so the
+	// named sequences are prefixed to avoid clashing with them.
+	seqName := c.tableName("_sequence_" + name)
+	if err := c.ensureSequence(seqName); err != nil {
+		return 0, err
+	}
+
+	var value int64
+	err := c.QueryRowx(`SELECT nextval($1);`, seqName).Scan(&value)
+	if isUndefinedTable(err) {
+		// The sequence is dropped, or its creation is rolled back,
+		// after it is known to exist. It is created again next time.
+		delete(c.sequences, seqName)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// ensureSequence creates the sequence if it does not exist. Sequences
+// known to exist are remembered, so that the sequence is looked up in
+// the catalog only once in the conn, and created without taking a
+// catalog lock unless it does not exist.
+func (c *conn) ensureSequence(seqName string) error {
+	if c.sequences[seqName] {
+		return nil
+	}
+
+	var exists bool
+	if err := c.QueryRowx(`SELECT to_regclass($1) IS NOT NULL;`, seqName).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		_, err := c.Exec(fmt.Sprintf(`CREATE SEQUENCE IF NOT EXISTS %s;`, seqName))
+		// Concurrent creation of the same sequence fails with unique
+		// violation when both have found the sequence not existing.
+		if err != nil && !isUniqueViolated(err) {
+			return err
+		}
+	}
+
+	if c.sequences == nil {
+		c.sequences = map[string]bool{}
+	}
+	c.sequences[seqName] = true
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"context"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNextSequenceValue(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		Convey("returns increasing values", func() {
+			var last int64
+			for i := 0; i < 5; i++ {
+				value, err := c.NextSequenceValue("invoice")
+				So(err, ShouldBeNil)
+				So(value, ShouldBeGreaterThan, last)
+				last = value
+			}
+		})
+
+		Convey("returns increasing values across conns", func() {
+			other, err := Open(context.Background(), c.appName, skydb.RoleBasedAccess, "", skydb.DBConfig{
+				CanMigrate: true,
+			})
+			So(err, ShouldBeNil)
+			defer other.Close()
+
+			var last int64
+			for i := 0; i < 5; i++ {
+				for _, conn := range []skydb.Conn{c, other} {
+					value, err := conn.NextSequenceValue("invoice")
+					So(err, ShouldBeNil)
+					So(value, ShouldBeGreaterThan, last)
+					last = value
+				}
+			}
+		})
+
+		Convey("keeps separate values for sequences of different names", func() {
+			value, err := c.NextSequenceValue("invoice")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 1)
+
+			value, err = c.NextSequenceValue("receipt")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 1)
+
+			value, err = c.NextSequenceValue("invoice")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 2)
+		})
+
+		Convey("creates the sequence only once", func() {
+			_, err := c.NextSequenceValue("invoice")
+			So(err, ShouldBeNil)
+
+			statementCount := c.statementCount
+			value, err := c.NextSequenceValue("invoice")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 2)
+			So(c.statementCount, ShouldEqual, statementCount+1)
+		})
+
+		Convey("creates the sequence again after it is dropped", func() {
+			_, err := c.NextSequenceValue("invoice")
+			So(err, ShouldBeNil)
+
+			_, err = c.Exec(`DROP SEQUENCE ` + c.tableName("_sequence_invoice"))
+			So(err, ShouldBeNil)
+
+			_, err = c.NextSequenceValue("invoice")
+			So(err, ShouldNotBeNil)
+
+			value, err := c.NextSequenceValue("invoice")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 1)
+		})
+	})
+}
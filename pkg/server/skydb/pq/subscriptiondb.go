@@ -21,12 +21,15 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
+	sq "github.com/lann/squirrel"
 	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 	"github.com/skygeario/skygear-server/pkg/server/skydb/pq/builder"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
 func isDeviceNotFound(err error) bool {
@@ -151,11 +154,11 @@ func (db *database) GetSubscription(key string, deviceID string, subscription *s
 	}
 	nullinfo := nullNotificationInfo{}
 
-	builder := psql.Select("type", "notification_info", "query").
+	builder := psql.Select("type", "notification_info", "query", "watch_fields").
 		From(db.TableName("_subscription")).
 		Where("auth_id = ? AND device_id = ? AND id = ?", db.userID, deviceID, key)
 	err := db.c.QueryRowWith(builder).
-		Scan(&subscription.Type, &nullinfo, (*queryValue)(&subscription.Query))
+		Scan(&subscription.Type, &nullinfo, (*queryValue)(&subscription.Query), (*pq.StringArray)(&subscription.WatchFields))
 
 	if err == sql.ErrNoRows {
 		return skydb.ErrSubscriptionNotFound
@@ -206,6 +209,10 @@ func (db *database) SaveSubscription(subscription *skydb.Subscription) error {
 		"type":              subscription.Type,
 		"notification_info": nullinfo,
 		"query":             queryValue(subscription.Query),
+		"watch_fields":      pq.StringArray(subscription.WatchFields),
+	}
+	if err := setSubscriptionEqualityIndex(data, &subscription.Query); err != nil {
+		return err
 	}
 
 	builder := builder.UpsertQuery(db.TableName("_subscription"), pkData, data)
@@ -218,6 +225,57 @@ func (db *database) SaveSubscription(subscription *skydb.Subscription) error {
 	return err
 }
 
+func (db *database) UpdateSubscription(subscription *skydb.Subscription) error {
+	if db.DatabaseType() == skydb.UnionDatabase {
+		return errors.New("union database does not implement subscription")
+	}
+	if subscription.Query.Type == "" {
+		return errors.New("empty query type")
+	}
+
+	data := map[string]interface{}{
+		"query": queryValue(subscription.Query),
+	}
+	if err := setSubscriptionEqualityIndex(data, &subscription.Query); err != nil {
+		return err
+	}
+
+	result, err := db.c.ExecWith(
+		psql.Update(db.TableName("_subscription")).
+			SetMap(data).
+			Where("auth_id = ? AND device_id = ? AND id = ?", db.userID, subscription.DeviceID, subscription.ID),
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return skydb.ErrSubscriptionNotFound
+	} else if rowsAffected > 1 {
+		panic(fmt.Errorf("want 1 rows updated, got %v", rowsAffected))
+	}
+
+	return nil
+}
+
+// setSubscriptionEqualityIndex sets the equality index columns of the
+// query in data, clearing them if the query has no indexable equality.
+func setSubscriptionEqualityIndex(data map[string]interface{}, query *skydb.Query) error {
+	data["eq_key"], data["eq_value"] = nil, nil
+	if key, value, ok := subscriptionEqualityIndex(&query.Predicate); ok {
+		valueJSON, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		data["eq_key"], data["eq_value"] = key, string(valueJSON)
+	}
+	return nil
+}
+
 func (db *database) DeleteSubscription(key string, deviceID string) error {
 	if db.DatabaseType() == skydb.UnionDatabase {
 		return errors.New("union database does not implement subscription")
@@ -244,43 +302,43 @@ func (db *database) DeleteSubscription(key string, deviceID string) error {
 	return nil
 }
 
-func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions []skydb.Subscription) {
-	if db.DatabaseType() == skydb.UnionDatabase {
+func (db *database) GetSubscriptionsByDeviceID(deviceID string) []skydb.Subscription {
+	subscriptions, err := db.GetSubscriptionsByDevice(deviceID)
+	if err != nil {
 		log.WithFields(logrus.Fields{
 			"auth_id":  db.userID,
 			"deviceID": deviceID,
-		}).Errorln("GetSubscriptionsByDeviceID on union database is not implemented")
+			"err":      err,
+		}).Errorln("failed to get subscriptions by device id")
+
 		return nil
 	}
+
+	log.Debug(subscriptions)
+	return subscriptions
+}
+
+func (db *database) GetSubscriptionsByDevice(deviceID string) ([]skydb.Subscription, error) {
+	if db.DatabaseType() == skydb.UnionDatabase {
+		return nil, errors.New("union database does not implement subscription")
+	}
 	rows, err := db.c.QueryWith(
-		psql.Select("id", "type", "notification_info", "query").
+		psql.Select("id", "type", "notification_info", "query", "watch_fields").
 			From(db.TableName("_subscription")).
 			Where(`auth_id = ? AND device_id = ?`, db.userID, deviceID),
 	)
-
 	if err != nil {
-		log.WithFields(logrus.Fields{
-			"auth_id":  db.userID,
-			"deviceID": deviceID,
-			"err":      err,
-		}).Errorln("failed to query subscriptions by device id")
-
-		return nil
+		return nil, err
 	}
+	defer rows.Close()
 
-	subscriptions = []skydb.Subscription{}
+	subscriptions := []skydb.Subscription{}
 	var s skydb.Subscription
 	for rows.Next() {
 		var nullinfo nullNotificationInfo
-		err := rows.Scan(&s.ID, &s.Type, &nullinfo, (*queryValue)(&s.Query))
+		err := rows.Scan(&s.ID, &s.Type, &nullinfo, (*queryValue)(&s.Query), (*pq.StringArray)(&s.WatchFields))
 		if err != nil {
-			log.WithFields(logrus.Fields{
-				"userID":   db.userID,
-				"deviceID": deviceID,
-				"err":      err,
-			}).Errorln("failed to scan a subscription row by device id, skipping...")
-
-			continue
+			return nil, err
 		}
 
 		if nullinfo.Valid {
@@ -293,46 +351,69 @@ func (db *database) GetSubscriptionsByDeviceID(deviceID string) (subscriptions [
 		subscriptions = append(subscriptions, s)
 	}
 
-	if rows.Err() != nil {
-		log.WithFields(logrus.Fields{
-			"userID":   db.userID,
-			"deviceID": deviceID,
-			"err":      rows.Err(),
-		}).Errorln("failed to scan subscriptions by device id")
-
-		return nil
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
-	log.Debug(subscriptions)
-	return subscriptions
+	return subscriptions, nil
+}
+
+func (db *database) GetMatchingSubscriptions(record *skydb.Record) []skydb.Subscription {
+	return db.GetMatchingSubscriptionsBatch([]*skydb.Record{record})[0]
 }
 
-func (db *database) GetMatchingSubscriptions(record *skydb.Record) (subscriptions []skydb.Subscription) {
+func (db *database) GetMatchingSubscriptionsBatch(records []*skydb.Record) [][]skydb.Subscription {
+	matches := make([][]skydb.Subscription, len(records))
 	if db.DatabaseType() == skydb.UnionDatabase {
 		log.WithFields(logrus.Fields{
 			"auth_id": db.userID,
-		}).Errorln("GetMatchingSubscriptions on union database is not implemented")
-		return nil
+		}).Errorln("GetMatchingSubscriptionsBatch on union database is not implemented")
+		return matches
 	}
-	builder := psql.Select("id", "device_id", "type", "notification_info", "query").
+	if len(records) == 0 {
+		return matches
+	}
+
+	// Subscriptions having an equality index are fetched only when the
+	// indexed field of a record holds the indexed value.
+	recordConds := sq.Or{}
+	for _, record := range records {
+		indexedJSON, err := json.Marshal(indexedRecordData(record))
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"record": record,
+				"err":    err,
+			}).Errorln("failed to marshal record data for matching subscriptions")
+			return matches
+		}
+		recordConds = append(recordConds, sq.Expr(
+			`(query @> ?::jsonb AND (eq_key IS NULL OR eq_value = (?::jsonb -> eq_key)))`,
+			fmt.Sprintf(`{"Type":"%s"}`, record.ID.Type),
+			string(indexedJSON),
+		))
+	}
+
+	builder := psql.Select("id", "device_id", "type", "notification_info", "query", "watch_fields").
 		From(db.TableName("_subscription")).
-		Where(`auth_id = ? AND query @> ?::jsonb`, db.userID, fmt.Sprintf(`{"Type":"%s"}`, record.ID.Type))
+		Where(`auth_id = ?`, db.userID).
+		Where(recordConds)
 
 	rows, err := db.c.QueryWith(builder)
 	if err != nil {
 		log.WithFields(logrus.Fields{
-			"record": record,
-			"userID": db.userID,
-			"err":    err,
+			"records": records,
+			"userID":  db.userID,
+			"err":     err,
 		}).Errorln("failed to select subscriptions")
 
-		return nil
+		return matches
 	}
 
+	subscriptionsByType := map[string][]indexedSubscription{}
 	var s skydb.Subscription
 	for rows.Next() {
 		var nullinfo nullNotificationInfo
-		err := rows.Scan(&s.ID, &s.DeviceID, &s.Type, &nullinfo, (*queryValue)(&s.Query))
+		err := rows.Scan(&s.ID, &s.DeviceID, &s.Type, &nullinfo, (*queryValue)(&s.Query), (*pq.StringArray)(&s.WatchFields))
 		if err != nil {
 			log.WithField("err", err).Errorln("failed to scan a subscription row, skipping...")
 			continue
@@ -344,102 +425,245 @@ func (db *database) GetMatchingSubscriptions(record *skydb.Record) (subscription
 			s.NotificationInfo = nil
 		}
 
-		subscriptions = append(subscriptions, s)
-	}
-
-	// filter without allocation
-	matchingSubs := subscriptions[:0]
-	for _, subscription := range subscriptions {
-		if predMatchRecord(&(subscription.Query.Predicate), record) {
-			matchingSubs = append(matchingSubs, subscription)
-		}
+		indexed := indexedSubscription{Subscription: s}
+		indexed.eqKey, indexed.eqValue, indexed.hasIndex = subscriptionEqualityIndex(&s.Query.Predicate)
+		subscriptionsByType[s.Query.Type] = append(subscriptionsByType[s.Query.Type], indexed)
 	}
 
 	if rows.Err() != nil {
 		log.WithFields(logrus.Fields{
-			"record": record,
-			"userID": db.userID,
-			"err":    rows.Err(),
+			"records": records,
+			"userID":  db.userID,
+			"err":     rows.Err(),
 		}).Errorln("failed to scan matching subscriptions")
 
-		return nil
+		return make([][]skydb.Subscription, len(records))
+	}
+
+	for i, record := range records {
+		for _, subscription := range subscriptionsByType[record.ID.Type] {
+			// the rows of a batch are shared by records of the same type,
+			// so the equality index is checked again for each record
+			if subscription.hasIndex && !reflect.DeepEqual(record.Get(subscription.eqKey), subscription.eqValue) {
+				continue
+			}
+			matched, err := matchSubscriptionPredicate(&(subscription.Query.Predicate), record)
+			if err != nil {
+				log.WithFields(logrus.Fields{
+					"subscriptionID": subscription.ID,
+					"err":            err,
+				}).Errorln("failed to evaluate a subscription predicate, skipping...")
+				continue
+			}
+			if matched {
+				matches[i] = append(matches[i], subscription.Subscription)
+			}
+		}
+	}
+	return matches
+}
+
+type indexedSubscription struct {
+	skydb.Subscription
+	eqKey    string
+	eqValue  interface{}
+	hasIndex bool
+}
+
+// matchSubscriptionPredicate evaluates the predicate of a candidate
+// subscription against a record. It is a variable for tests to count
+// the evaluations.
+var matchSubscriptionPredicate = predMatchRecord
+
+// subscriptionEqualityIndex returns the field and the value of an
+// equality constraint of p which every matching record must satisfy.
+// Only constraints on a record data field against a string, number or
+// boolean literal, either at the top level or in a conjunction, are
+// indexed. Key paths into a JSON field are not indexed, because they do
+// not name a key of the record data.
+func subscriptionEqualityIndex(p *skydb.Predicate) (key string, value interface{}, ok bool) {
+	if p == nil || p.IsEmpty() {
+		return "", nil, false
+	}
+
+	switch p.Operator {
+	case skydb.And:
+		for _, childPred := range p.GetSubPredicates() {
+			if key, value, ok = subscriptionEqualityIndex(&childPred); ok {
+				return
+			}
+		}
+	case skydb.Equal:
+		exprs := p.GetExpressions()
+		if len(exprs) != 2 {
+			return "", nil, false
+		}
+		keyPath, literal := exprs[0], exprs[1]
+		if keyPath.Type != skydb.KeyPath {
+			keyPath, literal = literal, keyPath
+		}
+		if keyPath.Type != skydb.KeyPath || literal.Type != skydb.Literal {
+			return "", nil, false
+		}
+		key, _ = keyPath.Value.(string)
+		if key == "" || key[0] == '_' || strings.Contains(key, ".") {
+			return "", nil, false
+		}
+		switch literal.Value.(type) {
+		case string, float64, bool:
+			return key, literal.Value, true
+		}
 	}
 
-	return matchingSubs
+	return "", nil, false
 }
 
-func predMatchRecord(p *skydb.Predicate, record *skydb.Record) (b bool) {
+// indexedRecordData returns the record data fields which may satisfy an
+// equality index.
+func indexedRecordData(record *skydb.Record) map[string]interface{} {
+	data := map[string]interface{}{}
+	for key, value := range record.Data {
+		switch value.(type) {
+		case string, float64, bool:
+			data[key] = value
+		}
+	}
+	return data
+}
+
+func (db *database) SubscriptionMatchesRecord(subscriptionID string, record *skydb.Record) (bool, error) {
+	if db.DatabaseType() == skydb.UnionDatabase {
+		return false, errors.New("union database does not implement subscription")
+	}
+
+	rows, err := db.c.QueryWith(
+		psql.Select("query").
+			From(db.TableName("_subscription")).
+			Where("auth_id = ? AND id = ?", db.userID, subscriptionID),
+	)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	found := false
+	matched := false
+	for rows.Next() {
+		var query skydb.Query
+		if err := rows.Scan((*queryValue)(&query)); err != nil {
+			return false, err
+		}
+		found = true
+
+		if query.Type != record.ID.Type {
+			continue
+		}
+		queryMatched, err := predMatchRecord(&query.Predicate, record)
+		if err != nil {
+			return false, err
+		}
+		if queryMatched {
+			matched = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	if !found {
+		return false, skydb.ErrSubscriptionNotFound
+	}
+	return matched, nil
+}
+
+// predMatchRecord evaluates p against the record. An error is returned
+// if p has an operator or expression not supported in subscriptions.
+func predMatchRecord(p *skydb.Predicate, record *skydb.Record) (bool, error) {
 	if p == nil || p.IsEmpty() {
-		return true
+		return true, nil
 	}
 
 	switch p.Operator {
 	case skydb.And:
-		b = true
 		for _, childPred := range p.GetSubPredicates() {
-			if !predMatchRecord(&childPred, record) {
-				b = false
-				break
+			if b, err := predMatchRecord(&childPred, record); err != nil || !b {
+				return false, err
 			}
 		}
+		return true, nil
 	case skydb.Or:
 		for _, childPred := range p.GetSubPredicates() {
-			if predMatchRecord(&childPred, record) {
-				b = true
-				break
+			if b, err := predMatchRecord(&childPred, record); err != nil || b {
+				return b, err
 			}
 		}
+		return false, nil
 	case skydb.Not:
-		b = !predMatchRecord(&p.GetSubPredicates()[0], record)
+		b, err := predMatchRecord(&p.GetSubPredicates()[0], record)
+		return !b && err == nil, err
 	case skydb.Equal:
-		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
-		return reflect.DeepEqual(lv, rv)
+		lv, rv, err := extractBinaryOperands(p.GetExpressions(), record)
+		return err == nil && reflect.DeepEqual(lv, rv), err
 	// case skydb.GreaterThan:
 	// case skydb.LessThan:
 	// case skydb.GreaterThanOrEqual:
 	// case skydb.LessThanOrEqual:
 	case skydb.NotEqual:
-		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
-		return !reflect.DeepEqual(lv, rv)
+		lv, rv, err := extractBinaryOperands(p.GetExpressions(), record)
+		return err == nil && !reflect.DeepEqual(lv, rv), err
 	case skydb.In:
-		lv, rv := extractBinaryOperands(p.GetExpressions(), record)
+		lv, rv, err := extractBinaryOperands(p.GetExpressions(), record)
+		if err != nil {
+			return false, err
+		}
 		haystack, ok := rv.([]interface{})
 		if !ok {
-			log.Panicf("unknown value in right hand side of `In` operand = %v", rv)
+			return false, skyerr.NewErrorf(skyerr.NotSupported,
+				"unknown value in right hand side of `In` operand = %v", rv)
 		}
 
-		return deepEqualIn(lv, haystack)
+		return deepEqualIn(lv, haystack), nil
+	case skydb.NoValue:
+		v, err := extractValue(p.GetExpressions()[0], record)
+		return err == nil && v == nil, err
+	case skydb.HasValue:
+		v, err := extractValue(p.GetExpressions()[0], record)
+		return err == nil && v != nil, err
 	// case skydb.Like:
 	// case skydb.ILike:
 	default:
-		log.Panicf("unknown Predicate.Operator = %v", p.Operator)
+		return false, skyerr.NewErrorf(skyerr.NotSupported,
+			"unsupported operator in subscription predicate = %v", p.Operator)
 	}
-
-	return
 }
 
-func extractBinaryOperands(exprs []skydb.Expression, record *skydb.Record) (lv interface{}, rv interface{}) {
-	lv = extractValue(exprs[0], record)
-	rv = extractValue(exprs[1], record)
+func extractBinaryOperands(exprs []skydb.Expression, record *skydb.Record) (lv interface{}, rv interface{}, err error) {
+	if lv, err = extractValue(exprs[0], record); err != nil {
+		return
+	}
+	rv, err = extractValue(exprs[1], record)
 	return
 }
 
-func extractValue(expr skydb.Expression, record *skydb.Record) interface{} {
+func extractValue(expr skydb.Expression, record *skydb.Record) (interface{}, error) {
 	switch expr.Type {
 	case skydb.Literal:
 		switch expr.Value.(type) {
 		case bool, float64, string, time.Time, *skydb.Location, skydb.Reference, []interface{}:
-			return expr.Value
+			return expr.Value, nil
 		default:
-			panic(fmt.Sprintf("unknown type %[1]T of Expression.Value = %[1]v", expr.Value))
+			return nil, skyerr.NewErrorf(skyerr.NotSupported,
+				"unknown type %[1]T of Expression.Value = %[1]v", expr.Value)
 		}
 	case skydb.KeyPath:
-		return record.Get(expr.Value.(string))
+		return record.Get(expr.Value.(string)), nil
 	case skydb.Function:
-		panic("unsupported type of predicate expression = Function")
+		return nil, skyerr.NewError(skyerr.NotSupported,
+			"unsupported type of predicate expression = Function")
 	}
 
-	panic("unreachable code")
+	return nil, skyerr.NewErrorf(skyerr.NotSupported,
+		"unsupported type of predicate expression = %v", expr.Type)
 }
 
 func deepEqualIn(needle interface{}, haystack []interface{}) bool {
@@ -16,6 +16,7 @@ package pq
 
 import (
 	"bytes"
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
@@ -101,6 +102,16 @@ func TestSubscriptionCRUD(t *testing.T) {
 			So(subscription, ShouldResemble, resultSubscription)
 		})
 
+		Convey("get an existing subscription with watch fields", func() {
+			subscription.WatchFields = []string{"title", "status"}
+			So(db.SaveSubscription(&subscription), ShouldBeNil)
+
+			resultSubscription := skydb.Subscription{}
+			err := db.GetSubscription("subscriptionid", "deviceid", &resultSubscription)
+			So(err, ShouldBeNil)
+			So(resultSubscription.WatchFields, ShouldResemble, []string{"title", "status"})
+		})
+
 		Convey("returns ErrSubscriptionNotFound while trying to get a non-existing subscription ", func() {
 			resultSubscription := skydb.Subscription{}
 			err := db.GetSubscription("notexistsubscriptionid", "deviceid", &resultSubscription)
@@ -195,6 +206,27 @@ func TestSubscriptionCRUD(t *testing.T) {
 			So(err, ShouldEqual, skydb.ErrDeviceNotFound)
 		})
 
+		Convey("update the query of an existing subscription", func() {
+			So(db.SaveSubscription(&subscription), ShouldBeNil)
+
+			subscription.Query.Predicate.Children[1] = skydb.Expression{
+				Type:  skydb.Literal,
+				Value: "OTHER_RECORD_ID",
+			}
+			So(db.UpdateSubscription(&subscription), ShouldBeNil)
+
+			resultSubscription := skydb.Subscription{}
+			err := db.GetSubscription("subscriptionid", "deviceid", &resultSubscription)
+			So(err, ShouldBeNil)
+			So(resultSubscription, ShouldResemble, subscription)
+		})
+
+		Convey("returns ErrSubscriptionNotFound while updating a non-exist subscription", func() {
+			subscription.ID = "notexistsubscriptionid"
+			err := db.UpdateSubscription(&subscription)
+			So(err, ShouldEqual, skydb.ErrSubscriptionNotFound)
+		})
+
 		Convey("delets an existing subscription", func() {
 			So(db.SaveSubscription(&subscription), ShouldBeNil)
 
@@ -252,6 +284,25 @@ func TestMatchingSubscriptions(t *testing.T) {
 			So(subscriptions, ShouldBeEmpty)
 		})
 
+		Convey("fetch matching subscriptions for a batch of records", func() {
+			records := []*skydb.Record{
+				{ID: skydb.NewRecordID("type1", "recordid")},
+				{ID: skydb.NewRecordID("notexisttype", "recordid")},
+				{ID: skydb.NewRecordID("type0", "recordid0")},
+				{ID: skydb.NewRecordID("type0", "recordid1")},
+			}
+			matches := db.GetMatchingSubscriptionsBatch(records)
+			So(matches, ShouldHaveLength, 4)
+			So(matches[0], ShouldResemble, []skydb.Subscription{sub11})
+			So(matches[1], ShouldBeEmpty)
+			So(matches[2], ShouldResemble, []skydb.Subscription{sub00, sub01, sub10})
+			So(matches[3], ShouldResemble, []skydb.Subscription{sub00, sub01, sub10})
+		})
+
+		Convey("fetch no subscription for an empty batch", func() {
+			So(db.GetMatchingSubscriptionsBatch(nil), ShouldBeEmpty)
+		})
+
 		Convey("match subscription with predicate eq", func() {
 			record := skydb.Record{ID: skydb.NewRecordID("record", "id")}
 			subeq := subscriptionForTest("device0", "eq", "record")
@@ -274,6 +325,35 @@ func TestMatchingSubscriptions(t *testing.T) {
 			So(subscriptions, ShouldResemble, []skydb.Subscription{subeq})
 		})
 
+		Convey("match subscription with updated predicate", func() {
+			subeq := subscriptionForTest("device0", "eq", "record")
+			subeq.Query.Predicate = skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "title"},
+					skydb.Expression{Type: skydb.Literal, Value: "old term"},
+				},
+			}
+			So(db.SaveSubscription(&subeq), ShouldBeNil)
+
+			oldRecord := skydb.Record{
+				ID:   skydb.NewRecordID("record", "old"),
+				Data: skydb.Data{"title": "old term"},
+			}
+			newRecord := skydb.Record{
+				ID:   skydb.NewRecordID("record", "new"),
+				Data: skydb.Data{"title": "new term"},
+			}
+			So(db.GetMatchingSubscriptions(&oldRecord), ShouldResemble, []skydb.Subscription{subeq})
+			So(db.GetMatchingSubscriptions(&newRecord), ShouldBeEmpty)
+
+			subeq.Query.Predicate.Children[1] = skydb.Expression{Type: skydb.Literal, Value: "new term"}
+			So(db.UpdateSubscription(&subeq), ShouldBeNil)
+
+			So(db.GetMatchingSubscriptions(&oldRecord), ShouldBeEmpty)
+			So(db.GetMatchingSubscriptions(&newRecord), ShouldResemble, []skydb.Subscription{subeq})
+		})
+
 		Convey("match subscription with compound predicates", func() {
 			binaryPred := func(op skydb.Operator, k string, v interface{}) skydb.Predicate {
 				return skydb.Predicate{
@@ -350,6 +430,167 @@ func TestMatchingSubscriptions(t *testing.T) {
 			subscriptions = db.GetMatchingSubscriptions(&record)
 			So(subscriptions, ShouldResemble, []skydb.Subscription{subor})
 		})
+
+		Convey("evaluate only subscriptions matching the equality index", func() {
+			evaluated := []string{}
+			matchSubscriptionPredicate = func(p *skydb.Predicate, record *skydb.Record) (bool, error) {
+				evaluated = append(evaluated, record.ID.Key)
+				return predMatchRecord(p, record)
+			}
+			defer func() {
+				matchSubscriptionPredicate = predMatchRecord
+			}()
+
+			categorySubs := []skydb.Subscription{}
+			for i := 0; i < 50; i++ {
+				sub := subscriptionForTest("device0", fmt.Sprintf("category%d", i), "note")
+				sub.Query.Predicate = skydb.Predicate{
+					Operator: skydb.And,
+					Children: []interface{}{
+						skydb.Predicate{
+							Operator: skydb.Equal,
+							Children: []interface{}{
+								skydb.Expression{Type: skydb.KeyPath, Value: "category"},
+								skydb.Expression{Type: skydb.Literal, Value: fmt.Sprintf("category%d", i)},
+							},
+						},
+						skydb.Predicate{
+							Operator: skydb.NotEqual,
+							Children: []interface{}{
+								skydb.Expression{Type: skydb.KeyPath, Value: "archived"},
+								skydb.Expression{Type: skydb.Literal, Value: true},
+							},
+						},
+					},
+				}
+				So(db.SaveSubscription(&sub), ShouldBeNil)
+				categorySubs = append(categorySubs, sub)
+			}
+			suball := subscriptionForTest("device1", "all", "note")
+			So(db.SaveSubscription(&suball), ShouldBeNil)
+
+			records := []*skydb.Record{
+				{
+					ID:   skydb.NewRecordID("note", "note7"),
+					Data: skydb.Data{"category": "category7"},
+				},
+				{
+					ID:   skydb.NewRecordID("note", "note42"),
+					Data: skydb.Data{"category": "category42", "archived": true},
+				},
+				{
+					ID:   skydb.NewRecordID("note", "uncategorized"),
+					Data: skydb.Data{},
+				},
+			}
+			matches := db.GetMatchingSubscriptionsBatch(records)
+			So(matches[0], ShouldResemble, []skydb.Subscription{categorySubs[7], suball})
+			So(matches[1], ShouldResemble, []skydb.Subscription{suball})
+			So(matches[2], ShouldResemble, []skydb.Subscription{suball})
+			So(evaluated, ShouldResemble, []string{
+				"note7", "note7",
+				"note42", "note42",
+				"uncategorized",
+			})
+		})
+	})
+}
+
+func TestSubscriptionEqualityIndex(t *testing.T) {
+	Convey("subscriptionEqualityIndex", t, func() {
+		keyPath := skydb.Expression{Type: skydb.KeyPath, Value: "category"}
+		literal := skydb.Expression{Type: skydb.Literal, Value: "recipe"}
+
+		Convey("indexes equality of a field and a literal", func() {
+			key, value, ok := subscriptionEqualityIndex(&skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{literal, keyPath},
+			})
+			So(ok, ShouldBeTrue)
+			So(key, ShouldEqual, "category")
+			So(value, ShouldEqual, "recipe")
+		})
+
+		Convey("indexes equality in a conjunction", func() {
+			key, value, ok := subscriptionEqualityIndex(&skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.NotEqual,
+						Children: []interface{}{keyPath, literal},
+					},
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "rating"},
+							skydb.Expression{Type: skydb.Literal, Value: float64(5)},
+						},
+					},
+				},
+			})
+			So(ok, ShouldBeTrue)
+			So(key, ShouldEqual, "rating")
+			So(value, ShouldEqual, 5)
+		})
+
+		Convey("does not index disjunction", func() {
+			_, _, ok := subscriptionEqualityIndex(&skydb.Predicate{
+				Operator: skydb.Or,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{keyPath, literal},
+					},
+				},
+			})
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("does not index key paths into a JSON field", func() {
+			key, _, ok := subscriptionEqualityIndex(&skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "stats.category"},
+					literal,
+				},
+			})
+			So(ok, ShouldBeFalse)
+
+			key, _, ok = subscriptionEqualityIndex(&skydb.Predicate{
+				Operator: skydb.And,
+				Children: []interface{}{
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{
+							skydb.Expression{Type: skydb.KeyPath, Value: "stats.category"},
+							literal,
+						},
+					},
+					skydb.Predicate{
+						Operator: skydb.Equal,
+						Children: []interface{}{keyPath, literal},
+					},
+				},
+			})
+			So(ok, ShouldBeTrue)
+			So(key, ShouldEqual, "category")
+		})
+
+		Convey("does not index reserved fields", func() {
+			_, _, ok := subscriptionEqualityIndex(&skydb.Predicate{
+				Operator: skydb.Equal,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "_id"},
+					literal,
+				},
+			})
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("does not index empty predicate", func() {
+			_, _, ok := subscriptionEqualityIndex(&skydb.Predicate{})
+			So(ok, ShouldBeFalse)
+		})
 	})
 }
 
@@ -391,6 +632,98 @@ func TestGetSubscriptionsByDeviceID(t *testing.T) {
 			subscriptions := db.GetSubscriptionsByDeviceID("notexistdeviceid")
 			So(subscriptions, ShouldBeEmpty)
 		})
+
+		Convey("lists subscriptions of each device", func() {
+			subscriptions, err := db.GetSubscriptionsByDevice("device0")
+			So(err, ShouldBeNil)
+			So(subscriptions, ShouldResemble, []skydb.Subscription{sub00, sub01})
+
+			subscriptions, err = db.GetSubscriptionsByDevice("device1")
+			So(err, ShouldBeNil)
+			So(subscriptions, ShouldResemble, []skydb.Subscription{sub10})
+
+			subscriptions, err = db.GetSubscriptionsByDevice("device2")
+			So(err, ShouldBeNil)
+			So(subscriptions, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestSubscriptionMatchesRecord(t *testing.T) {
+	Convey("Database", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		db := c.PublicDB()
+
+		// fixture
+		addUser(t, c, "userid")
+		addDevice(t, c, "userid", "device0")
+
+		sub := subscriptionForTest("device0", "sub", "note")
+		sub.Query.Predicate = skydb.Predicate{
+			Operator: skydb.Equal,
+			Children: []interface{}{
+				skydb.Expression{Type: skydb.KeyPath, Value: "category"},
+				skydb.Expression{Type: skydb.Literal, Value: "recipe"},
+			},
+		}
+		So(db.SaveSubscription(&sub), ShouldBeNil)
+
+		Convey("matches a record satisfying the predicate", func() {
+			record := skydb.Record{
+				ID:   skydb.NewRecordID("note", "id"),
+				Data: skydb.Data{"category": "recipe"},
+			}
+			matched, err := db.SubscriptionMatchesRecord("sub", &record)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeTrue)
+		})
+
+		Convey("does not match a record not satisfying the predicate", func() {
+			record := skydb.Record{
+				ID:   skydb.NewRecordID("note", "id"),
+				Data: skydb.Data{"category": "travel"},
+			}
+			matched, err := db.SubscriptionMatchesRecord("sub", &record)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeFalse)
+		})
+
+		Convey("does not match a record of another type", func() {
+			record := skydb.Record{
+				ID:   skydb.NewRecordID("article", "id"),
+				Data: skydb.Data{"category": "recipe"},
+			}
+			matched, err := db.SubscriptionMatchesRecord("sub", &record)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeFalse)
+		})
+
+		Convey("returns ErrSubscriptionNotFound for a non-exist subscription", func() {
+			record := skydb.Record{ID: skydb.NewRecordID("note", "id")}
+			_, err := db.SubscriptionMatchesRecord("notexistsubscriptionid", &record)
+			So(err, ShouldEqual, skydb.ErrSubscriptionNotFound)
+		})
+
+		Convey("returns error for a predicate with an unsupported operator", func() {
+			sub := subscriptionForTest("device0", "sub-gt", "note")
+			sub.Query.Predicate = skydb.Predicate{
+				Operator: skydb.GreaterThan,
+				Children: []interface{}{
+					skydb.Expression{Type: skydb.KeyPath, Value: "rating"},
+					skydb.Expression{Type: skydb.Literal, Value: float64(3)},
+				},
+			}
+			So(db.SaveSubscription(&sub), ShouldBeNil)
+
+			record := skydb.Record{
+				ID:   skydb.NewRecordID("note", "id"),
+				Data: skydb.Data{"rating": float64(5)},
+			}
+			_, err := db.SubscriptionMatchesRecord("sub-gt", &record)
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
 
@@ -427,7 +760,9 @@ func TestPredicateMatchRecord(t *testing.T) {
 				},
 			}
 
-			So(predMatchRecord(&predicate, &record1), ShouldBeTrue)
+			matched, err := predMatchRecord(&predicate, &record1)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeTrue)
 		})
 
 		Convey("Not match record with predicate in", func() {
@@ -445,7 +780,54 @@ func TestPredicateMatchRecord(t *testing.T) {
 				},
 			}
 
-			So(predMatchRecord(&predicate, &record1), ShouldBeFalse)
+			matched, err := predMatchRecord(&predicate, &record1)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeFalse)
+		})
+
+		Convey("Match record with predicate null", func() {
+			matched, err := predMatchRecord(&skydb.Predicate{
+				Operator: skydb.NoValue,
+				Children: []interface{}{
+					skydb.Expression{
+						Type:  skydb.KeyPath,
+						Value: "content",
+					},
+				},
+			}, &record1)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeTrue)
+
+			matched, err = predMatchRecord(&skydb.Predicate{
+				Operator: skydb.HasValue,
+				Children: []interface{}{
+					skydb.Expression{
+						Type:  skydb.KeyPath,
+						Value: "content",
+					},
+				},
+			}, &record1)
+			So(err, ShouldBeNil)
+			So(matched, ShouldBeFalse)
+		})
+
+		Convey("returns error for an unsupported operator", func() {
+			predicate := skydb.Predicate{
+				Operator: skydb.Like,
+				Children: []interface{}{
+					skydb.Expression{
+						Type:  skydb.KeyPath,
+						Value: "category",
+					},
+					skydb.Expression{
+						Type:  skydb.Literal,
+						Value: "rec%",
+					},
+				},
+			}
+
+			_, err := predMatchRecord(&predicate, &record1)
+			So(err, ShouldNotBeNil)
 		})
 	})
 }
@@ -30,4 +30,12 @@ func (db *database) Rollback() (err error) {
 	return db.c.Rollback()
 }
 
+func (db *database) Savepoint(name string) (err error) {
+	return db.c.Savepoint(name)
+}
+
+func (db *database) RollbackTo(name string) (err error) {
+	return db.c.RollbackTo(name)
+}
+
 var _ skydb.Transactional = &database{}
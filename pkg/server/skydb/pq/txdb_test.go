@@ -17,6 +17,8 @@ package pq
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -110,6 +112,67 @@ func TestTxDB(t *testing.T) {
 			})
 		})
 
+		Convey("RollbackTo undo the changes after Savepoint", func() {
+			_, err := db.Extend("record", skydb.RecordSchema{
+				"ref": skydb.FieldType{
+					Type:          skydb.TypeReference,
+					ReferenceType: "record",
+				},
+			})
+			So(err, ShouldBeNil)
+
+			So(db.Begin(), ShouldBeNil)
+
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("record", "0"),
+				Data:    map[string]interface{}{"content": "new0"},
+				OwnerID: "ownerID",
+			}), ShouldBeNil)
+
+			So(db.Savepoint("before_save"), ShouldBeNil)
+
+			// fails because the referenced record does not exist
+			So(db.Save(&skydb.Record{
+				ID: skydb.NewRecordID("record", "1"),
+				Data: map[string]interface{}{
+					"content": "new1",
+					"ref":     skydb.NewReference("record", "notexist"),
+				},
+				OwnerID: "ownerID",
+			}), ShouldNotBeNil)
+
+			So(db.RollbackTo("before_save"), ShouldBeNil)
+
+			So(db.Save(&skydb.Record{
+				ID:      skydb.NewRecordID("record", "3"),
+				Data:    map[string]interface{}{"content": "new3"},
+				OwnerID: "ownerID",
+			}), ShouldBeNil)
+
+			So(db.Commit(), ShouldBeNil)
+
+			var content string
+			err = dbx.QueryRowxContext(c.context, `SELECT content FROM "record" WHERE _id = '0'`).
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "new0")
+
+			err = dbx.QueryRowxContext(c.context, `SELECT content FROM "record" WHERE _id = '1'`).
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "original1")
+
+			err = dbx.QueryRowxContext(c.context, `SELECT content FROM "record" WHERE _id = '3'`).
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "new3")
+		})
+
+		Convey("Savepoint/RollbackTo on a non-Begin'ed db returns ErrDatabaseTxDidNotBegin", func() {
+			So(db.Savepoint("savepoint"), ShouldEqual, skydb.ErrDatabaseTxDidNotBegin)
+			So(db.RollbackTo("savepoint"), ShouldEqual, skydb.ErrDatabaseTxDidNotBegin)
+		})
+
 		Convey("Begin on a Begin'ed db returns ErrDatabaseTxDidBegin", func() {
 			So(db.Begin(), ShouldBeNil)
 			err := db.Begin()
@@ -136,6 +199,95 @@ func TestTxDB(t *testing.T) {
 		})
 	})
 
+	Convey("RunInTransaction", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		realDelay := transactionRetryDelay
+		transactionRetryDelay = func(attempt int) time.Duration { return 0 }
+		defer func() {
+			transactionRetryDelay = realDelay
+		}()
+
+		dbx := c.Db()
+		_, err := c.PublicDB().Extend("record", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		saveRecord := func(tx skydb.Conn, content string) error {
+			return tx.PublicDB().Save(&skydb.Record{
+				ID:      skydb.NewRecordID("record", "0"),
+				Data:    map[string]interface{}{"content": content},
+				OwnerID: "ownerID",
+			})
+		}
+
+		Convey("retries on serialization failure", func() {
+			attempts := 0
+			err := c.RunInTransaction(func(tx skydb.Conn) error {
+				attempts++
+				if err := saveRecord(tx, fmt.Sprintf("attempt%d", attempts)); err != nil {
+					return err
+				}
+				if attempts < 3 {
+					return &pq.Error{Code: "40001"}
+				}
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+
+			var content string
+			err = dbx.QueryRowxContext(c.context, `SELECT content FROM "record" WHERE _id = '0'`).
+				Scan(&content)
+			So(err, ShouldBeNil)
+			So(content, ShouldEqual, "attempt3")
+		})
+
+		Convey("retries on deadlock", func() {
+			attempts := 0
+			err := c.RunInTransaction(func(tx skydb.Conn) error {
+				attempts++
+				if attempts < 2 {
+					return &pq.Error{Code: "40P01"}
+				}
+				return saveRecord(tx, "content")
+			})
+			So(err, ShouldBeNil)
+			So(attempts, ShouldEqual, 2)
+		})
+
+		Convey("gives up after too many attempts", func() {
+			attempts := 0
+			err := c.RunInTransaction(func(tx skydb.Conn) error {
+				attempts++
+				if err := saveRecord(tx, "content"); err != nil {
+					return err
+				}
+				return &pq.Error{Code: "40001"}
+			})
+			So(err, ShouldResemble, &pq.Error{Code: "40001"})
+			So(attempts, ShouldEqual, maxTransactionAttempts)
+
+			var content string
+			err = dbx.QueryRowxContext(c.context, `SELECT content FROM "record" WHERE _id = '0'`).
+				Scan(&content)
+			So(err, ShouldEqual, sql.ErrNoRows)
+		})
+
+		Convey("does not retry on other errors", func() {
+			attempts := 0
+			fnErr := errors.New("some error")
+			err := c.RunInTransaction(func(tx skydb.Conn) error {
+				attempts++
+				return fnErr
+			})
+			So(err, ShouldEqual, fnErr)
+			So(attempts, ShouldEqual, 1)
+		})
+	})
+
 	Convey("TxDatabase with Context", t, func() {
 		c := getTestConn(t)
 		defer cleanupConn(t, c)
@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/lib/pq"
 	"github.com/paulmach/go.geo"
 	"github.com/skygeario/skygear-server/pkg/server/skydb"
 )
@@ -38,11 +39,14 @@ const (
 	TypeBoolean               = "boolean"
 	TypeJSON                  = "jsonb"
 	TypeTimestamp             = "timestamp without time zone"
+	TypeTimestampTZ           = "timestamp with time zone"
 	TypeLocation              = "geometry(Point)"
 	TypeInteger               = "integer"
 	TypeSerial                = "serial UNIQUE"
 	TypeBigInteger            = "bigint"
 	TypeGeometry              = "geometry"
+	TypeStringArray           = "text[]"
+	TypeBytea                 = "bytea"
 )
 
 func pqDataType(dataType skydb.DataType) string {
@@ -57,6 +61,8 @@ func pqDataType(dataType skydb.DataType) string {
 		return TypeInteger
 	case skydb.TypeDateTime:
 		return TypeTimestamp
+	case skydb.TypeDateTimeTZ:
+		return TypeTimestampTZ
 	case skydb.TypeBoolean:
 		return TypeBoolean
 	case skydb.TypeJSON:
@@ -67,6 +73,8 @@ func pqDataType(dataType skydb.DataType) string {
 		return TypeSerial
 	case skydb.TypeGeometry:
 		return TypeGeometry
+	case skydb.TypeAssetList:
+		return TypeStringArray
 	}
 }
 
@@ -148,6 +156,79 @@ func (na *nullAsset) Scan(value interface{}) error {
 	return nil
 }
 
+type assetVariantsValue map[string]skydb.AssetVariant
+
+func (variants assetVariantsValue) Value() (driver.Value, error) {
+	if variants == nil {
+		return nil, nil
+	}
+	return json.Marshal(map[string]skydb.AssetVariant(variants))
+}
+
+type nullAssetVariants struct {
+	Variants map[string]skydb.AssetVariant
+	Valid    bool
+}
+
+func (nav *nullAssetVariants) Scan(value interface{}) error {
+	data, ok := value.([]byte)
+	if value == nil || !ok {
+		nav.Variants = nil
+		nav.Valid = false
+		return nil
+	}
+
+	err := json.Unmarshal(data, &nav.Variants)
+	nav.Valid = err == nil
+	return err
+}
+
+type assetListValue []*skydb.Asset
+
+func (assets assetListValue) Value() (driver.Value, error) {
+	return pq.StringArray(assetNames(assets)).Value()
+}
+
+// assetNames returns the names of the assets in order, skipping nil
+// assets.
+func assetNames(assets []*skydb.Asset) []string {
+	names := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		if asset != nil {
+			names = append(names, asset.Name)
+		}
+	}
+	return names
+}
+
+type nullAssetList struct {
+	Assets []*skydb.Asset
+	Valid  bool
+}
+
+func (nal *nullAssetList) Scan(value interface{}) error {
+	if value == nil {
+		nal.Assets = nil
+		nal.Valid = false
+		return nil
+	}
+
+	var names pq.StringArray
+	if err := names.Scan(value); err != nil {
+		return fmt.Errorf("failed to scan AssetList: %v", err)
+	}
+
+	nal.Assets = make([]*skydb.Asset, len(names))
+	for i, name := range names {
+		nal.Assets[i] = &skydb.Asset{
+			Name: name,
+		}
+	}
+	nal.Valid = true
+
+	return nil
+}
+
 type nullLocation struct {
 	Location skydb.Location
 	Valid    bool
@@ -0,0 +1,229 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pq
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+)
+
+// unionFetchSize is the number of records fetched from the cursor of
+// each query of a union at a time.
+var unionFetchSize = 100
+
+// unionCursorSeq numbers the cursors of union queries, so that unions
+// read in the same transaction do not share cursor names.
+var unionCursorSeq uint64
+
+// QueryUnion reads each query through a cursor, so that the results of
+// all queries are read alternately on one connection as they are
+// merged, instead of being read in advance. Text columns are sorted as
+// bytes, so that Postgres orders them as UnionRows compares them.
+func (db *database) QueryUnion(queries []*skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	if err := skydb.ValidateUnionQueries(queries); err != nil {
+		return nil, err
+	}
+
+	if len(queries) == 0 {
+		return skydb.EmptyRows, nil
+	}
+
+	// Cursors only live in a transaction, so one is begun for the union
+	// unless the connection is in one already.
+	ext := db.c.Db()
+	var tx *sqlx.Tx
+	if db.c.tx == nil {
+		var err error
+		tx, err = db.c.db.BeginTxx(db.c.context, nil)
+		if err != nil {
+			return nil, err
+		}
+		ext = tx
+	}
+
+	results := make([]*skydb.Rows, 0, len(queries))
+	closeAll := func() {
+		for _, result := range results {
+			result.Close()
+		}
+		if tx != nil {
+			tx.Rollback()
+		}
+	}
+	for _, query := range queries {
+		rows, err := db.queryCursor(ext, query, accessControlOptions)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		results = append(results, rows)
+	}
+
+	union := skydb.NewUnionRows(querySorts(queries[0]), results)
+	if tx == nil {
+		return skydb.NewRows(union), nil
+	}
+	return skydb.NewRows(txRowsIter{union, tx}), nil
+}
+
+// queryCursor declares a cursor for the query and returns rows fetching
+// the records from it.
+func (db *database) queryCursor(ext ExtContext, query *skydb.Query, accessControlOptions *skydb.AccessControlOptions) (*skydb.Rows, error) {
+	// The default limit is applied without the extra record telling
+	// whether records are left out, which a union does not report.
+	if query.Limit == nil && db.c.defaultQueryLimit > 0 {
+		limitedQuery := *query
+		limit := db.c.defaultQueryLimit
+		limitedQuery.Limit = &limit
+		query = &limitedQuery
+	}
+
+	sel, err := db.selectRecords(query, accessControlOptions, true)
+	if err != nil {
+		return nil, err
+	}
+	if sel == nil {
+		return skydb.EmptyRows, nil
+	}
+
+	sql, args, err := sel.q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("_union_%d", atomic.AddUint64(&unionCursorSeq, 1))
+	stmt := fmt.Sprintf("DECLARE %s NO SCROLL CURSOR FOR %s", pq.QuoteIdentifier(name), sql)
+	if _, err := ext.ExecContext(db.c.context, stmt, args...); err != nil {
+		log.WithFields(logrus.Fields{
+			"sql":  stmt,
+			"args": db.c.logArgs(args),
+			"err":  err,
+		}).Errorln("Failed to declare cursor")
+		return nil, queryError(err)
+	}
+
+	rowsi := &cursorRowsIter{
+		db:         db,
+		ext:        ext,
+		name:       name,
+		recordType: query.Type,
+		typemap:    sel.typemap,
+	}
+	// The first batch is fetched now, so that errors of executing the
+	// query are returned here as in Query.
+	if err := rowsi.fetch(); err != nil {
+		rowsi.Close()
+		return nil, queryError(err)
+	}
+	return inTimeZone(skydb.NewRows(rowsi), sel.typemap, query.TimeZone), nil
+}
+
+// cursorRowsIter is a RowsIter of records fetched from a cursor a batch
+// at a time. A batch is read as soon as it is fetched, because the
+// connection cannot fetch from another cursor while rows are unread.
+type cursorRowsIter struct {
+	db          *database
+	ext         ExtContext
+	name        string
+	recordType  string
+	typemap     skydb.RecordSchema
+	batch       []scannedRecord
+	done        bool // whether the cursor has no more records to fetch
+	recordCount *uint64
+}
+
+// scannedRecord is a record scanned from a row, or the error of
+// scanning it.
+type scannedRecord struct {
+	record skydb.Record
+	err    error
+}
+
+func (rowsi *cursorRowsIter) fetch() error {
+	rows, err := rowsi.ext.QueryxContext(rowsi.db.c.context,
+		fmt.Sprintf("FETCH %d FROM %s", unionFetchSize, pq.QuoteIdentifier(rowsi.name)))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	rs := newRecordScanner(rowsi.recordType, rowsi.typemap, rows, rowsi.db.c.fieldKeyProvider)
+	rowsi.batch = make([]scannedRecord, 0, unionFetchSize)
+	for rows.Next() {
+		var record skydb.Record
+		err := rs.Scan(&record)
+		if err != nil {
+			if _, ok := err.(*skydb.RowScanError); !ok {
+				return err
+			}
+		}
+		rowsi.batch = append(rowsi.batch, scannedRecord{record, err})
+	}
+	if rs.recordCount != nil {
+		rowsi.recordCount = rs.recordCount
+	}
+	rowsi.done = len(rowsi.batch) < unionFetchSize
+	return rows.Err()
+}
+
+func (rowsi *cursorRowsIter) Close() error {
+	_, err := rowsi.ext.ExecContext(rowsi.db.c.context,
+		"CLOSE "+pq.QuoteIdentifier(rowsi.name))
+	return err
+}
+
+func (rowsi *cursorRowsIter) Next(record *skydb.Record) error {
+	if len(rowsi.batch) == 0 {
+		if rowsi.done {
+			return io.EOF
+		}
+		if err := rowsi.fetch(); err != nil {
+			return err
+		}
+		if len(rowsi.batch) == 0 {
+			return io.EOF
+		}
+	}
+
+	scanned := rowsi.batch[0]
+	rowsi.batch = rowsi.batch[1:]
+	*record = scanned.record
+	return scanned.err
+}
+
+func (rowsi *cursorRowsIter) OverallRecordCount() *uint64 {
+	return rowsi.recordCount
+}
+
+// txRowsIter is a RowsIter reading rows in a transaction begun for
+// them, which is committed when the rows are closed.
+type txRowsIter struct {
+	skydb.RowsIter
+	tx *sqlx.Tx
+}
+
+func (rowsi txRowsIter) Close() error {
+	err := rowsi.RowsIter.Close()
+	if commitErr := rowsi.tx.Commit(); err == nil {
+		err = commitErr
+	}
+	return err
+}
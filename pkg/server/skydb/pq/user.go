@@ -75,9 +75,15 @@ func (c *conn) CreateAuth(authinfo *skydb.AuthInfo) (err error) {
 		disabledExpiry,
 	)
 
+	// Duplicates are detected by the primary key rather than by looking
+	// up the ID beforehand, so that of two concurrent inserts of the same
+	// ID only one can succeed.
 	_, err = c.ExecWith(builder)
-	if isUniqueViolated(err) {
-		return skydb.ErrUserDuplicated
+	if err != nil {
+		if isUniqueViolated(err) {
+			return skydb.ErrUserDuplicated
+		}
+		return err
 	}
 
 	if err := c.UpdateUserRoles(authinfo); err != nil {
@@ -96,6 +102,46 @@ func (c *conn) CreateAuth(authinfo *skydb.AuthInfo) (err error) {
 	return err
 }
 
+func (c *conn) CreateOrGetAuth(authinfo *skydb.AuthInfo) (created bool, err error) {
+	if c.tx != nil {
+		return c.createOrGetAuth(authinfo)
+	}
+	err = c.RunInTransaction(func(tx skydb.Conn) error {
+		var txErr error
+		created, txErr = tx.(*conn).createOrGetAuth(authinfo)
+		return txErr
+	})
+	return
+}
+
+func (c *conn) createOrGetAuth(authinfo *skydb.AuthInfo) (bool, error) {
+	// Principal IDs are not covered by a unique constraint, so concurrent
+	// callers are serialized by a lock held until the transaction ends.
+	if _, err := c.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, c.tableName("_auth")); err != nil {
+		return false, fmt.Errorf("failed to lock auth: %s", err)
+	}
+
+	existing := skydb.AuthInfo{}
+	err := c.GetAuth(authinfo.ID, &existing)
+	for principalID := range authinfo.ProviderInfo {
+		if err != skydb.ErrUserNotFound {
+			break
+		}
+		err = c.GetAuthByPrincipalID(principalID, &existing)
+	}
+	if err == nil {
+		*authinfo = existing
+		return false, nil
+	} else if err != skydb.ErrUserNotFound {
+		return false, err
+	}
+
+	if err := c.CreateAuth(authinfo); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // nolint: gocyclo
 func (c *conn) UpdateAuth(authinfo *skydb.AuthInfo) (err error) {
 	var (
@@ -494,3 +540,229 @@ func managedIndexName(recordType string, index skydb.Index) string {
 	sort.Strings(fields)
 	return fmt.Sprintf("auth_record_keys_%s_%s_key", recordType, strings.Join(fields, "_"))
 }
+
+func (c *conn) MergeUsers(sourceID, targetID string) error {
+	if sourceID == targetID {
+		return fmt.Errorf("cannot merge user %s into itself", sourceID)
+	}
+
+	if c.tx != nil {
+		return c.mergeUsers(sourceID, targetID)
+	}
+	return c.RunInTransaction(func(tx skydb.Conn) error {
+		return tx.(*conn).mergeUsers(sourceID, targetID)
+	})
+}
+
+func (c *conn) mergeUsers(sourceID, targetID string) error {
+	// Lock both users so that they are not deleted or merged
+	// elsewhere in the meantime.
+	var count int
+	err := c.QueryRowx(
+		fmt.Sprintf("SELECT COUNT(*) FROM (SELECT id FROM %s WHERE id IN ($1, $2) FOR UPDATE) AS a",
+			c.tableName("_auth")),
+		sourceID, targetID,
+	).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count != 2 {
+		return skydb.ErrUserNotFound
+	}
+
+	steps := []func(sourceID, targetID string) error{
+		c.mergeUserRecords,
+		c.mergeUserRelations,
+		c.mergeUserDevices,
+		c.mergeUserPrincipals,
+	}
+	for _, step := range steps {
+		if err := step(sourceID, targetID); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"_auth_role", "_password_history", "_verify_code"} {
+		builder := psql.Delete(c.tableName(table)).Where("auth_id = ?", sourceID)
+		if _, err := c.ExecWith(builder); err != nil {
+			return err
+		}
+	}
+	return c.DeleteAuth(sourceID)
+}
+
+// mergeUserRecords reattributes records owned, created or updated by the
+// source user, and records referencing it, to the target user. The user
+// record of the source user is deleted.
+func (c *conn) mergeUserRecords(sourceID, targetID string) error {
+	db := c.PublicDB().(*database)
+	recordTypes, err := db.recordTypes()
+	if err != nil {
+		return err
+	}
+
+	for _, recordType := range recordTypes {
+		if err := db.checkMergeConflict(recordType, sourceID, targetID); err != nil {
+			return err
+		}
+	}
+
+	userRecordType := db.UserRecordType()
+	for _, recordType := range recordTypes {
+		schema, err := db.RemoteColumnTypes(recordType)
+		if err != nil {
+			return err
+		}
+
+		for column, fieldType := range schema {
+			if fieldType.Type != skydb.TypeReference || fieldType.ReferenceType != userRecordType {
+				continue
+			}
+			builder := psql.Update(db.TableName(recordType)).
+				Set(pq.QuoteIdentifier(column), targetID).
+				Where(pq.QuoteIdentifier(column)+" = ?", sourceID)
+			if _, err := c.ExecWith(builder); err != nil {
+				return err
+			}
+		}
+	}
+
+	builder := psql.Delete(db.TableName(userRecordType)).Where("_id = ?", sourceID)
+	if _, err := c.ExecWith(builder); err != nil {
+		return err
+	}
+	if err := db.deleteLabels(skydb.NewRecordID(userRecordType, sourceID)); err != nil {
+		return err
+	}
+
+	for _, recordType := range recordTypes {
+		for _, column := range []string{"_owner_id", "_database_id", "_created_by", "_updated_by"} {
+			builder := psql.Update(db.TableName(recordType)).
+				Set(column, targetID).
+				Where(column+" = ?", sourceID)
+			if _, err := c.ExecWith(builder); err != nil {
+				return err
+			}
+		}
+		c.invalidateQueryCache(recordType)
+	}
+	return nil
+}
+
+// checkMergeConflict returns *skydb.UserMergeConflictError if a record
+// of the record type would have the same primary key as another record
+// after the source user is replaced by the target user in its database
+// and owner.
+func (db *database) checkMergeConflict(recordType, sourceID, targetID string) error {
+	table := db.TableName(recordType)
+	var recordID string
+	err := db.c.QueryRowx(fmt.Sprintf(`
+SELECT s._id FROM %[1]s s JOIN %[1]s d
+ON s._id = d._id AND (s._database_id, s._owner_id) <> (d._database_id, d._owner_id)
+WHERE (s._database_id = $1 OR s._owner_id = $1)
+AND (CASE WHEN s._database_id = $1 THEN $2 ELSE s._database_id END) =
+	(CASE WHEN d._database_id = $1 THEN $2 ELSE d._database_id END)
+AND (CASE WHEN s._owner_id = $1 THEN $2 ELSE s._owner_id END) =
+	(CASE WHEN d._owner_id = $1 THEN $2 ELSE d._owner_id END)
+LIMIT 1`, table), sourceID, targetID).Scan(&recordID)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return &skydb.UserMergeConflictError{
+		RecordID: skydb.NewRecordID(recordType, recordID),
+	}
+}
+
+// mergeUserRelations moves relation edges of the source user to the
+// target user. Edges the target user already has, and edges that would
+// relate the target user to itself, are dropped.
+func (c *conn) mergeUserRelations(sourceID, targetID string) error {
+	for _, table := range []string{"_friend", "_follow"} {
+		tableName := c.tableName(table)
+		for _, side := range [][2]string{{"left_id", "right_id"}, {"right_id", "left_id"}} {
+			this, other := side[0], side[1]
+			_, err := c.Exec(fmt.Sprintf(
+				`DELETE FROM %[1]s WHERE %[2]s = $1 AND (%[3]s = $2 OR %[3]s IN (SELECT %[3]s FROM %[1]s WHERE %[2]s = $2))`,
+				tableName, this, other,
+			), sourceID, targetID)
+			if err != nil {
+				return err
+			}
+
+			builder := psql.Update(tableName).
+				Set(this, targetID).
+				Where(this+" = ?", sourceID)
+			if _, err := c.ExecWith(builder); err != nil {
+				return err
+			}
+		}
+		c.invalidateQueryCache(table)
+	}
+	return nil
+}
+
+// mergeUserDevices moves devices and subscriptions of the source user to
+// the target user. Devices the target user has already registered with
+// the same token are dropped along with their subscriptions.
+func (c *conn) mergeUserDevices(sourceID, targetID string) error {
+	_, err := c.Exec(fmt.Sprintf(
+		`DELETE FROM %[1]s AS d WHERE auth_id = $1 AND EXISTS (SELECT 1 FROM %[1]s WHERE auth_id = $2 AND type = d.type AND token = d.token)`,
+		c.tableName("_device"),
+	), sourceID, targetID)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"_device", "_subscription"} {
+		builder := psql.Update(c.tableName(table)).
+			Set("auth_id", targetID).
+			Where("auth_id = ?", sourceID)
+		if _, err := c.ExecWith(builder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeUserPrincipals moves principals of the source user to the target
+// user, so that the target user can log in with them. Where the target
+// user already has a principal of the same provider, the target user's
+// principal is kept.
+func (c *conn) mergeUserPrincipals(sourceID, targetID string) error {
+	_, err := c.Exec(fmt.Sprintf(
+		`DELETE FROM %[1]s AS o WHERE user_id = $1 AND EXISTS (SELECT 1 FROM %[1]s WHERE user_id = $2 AND provider = o.provider)`,
+		c.tableName("_sso_oauth"),
+	), sourceID, targetID)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Exec(fmt.Sprintf(
+		`DELETE FROM %[1]s WHERE user_id = $1 AND EXISTS (SELECT 1 FROM %[1]s WHERE user_id = $2)`,
+		c.tableName("_sso_custom_token"),
+	), sourceID, targetID)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"_sso_oauth", "_sso_custom_token"} {
+		builder := psql.Update(c.tableName(table)).
+			Set("user_id", targetID).
+			Where("user_id = ?", sourceID)
+		if _, err := c.ExecWith(builder); err != nil {
+			return err
+		}
+	}
+
+	// Principals of auth providers are stored in provider_info.
+	_, err = c.Exec(fmt.Sprintf(
+		`UPDATE %[1]s AS t
+		SET provider_info = COALESCE(s.provider_info, '{}'::jsonb) || COALESCE(t.provider_info, '{}'::jsonb)
+		FROM %[1]s AS s
+		WHERE t.id = $2 AND s.id = $1`,
+		c.tableName("_auth"),
+	), sourceID, targetID)
+	return err
+}
@@ -15,6 +15,7 @@
 package pq
 
 import (
+	"context"
 	"database/sql"
 	"sort"
 	"testing"
@@ -114,6 +115,35 @@ func TestAuthCRUD(t *testing.T) {
 			So(c.CreateAuth(&authinfo), ShouldEqual, skydb.ErrUserDuplicated)
 		})
 
+		Convey("creates only one of the users created concurrently", func() {
+			conns := make([]skydb.Conn, 2)
+			for i := range conns {
+				otherConn, err := Open(context.Background(), testAppName(), skydb.RoleBasedAccess, "", skydb.DBConfig{})
+				So(err, ShouldBeNil)
+				defer otherConn.Close()
+				conns[i] = otherConn
+			}
+
+			errs := make(chan error, len(conns))
+			for _, otherConn := range conns {
+				go func(otherConn skydb.Conn) {
+					errs <- otherConn.RunInTransaction(func(tx skydb.Conn) error {
+						info := authinfo
+						return tx.CreateAuth(&info)
+					})
+				}(otherConn)
+			}
+
+			results := []error{<-errs, <-errs}
+			So(results, ShouldContain, nil)
+			So(results, ShouldContain, skydb.ErrUserDuplicated)
+
+			var count int
+			err := c.QueryRowx("SELECT COUNT(*) FROM _auth WHERE id = 'userid'").Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+
 		Convey("gets an existing User", func() {
 			err := c.CreateAuth(&authinfo)
 			So(err, ShouldBeNil)
@@ -236,6 +266,66 @@ func TestAuthCRUD(t *testing.T) {
 	})
 }
 
+func TestCreateOrGetAuth(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		authinfo := skydb.AuthInfo{
+			ID:    "userid",
+			Roles: []string{},
+			ProviderInfo: skydb.ProviderInfo{
+				"com.example:johndoe": map[string]interface{}{
+					"name": "John Doe",
+				},
+			},
+		}
+
+		Convey("creates user if absent", func() {
+			created, err := c.CreateOrGetAuth(&authinfo)
+			So(err, ShouldBeNil)
+			So(created, ShouldBeTrue)
+
+			fetched := skydb.AuthInfo{}
+			So(c.GetAuth("userid", &fetched), ShouldBeNil)
+			So(fetched.ProviderInfo, ShouldResemble, authinfo.ProviderInfo)
+		})
+
+		Convey("returns existing user of the same id", func() {
+			So(c.CreateAuth(&authinfo), ShouldBeNil)
+
+			another := skydb.AuthInfo{
+				ID: "userid",
+			}
+			created, err := c.CreateOrGetAuth(&another)
+			So(err, ShouldBeNil)
+			So(created, ShouldBeFalse)
+			So(another.ProviderInfo, ShouldResemble, authinfo.ProviderInfo)
+		})
+
+		Convey("returns existing user of the same principal", func() {
+			So(c.CreateAuth(&authinfo), ShouldBeNil)
+
+			another := skydb.AuthInfo{
+				ID: "anotheruserid",
+				ProviderInfo: skydb.ProviderInfo{
+					"com.example:johndoe": map[string]interface{}{},
+				},
+			}
+			created, err := c.CreateOrGetAuth(&another)
+			So(err, ShouldBeNil)
+			So(created, ShouldBeFalse)
+			So(another.ID, ShouldEqual, "userid")
+			So(another.ProviderInfo, ShouldResemble, authinfo.ProviderInfo)
+
+			var count int
+			err = c.QueryRowx("SELECT COUNT(*) FROM _auth").Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+		})
+	})
+}
+
 type passwordHistoryByLoggedAt []skydb.PasswordHistory
 
 func (a passwordHistoryByLoggedAt) Len() int      { return len(a) }
@@ -565,3 +655,135 @@ func TestAuthRecordKeys(t *testing.T) {
 		})
 	})
 }
+
+func TestMergeUsers(t *testing.T) {
+	Convey("Conn", t, func() {
+		c := getTestConn(t)
+		defer cleanupConn(t, c)
+
+		addUser(t, c, "sourceid")
+		addUser(t, c, "targetid")
+		addUser(t, c, "friendid")
+
+		db := c.PublicDB()
+		_, err := db.Extend("note", skydb.RecordSchema{
+			"content": skydb.FieldType{Type: skydb.TypeString},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("reattributes records to the target user", func() {
+			note := skydb.Record{
+				ID:        skydb.NewRecordID("note", "publicnote"),
+				OwnerID:   "sourceid",
+				CreatorID: "sourceid",
+				UpdaterID: "sourceid",
+				Data:      skydb.Data{"content": "public"},
+			}
+			So(db.Save(&note), ShouldBeNil)
+			privateNote := skydb.Record{
+				ID:      skydb.NewRecordID("note", "privatenote"),
+				OwnerID: "sourceid",
+				Data:    skydb.Data{"content": "private"},
+			}
+			So(c.PrivateDB("sourceid").Save(&privateNote), ShouldBeNil)
+
+			So(c.MergeUsers("sourceid", "targetid"), ShouldBeNil)
+
+			note = skydb.Record{}
+			So(db.Get(skydb.NewRecordID("note", "publicnote"), &note), ShouldBeNil)
+			So(note.OwnerID, ShouldEqual, "targetid")
+			So(note.CreatorID, ShouldEqual, "targetid")
+			So(note.UpdaterID, ShouldEqual, "targetid")
+
+			privateNote = skydb.Record{}
+			err := c.PrivateDB("targetid").Get(skydb.NewRecordID("note", "privatenote"), &privateNote)
+			So(err, ShouldBeNil)
+			So(privateNote.OwnerID, ShouldEqual, "targetid")
+		})
+
+		Convey("reattributes devices to the target user", func() {
+			device := skydb.Device{
+				ID:               "deviceid",
+				Type:             "ios",
+				Token:            "devicetoken",
+				AuthInfoID:       "sourceid",
+				LastRegisteredAt: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+			}
+			So(c.SaveDevice(&device), ShouldBeNil)
+
+			So(c.MergeUsers("sourceid", "targetid"), ShouldBeNil)
+
+			devices, err := c.QueryDevicesByUser("targetid")
+			So(err, ShouldBeNil)
+			So(len(devices), ShouldEqual, 1)
+			So(devices[0].ID, ShouldEqual, "deviceid")
+		})
+
+		Convey("moves relations without duplicating edges", func() {
+			So(c.AddRelation("sourceid", "_friend", "friendid"), ShouldBeNil)
+			So(c.AddRelation("targetid", "_friend", "friendid"), ShouldBeNil)
+			So(c.AddRelation("friendid", "_follow", "sourceid"), ShouldBeNil)
+			So(c.AddRelation("sourceid", "_follow", "targetid"), ShouldBeNil)
+
+			So(c.MergeUsers("sourceid", "targetid"), ShouldBeNil)
+
+			var count int
+			err := c.QueryRowx(`SELECT COUNT(*) FROM _friend WHERE left_id = 'targetid' AND right_id = 'friendid'`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			err = c.QueryRowx(`SELECT COUNT(*) FROM _follow WHERE left_id = 'friendid' AND right_id = 'targetid'`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 1)
+
+			err = c.QueryRowx(`SELECT COUNT(*) FROM _follow WHERE left_id = right_id`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("deletes the source user", func() {
+			So(c.MergeUsers("sourceid", "targetid"), ShouldBeNil)
+
+			authinfo := skydb.AuthInfo{}
+			So(c.GetAuth("sourceid", &authinfo), ShouldEqual, skydb.ErrUserNotFound)
+
+			var count int
+			err := c.QueryRowx(`SELECT COUNT(*) FROM "user" WHERE _id = 'sourceid'`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			So(c.GetAuth("targetid", &authinfo), ShouldBeNil)
+		})
+
+		Convey("returns conflict error when both users have a private record of the same id", func() {
+			for _, userID := range []string{"sourceid", "targetid"} {
+				So(c.PrivateDB(userID).Save(&skydb.Record{
+					ID:      skydb.NewRecordID("note", "privatenote"),
+					OwnerID: userID,
+					Data:    skydb.Data{"content": userID},
+				}), ShouldBeNil)
+			}
+
+			err := c.MergeUsers("sourceid", "targetid")
+			So(err, ShouldResemble, &skydb.UserMergeConflictError{
+				RecordID: skydb.NewRecordID("note", "privatenote"),
+			})
+
+			// nothing is merged
+			note := skydb.Record{}
+			So(c.PrivateDB("sourceid").Get(skydb.NewRecordID("note", "privatenote"), &note), ShouldBeNil)
+			So(note.Data["content"], ShouldEqual, "sourceid")
+			authinfo := skydb.AuthInfo{}
+			So(c.GetAuth("sourceid", &authinfo), ShouldBeNil)
+		})
+
+		Convey("returns ErrUserNotFound when a user does not exist", func() {
+			So(c.MergeUsers("notexistid", "targetid"), ShouldEqual, skydb.ErrUserNotFound)
+			So(c.MergeUsers("sourceid", "notexistid"), ShouldEqual, skydb.ErrUserNotFound)
+		})
+
+		Convey("returns error when merging a user into itself", func() {
+			So(c.MergeUsers("sourceid", "sourceid"), ShouldNotBeNil)
+		})
+	})
+}
@@ -17,7 +17,9 @@
 package skydb
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
@@ -37,9 +39,17 @@ const (
 //
 // Record order can be sorted w.r.t. a record field or a value returned
 // from a predefined function.
+//
+// A key path may continue into a JSON field, such as "stats.views" for
+// the number at key "views" of JSON field "stats". Records without a
+// number at the path come last regardless of the order.
+//
+// CaseInsensitive orders a string field without regard to letter case.
+// It has no effect on fields of other types.
 type Sort struct {
-	Expression Expression
-	Order      SortOrder
+	Expression      Expression
+	Order           SortOrder
+	CaseInsensitive bool
 }
 
 // Accept implements the Visitor pattern.
@@ -73,6 +83,15 @@ const (
 	ILike
 	In
 	Functional
+	Contains
+	IContains
+	JSONHasPath
+	Between
+	Regex
+	IRegex
+	ContainsAll
+	NoValue
+	HasValue
 )
 
 // IsCompound checks whether the Operator is a compound operator, meaning the
@@ -92,7 +111,7 @@ func (op Operator) IsBinary() bool {
 	switch op {
 	default:
 		return false
-	case Equal, GreaterThan, LessThan, GreaterThanOrEqual, LessThanOrEqual, NotEqual, Like, ILike, In:
+	case Equal, GreaterThan, LessThan, GreaterThanOrEqual, LessThanOrEqual, NotEqual, Like, ILike, In, Contains, IContains, JSONHasPath, Regex, IRegex, ContainsAll:
 		return true
 	}
 }
@@ -108,6 +127,16 @@ func (op Operator) IsCommutative() bool {
 	}
 }
 
+// ErrUnsupportedOperator is returned when a Predicate specifies an
+// Operator that the Database does not know how to evaluate.
+type ErrUnsupportedOperator struct {
+	Operator Operator
+}
+
+func (e ErrUnsupportedOperator) Error() string {
+	return fmt.Sprintf("skydb: unsupported operator %v", e.Operator)
+}
+
 // ExpressionType is the type of an Expression.
 type ExpressionType int
 
@@ -193,22 +222,50 @@ func (p Predicate) IsEmpty() bool {
 	return p.Operator == 0 || p.Children == nil
 }
 
+// MaxPredicateDepth is the maximum number of levels of nested compound
+// predicates accepted by Predicate.Validate. It guards the recursive
+// processing of predicates against exhausting the stack, and may be
+// changed at start up.
+var MaxPredicateDepth = 100
+
+// ErrPredicateTooDeep is returned by Predicate.Validate when the predicate
+// is nested deeper than MaxPredicateDepth.
+var ErrPredicateTooDeep = skyerr.NewError(skyerr.RecordQueryInvalid,
+	"predicate is nested too deeply")
+
 // Validate returns an Error if a Predicate is invalid.
 //
 // If a Predicate is validated without error, nil is returned.
 func (p Predicate) Validate() skyerr.Error {
-	return p.validate(nil)
+	return p.validate(nil, 1)
 }
 
 // validate is an internal version of the exported Validate() function.
 //
 // Additional information is passed as parameter to check the context
-// in which the predicate is specified.
-func (p Predicate) validate(parentPredicate *Predicate) skyerr.Error {
+// in which the predicate is specified. depth is the level of the
+// predicate, which is 1 for the outermost one.
+func (p Predicate) validate(parentPredicate *Predicate, depth int) skyerr.Error {
+	if depth > MaxPredicateDepth {
+		return ErrPredicateTooDeep
+	}
+
 	if p.Operator.IsBinary() && len(p.Children) != 2 {
 		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
 			"binary predicate must have 2 operands, got %d", len(p.Children))
 	}
+	if p.Operator == Not && len(p.Children) != 1 {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			"not predicate must have 1 operand, got %d", len(p.Children))
+	}
+	if p.Operator == Between && len(p.Children) != 3 {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			"between predicate must have 3 operands, got %d", len(p.Children))
+	}
+	if (p.Operator == NoValue || p.Operator == HasValue) && len(p.Children) != 1 {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			"null predicate must have 1 operand, got %d", len(p.Children))
+	}
 	if p.Operator == Functional && len(p.Children) != 1 {
 		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
 			"functional predicate must have 1 operand, got %d", len(p.Children))
@@ -222,7 +279,7 @@ func (p Predicate) validate(parentPredicate *Predicate) skyerr.Error {
 					"children of compound predicate must be a predicate")
 			}
 
-			if err := predicate.validate(&p); err != nil {
+			if err := predicate.validate(&p, depth+1); err != nil {
 				return err
 			}
 		}
@@ -241,6 +298,20 @@ func (p Predicate) validate(parentPredicate *Predicate) skyerr.Error {
 		return p.validateFunctionalPredicate(parentPredicate)
 	case Equal:
 		return p.validateEqualPredicate(parentPredicate)
+	case In:
+		return p.validateInPredicate(parentPredicate)
+	case Contains, IContains:
+		return p.validateContainsPredicate(parentPredicate)
+	case Regex, IRegex:
+		return p.validateRegexPredicate(parentPredicate)
+	case JSONHasPath:
+		return p.validateJSONHasPathPredicate(parentPredicate)
+	case ContainsAll:
+		return p.validateContainsAllPredicate(parentPredicate)
+	case Between:
+		return p.validateBetweenPredicate(parentPredicate)
+	case NoValue, HasValue:
+		return p.validateNullPredicate(parentPredicate)
 	}
 	return nil
 }
@@ -259,6 +330,17 @@ func (p Predicate) validateFunctionalPredicate(parentPredicate *Predicate) skyer
 				`user relation predicate with "%d" relation is not supported`,
 				f.RelationName)
 		}
+	case IsPublicReadableFunc:
+	case FullTextMatchFunc:
+		if len(f.Fields) == 0 {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				`full text match predicate must specify at least one field`)
+		}
+	case ACLContainsRoleFunc:
+		if f.Role == "" {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				`acl contains role predicate must specify a role`)
+		}
 	default:
 		return skyerr.NewError(skyerr.NotSupported,
 			`unsupported function for functional predicate`)
@@ -290,6 +372,152 @@ func (p Predicate) validateEqualPredicate(parentPredicate *Predicate) skyerr.Err
 	return nil
 }
 
+func (p Predicate) validateInPredicate(parentPredicate *Predicate) skyerr.Error {
+	lhs := p.Children[0].(Expression)
+	rhs := p.Children[1].(Expression)
+
+	if lhs.Type == Literal && rhs.Type == Literal {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`in predicate must have a keypath operand`)
+	}
+	return nil
+}
+
+// validateContainsPredicate checks that a Contains or IContains
+// predicate searches a keypath for a plain string. The string is
+// matched literally, so it must not be a pattern built by the caller.
+func (p Predicate) validateContainsPredicate(parentPredicate *Predicate) skyerr.Error {
+	lhs := p.Children[0].(Expression)
+	rhs := p.Children[1].(Expression)
+
+	if !lhs.IsKeyPath() {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`%v predicate must have a keypath on the left side`, p.Operator)
+	}
+	if !rhs.IsLiteralString() {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`%v predicate must have a string on the right side`, p.Operator)
+	}
+	return nil
+}
+
+// validateRegexPredicate checks that a Regex or IRegex predicate matches
+// a keypath against a pattern string. The pattern itself is checked by
+// the database.
+func (p Predicate) validateRegexPredicate(parentPredicate *Predicate) skyerr.Error {
+	lhs := p.Children[0].(Expression)
+	rhs := p.Children[1].(Expression)
+
+	if !lhs.IsKeyPath() {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`%v predicate must have a keypath on the left side`, p.Operator)
+	}
+	if !rhs.IsLiteralString() {
+		return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+			`%v predicate must have a pattern string on the right side`, p.Operator)
+	}
+	return nil
+}
+
+// validateJSONHasPathPredicate checks that a JSONHasPath predicate tests
+// a keypath for a path of dot-separated non-empty keys, such as
+// "feature.enabled".
+func (p Predicate) validateJSONHasPathPredicate(parentPredicate *Predicate) skyerr.Error {
+	lhs := p.Children[0].(Expression)
+	rhs := p.Children[1].(Expression)
+
+	if !lhs.IsKeyPath() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`json has path predicate must have a keypath on the left side`)
+	}
+	if !rhs.IsLiteralString() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`json has path predicate must have a path on the right side`)
+	}
+	for _, key := range strings.Split(rhs.Value.(string), ".") {
+		if key == "" {
+			return skyerr.NewErrorf(skyerr.RecordQueryInvalid,
+				`json path "%s" must not contain empty key`, rhs.Value)
+		}
+	}
+	return nil
+}
+
+// validateContainsAllPredicate checks that a ContainsAll predicate
+// tests a keypath for an array of elements, all of which must be in the
+// field for a record to match.
+func (p Predicate) validateContainsAllPredicate(parentPredicate *Predicate) skyerr.Error {
+	lhs := p.Children[0].(Expression)
+	rhs := p.Children[1].(Expression)
+
+	if !lhs.IsKeyPath() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`contains all predicate must have a keypath on the left side`)
+	}
+	if !rhs.IsLiteralArray() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`contains all predicate must have an array on the right side`)
+	}
+	return nil
+}
+
+// validateNullPredicate checks that a NoValue or HasValue predicate
+// tests a keypath.
+func (p Predicate) validateNullPredicate(parentPredicate *Predicate) skyerr.Error {
+	expr := p.Children[0].(Expression)
+	if !expr.IsKeyPath() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`null predicate must have a keypath operand`)
+	}
+	return nil
+}
+
+// validateBetweenPredicate checks that a Between predicate tests a
+// keypath against a lower and an upper bound, which are both numbers or
+// both datetimes.
+func (p Predicate) validateBetweenPredicate(parentPredicate *Predicate) skyerr.Error {
+	field := p.Children[0].(Expression)
+	lower := p.Children[1].(Expression)
+	upper := p.Children[2].(Expression)
+
+	if !field.IsKeyPath() {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`between predicate must have a keypath as the first operand`)
+	}
+
+	lowerType, lowerOK := rangeBoundType(lower)
+	upperType, upperOK := rangeBoundType(upper)
+	if !lowerOK || !upperOK {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`between predicate must have number or datetime bounds`)
+	}
+	if lowerType != upperType {
+		return skyerr.NewError(skyerr.RecordQueryInvalid,
+			`between predicate must have bounds of the same type`)
+	}
+	return nil
+}
+
+// rangeBoundType returns TypeNumber or TypeDateTime for a literal
+// number or datetime respectively.
+func rangeBoundType(expr Expression) (DataType, bool) {
+	if expr.Type != Literal || expr.Value == nil {
+		return 0, false
+	}
+
+	fieldType, err := DeriveFieldType(expr.Value)
+	if err != nil {
+		return 0, false
+	}
+	switch {
+	case fieldType.Type.IsNumberCompatibleType():
+		return TypeNumber, true
+	case fieldType.Type == TypeDateTime:
+		return TypeDateTime, true
+	}
+	return 0, false
+}
+
 // GetSubPredicates returns Predicate.Children as []Predicate.
 //
 // This method is only valid when Operator is either And, Or and Not. Caller
@@ -343,17 +571,234 @@ func (p Predicate) Accept(visitor Visitor) {
 	}
 }
 
+// IsTrue returns a Predicate that matches records whose boolean field
+// at keyPath is true.
+func IsTrue(keyPath string) Predicate {
+	return booleanEqualPredicate(keyPath, true)
+}
+
+// IsFalse returns a Predicate that matches records whose boolean field
+// at keyPath is false. Records without value in the field are not
+// matched.
+func IsFalse(keyPath string) Predicate {
+	return booleanEqualPredicate(keyPath, false)
+}
+
+// IsNull returns a Predicate that matches records without value in the
+// field at keyPath. For a reference field, these are the records not
+// referencing any record.
+func IsNull(keyPath string) Predicate {
+	return nullPredicate(NoValue, keyPath)
+}
+
+// IsNotNull returns a Predicate that matches records with a value in
+// the field at keyPath.
+func IsNotNull(keyPath string) Predicate {
+	return nullPredicate(HasValue, keyPath)
+}
+
+func nullPredicate(operator Operator, keyPath string) Predicate {
+	return Predicate{
+		Operator: operator,
+		Children: []interface{}{
+			Expression{Type: KeyPath, Value: keyPath},
+		},
+	}
+}
+
+func booleanEqualPredicate(keyPath string, value bool) Predicate {
+	return Predicate{
+		Operator: Equal,
+		Children: []interface{}{
+			Expression{Type: KeyPath, Value: keyPath},
+			Expression{Type: Literal, Value: value},
+		},
+	}
+}
+
 // Query specifies the type, predicate and sorting order of Database
 // query.
 type Query struct {
-	Type         string
-	Predicate    Predicate
+	Type      string
+	Predicate Predicate
+
+	// Sorts specifies the order of the queried records. Records are
+	// sorted by ID ascendingly if no sort is specified.
 	Sorts        []Sort
 	ComputedKeys map[string]Expression
 	DesiredKeys  []string
 	GetCount     bool
 	Limit        *uint64
 	Offset       uint64
+
+	// After, if not nil, restricts the query to the records following
+	// the position in the order of the query, which is usually that of
+	// the last record of the previous page. Unlike Offset, the records
+	// before the position are not read, so deep pages are as cheap as
+	// the first one. After is only supported when the query has no sort
+	// or a single sort on _id, _created_at or _updated_at. Records of
+	// the same sort value are ordered by ID.
+	After *QueryPosition
+
+	// WithLabel restricts the query to records having the label,
+	// as attached by Database.AddLabel.
+	WithLabel string
+
+	// AsRoles and AsOwner, when either is set, replace
+	// AccessControlOptions.ViewAsUser when filtering records by ACL.
+	// A record is returned if it is readable by any of the roles or
+	// by the user AsOwner. This is for querying on behalf of a user,
+	// and is only supported with RoleBasedAccess.
+	AsRoles []string
+	AsOwner string
+
+	// TimeZone is the location in which times of TypeDateTimeTZ fields
+	// are returned. Times are returned in UTC if TimeZone is nil.
+	TimeZone *time.Location
+}
+
+// QueryPosition is the position of a record in the order of a query,
+// identified by the value of the record for the sort of the query and
+// the key of its ID. The sort value is ignored if the query is sorted
+// by ID. See Query.After.
+type QueryPosition struct {
+	SortValue interface{}
+	ID        string
+}
+
+// Validate returns an error if the Query is malformed, such as when
+// an operator is given the wrong number of operands, or operands of
+// the wrong kind.
+//
+// Validate does not check the query against the record schema, so a
+// Query validated without error may still be rejected by Database.
+func (q Query) Validate() error {
+	if q.Type == "" {
+		return skyerr.NewError(skyerr.RecordQueryInvalid, "query type must not be empty")
+	}
+
+	if !q.Predicate.IsEmpty() {
+		if err := q.Predicate.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, sort := range q.Sorts {
+		if t := sort.Expression.Type; t != KeyPath && t != Function {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				"sort expression must be either a keypath or a function")
+		}
+	}
+
+	if q.After != nil {
+		if q.After.ID == "" {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				"after must identify a record")
+		}
+		if _, ok := q.KeysetSortKey(); !ok {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				"after is only supported with a single sort on _id, _created_at or _updated_at")
+		}
+	}
+
+	return nil
+}
+
+// KeysetSortKey returns the key path the Query is sorted by if the
+// Query supports After, which is "_id" if the Query has no sort.
+func (q Query) KeysetSortKey() (string, bool) {
+	if len(q.Sorts) == 0 {
+		return "_id", true
+	}
+
+	sort := q.Sorts[0]
+	if len(q.Sorts) != 1 || sort.Expression.Type != KeyPath || sort.CaseInsensitive {
+		return "", false
+	}
+
+	keyPath, _ := sort.Expression.Value.(string)
+	switch keyPath {
+	case "_id", "_created_at", "_updated_at":
+		return keyPath, true
+	default:
+		return "", false
+	}
+}
+
+// DistanceKey is the transient key set by WithinDistance.
+const DistanceKey = "distance"
+
+// WithinDistance restricts the query to records whose location field is
+// within meters of center, sorting the nearest record first. The
+// distance is returned in the transient of each record under
+// DistanceKey.
+//
+// The restriction is ANDed with the existing predicate, and the
+// sort by distance takes precedence over existing sorts.
+func (q *Query) WithinDistance(field string, center Location, meters float64) {
+	distance := Expression{
+		Type:  Function,
+		Value: DistanceFunc{Field: field, Location: center},
+	}
+
+	within := Predicate{
+		Operator: LessThanOrEqual,
+		Children: []interface{}{
+			distance,
+			Expression{Type: Literal, Value: meters},
+		},
+	}
+	if q.Predicate.IsEmpty() {
+		q.Predicate = within
+	} else {
+		q.Predicate = Predicate{
+			Operator: And,
+			Children: []interface{}{q.Predicate, within},
+		}
+	}
+
+	if q.ComputedKeys == nil {
+		q.ComputedKeys = map[string]Expression{}
+	}
+	q.ComputedKeys[DistanceKey] = distance
+
+	q.Sorts = append([]Sort{{Expression: distance, Order: Asc}}, q.Sorts...)
+}
+
+// ScoreKey is the transient key set by OrderByScore.
+const ScoreKey = "score"
+
+// OrderByScore restricts the query to records matching the full text
+// search, sorting the best match first. The match score is returned in
+// the transient of each record under ScoreKey.
+//
+// Like WithinDistance, the restriction is ANDed with the existing
+// predicate and the sort takes precedence over existing sorts.
+func (q *Query) OrderByScore(match FullTextMatchFunc) {
+	score := Expression{
+		Type:  Function,
+		Value: match,
+	}
+
+	matches := Predicate{
+		Operator: Functional,
+		Children: []interface{}{score},
+	}
+	if q.Predicate.IsEmpty() {
+		q.Predicate = matches
+	} else {
+		q.Predicate = Predicate{
+			Operator: And,
+			Children: []interface{}{q.Predicate, matches},
+		}
+	}
+
+	if q.ComputedKeys == nil {
+		q.ComputedKeys = map[string]Expression{}
+	}
+	q.ComputedKeys[ScoreKey] = score
+
+	q.Sorts = append([]Sort{{Expression: score, Order: Desc}}, q.Sorts...)
 }
 
 // Accept implements the Visitor pattern.
@@ -443,6 +888,136 @@ func (f CountFunc) DataType() DataType {
 	return TypeNumber
 }
 
+// LengthFunc represents a function that returns the number of characters
+// in a string field, or the number of elements in a list field.
+type LengthFunc struct {
+	Field string
+}
+
+// Args implements the Func interface
+func (f LengthFunc) Args() []interface{} {
+	return []interface{}{f.Field}
+}
+
+func (f LengthFunc) DataType() DataType {
+	return TypeNumber
+}
+
+// ReferencedKeyPaths implements the KeyPathFunc interface.
+func (f LengthFunc) ReferencedKeyPaths() []string {
+	return []string{f.Field}
+}
+
+// LowerFunc represents a function that returns a string field converted
+// to lower case.
+type LowerFunc struct {
+	Field string
+}
+
+// Args implements the Func interface
+func (f LowerFunc) Args() []interface{} {
+	return []interface{}{f.Field}
+}
+
+func (f LowerFunc) DataType() DataType {
+	return TypeString
+}
+
+// ReferencedKeyPaths implements the KeyPathFunc interface.
+func (f LowerFunc) ReferencedKeyPaths() []string {
+	return []string{f.Field}
+}
+
+// UpperFunc represents a function that returns a string field converted
+// to upper case.
+type UpperFunc struct {
+	Field string
+}
+
+// Args implements the Func interface
+func (f UpperFunc) Args() []interface{} {
+	return []interface{}{f.Field}
+}
+
+func (f UpperFunc) DataType() DataType {
+	return TypeString
+}
+
+// ReferencedKeyPaths implements the KeyPathFunc interface.
+func (f UpperFunc) ReferencedKeyPaths() []string {
+	return []string{f.Field}
+}
+
+// DateTruncFunc represents a function that truncates a datetime field
+// to the start of the day, week or month containing it. Unit is one of
+// "day", "week" or "month".
+type DateTruncFunc struct {
+	Field string
+	Unit  string
+}
+
+// Args implements the Func interface
+func (f DateTruncFunc) Args() []interface{} {
+	return []interface{}{f.Field, f.Unit}
+}
+
+func (f DateTruncFunc) DataType() DataType {
+	return TypeDateTime
+}
+
+// ReferencedKeyPaths implements the KeyPathFunc interface.
+func (f DateTruncFunc) ReferencedKeyPaths() []string {
+	return []string{f.Field}
+}
+
+// GeohashFunc represents a function that returns the geohash of a
+// location field, with Precision being the number of characters of the
+// geohash. Records close to each other share a geohash prefix, which
+// is useful for clustering records on a map.
+type GeohashFunc struct {
+	Field     string
+	Precision int
+}
+
+// Args implements the Func interface
+func (f GeohashFunc) Args() []interface{} {
+	return []interface{}{f.Field, f.Precision}
+}
+
+func (f GeohashFunc) DataType() DataType {
+	return TypeString
+}
+
+// ReferencedKeyPaths implements the KeyPathFunc interface.
+func (f GeohashFunc) ReferencedKeyPaths() []string {
+	return []string{f.Field}
+}
+
+// FullTextMatchFunc represents a full text search of Query in the
+// string fields listed in Fields.
+//
+// Used in a functional predicate, it matches records containing all the
+// words of Query. Used as an expression, it evaluates to the match score
+// of the record, which is higher for better matches.
+type FullTextMatchFunc struct {
+	Fields []string
+	Query  string
+}
+
+// Args implements the Func interface
+func (f FullTextMatchFunc) Args() []interface{} {
+	return []interface{}{f.Fields, f.Query}
+}
+
+func (f FullTextMatchFunc) DataType() DataType {
+	return TypeNumber
+}
+
+// ReferencedKeyPaths implements the KeyPathFunc interface.
+func (f FullTextMatchFunc) ReferencedKeyPaths() []string {
+	return f.Fields
+}
+
 // UserRelationFunc represents a function that is used to evaulate
 // whether a record satisfy certain user-based relation
 type UserRelationFunc struct {
@@ -466,6 +1041,34 @@ func (f UserRelationFunc) ReferencedKeyPaths() []string {
 	return []string{f.KeyPath}
 }
 
+// IsPublicReadableFunc represents a function that is used to evaluate
+// whether the access control list of a record allows the public to read it.
+type IsPublicReadableFunc struct{}
+
+// Args implements the Func interface
+func (f IsPublicReadableFunc) Args() []interface{} {
+	return []interface{}{}
+}
+
+func (f IsPublicReadableFunc) DataType() DataType {
+	return TypeBoolean
+}
+
+// ACLContainsRoleFunc represents a function that is used to evaluate
+// whether the access control list of a record has an entry for a role.
+type ACLContainsRoleFunc struct {
+	Role string
+}
+
+// Args implements the Func interface
+func (f ACLContainsRoleFunc) Args() []interface{} {
+	return []interface{}{f.Role}
+}
+
+func (f ACLContainsRoleFunc) DataType() DataType {
+	return TypeBoolean
+}
+
 // Visitor is a marker interface
 type Visitor interface{}
 
@@ -16,9 +16,12 @@ package skydb
 
 import (
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
 func TestQuery(t *testing.T) {
@@ -67,6 +70,173 @@ func TestQuery(t *testing.T) {
 				q.Accept(v)
 			})
 		})
+
+		Convey("WithinDistance", func() {
+			center := NewLocation(1, 2)
+			distance := Expression{
+				Type:  Function,
+				Value: DistanceFunc{Field: "location", Location: center},
+			}
+			within := Predicate{
+				Operator: LessThanOrEqual,
+				Children: []interface{}{
+					distance,
+					Expression{Type: Literal, Value: float64(500)},
+				},
+			}
+
+			Convey("should set up predicate, computed key and sort", func() {
+				q := Query{Type: "note"}
+				q.WithinDistance("location", center, 500)
+
+				So(q.Predicate, ShouldResemble, within)
+				So(q.ComputedKeys, ShouldResemble, map[string]Expression{
+					DistanceKey: distance,
+				})
+				So(q.Sorts, ShouldResemble, []Sort{
+					{Expression: distance, Order: Asc},
+				})
+				So(q.Validate(), ShouldBeNil)
+			})
+
+			Convey("should keep existing predicate and sorts", func() {
+				existing := Predicate{
+					Operator: Equal,
+					Children: []interface{}{
+						Expression{Type: KeyPath, Value: "category"},
+						Expression{Type: Literal, Value: "cafe"},
+					},
+				}
+				titleSort := Sort{
+					Expression: Expression{Type: KeyPath, Value: "title"},
+					Order:      Desc,
+				}
+				q := Query{
+					Type:      "note",
+					Predicate: existing,
+					Sorts:     []Sort{titleSort},
+				}
+				q.WithinDistance("location", center, 500)
+
+				So(q.Predicate, ShouldResemble, Predicate{
+					Operator: And,
+					Children: []interface{}{existing, within},
+				})
+				So(q.Sorts, ShouldResemble, []Sort{
+					{Expression: distance, Order: Asc},
+					titleSort,
+				})
+			})
+		})
+
+		Convey("OrderByScore", func() {
+			match := FullTextMatchFunc{
+				Fields: []string{"title", "cuisine"},
+				Query:  "chinese",
+			}
+			score := Expression{Type: Function, Value: match}
+			matches := Predicate{
+				Operator: Functional,
+				Children: []interface{}{score},
+			}
+
+			Convey("should set up predicate, computed key and sort", func() {
+				q := Query{Type: "restaurant"}
+				q.OrderByScore(match)
+
+				So(q.Predicate, ShouldResemble, matches)
+				So(q.ComputedKeys, ShouldResemble, map[string]Expression{
+					ScoreKey: score,
+				})
+				So(q.Sorts, ShouldResemble, []Sort{
+					{Expression: score, Order: Desc},
+				})
+				So(q.Validate(), ShouldBeNil)
+			})
+
+			Convey("should keep existing predicate", func() {
+				existing := Predicate{
+					Operator: Equal,
+					Children: []interface{}{
+						Expression{Type: KeyPath, Value: "city"},
+						Expression{Type: Literal, Value: "hong kong"},
+					},
+				}
+				q := Query{Type: "restaurant", Predicate: existing}
+				q.OrderByScore(match)
+
+				So(q.Predicate, ShouldResemble, Predicate{
+					Operator: And,
+					Children: []interface{}{existing, matches},
+				})
+			})
+
+			Convey("should not validate without fields", func() {
+				q := Query{Type: "restaurant"}
+				q.OrderByScore(FullTextMatchFunc{Query: "chinese"})
+
+				err, ok := q.Validate().(skyerr.Error)
+				So(ok, ShouldBeTrue)
+				So(err.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			})
+		})
+
+		Convey("After", func() {
+			after := &QueryPosition{
+				SortValue: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+				ID:        "note1",
+			}
+
+			Convey("should validate with a single sort on a reserved column", func() {
+				q := Query{
+					Type: "note",
+					Sorts: []Sort{
+						{Expression: Expression{Type: KeyPath, Value: "_created_at"}, Order: Desc},
+					},
+					After: after,
+				}
+				So(q.Validate(), ShouldBeNil)
+			})
+
+			Convey("should validate without sort", func() {
+				q := Query{Type: "note", After: after}
+				So(q.Validate(), ShouldBeNil)
+			})
+
+			Convey("should not validate with sort on other field", func() {
+				q := Query{
+					Type: "note",
+					Sorts: []Sort{
+						{Expression: Expression{Type: KeyPath, Value: "title"}},
+					},
+					After: after,
+				}
+				err, ok := q.Validate().(skyerr.Error)
+				So(ok, ShouldBeTrue)
+				So(err.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			})
+
+			Convey("should not validate with multiple sorts", func() {
+				q := Query{
+					Type: "note",
+					Sorts: []Sort{
+						{Expression: Expression{Type: KeyPath, Value: "_created_at"}},
+						{Expression: Expression{Type: KeyPath, Value: "_id"}},
+					},
+					After: after,
+				}
+				err, ok := q.Validate().(skyerr.Error)
+				So(ok, ShouldBeTrue)
+				So(err.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			})
+
+			Convey("should not validate without id", func() {
+				q := Query{Type: "note", After: &QueryPosition{}}
+				err, ok := q.Validate().(skyerr.Error)
+				So(ok, ShouldBeTrue)
+				So(err.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			})
+		})
 	})
 }
 
@@ -116,6 +286,81 @@ func TestPredicate(t *testing.T) {
 	})
 }
 
+func TestBooleanPredicate(t *testing.T) {
+	Convey("IsTrue", t, func() {
+		p := IsTrue("done")
+		So(p, ShouldResemble, Predicate{
+			Operator: Equal,
+			Children: []interface{}{
+				Expression{Type: KeyPath, Value: "done"},
+				Expression{Type: Literal, Value: true},
+			},
+		})
+		So(p.Validate(), ShouldBeNil)
+	})
+
+	Convey("IsFalse", t, func() {
+		p := IsFalse("done")
+		So(p, ShouldResemble, Predicate{
+			Operator: Equal,
+			Children: []interface{}{
+				Expression{Type: KeyPath, Value: "done"},
+				Expression{Type: Literal, Value: false},
+			},
+		})
+		So(p.Validate(), ShouldBeNil)
+	})
+}
+
+func TestNullPredicate(t *testing.T) {
+	Convey("IsNull", t, func() {
+		p := IsNull("category")
+		So(p, ShouldResemble, Predicate{
+			Operator: NoValue,
+			Children: []interface{}{
+				Expression{Type: KeyPath, Value: "category"},
+			},
+		})
+		So(p.Validate(), ShouldBeNil)
+	})
+
+	Convey("IsNotNull", t, func() {
+		p := IsNotNull("category")
+		So(p, ShouldResemble, Predicate{
+			Operator: HasValue,
+			Children: []interface{}{
+				Expression{Type: KeyPath, Value: "category"},
+			},
+		})
+		So(p.Validate(), ShouldBeNil)
+	})
+
+	Convey("null predicate of a literal", t, func() {
+		p := Predicate{
+			Operator: NoValue,
+			Children: []interface{}{
+				Expression{Type: Literal, Value: "category"},
+			},
+		}
+		err := p.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+	})
+
+	Convey("null predicate of two operands", t, func() {
+		p := Predicate{
+			Operator: HasValue,
+			Children: []interface{}{
+				Expression{Type: KeyPath, Value: "category"},
+				Expression{Type: Literal, Value: nil},
+			},
+		}
+		err := p.Validate()
+		So(err, ShouldNotBeNil)
+		So(err.Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+	})
+}
+
 func TestSort(t *testing.T) {
 	Convey("Sort", t, func() {
 		Convey("Accept", func() {
@@ -214,3 +459,252 @@ func TestMalformedPredicate(t *testing.T) {
 		})
 	})
 }
+
+func TestPredicateDepth(t *testing.T) {
+	Convey("Query with nested predicate", t, func() {
+		originalMaxDepth := MaxPredicateDepth
+		MaxPredicateDepth = 10
+		defer func() {
+			MaxPredicateDepth = originalMaxDepth
+		}()
+
+		nestedPredicate := func(depth int) Predicate {
+			predicate := Predicate{
+				Operator: Equal,
+				Children: []interface{}{
+					Expression{KeyPath, "content"},
+					Expression{Literal, "hello"},
+				},
+			}
+			for i := 1; i < depth; i++ {
+				predicate = Predicate{
+					Operator: Or,
+					Children: []interface{}{predicate},
+				}
+			}
+			return predicate
+		}
+
+		Convey("accepts predicate at the limit", func() {
+			query := Query{Type: "note", Predicate: nestedPredicate(10)}
+			So(query.Validate(), ShouldBeNil)
+		})
+
+		Convey("rejects predicate above the limit", func() {
+			query := Query{Type: "note", Predicate: nestedPredicate(11)}
+			So(query.Validate(), ShouldEqual, ErrPredicateTooDeep)
+		})
+
+		Convey("rejects hostile predicate without exhausting the stack", func() {
+			query := Query{Type: "note", Predicate: nestedPredicate(1000000)}
+			So(query.Validate(), ShouldEqual, ErrPredicateTooDeep)
+		})
+	})
+}
+
+func TestQueryValidate(t *testing.T) {
+	Convey("Query", t, func() {
+		Convey("valid query", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Equal,
+					Children: []interface{}{
+						Expression{KeyPath, "content"},
+						Expression{Literal, "hello"},
+					},
+				},
+				Sorts: []Sort{
+					{Expression: Expression{KeyPath, "content"}, Order: Ascending},
+				},
+			}
+			So(query.Validate(), ShouldBeNil)
+		})
+
+		Convey("empty query type", func() {
+			query := Query{}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("equal with wrong arity", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Equal,
+					Children: []interface{}{
+						Expression{KeyPath, "content"},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			So(err.(skyerr.Error).Message(), ShouldEqual, "binary predicate must have 2 operands, got 1")
+		})
+
+		Convey("not with wrong arity", func() {
+			equal := Predicate{
+				Operator: Equal,
+				Children: []interface{}{
+					Expression{KeyPath, "content"},
+					Expression{Literal, "hello"},
+				},
+			}
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Not,
+					Children: []interface{}{equal, equal},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("in with literals on both sides", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: In,
+					Children: []interface{}{
+						Expression{Literal, "hello"},
+						Expression{Literal, []interface{}{"hello"}},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("between with number bounds", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Between,
+					Children: []interface{}{
+						Expression{KeyPath, "order"},
+						Expression{Literal, int64(1)},
+						Expression{Literal, float64(2.5)},
+					},
+				},
+			}
+			So(query.Validate(), ShouldBeNil)
+		})
+
+		Convey("between with wrong arity", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Between,
+					Children: []interface{}{
+						Expression{KeyPath, "order"},
+						Expression{Literal, float64(1)},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Message(), ShouldEqual, "between predicate must have 3 operands, got 2")
+		})
+
+		Convey("between with mismatched bounds", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Between,
+					Children: []interface{}{
+						Expression{KeyPath, "order"},
+						Expression{Literal, float64(1)},
+						Expression{Literal, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			So(err.(skyerr.Error).Message(), ShouldEqual, "between predicate must have bounds of the same type")
+		})
+
+		Convey("between with string bounds", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Between,
+					Children: []interface{}{
+						Expression{KeyPath, "content"},
+						Expression{Literal, "a"},
+						Expression{Literal, "b"},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("regex with non-string pattern", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: Regex,
+					Children: []interface{}{
+						Expression{KeyPath, "content"},
+						Expression{Literal, float64(1)},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			So(err.(skyerr.Error).Message(), ShouldEqual, "Regex predicate must have a pattern string on the right side")
+		})
+
+		Convey("contains all with non-array operand", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: ContainsAll,
+					Children: []interface{}{
+						Expression{KeyPath, "tags"},
+						Expression{Literal, "important"},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+			So(err.(skyerr.Error).Message(), ShouldEqual, "contains all predicate must have an array on the right side")
+		})
+
+		Convey("nested predicate with misplaced expression", func() {
+			query := Query{
+				Type: "note",
+				Predicate: Predicate{
+					Operator: And,
+					Children: []interface{}{
+						Expression{KeyPath, "content"},
+					},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("sort by literal", func() {
+			query := Query{
+				Type: "note",
+				Sorts: []Sort{
+					{Expression: Expression{Literal, "hello"}, Order: Ascending},
+				},
+			}
+			err := query.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+	})
+}
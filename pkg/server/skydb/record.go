@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/skygeario/skygear-server/pkg/server/asset"
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 )
 
 // RecordID identifies an unique record in a Database
@@ -65,6 +66,29 @@ func (id *RecordID) UnmarshalText(data []byte) error {
 	return nil
 }
 
+// ParseRecordID parses the string form of a RecordID, which is the
+// record type and the key separated by a slash, as returned by
+// RecordID.String. Both parts must be non-empty and there must be
+// exactly one slash. Other characters, such as the colon in a record
+// type like "ns:note", are allowed as record types are always quoted
+// in SQL.
+func ParseRecordID(s string) (RecordID, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return RecordID{}, skyerr.NewErrorf(skyerr.InvalidArgument,
+			`invalid record id "%s": expect exactly one slash between record type and key`, s)
+	}
+	if parts[0] == "" {
+		return RecordID{}, skyerr.NewErrorf(skyerr.InvalidArgument,
+			`invalid record id "%s": record type is empty`, s)
+	}
+	if parts[1] == "" {
+		return RecordID{}, skyerr.NewErrorf(skyerr.InvalidArgument,
+			`invalid record id "%s": key is empty`, s)
+	}
+	return NewRecordID(parts[0], parts[1]), nil
+}
+
 // IsEmpty returns whether the RecordID is empty.
 func (id *RecordID) IsEmpty() bool {
 	return id.Type == "" && id.Key == ""
@@ -76,22 +100,142 @@ type Asset struct {
 	Size        int64
 	Public      bool
 	Signer      asset.URLSigner
+
+	// Variants are the files derived from the asset, such as thumbnails
+	// of an image, keyed by the name of the variant.
+	Variants map[string]AssetVariant
+}
+
+// AssetVariant is a file derived from an Asset, stored in the asset
+// store under its own name.
+type AssetVariant struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
 }
 
 // SignedURL will try to return a signedURL with the injected Signer.
 func (a *Asset) SignedURL() string {
+	return a.signedURL(a.Name)
+}
+
+// VariantSignedURL will try to return a signedURL of the named variant
+// with the injected Signer. It returns an empty string if the asset does
+// not have such variant.
+func (a *Asset) VariantSignedURL(variant string) string {
+	v, ok := a.Variants[variant]
+	if !ok {
+		return ""
+	}
+	return a.signedURL(v.Name)
+}
+
+func (a *Asset) signedURL(name string) string {
 	if a.Signer == nil {
 		log.Warnf("Unable to generate signed url of asset because no singer is injected.")
 		return ""
 	}
 
-	url, err := a.Signer.SignedURL(a.Name)
+	url, err := a.Signer.SignedURL(name)
 	if err != nil {
 		log.Warnf("Unable to generate signed url: %v", err)
 	}
 	return url
 }
 
+// ErrAssetNotFound is returned by Database.Save when the Record is
+// associated with an Asset that does not exist.
+//
+// An ErrAssetNotFound is a skyerr.Error with the code ResourceNotFound.
+type ErrAssetNotFound struct {
+	AssetName string
+}
+
+func (e ErrAssetNotFound) err() skyerr.Error {
+	return skyerr.NewErrorWithInfo(
+		skyerr.ResourceNotFound,
+		fmt.Sprintf(`asset "%s" does not exist`, e.AssetName),
+		map[string]interface{}{"name": e.AssetName},
+	)
+}
+
+func (e ErrAssetNotFound) Name() string                 { return e.err().Name() }
+func (e ErrAssetNotFound) Code() skyerr.ErrorCode       { return e.err().Code() }
+func (e ErrAssetNotFound) Message() string              { return e.err().Message() }
+func (e ErrAssetNotFound) Info() map[string]interface{} { return e.err().Info() }
+func (e ErrAssetNotFound) Error() string                { return e.err().Error() }
+
+func (e ErrAssetNotFound) MarshalJSON() ([]byte, error) {
+	return e.err().MarshalJSON()
+}
+
+// ErrRecordTooLarge is returned by Database.Save when the size of the
+// Record exceeds DBConfig.MaxRecordSize.
+//
+// An ErrRecordTooLarge is a skyerr.Error with the code InvalidArgument.
+type ErrRecordTooLarge struct {
+	RecordID RecordID
+	Size     int
+	MaxSize  int
+}
+
+func (e ErrRecordTooLarge) err() skyerr.Error {
+	return skyerr.NewErrorWithInfo(
+		skyerr.InvalidArgument,
+		fmt.Sprintf(`record "%s" is %d bytes, larger than the maximum of %d bytes`,
+			e.RecordID, e.Size, e.MaxSize),
+		map[string]interface{}{
+			"id":       e.RecordID.String(),
+			"size":     e.Size,
+			"max_size": e.MaxSize,
+		},
+	)
+}
+
+func (e ErrRecordTooLarge) Name() string                 { return e.err().Name() }
+func (e ErrRecordTooLarge) Code() skyerr.ErrorCode       { return e.err().Code() }
+func (e ErrRecordTooLarge) Message() string              { return e.err().Message() }
+func (e ErrRecordTooLarge) Info() map[string]interface{} { return e.err().Info() }
+func (e ErrRecordTooLarge) Error() string                { return e.err().Error() }
+
+func (e ErrRecordTooLarge) MarshalJSON() ([]byte, error) {
+	return e.err().MarshalJSON()
+}
+
+// ErrInvalidEnumValue is returned by Database.Save when the value of a
+// field of TypeEnum is not one of the allowed values.
+//
+// An ErrInvalidEnumValue is a skyerr.Error with the code InvalidArgument.
+type ErrInvalidEnumValue struct {
+	RecordID RecordID
+	Field    string
+	Value    interface{}
+	Allowed  []string
+}
+
+func (e ErrInvalidEnumValue) err() skyerr.Error {
+	return skyerr.NewErrorWithInfo(
+		skyerr.InvalidArgument,
+		fmt.Sprintf(`field "%s" of record "%s" must be one of %s, got %v`,
+			e.Field, e.RecordID, strings.Join(e.Allowed, ", "), e.Value),
+		map[string]interface{}{
+			"id":      e.RecordID.String(),
+			"field":   e.Field,
+			"allowed": e.Allowed,
+		},
+	)
+}
+
+func (e ErrInvalidEnumValue) Name() string                 { return e.err().Name() }
+func (e ErrInvalidEnumValue) Code() skyerr.ErrorCode       { return e.err().Code() }
+func (e ErrInvalidEnumValue) Message() string              { return e.err().Message() }
+func (e ErrInvalidEnumValue) Info() map[string]interface{} { return e.err().Info() }
+func (e ErrInvalidEnumValue) Error() string                { return e.err().Error() }
+
+func (e ErrInvalidEnumValue) MarshalJSON() ([]byte, error) {
+	return e.err().MarshalJSON()
+}
+
 type Reference struct {
 	ID RecordID
 }
@@ -152,6 +296,13 @@ type Geometry map[string]interface{}
 // via JIT schema migration
 type Sequence struct{}
 
+// NullValue is the type of Null.
+type NullValue struct{}
+
+// Null is a sentinel value that explicitly sets a field to null, as
+// opposed to a field omitted from Database.Patch, which is left untouched.
+var Null = NullValue{}
+
 // Unknown is a bogus data type denoting the type of a field is unknown.
 type Unknown struct {
 	UnderlyingType string
@@ -174,6 +325,16 @@ type Record struct {
 	Transient  Data `json:"-"`
 }
 
+// RecordVersion is a version of a Record kept in the history. See
+// Database.GetHistory.
+type RecordVersion struct {
+	// Record is the Record in this version, or nil if the Record is
+	// deleted.
+	Record    *Record
+	UpdatedAt time.Time
+	UpdaterID string
+}
+
 // Copy makes a shadow copy of itself
 func (d Data) Copy() Data {
 	dataCopy := Data{}
@@ -298,6 +459,12 @@ func (r *Record) Accessible(authinfo *AuthInfo, level RecordACLLevel) bool {
 	return r.ACL.Accessible(authinfo, level)
 }
 
+// WasModified returns true if the record is updated after it is
+// created.
+func (r *Record) WasModified() bool {
+	return r.UpdatedAt.After(r.CreatedAt)
+}
+
 // Copy copies the content of the record.
 func (r *Record) Copy() Record {
 	dst := Record{}
@@ -348,6 +515,10 @@ func (r *Record) MergedCopy(merge *Record) Record {
 // Index indicates the value of fields within a record type cannot be duplicated
 type Index struct {
 	Fields []string
+
+	// CaseInsensitive indicates values that differ only in letter case
+	// are considered duplicated. It applies to string fields only.
+	CaseInsensitive bool
 }
 
 // RecordSchema is a mapping of record key to its value's data type or reference
@@ -396,6 +567,8 @@ func (schema RecordSchema) HasFields(fields []string) bool {
 type FieldType struct {
 	Type           DataType
 	ReferenceType  string     // used only by TypeReference
+	EnumValues     []string   // used only by TypeEnum
+	Encrypted      bool       // used only by TypeString
 	Expression     Expression // used by Computed Keys
 	UnderlyingType string     // indicates the underlying (pq) type
 }
@@ -414,10 +587,28 @@ func (f FieldType) DefinitionCompatibleTo(other FieldType) bool {
 		return f.Type == other.Type && f.ReferenceType == other.ReferenceType
 	}
 
+	if other.Encrypted && !f.Encrypted {
+		// The values of a plain field are not to be encrypted.
+		return false
+	}
+
+	if f.Type == TypeEnum {
+		// Strings are checked against the allowed values when saved.
+		if other.Type == TypeString {
+			return true
+		}
+		return f.Type == other.Type && reflect.DeepEqual(f.EnumValues, other.EnumValues)
+	}
+
 	if f.Type.IsNumberCompatibleType() && other.Type.IsNumberCompatibleType() {
 		return true
 	}
 
+	if f.Type == TypeDateTimeTZ && other.Type == TypeDateTime {
+		// Values of time.Time are derived as TypeDateTime.
+		return true
+	}
+
 	if f.Type == TypeGeometry && other.Type.IsGeometryCompatibleType() {
 		// Note: Saving skydb.Location to skydb.Geometry is currently
 		// not supported (see #343)
@@ -431,6 +622,9 @@ func (f FieldType) DefinitionCompatibleTo(other FieldType) bool {
 func (f FieldType) ToSimpleName() string {
 	switch f.Type {
 	case TypeString:
+		if f.Encrypted {
+			return "encrypted_string"
+		}
 		return "string"
 	case TypeNumber:
 		return "number"
@@ -456,6 +650,12 @@ func (f FieldType) ToSimpleName() string {
 		return "geometry"
 	case TypeUnknown:
 		return "unknown"
+	case TypeAssetList:
+		return "asset_list"
+	case TypeDateTimeTZ:
+		return "datetime_tz"
+	case TypeEnum:
+		return fmt.Sprintf("enum(%s)", strings.Join(f.EnumValues, ","))
 	}
 	return ""
 }
@@ -479,6 +679,9 @@ const (
 	TypeSequence
 	TypeGeometry
 	TypeUnknown
+	TypeAssetList
+	TypeDateTimeTZ
+	TypeEnum
 )
 
 // IsNumberCompatibleType returns true if the type is a numeric type
@@ -499,6 +702,9 @@ func SimpleNameToFieldType(s string) (result FieldType, err error) {
 	switch s {
 	case "string":
 		result.Type = TypeString
+	case "encrypted_string":
+		result.Type = TypeString
+		result.Encrypted = true
 	case "number":
 		result.Type = TypeNumber
 	case "boolean":
@@ -521,10 +727,17 @@ func SimpleNameToFieldType(s string) (result FieldType, err error) {
 		result.Type = TypeGeometry
 	case "unknown":
 		result.Type = TypeUnknown
+	case "asset_list":
+		result.Type = TypeAssetList
+	case "datetime_tz":
+		result.Type = TypeDateTimeTZ
 	default:
 		if regexp.MustCompile(`^ref\(.+\)$`).MatchString(s) {
 			result.Type = TypeReference
 			result.ReferenceType = s[4 : len(s)-1]
+		} else if regexp.MustCompile(`^enum\(.+\)$`).MatchString(s) {
+			result.Type = TypeEnum
+			result.EnumValues = strings.Split(s[5:len(s)-1], ",")
 		} else {
 			err = fmt.Errorf("Unexpected type name: %s", s)
 			return
@@ -573,6 +786,10 @@ func DeriveFieldType(value interface{}) (fieldType FieldType, err error) {
 		fieldType = FieldType{
 			Type: TypeAsset,
 		}
+	case []*Asset:
+		fieldType = FieldType{
+			Type: TypeAssetList,
+		}
 	case Reference:
 		v := value.(Reference)
 		fieldType = FieldType{
@@ -16,7 +16,9 @@ package skydb
 
 import (
 	"testing"
+	"time"
 
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -67,6 +69,52 @@ func TestRecord(t *testing.T) {
 			"existing": "should be here",
 		})
 	})
+
+	Convey("Record was modified", t, func() {
+		createdAt := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+		note0 := Record{
+			ID:        NewRecordID("note", "0"),
+			CreatedAt: createdAt,
+			UpdatedAt: createdAt,
+		}
+		So(note0.WasModified(), ShouldBeFalse)
+
+		note0.UpdatedAt = createdAt.Add(time.Second)
+		So(note0.WasModified(), ShouldBeTrue)
+	})
+}
+
+func TestRecordID(t *testing.T) {
+	Convey("RecordID", t, func() {
+		Convey("round-trips through its string form", func() {
+			for _, id := range []RecordID{
+				NewRecordID("note", "0"),
+				NewRecordID("ns:note", "6f2e8c1a-0b3d-4e5f-9a7b-1c2d3e4f5a6b"),
+				NewRecordID("note", "key:with:colons"),
+			} {
+				parsed, err := ParseRecordID(id.String())
+				So(err, ShouldBeNil)
+				So(parsed, ShouldResemble, id)
+			}
+		})
+
+		Convey("rejects malformed string", func() {
+			for _, s := range []string{
+				"",
+				"note",
+				"/0",
+				"note/",
+				"/",
+				"note//0",
+				"note/0/",
+				"/note/0",
+			} {
+				_, err := ParseRecordID(s)
+				So(err, ShouldNotBeNil)
+				So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.InvalidArgument)
+			}
+		})
+	})
 }
 
 func TestRecordACL(t *testing.T) {
@@ -235,4 +283,50 @@ func TestRecordSchema(t *testing.T) {
 			So(target.DefinitionCompatibleTo(other), ShouldBeFalse)
 		})
 	})
+
+	Convey("FieldType of TypeEnum", t, func() {
+		target := FieldType{Type: TypeEnum, EnumValues: []string{"open", "closed"}}
+
+		Convey("is compatible with string", func() {
+			So(target.DefinitionCompatibleTo(FieldType{Type: TypeString}), ShouldBeTrue)
+		})
+
+		Convey("is compatible with enum of the same values", func() {
+			other := FieldType{Type: TypeEnum, EnumValues: []string{"open", "closed"}}
+			So(target.DefinitionCompatibleTo(other), ShouldBeTrue)
+		})
+
+		Convey("is not compatible with enum of different values", func() {
+			other := FieldType{Type: TypeEnum, EnumValues: []string{"open", "closed", "archived"}}
+			So(target.DefinitionCompatibleTo(other), ShouldBeFalse)
+		})
+
+		Convey("converts to and from simple name", func() {
+			So(target.ToSimpleName(), ShouldEqual, "enum(open,closed)")
+
+			fieldType, err := SimpleNameToFieldType("enum(open,closed)")
+			So(err, ShouldBeNil)
+			So(fieldType, ShouldResemble, target)
+		})
+	})
+
+	Convey("FieldType of encrypted string", t, func() {
+		target := FieldType{Type: TypeString, Encrypted: true}
+
+		Convey("is compatible with string", func() {
+			So(target.DefinitionCompatibleTo(FieldType{Type: TypeString}), ShouldBeTrue)
+		})
+
+		Convey("is not compatible to a plain string field", func() {
+			So(FieldType{Type: TypeString}.DefinitionCompatibleTo(target), ShouldBeFalse)
+		})
+
+		Convey("converts to and from simple name", func() {
+			So(target.ToSimpleName(), ShouldEqual, "encrypted_string")
+
+			fieldType, err := SimpleNameToFieldType("encrypted_string")
+			So(err, ShouldBeNil)
+			So(fieldType, ShouldResemble, target)
+		})
+	})
 }
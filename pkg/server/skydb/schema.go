@@ -16,10 +16,149 @@ package skydb
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// SchemaErrorKind is the kind of conflict described by a SchemaError.
+//go:generate stringer -type=SchemaErrorKind
+type SchemaErrorKind int
+
+// A list of SchemaErrorKind.
+const (
+	// SchemaTypeConflict means the field exists with a type
+	// incompatible with the requested type.
+	SchemaTypeConflict SchemaErrorKind = iota + 1
+
+	// SchemaReferenceTargetMissing means the field references a record
+	// type that does not exist.
+	SchemaReferenceTargetMissing
+
+	// SchemaFieldDuplicated means the field to be added already exists,
+	// usually because it is added since the schema was last read.
+	SchemaFieldDuplicated
+)
+
+// SchemaError is returned by Database.Extend when the requested schema
+// conflicts with the existing schema of the record type.
+//
+// A SchemaError is a skyerr.Error with the code IncompatibleSchema.
+type SchemaError struct {
+	Kind       SchemaErrorKind
+	RecordType string
+	Field      string
+	err        skyerr.Error
+}
+
+// NewSchemaError returns a new SchemaError.
+func NewSchemaError(kind SchemaErrorKind, recordType, field, message string) *SchemaError {
+	return &SchemaError{
+		Kind:       kind,
+		RecordType: recordType,
+		Field:      field,
+		err: skyerr.NewErrorWithInfo(skyerr.IncompatibleSchema, message, map[string]interface{}{
+			"kind":        kind.String(),
+			"record_type": recordType,
+			"field":       field,
+		}),
+	}
+}
+
+func (e *SchemaError) Name() string                 { return e.err.Name() }
+func (e *SchemaError) Code() skyerr.ErrorCode       { return e.err.Code() }
+func (e *SchemaError) Message() string              { return e.err.Message() }
+func (e *SchemaError) Info() map[string]interface{} { return e.err.Info() }
+func (e *SchemaError) Error() string                { return e.err.Error() }
+
+func (e *SchemaError) MarshalJSON() ([]byte, error) {
+	return e.err.MarshalJSON()
+}
+
+// SchemaDiffKind is the kind of difference described by a SchemaDiff.
+//go:generate stringer -type=SchemaDiffKind
+type SchemaDiffKind int
+
+// A list of SchemaDiffKind.
+const (
+	// SchemaFieldMissing means the expected field does not exist.
+	SchemaFieldMissing SchemaDiffKind = iota + 1
+
+	// SchemaFieldExtra means the field exists but is not expected.
+	SchemaFieldExtra
+
+	// SchemaFieldConflict means the field exists with a type
+	// incompatible with the expected type.
+	SchemaFieldConflict
 )
 
+// SchemaDiff describes how a field of a record type differs from the
+// expected schema. Expected is empty for SchemaFieldExtra, and Actual
+// is empty for SchemaFieldMissing.
+type SchemaDiff struct {
+	Kind       SchemaDiffKind
+	RecordType string
+	Field      string
+	Expected   FieldType
+	Actual     FieldType
+}
+
+// DiffSchemas compares the actual schemas of record types against the
+// expected ones, sorted by record type and field. Only record types in
+// expected are compared, and reserved fields, which are prefixed by
+// an underscore, are ignored.
+func DiffSchemas(expected map[string]RecordSchema, actual map[string]RecordSchema) []SchemaDiff {
+	diffs := []SchemaDiff{}
+	for recordType, expectedSchema := range expected {
+		actualSchema := actual[recordType]
+		for field, expectedType := range expectedSchema {
+			actualType, ok := actualSchema[field]
+			if !ok {
+				diffs = append(diffs, SchemaDiff{
+					Kind:       SchemaFieldMissing,
+					RecordType: recordType,
+					Field:      field,
+					Expected:   expectedType,
+				})
+			} else if !actualType.DefinitionCompatibleTo(expectedType) {
+				diffs = append(diffs, SchemaDiff{
+					Kind:       SchemaFieldConflict,
+					RecordType: recordType,
+					Field:      field,
+					Expected:   expectedType,
+					Actual:     actualType,
+				})
+			}
+		}
+
+		for field, actualType := range actualSchema {
+			if _, ok := expectedSchema[field]; ok || strings.HasPrefix(field, "_") {
+				continue
+			}
+			diffs = append(diffs, SchemaDiff{
+				Kind:       SchemaFieldExtra,
+				RecordType: recordType,
+				Field:      field,
+				Actual:     actualType,
+			})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].RecordType != diffs[j].RecordType {
+			return diffs[i].RecordType < diffs[j].RecordType
+		}
+		return diffs[i].Field < diffs[j].Field
+	})
+	return diffs
+}
+
 // TraverseColumnTypes traverse the field type of a key path from database table.
+//
+// A JSON field in the middle of the key path ends the traversal, the
+// rest of the key path being a path within the JSON value. The returned
+// field types then have fewer elements than the key path components.
 func TraverseColumnTypes(db Database, recordType string, keyPath string) ([]FieldType, error) {
 	fields := []FieldType{}
 	components := strings.Split(keyPath, ".")
@@ -38,6 +177,11 @@ func TraverseColumnTypes(db Database, recordType string, keyPath string) ([]Fiel
 			return fields, fmt.Errorf(`keypath "%s" does not exist`, keyPath)
 		}
 
+		if field.Type == TypeJSON && !isLast {
+			fields = append(fields, field)
+			break
+		}
+
 		if field.Type != TypeReference && !isLast {
 			return fields, fmt.Errorf(`field "%s" in keypath "%s" is not a reference`, component, keyPath)
 		}
@@ -50,3 +194,5 @@ func TraverseColumnTypes(db Database, recordType string, keyPath string) ([]Fiel
 	}
 	return fields, nil
 }
+
+var _ skyerr.Error = &SchemaError{}
@@ -33,6 +33,7 @@ func TestTraverseColumnTypes(t *testing.T) {
 				RecordSchema{
 					"index":    FieldType{Type: TypeInteger},
 					"category": FieldType{Type: TypeReference, ReferenceType: "category"},
+					"metadata": FieldType{Type: TypeJSON},
 				}, nil,
 			).AnyTimes()
 		db.EXPECT().RemoteColumnTypes(gomock.Eq("category")).
@@ -71,6 +72,14 @@ func TestTraverseColumnTypes(t *testing.T) {
 			})
 		})
 
+		Convey("should stop traversing at JSON field", func() {
+			fields, err := TraverseColumnTypes(db, "note", "metadata.author.name")
+			So(err, ShouldBeNil)
+			So(fields, ShouldResemble, []FieldType{
+				{Type: TypeJSON},
+			})
+		})
+
 		Convey("should return error if traversing a non-reference field", func() {
 			_, err := TraverseColumnTypes(db, "note", "index.name")
 			So(err, ShouldNotBeNil)
@@ -87,3 +96,73 @@ func TestTraverseColumnTypes(t *testing.T) {
 		})
 	})
 }
+
+func TestDiffSchemas(t *testing.T) {
+	Convey("DiffSchemas", t, func() {
+		actual := map[string]RecordSchema{
+			"note": RecordSchema{
+				"_id":     FieldType{Type: TypeString},
+				"title":   FieldType{Type: TypeString},
+				"content": FieldType{Type: TypeString},
+				"count":   FieldType{Type: TypeNumber},
+				"done":    FieldType{Type: TypeBoolean},
+			},
+			"category": RecordSchema{
+				"name": FieldType{Type: TypeString},
+			},
+		}
+
+		Convey("returns no diff for matching schema", func() {
+			diffs := DiffSchemas(map[string]RecordSchema{
+				"note": RecordSchema{
+					"title":   FieldType{Type: TypeString},
+					"content": FieldType{Type: TypeString},
+					"count":   FieldType{Type: TypeInteger},
+					"done":    FieldType{Type: TypeBoolean},
+				},
+			}, actual)
+			So(diffs, ShouldBeEmpty)
+		})
+
+		Convey("returns missing, extra and conflicting fields", func() {
+			diffs := DiffSchemas(map[string]RecordSchema{
+				"note": RecordSchema{
+					"title":    FieldType{Type: TypeString},
+					"done":     FieldType{Type: TypeString},
+					"category": FieldType{Type: TypeReference, ReferenceType: "category"},
+					"count":    FieldType{Type: TypeNumber},
+				},
+				"comment": RecordSchema{
+					"body": FieldType{Type: TypeString},
+				},
+			}, actual)
+			So(diffs, ShouldResemble, []SchemaDiff{
+				{
+					Kind:       SchemaFieldMissing,
+					RecordType: "comment",
+					Field:      "body",
+					Expected:   FieldType{Type: TypeString},
+				},
+				{
+					Kind:       SchemaFieldMissing,
+					RecordType: "note",
+					Field:      "category",
+					Expected:   FieldType{Type: TypeReference, ReferenceType: "category"},
+				},
+				{
+					Kind:       SchemaFieldExtra,
+					RecordType: "note",
+					Field:      "content",
+					Actual:     FieldType{Type: TypeString},
+				},
+				{
+					Kind:       SchemaFieldConflict,
+					RecordType: "note",
+					Field:      "done",
+					Expected:   FieldType{Type: TypeString},
+					Actual:     FieldType{Type: TypeBoolean},
+				},
+			})
+		})
+	})
+}
@@ -145,6 +145,22 @@ func (asset *MapAsset) ToMap(m map[string]interface{}) {
 	if url != "" {
 		m["$url"] = url
 	}
+
+	if len(asset.Variants) > 0 {
+		variants := map[string]interface{}{}
+		for key, variant := range asset.Variants {
+			v := map[string]interface{}{
+				"$name":         variant.Name,
+				"$content_type": variant.ContentType,
+				"$size":         variant.Size,
+			}
+			if url := (*skydb.Asset)(asset).VariantSignedURL(key); url != "" {
+				v["$url"] = url
+			}
+			variants[key] = v
+		}
+		m["$variants"] = variants
+	}
 }
 
 // MapReference is skydb.Reference that can be converted from and to a map.
@@ -43,6 +43,14 @@ func (record *JSONRecord) MarshalJSON() ([]byte, error) {
 			data[key] = (MapGeometry)(v)
 		case *skydb.Asset:
 			data[key] = (*MapAsset)(v)
+		case []*skydb.Asset:
+			assets := make([]interface{}, len(v))
+			for i, asset := range v {
+				m := map[string]interface{}{}
+				(*MapAsset)(asset).ToMap(m)
+				assets[i] = m
+			}
+			data[key] = assets
 		case skydb.Sequence:
 			data[key] = (MapSequence)(v)
 		case skydb.Unknown:
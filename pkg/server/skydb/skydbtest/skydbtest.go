@@ -58,6 +58,25 @@ func (conn *MapConn) CreateAuth(authinfo *skydb.AuthInfo) error {
 	return nil
 }
 
+// CreateOrGetAuth creates a AuthInfo in UserMap unless one with the same
+// ID or principal ID exists.
+func (conn *MapConn) CreateOrGetAuth(authinfo *skydb.AuthInfo) (bool, error) {
+	existing := skydb.AuthInfo{}
+	err := conn.GetAuth(authinfo.ID, &existing)
+	for principalID := range authinfo.ProviderInfo {
+		if err == nil {
+			break
+		}
+		err = conn.GetAuthByPrincipalID(principalID, &existing)
+	}
+	if err == nil {
+		*authinfo = existing
+		return false, nil
+	}
+
+	return true, conn.CreateAuth(authinfo)
+}
+
 // GetAuth returns a AuthInfo in UserMap.
 func (conn *MapConn) GetAuth(id string, authinfo *skydb.AuthInfo) error {
 	u, ok := conn.UserMap[id]
@@ -177,6 +196,11 @@ func (conn *MapConn) SaveAsset(asset *skydb.Asset) error {
 	panic("not implemented")
 }
 
+// DeleteOrphanedAssets is not implemented.
+func (conn *MapConn) DeleteOrphanedAssets() (int, error) {
+	panic("not implemented")
+}
+
 // GetAssets always returns empty array.
 func (conn *MapConn) GetAssets(names []string) ([]skydb.Asset, error) {
 	assets := []skydb.Asset{}
@@ -209,6 +233,11 @@ func (conn *MapConn) RemoveRelation(user string, name string, targetUser string)
 	panic("not implemented")
 }
 
+// RemoveRelations is not implemented.
+func (conn *MapConn) RemoveRelations(user string, name string, targetUsers []string) (int, error) {
+	panic("not implemented")
+}
+
 // GetDevice is not implemented.
 func (conn *MapConn) GetDevice(id string, device *skydb.Device) error {
 	panic("not implemented")
@@ -234,11 +263,31 @@ func (conn *MapConn) DeleteDevicesByToken(token string, t time.Time) error {
 	panic("not implemented")
 }
 
+// QueryEmptyDevicesByTime is not implemented.
+func (conn *MapConn) QueryEmptyDevicesByTime(t time.Time) ([]skydb.Device, error) {
+	panic("not implemented")
+}
+
 // DeleteEmptyDevicesByTime is not implemented.
 func (conn *MapConn) DeleteEmptyDevicesByTime(t time.Time) error {
 	panic("not implemented")
 }
 
+// RegisterDevice is not implemented.
+func (conn *MapConn) RegisterDevice(device *skydb.Device) error {
+	panic("not implemented")
+}
+
+// QueryDevicesByAppVersion is not implemented.
+func (conn *MapConn) QueryDevicesByAppVersion(appVersion string) ([]skydb.Device, error) {
+	panic("not implemented")
+}
+
+// DeleteDevicesByUser is not implemented.
+func (conn *MapConn) DeleteDevicesByUser(user string) (int, error) {
+	panic("not implemented")
+}
+
 // PublicDB is not implemented.
 func (conn *MapConn) PublicDB() skydb.Database {
 	return conn.InternalPublicDB
@@ -527,6 +576,7 @@ func (db *MapDB) DeleteSubscription(name string, deviceID string) error {
 // calls to underlying Database
 type MockTxDatabase struct {
 	DidBegin, DidCommit, DidRollback bool
+	Savepoints, RolledBackTo         []string
 	skydb.Database
 }
 
@@ -549,6 +599,16 @@ func (db *MockTxDatabase) Rollback() error {
 	return nil
 }
 
+func (db *MockTxDatabase) Savepoint(name string) error {
+	db.Savepoints = append(db.Savepoints, name)
+	return nil
+}
+
+func (db *MockTxDatabase) RollbackTo(name string) error {
+	db.RolledBackTo = append(db.RolledBackTo, name)
+	return nil
+}
+
 var _ skydb.TxDatabase = &MockTxDatabase{}
 
 var (
@@ -14,7 +14,10 @@
 
 package skydb
 
-import "errors"
+import (
+	"errors"
+	"reflect"
+)
 
 // ErrSubscriptionNotFound is returned from GetSubscription or
 // DeleteSubscription when the specific subscription cannot be found.
@@ -28,6 +31,29 @@ type Subscription struct {
 	DeviceID         string            `json:"device_id"`
 	NotificationInfo *NotificationInfo `json:"notification_info,omitempty"`
 	Query            Query             `json:"query"`
+
+	// WatchFields limits the update events notified to those changing
+	// at least one of the fields. All updates are notified if it is
+	// empty.
+	WatchFields []string `json:"watch_fields,omitempty"`
+}
+
+// WatchesChange returns whether the record event is to be notified to
+// the subscription according to its WatchFields.
+//
+// Creations and deletions are always notified, as are updates of which
+// the original record is not known.
+func (s *Subscription) WatchesChange(event RecordEvent) bool {
+	if len(s.WatchFields) == 0 || event.Event != RecordUpdated || event.Original == nil {
+		return true
+	}
+
+	for _, field := range s.WatchFields {
+		if !reflect.DeepEqual(event.Original.Get(field), event.Record.Get(field)) {
+			return true
+		}
+	}
+	return false
 }
 
 // NotificationInfo describes how server should send a notification
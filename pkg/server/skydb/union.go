@@ -0,0 +1,244 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+)
+
+// ValidateUnionQueries returns an Error if the supplied queries cannot
+// be executed together by Database.QueryUnion.
+//
+// Each query has to be valid on its own, and all queries have to be
+// sorted by the same key paths in the same order, so that their results
+// can be merged without evaluating functions in memory.
+func ValidateUnionQueries(queries []*Query) error {
+	for _, query := range queries {
+		if err := query.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(queries) == 0 {
+		return nil
+	}
+
+	sorts := queries[0].Sorts
+	for _, sort := range sorts {
+		if sort.Expression.Type != KeyPath {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				"union queries can only be sorted by key path")
+		}
+	}
+
+	for _, query := range queries[1:] {
+		if !reflect.DeepEqual(query.Sorts, sorts) {
+			return skyerr.NewError(skyerr.RecordQueryInvalid,
+				"union queries must have the same sorts")
+		}
+	}
+
+	return nil
+}
+
+// UnionRows is an implementation of RowsIter that merges the results of
+// multiple Rows into one. Each Rows is expected to be ordered by sorts
+// already, and records are returned in the same order.
+//
+// Sorts must consist of key path expressions only. Strings are compared
+// as bytes, so Rows sorted by strings are expected in that order too.
+type UnionRows struct {
+	sorts   []Sort
+	rows    []*Rows
+	heads   []*Record
+	drained []bool
+}
+
+// NewUnionRows creates a new UnionRows merging rows by sorts.
+func NewUnionRows(sorts []Sort, rows []*Rows) *UnionRows {
+	return &UnionRows{
+		sorts:   sorts,
+		rows:    rows,
+		heads:   make([]*Record, len(rows)),
+		drained: make([]bool, len(rows)),
+	}
+}
+
+// Close closes all the merged Rows.
+func (rs *UnionRows) Close() error {
+	var err error
+	for _, rows := range rs.rows {
+		if closeErr := rows.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Next populates the first record among the next records of all
+// merged Rows.
+func (rs *UnionRows) Next(record *Record) error {
+	next := -1
+	for i := range rs.rows {
+		if err := rs.fetchHead(i); err != nil {
+			return err
+		}
+		if rs.heads[i] == nil {
+			continue
+		}
+		if next == -1 || compareRecords(rs.sorts, rs.heads[i], rs.heads[next]) < 0 {
+			next = i
+		}
+	}
+
+	if next == -1 {
+		return io.EOF
+	}
+
+	*record = *rs.heads[next]
+	rs.heads[next] = nil
+	return nil
+}
+
+// fetchHead scans the next record of the i-th Rows if the previous one
+// has been returned already.
+func (rs *UnionRows) fetchHead(i int) error {
+	if rs.heads[i] != nil || rs.drained[i] {
+		return nil
+	}
+
+	rows := rs.rows[i]
+	if rows.Scan() {
+		record := rows.Record()
+		rs.heads[i] = &record
+		return nil
+	}
+
+	err := rows.Err()
+	if _, ok := err.(*RowScanError); !ok {
+		rs.drained[i] = true
+	}
+	return err
+}
+
+// OverallRecordCount returns the sum of the overall record counts of
+// all merged Rows.
+func (rs *UnionRows) OverallRecordCount() *uint64 {
+	var count *uint64
+	for _, rows := range rs.rows {
+		if c := rows.OverallRecordCount(); c != nil {
+			if count == nil {
+				count = new(uint64)
+			}
+			*count += *c
+		}
+	}
+	return count
+}
+
+// compareRecords compares two records with sorts, returning a negative
+// number if r1 comes before r2.
+func compareRecords(sorts []Sort, r1, r2 *Record) int {
+	for _, sort := range sorts {
+		keyPath, _ := sort.Expression.Value.(string)
+		v1, v2 := r1.Get(keyPath), r2.Get(keyPath)
+		if sort.CaseInsensitive {
+			v1, v2 = lowerString(v1), lowerString(v2)
+		}
+		result := compareValues(v1, v2)
+		if sort.Order == Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// lowerString returns the value in lower case if it is a string.
+func lowerString(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return strings.ToLower(s)
+	}
+	return v
+}
+
+// compareValues compares two record values. Null comes after all other
+// values, which is how PostgreSQL orders nulls in ascending order.
+func compareValues(v1, v2 interface{}) int {
+	if v1 == nil || v2 == nil {
+		switch {
+		case v1 == nil && v2 == nil:
+			return 0
+		case v1 == nil:
+			return 1
+		default:
+			return -1
+		}
+	}
+
+	switch value1 := v1.(type) {
+	case string:
+		if value2, ok := v2.(string); ok {
+			return strings.Compare(value1, value2)
+		}
+	case float64:
+		if value2, ok := v2.(float64); ok {
+			return compareFloats(value1, value2)
+		}
+	case int64:
+		if value2, ok := v2.(int64); ok {
+			return compareFloats(float64(value1), float64(value2))
+		}
+	case bool:
+		if value2, ok := v2.(bool); ok && value1 != value2 {
+			if value1 {
+				return 1
+			}
+			return -1
+		}
+	case time.Time:
+		if value2, ok := v2.(time.Time); ok {
+			switch {
+			case value1.Before(value2):
+				return -1
+			case value1.After(value2):
+				return 1
+			}
+		}
+	case Reference:
+		if value2, ok := v2.(Reference); ok {
+			return strings.Compare(value1.ID.String(), value2.ID.String())
+		}
+	}
+	return 0
+}
+
+func compareFloats(f1, f2 float64) int {
+	switch {
+	case f1 < f2:
+		return -1
+	case f1 > f2:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package skydb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skyerr"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateUnionQueries(t *testing.T) {
+	Convey("ValidateUnionQueries", t, func() {
+		sortByUpdatedAt := Sort{
+			Expression: Expression{KeyPath, "_updated_at"},
+			Order:      Descending,
+		}
+
+		Convey("accepts queries with the same sorts", func() {
+			err := ValidateUnionQueries([]*Query{
+				{Type: "note", Sorts: []Sort{sortByUpdatedAt}},
+				{Type: "article", Sorts: []Sort{sortByUpdatedAt}},
+			})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("rejects queries with different sorts", func() {
+			err := ValidateUnionQueries([]*Query{
+				{Type: "note", Sorts: []Sort{sortByUpdatedAt}},
+				{Type: "article"},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("rejects queries sorted by function", func() {
+			sortByDistance := Sort{
+				Expression: Expression{Function, DistanceFunc{"location", NewLocation(1, 2)}},
+			}
+			err := ValidateUnionQueries([]*Query{
+				{Type: "note", Sorts: []Sort{sortByDistance}},
+				{Type: "article", Sorts: []Sort{sortByDistance}},
+			})
+			So(err, ShouldNotBeNil)
+			So(err.(skyerr.Error).Code(), ShouldEqual, skyerr.RecordQueryInvalid)
+		})
+
+		Convey("rejects invalid query", func() {
+			err := ValidateUnionQueries([]*Query{
+				{Type: ""},
+			})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUnionRows(t *testing.T) {
+	Convey("UnionRows", t, func() {
+		at := func(minute int) time.Time {
+			return time.Date(2017, 1, 1, 0, minute, 0, 0, time.UTC)
+		}
+		note1 := Record{ID: NewRecordID("note", "1"), UpdatedAt: at(4)}
+		note2 := Record{ID: NewRecordID("note", "2"), UpdatedAt: at(1)}
+		article1 := Record{ID: NewRecordID("article", "1"), UpdatedAt: at(3), Data: Data{"rank": 1.0}}
+		article2 := Record{ID: NewRecordID("article", "2"), UpdatedAt: at(2), Data: Data{"rank": 2.0}}
+		article3 := Record{ID: NewRecordID("article", "3"), UpdatedAt: at(2)}
+
+		scanAll := func(rows *Rows) []Record {
+			records := []Record{}
+			for rows.Scan() {
+				records = append(records, rows.Record())
+			}
+			So(rows.Err(), ShouldBeNil)
+			return records
+		}
+
+		Convey("merges records in descending order", func() {
+			rows := NewRows(NewUnionRows(
+				[]Sort{{Expression: Expression{KeyPath, "_updated_at"}, Order: Descending}},
+				[]*Rows{
+					NewRows(NewMemoryRows([]Record{note1, note2})),
+					NewRows(NewMemoryRows([]Record{article1, article2})),
+				},
+			))
+
+			So(scanAll(rows), ShouldResemble, []Record{note1, article1, article2, note2})
+		})
+
+		Convey("merges records by multiple sorts with nulls last", func() {
+			rows := NewRows(NewUnionRows(
+				[]Sort{
+					{Expression: Expression{KeyPath, "_updated_at"}, Order: Ascending},
+					{Expression: Expression{KeyPath, "rank"}, Order: Ascending},
+				},
+				[]*Rows{
+					NewRows(NewMemoryRows([]Record{article3})),
+					NewRows(NewMemoryRows([]Record{article2})),
+				},
+			))
+
+			So(scanAll(rows), ShouldResemble, []Record{article2, article3})
+		})
+
+		Convey("merges records by string case insensitively", func() {
+			zebra := Record{ID: NewRecordID("note", "3"), Data: Data{"title": "Zebra"}}
+			apple := Record{ID: NewRecordID("article", "4"), Data: Data{"title": "apple"}}
+			rows := NewRows(NewUnionRows(
+				[]Sort{{Expression: Expression{KeyPath, "title"}, Order: Ascending, CaseInsensitive: true}},
+				[]*Rows{
+					NewRows(NewMemoryRows([]Record{zebra})),
+					NewRows(NewMemoryRows([]Record{apple})),
+				},
+			))
+
+			So(scanAll(rows), ShouldResemble, []Record{apple, zebra})
+		})
+
+		Convey("returns records of remaining rows when one is exhausted", func() {
+			rows := NewRows(NewUnionRows(
+				[]Sort{{Expression: Expression{KeyPath, "_updated_at"}, Order: Descending}},
+				[]*Rows{
+					NewRows(NewMemoryRows([]Record{})),
+					NewRows(NewMemoryRows([]Record{article1, article2})),
+				},
+			))
+
+			So(scanAll(rows), ShouldResemble, []Record{article1, article2})
+		})
+
+		Convey("sums overall record count", func() {
+			rows := NewRows(NewUnionRows(
+				[]Sort{},
+				[]*Rows{
+					NewRows(NewMemoryRows([]Record{note1, note2})),
+					NewRows(NewMemoryRows([]Record{article1})),
+				},
+			))
+
+			So(*rows.OverallRecordCount(), ShouldEqual, 3)
+		})
+	})
+}
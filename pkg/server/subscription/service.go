@@ -15,6 +15,7 @@
 package subscription
 
 import (
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -23,66 +24,142 @@ import (
 
 var timeNow = time.Now
 
+// RecordEventFunc is called with a record event and the subscriptions
+// matching the record.
+type RecordEventFunc func(skydb.RecordEvent, []skydb.Subscription)
+
+// DeadLetterSink is the interface implemented by an object that records
+// the notices that cannot be delivered.
+type DeadLetterSink interface {
+	// DeadLetter is called with the notice to the device and the error
+	// of the last attempt to send it.
+	DeadLetter(device skydb.Device, notice Notice, err error)
+}
+
+// DeadLetterFunc is an adapter to use a function as a DeadLetterSink.
+type DeadLetterFunc func(device skydb.Device, notice Notice, err error)
+
+// DeadLetter implements DeadLetterSink.
+func (f DeadLetterFunc) DeadLetter(device skydb.Device, notice Notice, err error) {
+	f(device, notice, err)
+}
+
 // Service is responsible to send push notification to device whenever
 // a record has been modified in db.
 type Service struct {
 	ConnOpener func() (skydb.Conn, error)
 	Notifier   Notifier
-	stop       chan struct{}
+
+	// DeviceRateLimit is the maximum number of notices sent to a device
+	// per second. Notices exceeding the limit are dropped. Notices are
+	// not limited if it is zero.
+	DeviceRateLimit int
+
+	// NotifyAttempts is the number of attempts to send a notice before
+	// it is given to DeadLetterSink. A notice is attempted once if it
+	// is not positive.
+	NotifyAttempts int
+	DeadLetterSink DeadLetterSink
+
+	mu             sync.Mutex
+	stop           chan struct{}
+	stopped        chan struct{}
+	eventCallbacks []RecordEventFunc
+
+	// number of notices sent to each device in rateLimitUnix
+	deviceNoticeCounts map[string]int
+	rateLimitUnix      int64
+}
+
+// OnRecordEvent registers fn to be called for every record event
+// matching at least one subscription, with the matching subscriptions.
+// Unlike Notifier, fn is not called per device, so that the events can
+// be consumed in process. It has to be called before Run.
+func (s *Service) OnRecordEvent(fn RecordEventFunc) {
+	s.eventCallbacks = append(s.eventCallbacks, fn)
 }
 
-// Run listens for Conn record event
+// noticeSeqName is the name of the conn sequence of Notice.SeqNum.
+const noticeSeqName = "subscription_notice"
+
+// seqNumBase is added to the values of the sequence so that they are
+// larger than the sequence numbers derived from time by earlier
+// versions, which are the unix time shifted by 28 bits.
+const seqNumBase = 1 << 62
+
+// Run listens for Conn record event until Stop is called.
 func (s *Service) Run() {
-	// maximum number of events per second
-	const EventCountBits = 28
-	const EventCountMask = 1<<EventCountBits - 1
-
-	var (
-		// number of events processed, reset per second
-		eventCount    uint
-		prevUnix      = timeNow().Unix()
-		recordEventCh = s.subscribe()
-	)
-	s.stop = make(chan struct{})
-	defer func() { s.stop = nil }()
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	s.mu.Lock()
+	s.stop, s.stopped = stop, stopped
+	s.mu.Unlock()
+	defer close(stopped)
+
+	recordEventCh := s.subscribe()
 
 	for {
 		select {
 		case event := <-recordEventCh:
-			switch event.Event {
-			case skydb.RecordCreated, skydb.RecordUpdated, skydb.RecordDeleted:
-				conn, err := s.ConnOpener()
-				if err != nil {
-					log.WithFields(logrus.Fields{
-						"event": event,
-						"err":   err,
-					}).Errorln("subscription: failed to open skydb.Conn")
-					continue
-				}
-
-				currUnix := timeNow().Unix()
-				if currUnix != prevUnix {
-					eventCount = 0
-					prevUnix = currUnix
+			s.handleEvent(event)
+		case <-stop:
+			log.Infoln("subscription: stopping the service")
+			// handle the events already sent before returning
+			for {
+				select {
+				case event := <-recordEventCh:
+					s.handleEvent(event)
+				default:
+					return
 				}
-				seqNum := uint64(currUnix)<<EventCountBits | uint64(eventCount)&EventCountMask
-				eventCount++
-
-				db := getDB(conn, event.Record)
-				s.handleRecordHook(db, event, seqNum)
-			default:
-				log.Panicf("subscription: unrecgonized event: %v", event)
 			}
-		case <-s.stop:
-			log.Infoln("subscription: stopping the service")
-			return
 		}
 	}
 }
 
-// Stop stops the running subscription service
+// Stop stops the running subscription service. It returns after the
+// events received by the service are handled. It does nothing if the
+// service is not running.
 func (s *Service) Stop() {
-	s.stop <- struct{}{}
+	s.mu.Lock()
+	stop, stopped := s.stop, s.stopped
+	s.stop = nil
+	s.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-stopped
+}
+
+func (s *Service) handleEvent(event skydb.RecordEvent) {
+	switch event.Event {
+	case skydb.RecordCreated, skydb.RecordUpdated, skydb.RecordDeleted:
+		conn, err := s.ConnOpener()
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"event": event,
+				"err":   err,
+			}).Errorln("subscription: failed to open skydb.Conn")
+			return
+		}
+
+		// The sequence is persisted so that sequence numbers keep
+		// increasing across restarts and regardless of the clock.
+		seqValue, err := conn.NextSequenceValue(noticeSeqName)
+		if err != nil {
+			log.WithFields(logrus.Fields{
+				"event": event,
+				"err":   err,
+			}).Errorln("subscription: failed to obtain sequence number")
+			return
+		}
+
+		db := getDB(conn, event.Record)
+		s.handleRecordHook(db, event, seqNumBase+uint64(seqValue))
+	default:
+		log.Panicf("subscription: unrecgonized event: %v", event)
+	}
 }
 
 func (s *Service) subscribe() chan skydb.RecordEvent {
@@ -99,20 +176,85 @@ func (s *Service) subscribe() chan skydb.RecordEvent {
 
 func (s *Service) handleRecordHook(db skydb.Database, e skydb.RecordEvent, seqNum uint64) {
 	subscriptions := db.GetMatchingSubscriptions(e.Record)
+
+	// filter without allocation
+	watchingSubs := subscriptions[:0]
+	for _, subscription := range subscriptions {
+		if subscription.WatchesChange(e) {
+			watchingSubs = append(watchingSubs, subscription)
+		}
+	}
+	subscriptions = watchingSubs
+
+	if len(subscriptions) > 0 {
+		for _, fn := range s.eventCallbacks {
+			fn(e, subscriptions)
+		}
+	}
+
+	if s.Notifier == nil {
+		return
+	}
+
 	device := skydb.Device{}
 	for _, subscription := range subscriptions {
 		log.Printf("subscription: got a matching sub id = %s", subscription.ID)
 
+		if !s.allowNotice(subscription.DeviceID) {
+			log.WithFields(logrus.Fields{
+				"subscriptionID": subscription.ID,
+				"deviceID":       subscription.DeviceID,
+				"seqNum":         seqNum,
+			}).Warnln("subscription: dropped notice exceeding device rate limit")
+			continue
+		}
+
 		conn := db.Conn()
 		if err := conn.GetDevice(subscription.DeviceID, &device); err != nil {
 			log.Panicf("subscription: failed to get device with id = %v: %v", subscription.DeviceID, err)
 		}
 
 		notice := Notice{seqNum, subscription.ID, e.Event, e.Record}
-		if err := s.Notifier.Notify(device, notice); err != nil {
-			log.Errorf("subscription: failed to send notice to device id = %s", device.ID)
+		s.notify(device, notice)
+	}
+}
+
+func (s *Service) notify(device skydb.Device, notice Notice) {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.Notifier.Notify(device, notice); err == nil {
+			return
 		}
+		log.Errorf("subscription: failed to send notice to device id = %s", device.ID)
+		if attempt >= s.NotifyAttempts {
+			break
+		}
+	}
+
+	// The notice is not kept if the device no longer exists.
+	if s.DeadLetterSink != nil && err != skydb.ErrDeviceNotFound {
+		s.DeadLetterSink.DeadLetter(device, notice, err)
+	}
+}
+
+// allowNotice returns whether a notice can be sent to the device within
+// DeviceRateLimit, counting the notice if so.
+func (s *Service) allowNotice(deviceID string) bool {
+	if s.DeviceRateLimit <= 0 {
+		return true
+	}
+
+	currUnix := timeNow().Unix()
+	if s.deviceNoticeCounts == nil || currUnix != s.rateLimitUnix {
+		s.deviceNoticeCounts = map[string]int{}
+		s.rateLimitUnix = currUnix
+	}
+
+	if s.deviceNoticeCounts[deviceID] >= s.DeviceRateLimit {
+		return false
 	}
+	s.deviceNoticeCounts[deviceID]++
+	return true
 }
 
 func getDB(conn skydb.Conn, record *skydb.Record) skydb.Database {
@@ -15,6 +15,7 @@
 package subscription
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -34,6 +35,17 @@ func (f notifyFunc) Notify(device skydb.Device, notice Notice) error {
 	return f(device, notice)
 }
 
+// seqConn is a skydb.Conn of which the sequences count from one.
+type seqConn struct {
+	skydb.Conn
+	seq int64
+}
+
+func (c *seqConn) NextSequenceValue(name string) (int64, error) {
+	c.seq++
+	return c.seq, nil
+}
+
 func TestService(t *testing.T) {
 	Convey("Subscription Service", t, func() {
 		ctrl := gomock.NewController(t)
@@ -47,8 +59,9 @@ func TestService(t *testing.T) {
 		conn := mock_skydb.NewMockConn(ctrl)
 		db := mock_skydb.NewMockDatabase(ctrl)
 
+		sc := &seqConn{Conn: conn}
 		service := &Service{
-			ConnOpener: func() (skydb.Conn, error) { return conn, nil },
+			ConnOpener: func() (skydb.Conn, error) { return sc, nil },
 		}
 
 		chch := make(chan chan skydb.RecordEvent, 1)
@@ -106,7 +119,7 @@ func TestService(t *testing.T) {
 
 			So(d, ShouldResemble, device)
 			So(n, ShouldResemble, Notice{
-				SeqNum:         0x43b940e50000000,
+				SeqNum:         seqNumBase + 1,
 				SubscriptionID: "subscriptionid",
 				Event:          skydb.RecordCreated,
 				Record:         &record,
@@ -124,14 +137,14 @@ func TestService(t *testing.T) {
 
 			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
 			<-done
-			So(n.SeqNum, ShouldEqual, 0x43b940e50000000)
+			So(n.SeqNum, ShouldEqual, uint64(seqNumBase+1))
 
 			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
 			<-done
-			So(n.SeqNum, ShouldEqual, 0x43b940e50000001)
+			So(n.SeqNum, ShouldEqual, uint64(seqNumBase+2))
 		})
 
-		Convey("resets sequence number on next second", func() {
+		Convey("increases sequence number regardless of the clock", func() {
 			var n Notice
 			done := make(chan bool)
 			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
@@ -140,14 +153,216 @@ func TestService(t *testing.T) {
 				return nil
 			})
 
+			var prevSeqNum uint64
+			for _, unix := range []int64{0x43b940e6, 0x43b940e5, 0x43b940e5, 0x43b940e4} {
+				unix := unix
+				timeNow = func() time.Time { return time.Unix(unix, 0) }
+				ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
+				<-done
+				So(n.SeqNum, ShouldBeGreaterThan, prevSeqNum)
+				prevSeqNum = n.SeqNum
+			}
+			// larger than the ones derived from time by earlier versions
+			So(prevSeqNum, ShouldBeGreaterThan, uint64(time.Now().Unix())<<28)
+		})
+
+		Convey("stops promptly", func() {
+			stopped := make(chan bool)
+			go func() {
+				service.Stop()
+				stopped <- true
+			}()
+
+			select {
+			case <-stopped:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Service is not stopped after 100 ms")
+			}
+		})
+
+		Convey("stops after handling the event in flight", func() {
+			notifying := make(chan bool)
+			release := make(chan bool)
+			var notified bool
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				notifying <- true
+				<-release
+				notified = true
+				return nil
+			})
+
 			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
-			<-done
-			So(n.SeqNum, ShouldEqual, 0x43b940e50000000)
+			<-notifying
+
+			stopped := make(chan bool)
+			go func() {
+				service.Stop()
+				stopped <- true
+			}()
+
+			select {
+			case <-stopped:
+				t.Fatal("Service is stopped before the event is handled")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			release <- true
+			select {
+			case <-stopped:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Service is not stopped after 100 ms")
+			}
+			So(notified, ShouldBeTrue)
+		})
+
+		Convey("sends undeliverable notice to dead-letter sink", func() {
+			service.NotifyAttempts = 3
+
+			var attempts int
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				attempts++
+				return errors.New("unreachable")
+			})
+
+			var (
+				d   skydb.Device
+				n   Notice
+				err error
+			)
+			done := make(chan bool)
+			service.DeadLetterSink = DeadLetterFunc(func(device skydb.Device, notice Notice, lastErr error) {
+				d = device
+				n = notice
+				err = lastErr
+				done <- true
+			})
 
-			timeNow = func() time.Time { return time.Unix(0x43b940e6, 0) }
 			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
-			<-done
-			So(n.SeqNum, ShouldEqual, 0x43b940e60000000)
+
+			select {
+			case <-done:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Receive no dead letters after 100 ms")
+			}
+
+			So(attempts, ShouldEqual, 3)
+			So(d, ShouldResemble, device)
+			So(n.SubscriptionID, ShouldEqual, "subscriptionid")
+			So(n.Record, ShouldEqual, &record)
+			So(err, ShouldResemble, errors.New("unreachable"))
+		})
+
+		Convey("does not dead-letter notice to removed device", func() {
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				return skydb.ErrDeviceNotFound
+			})
+
+			var deadLetters int
+			service.DeadLetterSink = DeadLetterFunc(func(device skydb.Device, notice Notice, lastErr error) {
+				deadLetters++
+			})
+
+			// the second send returns only after the first event is
+			// handled, as the channel is unbuffered
+			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
+			ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
+
+			So(deadLetters, ShouldEqual, 0)
+		})
+
+		Convey("drops notices exceeding device rate limit", func() {
+			service.DeviceRateLimit = 2
+
+			var notified int
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				notified++
+				return nil
+			})
+
+			// the send of an event returns only after the previous
+			// event is handled, as the channel is unbuffered
+			for i := 0; i < 6; i++ {
+				ch <- skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
+			}
+
+			So(notified, ShouldEqual, 2)
+		})
+
+		Convey("notifies only updates of watched fields", func() {
+			watching := skydb.Subscription{
+				ID:          "watchingid",
+				DeviceID:    "deviceid",
+				WatchFields: []string{"title"},
+			}
+			db.EXPECT().GetMatchingSubscriptions(gomock.Any()).Return([]skydb.Subscription{
+				watching,
+			}).AnyTimes()
+
+			var n Notice
+			done := make(chan bool)
+			service.Notifier = notifyFunc(func(device skydb.Device, notice Notice) error {
+				n = notice
+				done <- true
+				return nil
+			})
+
+			original := skydb.Record{
+				ID:   skydb.NewRecordID("note", "0"),
+				Data: skydb.Data{"title": "Hello", "content": "world"},
+			}
+			unwatchedUpdate := skydb.Record{
+				ID:   skydb.NewRecordID("note", "0"),
+				Data: skydb.Data{"title": "Hello", "content": "there"},
+			}
+			watchedUpdate := skydb.Record{
+				ID:   skydb.NewRecordID("note", "0"),
+				Data: skydb.Data{"title": "Hi", "content": "there"},
+			}
+
+			ch <- skydb.RecordEvent{
+				Record:   &unwatchedUpdate,
+				Original: &original,
+				Event:    skydb.RecordUpdated,
+			}
+			ch <- skydb.RecordEvent{
+				Record:   &watchedUpdate,
+				Original: &unwatchedUpdate,
+				Event:    skydb.RecordUpdated,
+			}
+
+			select {
+			case <-done:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Receive no notices after 100 ms")
+			}
+
+			So(n.SubscriptionID, ShouldEqual, "watchingid")
+			So(n.Record, ShouldEqual, &watchedUpdate)
+		})
+
+		Convey("calls record event callback", func() {
+			var (
+				e    skydb.RecordEvent
+				subs []skydb.Subscription
+			)
+			done := make(chan bool)
+			service.OnRecordEvent(func(event skydb.RecordEvent, subscriptions []skydb.Subscription) {
+				e = event
+				subs = subscriptions
+				done <- true
+			})
+
+			event := skydb.RecordEvent{Record: &record, Event: skydb.RecordCreated}
+			ch <- event
+
+			select {
+			case <-done:
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("Receive no record events after 100 ms")
+			}
+
+			So(e, ShouldResemble, event)
+			So(subs, ShouldResemble, []skydb.Subscription{subscription})
 		})
 	})
 }
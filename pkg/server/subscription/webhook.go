@@ -0,0 +1,102 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	"github.com/skygeario/skygear-server/pkg/server/skydb/skyconv"
+)
+
+// WebhookSignatureHeader is the header of a webhook request holding the
+// hex encoded HMAC-SHA256 of the request body keyed by the secret.
+const WebhookSignatureHeader = "X-Skygear-Signature"
+
+var webhookEventNames = map[skydb.RecordHookEvent]string{
+	skydb.RecordCreated: "create",
+	skydb.RecordUpdated: "update",
+	skydb.RecordDeleted: "delete",
+}
+
+type webhookNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// NewWebhookNotifier returns a Notifier which POSTs Notice in JSON to
+// the url. The request is signed with the secret in the
+// WebhookSignatureHeader. The request is sent once; failed notices are
+// retried by Service according to Service.NotifyAttempts.
+func NewWebhookNotifier(url string, secret string) Notifier {
+	return &webhookNotifier{
+		url:    url,
+		secret: secret,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (n *webhookNotifier) CanNotify(device skydb.Device) bool {
+	return true
+}
+
+func (n *webhookNotifier) Notify(device skydb.Device, notice Notice) error {
+	body, err := json.Marshal(struct {
+		SeqNum         uint64              `json:"seq-num"`
+		SubscriptionID string              `json:"subscription-id"`
+		DeviceID       string              `json:"device-id"`
+		Event          string              `json:"event"`
+		Record         *skyconv.JSONRecord `json:"record"`
+	}{
+		notice.SeqNum,
+		notice.SubscriptionID,
+		device.ID,
+		webhookEventNames[notice.Event],
+		(*skyconv.JSONRecord)(notice.Record),
+	})
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(n.secret))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	req, err := http.NewRequest("POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signature)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
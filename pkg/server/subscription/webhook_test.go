@@ -0,0 +1,100 @@
+// Copyright 2015-present Oursky Ltd.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/skygeario/skygear-server/pkg/server/skydb"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	Convey("Webhook Notifier", t, func() {
+		var (
+			requests  int
+			body      []byte
+			signature string
+		)
+		statuses := []int{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			body, _ = ioutil.ReadAll(r.Body)
+			signature = r.Header.Get(WebhookSignatureHeader)
+			if len(statuses) > 0 {
+				w.WriteHeader(statuses[0])
+				statuses = statuses[1:]
+			}
+		}))
+		defer server.Close()
+
+		notifier := NewWebhookNotifier(server.URL, "secret")
+		device := skydb.Device{ID: "deviceid"}
+		notice := Notice{
+			SeqNum:         1,
+			SubscriptionID: "subscriptionid",
+			Event:          skydb.RecordCreated,
+			Record: &skydb.Record{
+				ID:      skydb.NewRecordID("note", "0"),
+				OwnerID: "ownerid",
+				Data:    skydb.Data{"content": "hello"},
+			},
+		}
+
+		Convey("posts notice with record", func() {
+			So(notifier.Notify(device, notice), ShouldBeNil)
+			So(requests, ShouldEqual, 1)
+
+			payload := map[string]interface{}{}
+			So(json.Unmarshal(body, &payload), ShouldBeNil)
+			So(payload["seq-num"], ShouldEqual, 1)
+			So(payload["subscription-id"], ShouldEqual, "subscriptionid")
+			So(payload["device-id"], ShouldEqual, "deviceid")
+			So(payload["event"], ShouldEqual, "create")
+
+			record := payload["record"].(map[string]interface{})
+			So(record["_id"], ShouldEqual, "note/0")
+			So(record["_ownerID"], ShouldEqual, "ownerid")
+			So(record["content"], ShouldEqual, "hello")
+		})
+
+		Convey("signs the body", func() {
+			So(notifier.Notify(device, notice), ShouldBeNil)
+
+			mac := hmac.New(sha256.New, []byte("secret"))
+			mac.Write(body)
+			So(signature, ShouldEqual, hex.EncodeToString(mac.Sum(nil)))
+		})
+
+		Convey("does not retry on server error", func() {
+			statuses = []int{http.StatusBadGateway}
+			So(notifier.Notify(device, notice), ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("does not retry on client error", func() {
+			statuses = []int{http.StatusBadRequest}
+			So(notifier.Notify(device, notice), ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+	})
+}